@@ -0,0 +1,90 @@
+package email
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+)
+
+// wordDecoder decodes RFC 2047 encoded-words in any charset known to the
+// WHATWG encoding standard, not only UTF-8 and ISO-8859-1.
+var wordDecoder = &mime.WordDecoder{
+	CharsetReader: func(label string, input io.Reader) (io.Reader, error) {
+		encoding, _ := charset.Lookup(label)
+		if encoding == nil {
+			return nil, fmt.Errorf("unsupported charset %q", label)
+		}
+		return encoding.NewDecoder().Reader(input), nil
+	},
+}
+
+// DecodeHeader decodes the RFC 2047 encoded-words of a header value. Values
+// that cannot be decoded are returned unchanged.
+func DecodeHeader(value string) string {
+	if !strings.Contains(value, "=?") {
+		return value
+	}
+
+	decoded, err := wordDecoder.DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
+
+// DecodeCharset converts text in the named charset to UTF-8. Without a
+// charset, HTML is sniffed for a <meta> declaration and other text is taken
+// as UTF-8 when valid and as Windows-1252 otherwise, which is what mail
+// clients do for unlabelled 8-bit mail.
+func DecodeCharset(data []byte, label, mediaType string) string {
+	label = strings.TrimSpace(label)
+
+	if label == "" && mediaType == "text/html" {
+		_, label, _ = charset.DetermineEncoding(data, "text/html")
+	}
+
+	if label == "" || strings.EqualFold(label, "us-ascii") {
+		if utf8.Valid(data) {
+			return string(data)
+		}
+		label = "windows-1252"
+	}
+
+	encoding, name := charset.Lookup(label)
+	if encoding == nil || name == "utf-8" {
+		return strings.ToValidUTF8(string(data), "�")
+	}
+
+	decoded, err := encoding.NewDecoder().Bytes(data)
+	if err != nil {
+		return strings.ToValidUTF8(string(data), "�")
+	}
+	return string(decoded)
+}
+
+// DecodeBase64 decodes standard or URL-safe base64, with or without
+// padding. Characters outside the alphabet, such as line breaks, are
+// ignored as RFC 2045 requires, and so is a dangling final character.
+func DecodeBase64(s string) ([]byte, error) {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case 'A' <= r && r <= 'Z', 'a' <= r && r <= 'z', '0' <= r && r <= '9', r == '-', r == '_':
+			return r
+		case r == '+':
+			return '-'
+		case r == '/':
+			return '_'
+		}
+		return -1
+	}, s)
+	if len(s)%4 == 1 {
+		s = s[:len(s)-1]
+	}
+
+	return base64.RawURLEncoding.DecodeString(s)
+}
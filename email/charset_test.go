@@ -0,0 +1,181 @@
+package email
+
+import (
+	"bytes"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestDecodeFixtures parses the messages in testdata/mime, which carry the
+// charsets, transfer encodings and MIME structures that mail from old,
+// broken or elaborate clients uses, and checks the text that comes out.
+func TestDecodeFixtures(t *testing.T) {
+	allBytes := make([]byte, 256)
+	for i := range allBytes {
+		allBytes[i] = byte(i)
+	}
+
+	tests := []struct {
+		file        string
+		subject     string
+		text        string
+		html        string
+		attachments map[string][]byte
+	}{
+		{
+			file:    "iso-2022-jp.eml",
+			subject: "会議の件",
+			text:    "こんにちは。\n明日の会議は10時からです。\n",
+		},
+		{
+			file:    "windows-1252.eml",
+			subject: "“Deals” – €20 off",
+			text:    "“Smart quotes” cost €20 – naïve café.\n",
+		},
+		{
+			// Unlabelled 8-bit text that is not UTF-8 is read as
+			// Windows-1252.
+			file:    "unlabelled-8bit.eml",
+			subject: "Old mailer",
+			text:    "Crème brûlée à la carte\n",
+		},
+		{
+			// UTF-8 labelled us-ascii is kept as UTF-8.
+			file:    "mislabelled-us-ascii.eml",
+			subject: "Mislabelled",
+			text:    "naïve ☕ coffee\n",
+		},
+		{
+			// An unknown charset falls back to UTF-8, in the body and in
+			// encoded-words, which are left as they are.
+			file:    "unknown-charset.eml",
+			subject: "=?x-klingon?Q?Qapla=27?=",
+			text:    "Plain UTF-8 — despite the label\n",
+		},
+		{
+			file:    "invalid-utf-8.eml",
+			subject: "Broken",
+			text:    "ok � then ok\n",
+		},
+		{
+			// HTML without a charset parameter is sniffed for <meta>.
+			file:    "html-meta-charset.eml",
+			subject: "Meta",
+			html:    `<html><head><meta http-equiv="Content-Type" content="text/html; charset=iso-8859-1"></head><body><p>Señor Muñoz</p></body></html>` + "\n",
+		},
+		{
+			// Unpadded URL-safe base64, a base64 attachment with
+			// characters outside the alphabet and an unpadded part after
+			// it, which must not be lost.
+			file:    "base64-malformed.eml",
+			subject: "Base64",
+			text:    "Unpadded, URL-safe base64 body: ü?>\n",
+			attachments: map[string][]byte{
+				"bytes.bin": allBytes,
+				"after.txt": []byte("After the broken part."),
+			},
+		},
+		{
+			// Lowercase hex is decoded, invalid escapes and a trailing
+			// soft line break are kept or dropped rather than failing the
+			// part.
+			file:    "quoted-printable-malformed.eml",
+			subject: "QP",
+			text:    "Café with lowercase hex, a stray =ZZ and a lone = sign.\nSoft line break joined.\nTrailing soft break",
+		},
+		{
+			// The plain text alternative and the root of the related HTML
+			// alternative are the body; the inline image and the file are
+			// attachments.
+			file:    "nested-alternative-related.eml",
+			subject: "Nested",
+			text:    "Plain version with the logo.",
+			html:    `<p>HTML version with the <img src="cid:logo@example.com" alt="logo">.</p>`,
+			attachments: map[string][]byte{
+				"logo.png":   []byte("\x89PNG\r\n\x1a\n"),
+				"report.pdf": []byte("%PDF-1.4\n"),
+			},
+		},
+		{
+			// A forwarded message is walked as part of the body, and body
+			// parts of multipart/mixed are joined.
+			file:    "forwarded-message.eml",
+			subject: "Fwd: Budget",
+			text:    "See the message below.\n\nThe budget is final.\n\nSent from my phone",
+			html:    "<p>The budget is <b>final</b>.</p>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", "mime", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			part, err := Parse(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			header, err := mail.ReadMessage(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if subject := DecodeHeader(header.Header.Get("Subject")); subject != tt.subject {
+				t.Errorf("subject = %q, want %q", subject, tt.subject)
+			}
+
+			content := part.Content()
+			if text := strings.ReplaceAll(content.Text, "\r\n", "\n"); text != tt.text {
+				t.Errorf("text = %q, want %q", text, tt.text)
+			}
+			if html := strings.ReplaceAll(content.HTML, "\r\n", "\n"); html != tt.html {
+				t.Errorf("html = %q, want %q", html, tt.html)
+			}
+
+			if len(content.Attachments) != len(tt.attachments) {
+				t.Fatalf("%d attachments, want %d", len(content.Attachments), len(tt.attachments))
+			}
+			for _, attachment := range content.Attachments {
+				want, ok := tt.attachments[attachment.Filename]
+				if !ok {
+					t.Errorf("unexpected attachment %q", attachment.Filename)
+					continue
+				}
+				if !bytes.Equal(attachment.Body, want) {
+					t.Errorf("attachment %q = %q, want %q", attachment.Filename, attachment.Body, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeBase64(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"SGVsbG8gd29ybGQh", "Hello world!"},
+		{"SGVsbG8gd29ybA==", "Hello worl"},
+		{"SGVsbG8gd29ybA", "Hello worl"},
+		{"SGVsbG8g\r\nd29ybA==\r\n", "Hello worl"},
+		{"-_8", "\xfb\xff"},
+		{"+/8=", "\xfb\xff"},
+		{"SGVs*bG8g d29y!bGQh", "Hello world!"},
+		{"SGVsbG8gd29ybGQhI", "Hello world!"},
+	}
+
+	for _, tt := range tests {
+		got, err := DecodeBase64(tt.in)
+		if err != nil {
+			t.Errorf("DecodeBase64(%q): %v", tt.in, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("DecodeBase64(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
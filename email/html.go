@@ -0,0 +1,72 @@
+package email
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// HTMLToText returns the visible text of an HTML fragment, with line breaks
+// for <br> and block elements. It is meant for short fragments such as
+// signatures; use it to derive a plain-text alternative from an HTML body.
+func HTMLToText(fragment string) string {
+	var b strings.Builder
+
+	tokenizer := html.NewTokenizer(strings.NewReader(fragment))
+	skip := 0
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			text := blankLines.ReplaceAllString(b.String(), "\n\n")
+			return strings.TrimSpace(text)
+		case html.TextToken:
+			if skip == 0 {
+				b.WriteString(collapseSpace(string(tokenizer.Text())))
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, _ := tokenizer.TagName()
+			switch string(name) {
+			case "script", "style", "head":
+				skip++
+			case "br":
+				b.WriteString("\n")
+			case "p", "div", "tr", "li", "h1", "h2", "h3", "h4", "h5", "h6":
+				b.WriteString("\n")
+			}
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			switch string(name) {
+			case "script", "style", "head":
+				if skip > 0 {
+					skip--
+				}
+			case "p", "div", "tr", "li", "h1", "h2", "h3", "h4", "h5", "h6":
+				b.WriteString("\n")
+			}
+		}
+	}
+}
+
+// collapseSpace replaces runs of whitespace with a single space, as HTML
+// rendering does.
+func collapseSpace(s string) string {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		if s != "" {
+			return " "
+		}
+		return ""
+	}
+
+	out := strings.Join(fields, " ")
+	if strings.TrimLeft(s, " \t\r\n") != s {
+		out = " " + out
+	}
+	if strings.TrimRight(s, " \t\r\n") != s {
+		out += " "
+	}
+	return out
+}
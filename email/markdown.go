@@ -0,0 +1,291 @@
+package email
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// HTMLToMarkdown converts an HTML document or fragment to Markdown. Scripts,
+// styles and other invisible elements are dropped; links, emphasis, headings,
+// lists, quotes and preformatted text are kept.
+func HTMLToMarkdown(document string) string {
+	root, err := html.Parse(strings.NewReader(document))
+	if err != nil {
+		return HTMLToText(document)
+	}
+
+	w := &markdownWriter{}
+	w.children(root)
+
+	out := blankLines.ReplaceAllString(w.String(), "\n\n")
+	return strings.TrimSpace(out)
+}
+
+type markdownWriter struct {
+	buf   bytes.Buffer
+	pre   int
+	lists []*markdownList
+}
+
+type markdownList struct {
+	ordered bool
+	n       int
+}
+
+func (w *markdownWriter) String() string {
+	return w.buf.String()
+}
+
+// sub returns a writer for content that is post-processed before being
+// written, such as link text or quotes.
+func (w *markdownWriter) sub() *markdownWriter {
+	return &markdownWriter{pre: w.pre}
+}
+
+func (w *markdownWriter) write(s string) {
+	w.buf.WriteString(s)
+}
+
+// text writes a text node, collapsing whitespace outside <pre>.
+func (w *markdownWriter) text(s string) {
+	if w.pre > 0 {
+		w.write(s)
+		return
+	}
+
+	s = collapseSpace(s)
+	if strings.HasPrefix(s, " ") && w.atSpace() {
+		s = s[1:]
+	}
+	w.write(s)
+}
+
+func (w *markdownWriter) atSpace() bool {
+	b := w.buf.Bytes()
+	return len(b) == 0 || b[len(b)-1] == '\n' || b[len(b)-1] == ' '
+}
+
+func (w *markdownWriter) trimTrailingSpace() {
+	w.buf.Truncate(len(bytes.TrimRight(w.buf.Bytes(), " \t")))
+}
+
+// newline ends the current line, if any.
+func (w *markdownWriter) newline() {
+	w.trimTrailingSpace()
+	if b := w.buf.Bytes(); len(b) > 0 && b[len(b)-1] != '\n' {
+		w.write("\n")
+	}
+}
+
+// block separates block elements with a blank line.
+func (w *markdownWriter) block() {
+	w.newline()
+	if b := w.buf.Bytes(); len(b) > 0 && !bytes.HasSuffix(b, []byte("\n\n")) {
+		w.write("\n")
+	}
+}
+
+func (w *markdownWriter) children(n *html.Node) {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		w.node(child)
+	}
+}
+
+func (w *markdownWriter) node(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.text(n.Data)
+		return
+	case html.DocumentNode:
+		w.children(n)
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Script, atom.Style, atom.Head, atom.Title, atom.Noscript, atom.Template,
+		atom.Svg, atom.Iframe, atom.Object, atom.Button, atom.Select:
+		return
+
+	case atom.Br:
+		w.trimTrailingSpace()
+		w.write("\n")
+
+	case atom.Hr:
+		w.block()
+		w.write("---")
+		w.block()
+
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		level := int(n.Data[1] - '0')
+		if heading := w.inline(n); heading != "" {
+			w.block()
+			w.write(strings.Repeat("#", level) + " " + heading)
+			w.block()
+		}
+
+	case atom.P:
+		w.block()
+		w.children(n)
+		w.block()
+
+	case atom.Div, atom.Section, atom.Article, atom.Header, atom.Footer, atom.Main,
+		atom.Center, atom.Table, atom.Tbody, atom.Thead, atom.Tfoot, atom.Tr, atom.Form,
+		atom.Dl, atom.Dt, atom.Dd, atom.Figure, atom.Figcaption, atom.Address:
+		w.newline()
+		w.children(n)
+		w.newline()
+
+	case atom.Td, atom.Th:
+		if !w.atSpace() {
+			w.write(" ")
+		}
+		w.children(n)
+
+	case atom.A:
+		w.link(n)
+
+	case atom.Img:
+		alt := strings.TrimSpace(attribute(n, "alt"))
+		src := attribute(n, "src")
+		if alt != "" && src != "" && !strings.HasPrefix(src, "cid:") {
+			w.write(fmt.Sprintf("![%s](%s)", alt, src))
+		} else if alt != "" {
+			w.text(alt)
+		}
+
+	case atom.B, atom.Strong:
+		w.wrap(n, "**")
+
+	case atom.I, atom.Em:
+		w.wrap(n, "_")
+
+	case atom.S, atom.Strike, atom.Del:
+		w.wrap(n, "~~")
+
+	case atom.Code:
+		if w.pre > 0 {
+			w.children(n)
+		} else {
+			w.wrap(n, "`")
+		}
+
+	case atom.Pre:
+		w.block()
+		w.write("```\n")
+		w.pre++
+		w.children(n)
+		w.pre--
+		w.newline()
+		w.write("```")
+		w.block()
+
+	case atom.Blockquote:
+		sub := w.sub()
+		sub.children(n)
+		quoted := strings.TrimSpace(blankLines.ReplaceAllString(sub.String(), "\n\n"))
+		if quoted == "" {
+			return
+		}
+		w.block()
+		for i, line := range strings.Split(quoted, "\n") {
+			if i > 0 {
+				w.write("\n")
+			}
+			w.write(strings.TrimRight("> "+line, " "))
+		}
+		w.block()
+
+	case atom.Ul, atom.Ol:
+		if len(w.lists) == 0 {
+			w.block()
+		} else {
+			w.newline()
+		}
+		w.lists = append(w.lists, &markdownList{ordered: n.DataAtom == atom.Ol})
+		w.children(n)
+		w.lists = w.lists[:len(w.lists)-1]
+		if len(w.lists) == 0 {
+			w.block()
+		} else {
+			w.newline()
+		}
+
+	case atom.Li:
+		w.newline()
+		marker := "- "
+		indent := ""
+		if len(w.lists) > 0 {
+			list := w.lists[len(w.lists)-1]
+			list.n++
+			if list.ordered {
+				marker = fmt.Sprintf("%d. ", list.n)
+			}
+			indent = strings.Repeat("  ", len(w.lists)-1)
+		}
+		w.write(indent + marker)
+		w.children(n)
+		w.newline()
+
+	default:
+		w.children(n)
+	}
+}
+
+// inline renders the children of n on a single line.
+func (w *markdownWriter) inline(n *html.Node) string {
+	sub := w.sub()
+	sub.children(n)
+	return strings.Join(strings.Fields(sub.String()), " ")
+}
+
+// wrap writes the children of n between marker, e.g. **bold**.
+func (w *markdownWriter) wrap(n *html.Node, marker string) {
+	content := w.inline(n)
+	if content == "" {
+		return
+	}
+	if !w.atSpace() && hasLeadingSpace(n) {
+		w.write(" ")
+	}
+	w.write(marker + content + marker)
+}
+
+func (w *markdownWriter) link(n *html.Node) {
+	text := w.inline(n)
+	href := strings.TrimSpace(attribute(n, "href"))
+
+	switch {
+	case text == "":
+		return
+	case href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(strings.ToLower(href), "javascript:"):
+		w.text(text)
+	case text == href || "mailto:"+text == href:
+		w.write("<" + href + ">")
+	default:
+		if !w.atSpace() && hasLeadingSpace(n) {
+			w.write(" ")
+		}
+		w.write("[" + text + "](" + href + ")")
+	}
+}
+
+func hasLeadingSpace(n *html.Node) bool {
+	first := n.FirstChild
+	return first != nil && first.Type == html.TextNode && strings.TrimLeft(first.Data, " \t\r\n") != first.Data
+}
+
+func attribute(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
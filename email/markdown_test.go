@@ -0,0 +1,125 @@
+package email
+
+import "testing"
+
+func TestHTMLToMarkdown(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{
+			name: "paragraphs and emphasis",
+			html: "<p>Hello <b>Jane</b>,</p><p>The report is <i>nearly</i> done and <s>late</s>.</p>",
+			want: "Hello **Jane**,\n\nThe report is _nearly_ done and ~~late~~.",
+		},
+		{
+			name: "whitespace is collapsed",
+			html: "<div>\n  Line   one\n  <br>\n  Line two\n</div>",
+			want: "Line one\nLine two",
+		},
+		{
+			name: "links",
+			html: `<p>See <a href="https://example.com/report">the report</a>, <a href="https://example.com">https://example.com</a>, <a href="mailto:jane@example.com">jane@example.com</a>, <a href="#top">top</a> and <a href="javascript:void(0)">nothing</a>.</p>`,
+			want: "See [the report](https://example.com/report), <https://example.com>, <mailto:jane@example.com>, top and nothing.",
+		},
+		{
+			name: "link without text",
+			html: `<p>Tracker<a href="https://example.com/t"></a> gone</p>`,
+			want: "Tracker gone",
+		},
+		{
+			name: "images",
+			html: `<p><img src="https://example.com/logo.png" alt="Logo"> <img src="cid:sig" alt="Signature"> <img src="https://example.com/pixel.gif"></p>`,
+			want: "![Logo](https://example.com/logo.png) Signature",
+		},
+		{
+			name: "headings",
+			html: "<h1>Title</h1><h3>  Section\n  three </h3><p>Text</p>",
+			want: "# Title\n\n### Section three\n\nText",
+		},
+		{
+			name: "unordered list",
+			html: "<p>Agenda:</p><ul><li>Budget</li><li>Hiring</li></ul><p>Thanks</p>",
+			want: "Agenda:\n\n- Budget\n- Hiring\n\nThanks",
+		},
+		{
+			name: "nested and ordered lists",
+			html: "<ol><li>First<ul><li>detail</li><li>more</li></ul></li><li>Second</li></ol>",
+			want: "1. First\n  - detail\n  - more\n2. Second",
+		},
+		{
+			name: "table",
+			html: "<table><tr><th>Item</th><th>Price</th></tr><tr><td>Coffee</td><td>€3</td></tr></table>",
+			want: "Item Price\nCoffee €3",
+		},
+		{
+			name: "blockquote",
+			html: "<p>Yes.</p><blockquote><p>Can you come?</p><p>At <b>10</b>?</p></blockquote>",
+			want: "Yes.\n\n> Can you come?\n>\n> At **10**?",
+		},
+		{
+			name: "nested blockquote",
+			html: "<blockquote>Sure<blockquote>Lunch?</blockquote></blockquote>",
+			want: "> Sure\n>\n> > Lunch?",
+		},
+		{
+			name: "preformatted",
+			html: "<p>Run:</p><pre><code>go test ./...\n  ok</code></pre>",
+			want: "Run:\n\n```\ngo test ./...\n  ok\n```",
+		},
+		{
+			name: "inline code",
+			html: "<p>Set <code>STATE_DIR</code> first.</p>",
+			want: "Set `STATE_DIR` first.",
+		},
+		{
+			name: "invisible elements",
+			html: "<html><head><title>Newsletter</title><style>p{color:red}</style></head><body><script>alert(1)</script><p>Visible</p></body></html>",
+			want: "Visible",
+		},
+		{
+			name: "horizontal rule",
+			html: "<p>Above</p><hr><p>Below</p>",
+			want: "Above\n\n---\n\nBelow",
+		},
+		{
+			name: "entities",
+			html: "<p>Fish &amp; chips &lt;3&nbsp;today</p>",
+			want: "Fish & chips <3 today",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HTMLToMarkdown(tt.html); got != tt.want {
+				t.Errorf("HTMLToMarkdown(%q) =\n%q\nwant\n%q", tt.html, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContentBody(t *testing.T) {
+	both := &Content{Text: "Plain", HTML: "<p><b>Rich</b></p>"}
+	htmlOnly := &Content{HTML: "<p><b>Rich</b></p>"}
+	textOnly := &Content{Text: "Plain"}
+
+	tests := []struct {
+		content *Content
+		format  string
+		want    string
+	}{
+		{both, "text", "Plain"},
+		{both, "markdown", "**Rich**"},
+		{both, "html", "<p><b>Rich</b></p>"},
+		{htmlOnly, "text", "**Rich**"},
+		{htmlOnly, "markdown", "**Rich**"},
+		{textOnly, "markdown", "Plain"},
+		{textOnly, "html", "Plain"},
+	}
+	for _, tt := range tests {
+		if got := tt.content.Body(tt.format); got != tt.want {
+			t.Errorf("Body(%q) of %+v = %q, want %q", tt.format, tt.content, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"time"
+)
+
+// mboxDate is the date format of mbox "From " lines, as in asctime(3).
+const mboxDate = "Mon Jan _2 15:04:05 2006"
+
+// MboxWriter writes messages in the mboxrd format: every message starts
+// with a "From " line and ends with a blank line, lines of the message that
+// start with any number of '>' followed by "From " get one more '>', and
+// line endings are LF.
+type MboxWriter struct {
+	w io.Writer
+}
+
+// NewMboxWriter returns a writer appending messages to w.
+func NewMboxWriter(w io.Writer) *MboxWriter {
+	return &MboxWriter{w: w}
+}
+
+// WriteMessage writes one message and returns the number of bytes written.
+// sender, an address without display name, and date fill the "From " line;
+// an empty sender is written as MAILER-DAEMON.
+func (m *MboxWriter) WriteMessage(sender string, date time.Time, message []byte) (int64, error) {
+	if sender == "" || bytes.ContainsAny([]byte(sender), " \t\r\n") {
+		sender = "MAILER-DAEMON"
+	}
+
+	var b bytes.Buffer
+	b.Grow(len(message) + 128)
+	b.WriteString("From " + sender + " " + date.UTC().Format(mboxDate) + "\n")
+
+	for len(message) > 0 {
+		line := message
+		if i := bytes.IndexByte(message, '\n'); i >= 0 {
+			line, message = message[:i], message[i+1:]
+		} else {
+			message = nil
+		}
+		line = bytes.TrimSuffix(line, []byte("\r"))
+
+		if isFromLine(line) {
+			b.WriteByte('>')
+		}
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+	b.WriteByte('\n')
+
+	n, err := m.w.Write(b.Bytes())
+	return int64(n), err
+}
+
+// isFromLine reports whether line is "From " preceded by any number of
+// '>', which mboxrd quotes.
+func isFromLine(line []byte) bool {
+	return bytes.HasPrefix(bytes.TrimLeft(line, ">"), []byte("From "))
+}
+
+// MboxReader reads the messages of an mbox file. Lines starting with "From "
+// after a blank line separate messages, and one '>' is removed from quoted
+// "From " lines, as in mboxrd. Files in the older mboxo format read the same
+// way, except that lines their writer quoted keep one '>'.
+type MboxReader struct {
+	r *bufio.Reader
+	// offset is the number of bytes read.
+	offset int64
+	// next is the offset of the "From " line of the next message, which
+	// has already been read, or -1 when it has not.
+	next int64
+}
+
+// NewMboxReader returns a reader of the messages in r, which must be at the
+// start of the file or of a "From " line.
+func NewMboxReader(r io.Reader) *MboxReader {
+	return &MboxReader{r: bufio.NewReaderSize(r, 64<<10), next: -1}
+}
+
+// Next returns the next message, with LF line endings, and the offset of its
+// "From " line relative to where reading started. It returns io.EOF after
+// the last message.
+func (m *MboxReader) Next() ([]byte, int64, error) {
+	start := m.next
+	for start < 0 {
+		before := m.offset
+		line, err := m.readLine()
+		if len(line) == 0 && err != nil {
+			return nil, 0, err
+		}
+		// Anything before the first "From " line is not a message.
+		if bytes.HasPrefix(line, []byte("From ")) {
+			start = before
+		}
+	}
+	m.next = -1
+
+	var message bytes.Buffer
+	for {
+		before := m.offset
+		line, err := m.readLine()
+		// Unquoted "From " lines in the body of mboxo files are only
+		// taken as separators after a blank line.
+		if bytes.HasPrefix(line, []byte("From ")) && (message.Len() == 0 || bytes.HasSuffix(message.Bytes(), []byte("\n\n"))) {
+			m.next = before
+			break
+		}
+		if len(line) > 0 && line[0] == '>' && isFromLine(line) {
+			line = line[1:]
+		}
+		message.Write(line)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	// The blank line before the next "From " line belongs to the mbox.
+	data := message.Bytes()
+	if bytes.HasSuffix(data, []byte("\n\n")) {
+		data = data[:len(data)-1]
+	}
+	return data, start, nil
+}
+
+// Offset returns the offset at which the message after the last one
+// returned by Next starts, relative to where reading started. Reading can
+// be resumed there with a new MboxReader.
+func (m *MboxReader) Offset() int64 {
+	if m.next >= 0 {
+		return m.next
+	}
+	return m.offset
+}
+
+// readLine returns the next line with an LF ending, except possibly the
+// last line of the file.
+func (m *MboxReader) readLine() ([]byte, error) {
+	line, err := m.r.ReadBytes('\n')
+	m.offset += int64(len(line))
+	if bytes.HasSuffix(line, []byte("\r\n")) {
+		line = append(line[:len(line)-2], '\n')
+	}
+	return line, err
+}
@@ -0,0 +1,70 @@
+package email
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestMboxRoundTrip(t *testing.T) {
+	messages := []string{
+		"Subject: plain\n\nNothing special.\n",
+		"Subject: quoted\n\nFrom the start of a paragraph.\n\n>From already quoted\n>>From twice\n",
+		"Subject: unquoted\n\nA line\nFrom right after another line\nand more\n",
+		"Subject: first line\n\nFrom here on\n",
+		"Subject: trailing blank\n\nEnds with a blank line.\n\n",
+		"Subject: crlf\r\n\r\nWindows line endings\r\nFrom a Windows client\r\n",
+	}
+
+	var mbox bytes.Buffer
+	w := NewMboxWriter(&mbox)
+	date := time.Date(2024, 3, 9, 7, 30, 0, 0, time.UTC)
+	offsets := make([]int64, len(messages))
+	for i, message := range messages {
+		offsets[i] = int64(mbox.Len())
+		if _, err := w.WriteMessage("jane@example.com", date, []byte(message)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := NewMboxReader(bytes.NewReader(mbox.Bytes()))
+	for i, message := range messages {
+		got, offset, err := r.Next()
+		if err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+		want := string(bytes.ReplaceAll([]byte(message), []byte("\r\n"), []byte("\n")))
+		if string(got) != want {
+			t.Errorf("message %d = %q, want %q", i, got, want)
+		}
+		if offset != offsets[i] {
+			t.Errorf("message %d at offset %d, want %d", i, offset, offsets[i])
+		}
+	}
+	if _, _, err := r.Next(); err != io.EOF {
+		t.Errorf("after the last message: %v, want io.EOF", err)
+	}
+}
+
+func TestMboxReaderUnquotedFromLine(t *testing.T) {
+	// An mboxo file whose writer did not quote a "From " line in the
+	// middle of a paragraph: the line is kept whole.
+	mbox := "From jane@example.com Sat Mar  9 07:30:00 2024\nSubject: a\n\nline\nFrom the body\n\nFrom bob@example.com Sat Mar  9 07:31:00 2024\nSubject: b\n\nbody\n"
+
+	r := NewMboxReader(bytes.NewReader([]byte(mbox)))
+	first, _, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Subject: a\n\nline\nFrom the body\n"; string(first) != want {
+		t.Errorf("first message = %q, want %q", first, want)
+	}
+	second, _, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Subject: b\n\nbody\n"; string(second) != want {
+		t.Errorf("second message = %q, want %q", second, want)
+	}
+}
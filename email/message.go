@@ -0,0 +1,318 @@
+// Package email builds and parses RFC 5322 / MIME messages for the Gmail tools.
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// Header is a single message header. Headers are written in the order given.
+type Header struct {
+	Name  string
+	Value string
+}
+
+// Message is an outgoing email. Text and HTML may both be set, in which case
+// they are sent as multipart/alternative, and attachments turn the message
+// into multipart/mixed.
+type Message struct {
+	From    *mail.Address
+	To      []*mail.Address
+	Cc      []*mail.Address
+	Bcc     []*mail.Address
+	ReplyTo []*mail.Address
+	Subject string
+	Date    time.Time
+
+	// Headers are extra headers such as In-Reply-To or References. Their
+	// values must already be valid header values.
+	Headers []Header
+
+	Text string
+	HTML string
+
+	Attachments []Attachment
+}
+
+// ParseAddressList parses a comma-separated list of addresses such as
+// `"Doe, Jane" <jane@example.com>, bob@example.com`. An empty string yields
+// an empty list. Encoded-words in display names are decoded.
+func ParseAddressList(list string) ([]*mail.Address, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
+	}
+
+	parser := mail.AddressParser{WordDecoder: wordDecoder}
+	addresses, err := parser.ParseList(list)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address list %q: %v", list, err)
+	}
+
+	return addresses, nil
+}
+
+// Bytes renders the message with CRLF line endings, ready to be base64url
+// encoded into gmail.Message.Raw.
+func (m *Message) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+
+	date := m.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+
+	if m.From != nil {
+		writeHeader(&buf, "From", m.From.String())
+	}
+	writeAddressHeader(&buf, "To", m.To)
+	writeAddressHeader(&buf, "Cc", m.Cc)
+	writeAddressHeader(&buf, "Bcc", m.Bcc)
+	writeAddressHeader(&buf, "Reply-To", m.ReplyTo)
+	writeHeader(&buf, "Subject", EncodeHeader(m.Subject))
+	writeHeader(&buf, "Date", date.Format(time.RFC1123Z))
+	for _, header := range m.Headers {
+		writeHeader(&buf, header.Name, header.Value)
+	}
+	writeHeader(&buf, "MIME-Version", "1.0")
+
+	if err := m.writeBody(&buf); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Attachment is a file attached to a message. Inline attachments with a
+// ContentID can be referenced from the HTML body as cid:<ContentID>.
+type Attachment struct {
+	Filename    string
+	ContentType string
+	ContentID   string
+	Inline      bool
+	Data        []byte
+}
+
+// entity is a MIME entity: its headers and encoded body.
+type entity struct {
+	header textproto.MIMEHeader
+	body   []byte
+}
+
+// entityHeaders is the order in which entity headers are written.
+var entityHeaders = []string{"Content-Type", "Content-Transfer-Encoding", "Content-Disposition", "Content-ID"}
+
+func (m *Message) writeBody(buf *bytes.Buffer) error {
+	root, err := m.rootEntity()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range entityHeaders {
+		if value := root.header.Get(name); value != "" {
+			writeHeader(buf, name, value)
+		}
+	}
+	buf.WriteString("\r\n")
+	buf.Write(root.body)
+
+	return nil
+}
+
+// rootEntity nests the body parts as multipart/mixed(multipart/related(
+// multipart/alternative(text, html), inline...), attachments...), leaving
+// out every level that would have a single part.
+func (m *Message) rootEntity() (entity, error) {
+	var body entity
+	switch {
+	case m.HTML == "":
+		// Also covers an empty message, which drafts may be.
+		body = textEntity("text/plain", m.Text)
+	case m.Text == "":
+		body = textEntity("text/html", m.HTML)
+	default:
+		var err error
+		body, err = multipartEntity("alternative", []entity{textEntity("text/plain", m.Text), textEntity("text/html", m.HTML)})
+		if err != nil {
+			return entity{}, err
+		}
+	}
+
+	var inline, attached []entity
+	for _, attachment := range m.Attachments {
+		if attachment.Inline && attachment.ContentID != "" {
+			inline = append(inline, attachmentEntity(attachment))
+		} else {
+			attached = append(attached, attachmentEntity(attachment))
+		}
+	}
+
+	if len(inline) > 0 {
+		var err error
+		body, err = multipartEntity("related", append([]entity{body}, inline...))
+		if err != nil {
+			return entity{}, err
+		}
+	}
+
+	if len(attached) > 0 {
+		return multipartEntity("mixed", append([]entity{body}, attached...))
+	}
+
+	return body, nil
+}
+
+// textEntity returns a UTF-8 quoted-printable text part.
+func textEntity(mediaType, content string) entity {
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", mime.FormatMediaType(mediaType, map[string]string{"charset": "utf-8"}))
+	header.Set("Content-Transfer-Encoding", "quoted-printable")
+
+	var buf bytes.Buffer
+	qp := quotedprintable.NewWriter(&buf)
+	qp.Write([]byte(toCRLF(content)))
+	qp.Close()
+
+	return entity{header: header, body: buf.Bytes()}
+}
+
+// attachmentEntity returns a base64 encoded attachment part. Non-ASCII file
+// names are encoded as RFC 2231 parameters by mime.FormatMediaType.
+func attachmentEntity(attachment Attachment) entity {
+	contentType := attachment.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	typeParams := map[string]string{}
+	dispositionParams := map[string]string{}
+	if attachment.Filename != "" {
+		typeParams["name"] = attachment.Filename
+		dispositionParams["filename"] = attachment.Filename
+	}
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "application/octet-stream"
+	}
+	for key, value := range params {
+		typeParams[key] = value
+	}
+
+	disposition := "attachment"
+	if attachment.Inline {
+		disposition = "inline"
+	}
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", mime.FormatMediaType(mediaType, typeParams))
+	header.Set("Content-Transfer-Encoding", "base64")
+	header.Set("Content-Disposition", mime.FormatMediaType(disposition, dispositionParams))
+	if attachment.ContentID != "" {
+		header.Set("Content-ID", "<"+strings.Trim(attachment.ContentID, "<>")+">")
+	}
+
+	return entity{header: header, body: wrapBase64(attachment.Data)}
+}
+
+// newBoundary, when set, returns the boundaries of multipart entities
+// instead of random ones, so that tests get reproducible output.
+var newBoundary func() string
+
+// multipartEntity returns a multipart/<subtype> entity holding parts.
+func multipartEntity(subtype string, parts []entity) (entity, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	if newBoundary != nil {
+		if err := w.SetBoundary(newBoundary()); err != nil {
+			return entity{}, err
+		}
+	}
+
+	for _, part := range parts {
+		pw, err := w.CreatePart(part.header)
+		if err != nil {
+			return entity{}, err
+		}
+		if _, err := pw.Write(part.body); err != nil {
+			return entity{}, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return entity{}, err
+	}
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", mime.FormatMediaType("multipart/"+subtype, map[string]string{"boundary": w.Boundary()}))
+
+	return entity{header: header, body: buf.Bytes()}, nil
+}
+
+// wrapBase64 encodes data as base64 in lines of 76 characters.
+func wrapBase64(data []byte) []byte {
+	const lineLength = 76
+
+	encoded := base64.StdEncoding.EncodeToString(data)
+
+	var buf bytes.Buffer
+	for len(encoded) > lineLength {
+		buf.WriteString(encoded[:lineLength])
+		buf.WriteString("\r\n")
+		encoded = encoded[lineLength:]
+	}
+	buf.WriteString(encoded)
+
+	return buf.Bytes()
+}
+
+// EncodeHeader encodes a header value as RFC 2047 encoded-words when it
+// contains non-ASCII characters, and returns it unchanged otherwise.
+func EncodeHeader(value string) string {
+	return mime.QEncoding.Encode("utf-8", value)
+}
+
+func writeAddressHeader(buf *bytes.Buffer, name string, addresses []*mail.Address) {
+	if len(addresses) == 0 {
+		return
+	}
+
+	formatted := make([]string, len(addresses))
+	for i, address := range addresses {
+		formatted[i] = address.String()
+	}
+	writeHeader(buf, name, strings.Join(formatted, ", "))
+}
+
+// writeHeader writes a header line, folding it at whitespace so lines stay
+// within the 78 character limit of RFC 5322 where possible.
+func writeHeader(buf *bytes.Buffer, name, value string) {
+	const maxLine = 78
+
+	line := name + ": "
+	for i, word := range strings.Split(value, " ") {
+		if i > 0 {
+			if len(line)+1+len(word) > maxLine {
+				buf.WriteString(line)
+				buf.WriteString("\r\n")
+				line = " " + word
+				continue
+			}
+			line += " "
+		}
+		line += word
+	}
+	buf.WriteString(line)
+	buf.WriteString("\r\n")
+}
+
+func toCRLF(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.ReplaceAll(s, "\n", "\r\n")
+}
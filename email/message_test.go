@@ -0,0 +1,149 @@
+package email
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// goldenDate is the date of every golden message.
+var goldenDate = time.Date(2024, 3, 9, 14, 30, 0, 0, time.FixedZone("", 7*3600))
+
+func TestMessageBytesGolden(t *testing.T) {
+	from := &mail.Address{Name: "Jane Doe", Address: "jane@example.com"}
+	to := []*mail.Address{{Name: "Bob", Address: "bob@example.com"}}
+
+	tests := []struct {
+		name    string
+		message Message
+	}{
+		{
+			name: "plain",
+			message: Message{
+				From:    from,
+				To:      to,
+				Subject: "Lunch",
+				Text:    "Are we still on for lunch?\nSee you at noon.\n",
+			},
+		},
+		{
+			name: "alternative",
+			message: Message{
+				From:    from,
+				To:      to,
+				Cc:      []*mail.Address{{Address: "carol@example.com"}},
+				Subject: "Quarterly report",
+				Text:    "The report is ready.",
+				HTML:    "<p>The report is <b>ready</b>.</p>",
+			},
+		},
+		{
+			name: "mixed",
+			message: Message{
+				From:    from,
+				To:      to,
+				Subject: "Files",
+				Text:    "Two files and a logo.",
+				HTML:    `<p>Two files and a logo: <img src="cid:logo"></p>`,
+				Attachments: []Attachment{
+					{Filename: "logo.png", ContentType: "image/png", ContentID: "logo", Inline: true, Data: []byte("\x89PNG\r\n\x1a\n")},
+					{Filename: "notes.txt", ContentType: "text/plain", Data: []byte("first line\nsecond line\n")},
+					{Filename: "résumé.pdf", Data: bytes.Repeat([]byte{0, 1, 2, 3, 250, 251, 252, 253}, 20)},
+				},
+			},
+		},
+		{
+			name: "rfc2047",
+			message: Message{
+				From:    &mail.Address{Name: "Nguyễn Văn Được", Address: "duoc@example.com"},
+				To:      []*mail.Address{{Name: "Zoë Müller", Address: "zoe@example.com"}},
+				ReplyTo: []*mail.Address{{Name: "Support, Team", Address: "support@example.com"}},
+				Subject: "Café à 15h — réunion 日本語",
+				Text:    "Ça marche, à tout à l'heure !",
+			},
+		},
+		{
+			name: "folding",
+			message: Message{
+				From: from,
+				To: []*mail.Address{
+					{Name: "Alice Anderson", Address: "alice.anderson@example.com"},
+					{Name: "Bob Brown", Address: "bob.brown@example.com"},
+					{Name: "Carol Clark", Address: "carol.clark@example.com"},
+					{Name: "Dave Davis", Address: "dave.davis@example.com"},
+				},
+				Subject: "A rather long subject line that certainly does not fit within the seventy-eight characters of a header line",
+				Headers: []Header{{Name: "References", Value: "<first-message-id@mail.example.com> <second-message-id@mail.example.com> <third-message-id@mail.example.com>"}},
+				Text:    strings.Repeat("A long body line that quoted-printable has to wrap. ", 4),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			boundaries := 0
+			newBoundary = func() string {
+				boundaries++
+				return fmt.Sprintf("boundary-%d", boundaries)
+			}
+			t.Cleanup(func() { newBoundary = nil })
+
+			message := tt.message
+			message.Date = goldenDate
+			got, err := message.Bytes()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, line := range strings.Split(strings.TrimSuffix(string(got), "\r\n"), "\r\n") {
+				if strings.Contains(line, "\n") {
+					t.Errorf("line %d has a bare LF: %q", i, line)
+				}
+				// Only a header name followed by a single word that
+				// cannot be split may go over the limit.
+				if _, rest, _ := strings.Cut(strings.TrimSpace(line), " "); len(line) > 78 && strings.Contains(rest, " ") {
+					t.Errorf("line %d is %d characters long: %q", i, len(line), line)
+				}
+			}
+
+			golden := filepath.Join("testdata", tt.name+".golden")
+			if *update {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v (run go test -update to create it)", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("message differs from %s:\n--- got ---\n%s\n--- want ---\n%s", golden, got, want)
+			}
+
+			// The output must parse back to what was built.
+			part, err := Parse(bytes.NewReader(got))
+			if err != nil {
+				t.Fatalf("output does not parse: %v", err)
+			}
+			header, _ := mail.ReadMessage(bytes.NewReader(got))
+			if subject := DecodeHeader(header.Header.Get("Subject")); subject != tt.message.Subject {
+				t.Errorf("subject parses back as %q, want %q", subject, tt.message.Subject)
+			}
+			content := part.Content()
+			if text := strings.ReplaceAll(content.Text, "\r\n", "\n"); text != tt.message.Text {
+				t.Errorf("text parses back as %q, want %q", text, tt.message.Text)
+			}
+			if len(content.Attachments) != len(tt.message.Attachments) {
+				t.Errorf("%d attachments parse back, want %d", len(content.Attachments), len(tt.message.Attachments))
+			}
+		})
+	}
+}
@@ -0,0 +1,278 @@
+package email
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+)
+
+// Part is a node of a parsed MIME tree. Leaf parts carry their body with the
+// transfer encoding removed; multipart parts carry their children.
+type Part struct {
+	Header    textproto.MIMEHeader
+	MediaType string
+	Params    map[string]string
+	Filename  string
+	Body      []byte
+	Parts     []*Part
+
+	// PartID, AttachmentID and Size describe parts of messages fetched
+	// from Gmail, whose attachment bodies are stored separately and not
+	// loaded into Body.
+	PartID       string
+	AttachmentID string
+	Size         int64
+}
+
+// Content is the readable body of a message and its attachments.
+type Content struct {
+	Text        string
+	HTML        string
+	Attachments []*Part
+}
+
+// Parse reads an RFC 5322 message and parses its MIME tree. Malformed
+// multipart bodies are parsed as far as possible rather than rejected.
+func Parse(r io.Reader) (*Part, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseEntity(textproto.MIMEHeader(msg.Header), msg.Body)
+}
+
+func parseEntity(header textproto.MIMEHeader, body io.Reader) (*Part, error) {
+	part := NewPart(header)
+
+	switch {
+	case strings.HasPrefix(part.MediaType, "multipart/") && part.Params["boundary"] != "":
+		reader := multipart.NewReader(body, part.Params["boundary"])
+		for {
+			raw, err := reader.NextRawPart()
+			if err != nil {
+				// io.EOF ends a well-formed body; anything else is a
+				// truncated or malformed one, which keeps what was read.
+				break
+			}
+
+			child, err := parseEntity(raw.Header, raw)
+			if err != nil {
+				break
+			}
+			part.Parts = append(part.Parts, child)
+		}
+		return part, nil
+
+	case part.MediaType == "message/rfc822":
+		data, err := readBody(header.Get("Content-Transfer-Encoding"), body)
+		if err != nil {
+			return nil, err
+		}
+		part.Body = data
+		part.Size = int64(len(data))
+
+		if nested, err := Parse(bytes.NewReader(data)); err == nil {
+			part.Parts = []*Part{nested}
+		}
+		return part, nil
+	}
+
+	data, err := readBody(header.Get("Content-Transfer-Encoding"), body)
+	if err != nil && len(data) == 0 {
+		return nil, err
+	}
+	part.Body = data
+	part.Size = int64(len(data))
+
+	return part, nil
+}
+
+// NewPart returns a part whose media type, parameters and file name are
+// taken from header. A missing or invalid Content-Type means text/plain.
+func NewPart(header textproto.MIMEHeader) *Part {
+	part := &Part{Header: header}
+
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil || mediaType == "" {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+	part.MediaType = strings.ToLower(mediaType)
+	part.Params = params
+
+	if _, dispositionParams, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil {
+		part.Filename = dispositionParams["filename"]
+	}
+	if part.Filename == "" {
+		part.Filename = params["name"]
+	}
+	// RFC 2231 parameters are decoded by mime.ParseMediaType, but many
+	// clients put RFC 2047 encoded-words in quoted file names instead.
+	part.Filename = DecodeHeader(part.Filename)
+
+	return part
+}
+
+// readBody reads a body and removes its Content-Transfer-Encoding. Base64
+// is decoded tolerantly since unpadded, URL-safe and corrupted bodies occur
+// in the wild.
+func readBody(encoding string, body io.Reader) ([]byte, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		return io.ReadAll(quotedprintable.NewReader(body))
+	case "base64":
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		return DecodeBase64(string(data))
+	default:
+		return io.ReadAll(body)
+	}
+}
+
+// Disposition returns the lowercased Content-Disposition type, or "".
+func (p *Part) Disposition() string {
+	disposition, _, err := mime.ParseMediaType(p.Header.Get("Content-Disposition"))
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(disposition)
+}
+
+// ContentID returns the Content-ID without its angle brackets.
+func (p *Part) ContentID() string {
+	return strings.Trim(strings.TrimSpace(p.Header.Get("Content-Id")), "<>")
+}
+
+// IsAttachment reports whether the part is a file rather than body text.
+func (p *Part) IsAttachment() bool {
+	if strings.HasPrefix(p.MediaType, "multipart/") {
+		return false
+	}
+
+	switch p.Disposition() {
+	case "attachment":
+		return true
+	case "inline":
+		if p.Filename == "" && isBodyType(p.MediaType) {
+			return false
+		}
+	}
+
+	return p.Filename != "" || !isBodyType(p.MediaType) && p.MediaType != "message/rfc822"
+}
+
+// Text returns the body of a text part converted to UTF-8 from the charset
+// of its Content-Type.
+func (p *Part) Text() string {
+	return DecodeCharset(p.Body, p.Params["charset"], p.MediaType)
+}
+
+func isBodyType(mediaType string) bool {
+	return mediaType == "text/plain" || mediaType == "text/html"
+}
+
+// Content walks the MIME tree and returns the readable body and the
+// attachments. For multipart/alternative the plain text is taken from the
+// first alternative that has it and the HTML from the last, following the
+// order of increasing preference. For multipart/related only the root part
+// is body; the other parts are inline resources. Successive body parts of
+// multipart/mixed are concatenated.
+func (p *Part) Content() *Content {
+	content := &Content{}
+	content.walk(p)
+	return content
+}
+
+func (c *Content) walk(p *Part) {
+	switch {
+	case p.IsAttachment():
+		c.Attachments = append(c.Attachments, p)
+
+	case p.MediaType == "multipart/alternative":
+		var text, html string
+		for _, child := range p.Parts {
+			sub := &Content{}
+			sub.walk(child)
+			if text == "" {
+				text = sub.Text
+			}
+			if sub.HTML != "" {
+				html = sub.HTML
+			}
+			c.Attachments = append(c.Attachments, sub.Attachments...)
+		}
+		c.appendText(text)
+		c.appendHTML(html)
+
+	case p.MediaType == "multipart/related":
+		for i, child := range p.Parts {
+			if i == 0 {
+				c.walk(child)
+			} else {
+				c.Attachments = append(c.Attachments, child)
+			}
+		}
+
+	case strings.HasPrefix(p.MediaType, "multipart/") || p.MediaType == "message/rfc822":
+		for _, child := range p.Parts {
+			c.walk(child)
+		}
+
+	case p.MediaType == "text/html":
+		c.appendHTML(p.Text())
+
+	default:
+		c.appendText(p.Text())
+	}
+}
+
+func (c *Content) appendText(text string) {
+	if text == "" {
+		return
+	}
+	if c.Text != "" {
+		c.Text = strings.TrimRight(c.Text, "\r\n") + "\n\n"
+	}
+	c.Text += text
+}
+
+func (c *Content) appendHTML(html string) {
+	if html == "" {
+		return
+	}
+	if c.HTML != "" {
+		c.HTML += "<br>"
+	}
+	c.HTML += html
+}
+
+// Body returns the body in the given format: "text" prefers the plain-text
+// alternative, "markdown" converts the HTML alternative to Markdown and
+// "html" returns the HTML alternative. Each falls back to the other
+// alternative when the preferred one is missing.
+func (c *Content) Body(format string) string {
+	switch format {
+	case "html":
+		if c.HTML != "" {
+			return c.HTML
+		}
+		return c.Text
+	case "markdown":
+		if c.HTML != "" {
+			return HTMLToMarkdown(c.HTML)
+		}
+		return c.Text
+	default:
+		if c.Text != "" {
+			return c.Text
+		}
+		return HTMLToMarkdown(c.HTML)
+	}
+}
@@ -0,0 +1,81 @@
+package email
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// attributionLine matches the line that introduces a quoted reply, such
+	// as "On Mon, 1 Jan 2024 at 10:00, Jane <jane@example.com> wrote:". Long
+	// attributions are often wrapped, so it may also end the next line,
+	// which in German, where the verb comes before the name, may hold only
+	// the rest of the address.
+	attributionLine = regexp.MustCompile(`(?i)^\s*(on\s.+(wrote|écrit|schrieb|escribió|scrisse|schreef)\s*:?|le\s.+a écrit\s*:|am\s.+schrieb\s.*:)\s*$`)
+	attributionHead = regexp.MustCompile(`(?i)^\s*(on|le|am)\s.+`)
+	attributionTail = regexp.MustCompile(`(?i)((wrote|écrit|schrieb|escribió|scrisse|schreef)\s*:|^\s*\S+@\S+>\s*:)\s*$`)
+
+	// originalHeader matches the separators Outlook and other clients put
+	// above the quoted original.
+	originalHeader = regexp.MustCompile(`(?i)^\s*(-{2,}\s*original message\s*-{2,}|_{10,})\s*$`)
+	outlookFrom    = regexp.MustCompile(`(?i)^\s*\**from:\**\s.+`)
+	outlookSent    = regexp.MustCompile(`(?i)^\s*\**(sent|date):\**\s.+`)
+
+	// signatureLine matches the start of a signature: the "-- " delimiter of
+	// RFC 3676 and the common mobile footers.
+	signatureLine = regexp.MustCompile(`(?i)^(--|sent from my .+|get outlook for .+|sent from (mail|yahoo mail) for .+)$`)
+)
+
+// TrimReply returns only the new content of a reply: the quoted original
+// (an attribution line followed by quoted text, a "Original Message" block
+// or trailing "> " lines) and the signature are removed. Text that is all
+// quote is returned unchanged, since nothing new would be left.
+func TrimReply(text string) string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+
+	cut := len(lines)
+	for i := range lines {
+		if isQuoteStart(lines, i) {
+			cut = i
+			break
+		}
+	}
+
+	// Drop trailing quoted lines that had no attribution.
+	for cut > 0 && (strings.HasPrefix(strings.TrimSpace(lines[cut-1]), ">") || strings.TrimSpace(lines[cut-1]) == "") {
+		cut--
+	}
+
+	for i := 1; i < cut; i++ {
+		if signatureLine.MatchString(strings.TrimSpace(lines[i])) {
+			cut = i
+			break
+		}
+	}
+
+	trimmed := strings.TrimSpace(strings.Join(lines[:cut], "\n"))
+	if trimmed == "" {
+		return strings.TrimSpace(text)
+	}
+	return trimmed
+}
+
+func isQuoteStart(lines []string, i int) bool {
+	line := lines[i]
+
+	if attributionLine.MatchString(line) {
+		return true
+	}
+	if i+1 < len(lines) && attributionHead.MatchString(line) && attributionTail.MatchString(lines[i+1]) {
+		return true
+	}
+
+	if originalHeader.MatchString(line) {
+		return true
+	}
+	if outlookFrom.MatchString(line) && i+1 < len(lines) && outlookSent.MatchString(lines[i+1]) {
+		return true
+	}
+
+	return false
+}
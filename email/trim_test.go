@@ -0,0 +1,135 @@
+package email
+
+import "testing"
+
+func TestTrimReply(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			name: "gmail",
+			text: "Sounds good.\n\nOn Mon, 1 Jan 2024 at 10:00, Jane Doe <jane@example.com> wrote:\n> Lunch tomorrow?\n>\n> Jane\n",
+			want: "Sounds good.",
+		},
+		{
+			name: "gmail wrapped attribution",
+			text: "Yes.\n\nOn Mon, 1 Jan 2024 at 10:00, Jane Doe via Example Support <support@example.com>\nwrote:\n> Lunch tomorrow?\n",
+			want: "Yes.",
+		},
+		{
+			name: "gmail attribution wrapped inside the address",
+			text: "Yes.\n\nOn Mon, 1 Jan 2024 at 10:00, Jane Doe via Example Support <\nsupport@example.com> wrote:\n> Lunch tomorrow?\n",
+			want: "Yes.",
+		},
+		{
+			name: "apple mail",
+			text: "Will do.\n\n> On 1 Jan 2024, at 10:00, Jane Doe <jane@example.com> wrote:\n>\n> Can you send it?\n",
+			want: "Will do.",
+		},
+		{
+			name: "outlook headers",
+			text: "Approved.\n\nFrom: Jane Doe <jane@example.com>\nSent: Monday, January 1, 2024 10:00 AM\nTo: Bob <bob@example.com>\nSubject: Budget\n\nPlease approve the budget.\n",
+			want: "Approved.",
+		},
+		{
+			name: "outlook bold headers",
+			text: "Approved.\n\n**From:** Jane Doe <jane@example.com>\n**Sent:** Monday, January 1, 2024 10:00 AM\n**Subject:** Budget\n\nPlease approve the budget.\n",
+			want: "Approved.",
+		},
+		{
+			name: "original message separator",
+			text: "Thanks, got it.\n\n-----Original Message-----\nFrom: Jane Doe\nPlease find the file attached.\n",
+			want: "Thanks, got it.",
+		},
+		{
+			name: "underscore separator",
+			text: "Thanks.\n\n________________________________\nFrom: Jane Doe <jane@example.com>\nDate: Monday\n",
+			want: "Thanks.",
+		},
+		{
+			name: "french",
+			text: "Merci !\n\nLe lun. 1 janv. 2024 à 10:00, Jeanne <jeanne@example.fr> a écrit :\n> Bonjour\n",
+			want: "Merci !",
+		},
+		{
+			name: "french wrapped attribution",
+			text: "Merci !\n\nLe lun. 1 janv. 2024 à 10:00, Jeanne Dupont <jeanne.dupont@example.fr> a\nécrit :\n> Bonjour\n",
+			want: "Merci !",
+		},
+		{
+			name: "german",
+			text: "Danke.\n\nAm Mo., 1. Jan. 2024 um 10:00 Uhr schrieb Hans Müller <hans@example.de>:\n> Hallo\n",
+			want: "Danke.",
+		},
+		{
+			name: "german wrapped attribution",
+			text: "Danke.\n\nAm Mo., 1. Jan. 2024 um 10:00 Uhr schrieb Hans Müller <\nhans.mueller@example.de>:\n> Hallo\n",
+			want: "Danke.",
+		},
+		{
+			name: "signature",
+			text: "See you then.\n\n-- \nJane Doe\nAcme Inc.\n",
+			want: "See you then.",
+		},
+		{
+			name: "signature before the quote",
+			text: "See you then.\n-- \nJane\n\nOn Mon, 1 Jan 2024, Bob <bob@example.com> wrote:\n> Tuesday?\n",
+			want: "See you then.",
+		},
+		{
+			name: "iphone footer",
+			text: "OK\n\nSent from my iPhone\n",
+			want: "OK",
+		},
+		{
+			name: "outlook mobile footer",
+			text: "On my way.\n\nGet Outlook for iOS\n",
+			want: "On my way.",
+		},
+		{
+			name: "windows mail footer",
+			text: "Done.\n\nSent from Mail for Windows\n",
+			want: "Done.",
+		},
+		{
+			name: "trailing quote without attribution",
+			text: "Agreed.\n\n> We should ship on Monday.\n> Thoughts?\n",
+			want: "Agreed.",
+		},
+		{
+			name: "inline replies are kept",
+			text: "> Can you come?\nYes.\n> At 10?\nMake it 11.",
+			want: "> Can you come?\nYes.\n> At 10?\nMake it 11.",
+		},
+		{
+			name: "sentence starting with on",
+			text: "On Monday we ship.\nThanks",
+			want: "On Monday we ship.\nThanks",
+		},
+		{
+			name: "all quote",
+			text: "> Only the quoted\n> original.\n",
+			want: "> Only the quoted\n> original.",
+		},
+		{
+			name: "only an attribution and a quote",
+			text: "On Mon, 1 Jan 2024, Jane <jane@example.com> wrote:\n> Hi\n",
+			want: "On Mon, 1 Jan 2024, Jane <jane@example.com> wrote:\n> Hi",
+		},
+		{
+			name: "crlf",
+			text: "Yes\r\n\r\nOn Mon, 1 Jan 2024, Jane <jane@example.com> wrote:\r\n> Lunch?\r\n",
+			want: "Yes",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TrimReply(tt.text); got != tt.want {
+				t.Errorf("TrimReply(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+// Package mailindex is a small in-memory full-text index of mail messages
+// with BM25 ranking, phrase and proximity queries, fuzzy and prefix terms,
+// snippets and date facets. It can be saved to disk, optionally encrypted.
+package mailindex
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Document is one message in the index. Labels hold label IDs.
+type Document struct {
+	ID       string
+	ThreadID string
+	From     string
+	To       string
+	Cc       string
+	Subject  string
+	Date     time.Time
+	Labels   []string
+	Body     string
+}
+
+// Options limits the size of an index. Zero values mean no limit.
+type Options struct {
+	// MaxDocuments is the number of documents kept; the oldest are
+	// dropped first.
+	MaxDocuments int
+	// MaxBodyBytes truncates the body of each document.
+	MaxBodyBytes int
+	// MaxTotalBytes bounds the text stored for all documents; the oldest
+	// are dropped first.
+	MaxTotalBytes int64
+}
+
+// fieldGap separates the positions of the subject, the addresses and the
+// body, so that phrases never match across them.
+const fieldGap = 100
+
+// subjectBoost weighs terms found in the subject over the rest.
+const subjectBoost = 2.0
+
+type entry struct {
+	doc        *Document
+	length     int
+	subjectEnd int32
+	size       int64
+	terms      []string
+}
+
+// Index is safe for concurrent use.
+type Index struct {
+	opts Options
+
+	mu          sync.RWMutex
+	docs        map[string]*entry
+	postings    map[string]map[string][]int32
+	totalTokens int
+	size        int64
+
+	account   string
+	historyID uint64
+	updatedAt time.Time
+}
+
+// New returns an empty index.
+func New(opts Options) *Index {
+	return &Index{
+		opts:     opts,
+		docs:     make(map[string]*entry),
+		postings: make(map[string]map[string][]int32),
+	}
+}
+
+// Account returns the mailbox the index was built from.
+func (ix *Index) Account() string {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return ix.account
+}
+
+// SetAccount records the mailbox the index is built from.
+func (ix *Index) SetAccount(account string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.account = account
+}
+
+// Cursor returns the history ID the index is synchronized to and when it
+// was last updated.
+func (ix *Index) Cursor() (uint64, time.Time) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return ix.historyID, ix.updatedAt
+}
+
+// SetCursor records the history ID the index is synchronized to.
+func (ix *Index) SetCursor(historyID uint64) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.historyID = historyID
+	ix.updatedAt = time.Now()
+}
+
+// Len returns the number of documents.
+func (ix *Index) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return len(ix.docs)
+}
+
+// Size returns the number of bytes of text stored.
+func (ix *Index) Size() int64 {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return ix.size
+}
+
+// Has reports whether the document with the given ID is indexed.
+func (ix *Index) Has(id string) bool {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	_, ok := ix.docs[id]
+	return ok
+}
+
+// Put adds a document, replacing any with the same ID, and then drops the
+// oldest documents if the index is over its limits.
+func (ix *Index) Put(doc *Document) {
+	doc = ix.truncateBody(doc)
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.remove(doc.ID)
+	ix.add(doc)
+	ix.enforceLimits()
+}
+
+// truncateBody returns doc with its body cut to MaxBodyBytes, copying it
+// when it is cut.
+func (ix *Index) truncateBody(doc *Document) *Document {
+	if ix.opts.MaxBodyBytes <= 0 || len(doc.Body) <= ix.opts.MaxBodyBytes {
+		return doc
+	}
+	copied := *doc
+	// Drop the character the cut may have split.
+	copied.Body = strings.ToValidUTF8(doc.Body[:ix.opts.MaxBodyBytes], "")
+	return &copied
+}
+
+// Remove drops the document with the given ID, if indexed.
+func (ix *Index) Remove(id string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.remove(id)
+}
+
+// SetLabels replaces the labels of an indexed document. It reports false
+// when the document is not indexed.
+func (ix *Index) SetLabels(id string, labels []string) bool {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	e, ok := ix.docs[id]
+	if !ok {
+		return false
+	}
+	copied := *e.doc
+	copied.Labels = append([]string(nil), labels...)
+	e.doc = &copied
+	return true
+}
+
+// Labels returns the labels of an indexed document.
+func (ix *Index) Labels(id string) ([]string, bool) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	e, ok := ix.docs[id]
+	if !ok {
+		return nil, false
+	}
+	return append([]string(nil), e.doc.Labels...), true
+}
+
+func (ix *Index) add(doc *Document) {
+	var positions = make(map[string][]int32)
+	pos := int32(0)
+	addText := func(text string) {
+		for _, term := range terms(text) {
+			positions[term] = append(positions[term], pos)
+			pos++
+		}
+		pos += fieldGap
+	}
+
+	addText(doc.Subject)
+	subjectEnd := pos - fieldGap
+	addText(strings.Join([]string{doc.From, doc.To, doc.Cc}, " "))
+	addText(doc.Body)
+
+	e := &entry{
+		doc:        doc,
+		subjectEnd: subjectEnd,
+		size:       int64(len(doc.Subject) + len(doc.From) + len(doc.To) + len(doc.Cc) + len(doc.Body)),
+		terms:      make([]string, 0, len(positions)),
+	}
+	for term, list := range positions {
+		docs, ok := ix.postings[term]
+		if !ok {
+			docs = make(map[string][]int32)
+			ix.postings[term] = docs
+		}
+		docs[doc.ID] = list
+		e.length += len(list)
+		e.terms = append(e.terms, term)
+	}
+
+	ix.docs[doc.ID] = e
+	ix.totalTokens += e.length
+	ix.size += e.size
+}
+
+func (ix *Index) remove(id string) {
+	e, ok := ix.docs[id]
+	if !ok {
+		return
+	}
+	for _, term := range e.terms {
+		docs := ix.postings[term]
+		delete(docs, id)
+		if len(docs) == 0 {
+			delete(ix.postings, term)
+		}
+	}
+	delete(ix.docs, id)
+	ix.totalTokens -= e.length
+	ix.size -= e.size
+}
+
+func (ix *Index) enforceLimits() {
+	over := func() bool {
+		return (ix.opts.MaxDocuments > 0 && len(ix.docs) > ix.opts.MaxDocuments) ||
+			(ix.opts.MaxTotalBytes > 0 && ix.size > ix.opts.MaxTotalBytes)
+	}
+	if !over() {
+		return
+	}
+
+	entries := make([]*entry, 0, len(ix.docs))
+	for _, e := range ix.docs {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].doc.Date.Before(entries[j].doc.Date)
+	})
+	for _, e := range entries {
+		if !over() {
+			break
+		}
+		ix.remove(e.doc.ID)
+	}
+}
+
+// documents returns every document, for saving.
+func (ix *Index) documents() []*Document {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	docs := make([]*Document, 0, len(ix.docs))
+	for _, e := range ix.docs {
+		docs = append(docs, e.doc)
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].ID < docs[j].ID })
+	return docs
+}
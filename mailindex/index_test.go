@@ -0,0 +1,91 @@
+package mailindex
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLimitsDropOldest(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 0, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name string
+		opts Options
+		want []string
+	}{
+		{name: "no limits", opts: Options{}, want: []string{"1", "2", "3", "4"}},
+		{name: "documents", opts: Options{MaxDocuments: 2}, want: []string{"3", "4"}},
+		// Each document stores 10 bytes of body.
+		{name: "total bytes", opts: Options{MaxTotalBytes: 35}, want: []string{"2", "3", "4"}},
+		{name: "both", opts: Options{MaxDocuments: 3, MaxTotalBytes: 25}, want: []string{"3", "4"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ix := New(tt.opts)
+			// Put out of date order: the oldest go first, not the first put.
+			for _, d := range []int{3, 1, 4, 2} {
+				id := string(rune('0' + d))
+				ix.Put(&Document{ID: id, Date: day(d), Body: strings.Repeat(id, 10)})
+			}
+
+			var got []string
+			for _, hit := range ix.Search("", SearchOptions{}).Hits {
+				got = append(got, hit.Document.ID)
+			}
+			sort.Strings(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("kept %v, want %v", got, tt.want)
+			}
+			if ix.Len() != len(tt.want) || ix.Size() != int64(10*len(tt.want)) {
+				t.Errorf("Len() = %d and Size() = %d, want %d and %d", ix.Len(), ix.Size(), len(tt.want), 10*len(tt.want))
+			}
+		})
+	}
+}
+
+func TestPutReplacesAndRemove(t *testing.T) {
+	ix := New(Options{})
+	ix.Put(&Document{ID: "1", Date: time.Now(), Body: "first draft"})
+	ix.Put(&Document{ID: "1", Date: time.Now(), Body: "final version"})
+
+	if hits := ix.Search("draft", SearchOptions{}).Hits; len(hits) != 0 {
+		t.Error("the replaced body is still found")
+	}
+	if hits := ix.Search("final", SearchOptions{}).Hits; len(hits) != 1 {
+		t.Error("the new body is not found")
+	}
+	if ix.Len() != 1 || ix.Size() != int64(len("final version")) {
+		t.Errorf("Len() = %d and Size() = %d after replacing", ix.Len(), ix.Size())
+	}
+
+	ix.Remove("1")
+	if ix.Len() != 0 || ix.Size() != 0 || len(ix.postings) != 0 {
+		t.Errorf("Len() = %d, Size() = %d and %d terms after removing", ix.Len(), ix.Size(), len(ix.postings))
+	}
+}
+
+func TestSetLabels(t *testing.T) {
+	ix := New(Options{})
+	doc := &Document{ID: "1", Date: time.Now(), Labels: []string{"INBOX"}, Body: "hello"}
+	ix.Put(doc)
+
+	if !ix.SetLabels("1", []string{"Label_1"}) {
+		t.Fatal("SetLabels reports the document is not indexed")
+	}
+	if ix.SetLabels("2", []string{"Label_1"}) {
+		t.Error("SetLabels reports an unknown document as indexed")
+	}
+	if labels, _ := ix.Labels("1"); !slices.Equal(labels, []string{"Label_1"}) {
+		t.Errorf("Labels() = %v, want [Label_1]", labels)
+	}
+	if !slices.Equal(doc.Labels, []string{"INBOX"}) {
+		t.Errorf("the document put was changed to %v", doc.Labels)
+	}
+	if hits := ix.Search("hello", SearchOptions{Labels: []string{"Label_1"}}).Hits; len(hits) != 1 {
+		t.Error("search does not see the new labels")
+	}
+}
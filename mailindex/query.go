@@ -0,0 +1,119 @@
+package mailindex
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// clauseKind is how a query clause matches terms.
+type clauseKind int
+
+const (
+	matchExact clauseKind = iota
+	matchPrefix
+	matchFuzzy
+	matchPhrase
+)
+
+// maxExpansions caps the index terms a prefix or fuzzy clause expands to.
+const maxExpansions = 50
+
+// clause is one part of a query. Every clause must match, except negated
+// ones, which must not.
+type clause struct {
+	kind     clauseKind
+	terms    []string
+	distance int // edit distance for fuzzy, slop for phrases
+	negated  bool
+}
+
+// parseQuery parses a query of words, "exact phrases", "near words"~N,
+// prefixes such as invoic*, fuzzy words such as recieve~ or recieve~2 and
+// -excluded words or phrases.
+func parseQuery(query string) []clause {
+	var clauses []clause
+	s := query
+	for {
+		s = strings.TrimLeftFunc(s, unicode.IsSpace)
+		if s == "" {
+			return clauses
+		}
+
+		negated := false
+		if s[0] == '-' {
+			negated = true
+			s = s[1:]
+		}
+
+		var c clause
+		if s != "" && s[0] == '"' {
+			end := strings.IndexByte(s[1:], '"')
+			var phrase string
+			if end < 0 {
+				phrase, s = s[1:], ""
+			} else {
+				phrase, s = s[1:end+1], s[end+2:]
+			}
+			c = clause{kind: matchPhrase, terms: terms(phrase)}
+			if strings.HasPrefix(s, "~") {
+				n, rest := leadingNumber(s[1:])
+				c.distance, s = n, rest
+			}
+		} else {
+			end := strings.IndexFunc(s, unicode.IsSpace)
+			if end < 0 {
+				end = len(s)
+			}
+			word := s[:end]
+			s = s[end:]
+			c = wordClause(word)
+		}
+
+		if len(c.terms) == 0 {
+			continue
+		}
+		c.negated = negated
+		clauses = append(clauses, c)
+	}
+}
+
+// wordClause parses a single word with its optional * or ~ suffix. A word
+// that splits into several terms, such as an address, is a phrase.
+func wordClause(word string) clause {
+	switch {
+	case strings.HasSuffix(word, "*"):
+		t := terms(strings.TrimSuffix(word, "*"))
+		if len(t) == 1 {
+			return clause{kind: matchPrefix, terms: t}
+		}
+		return clause{kind: matchPhrase, terms: t}
+	case strings.Contains(word, "~"):
+		i := strings.LastIndexByte(word, '~')
+		t := terms(word[:i])
+		if len(t) == 1 {
+			distance := fuzziness(t[0])
+			if n, rest := leadingNumber(word[i+1:]); rest == "" && word[i+1:] != "" {
+				distance = min(n, 2)
+			}
+			return clause{kind: matchFuzzy, terms: t, distance: distance}
+		}
+		return clause{kind: matchPhrase, terms: t}
+	}
+
+	t := terms(word)
+	if len(t) == 1 {
+		return clause{kind: matchExact, terms: t}
+	}
+	return clause{kind: matchPhrase, terms: t}
+}
+
+// leadingNumber parses the digits at the start of s and returns the rest.
+func leadingNumber(s string) (int, string) {
+	end := 0
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		end++
+	}
+	n, _ := strconv.Atoi(s[:end])
+	return n, s[end:]
+}
@@ -0,0 +1,48 @@
+package mailindex
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []clause
+	}{
+		{"", nil},
+		{"Invoice march", []clause{
+			{kind: matchExact, terms: []string{"invoice"}},
+			{kind: matchExact, terms: []string{"march"}},
+		}},
+		{"café", []clause{{kind: matchExact, terms: []string{"cafe"}}}},
+		{`"quarterly report"`, []clause{{kind: matchPhrase, terms: []string{"quarterly", "report"}}}},
+		{`"budget review"~3 draft`, []clause{
+			{kind: matchPhrase, terms: []string{"budget", "review"}, distance: 3},
+			{kind: matchExact, terms: []string{"draft"}},
+		}},
+		{`"unterminated phrase`, []clause{{kind: matchPhrase, terms: []string{"unterminated", "phrase"}}}},
+		{"invoic*", []clause{{kind: matchPrefix, terms: []string{"invoic"}}}},
+		{"recieve~", []clause{{kind: matchFuzzy, terms: []string{"recieve"}, distance: 1}}},
+		{"acknowledgment~", []clause{{kind: matchFuzzy, terms: []string{"acknowledgment"}, distance: 2}}},
+		{"cat~", []clause{{kind: matchFuzzy, terms: []string{"cat"}, distance: 0}}},
+		{"recieve~1", []clause{{kind: matchFuzzy, terms: []string{"recieve"}, distance: 1}}},
+		{"recieve~5", []clause{{kind: matchFuzzy, terms: []string{"recieve"}, distance: 2}}},
+		{"-newsletter", []clause{{kind: matchExact, terms: []string{"newsletter"}, negated: true}}},
+		{`-"weekly digest" report`, []clause{
+			{kind: matchPhrase, terms: []string{"weekly", "digest"}, negated: true},
+			{kind: matchExact, terms: []string{"report"}},
+		}},
+		// An address splits into several terms, which must be adjacent.
+		{"jane@example.com", []clause{{kind: matchPhrase, terms: []string{"jane", "example", "com"}}}},
+		{"jane.doe*", []clause{{kind: matchPhrase, terms: []string{"jane", "doe"}}}},
+		// Punctuation alone has no terms and is skipped.
+		{"- ... *", nil},
+	}
+
+	for _, tt := range tests {
+		if got := parseQuery(tt.query); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseQuery(%q) = %+v, want %+v", tt.query, got, tt.want)
+		}
+	}
+}
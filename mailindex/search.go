@@ -0,0 +1,329 @@
+package mailindex
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BM25 parameters.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Weights of terms that only match a query word approximately, and the
+// bonus of a phrase over its words found apart.
+const (
+	prefixWeight = 0.8
+	fuzzyWeight  = 0.7
+	phraseBonus  = 1.5
+)
+
+// snippetWords is the length of a snippet, in words.
+const snippetWords = 30
+
+// SearchOptions narrows a search. Zero values do not filter.
+type SearchOptions struct {
+	// After and Before bound the date; After is inclusive and Before
+	// exclusive.
+	After, Before time.Time
+	// Labels are label IDs that every hit must have.
+	Labels []string
+	// From and To match part of the sender, and of the recipients and
+	// copies, case-insensitively.
+	From, To string
+}
+
+// Hit is a matching document. Document is shared with the index and must
+// not be modified.
+type Hit struct {
+	Document *Document
+	Score    float64
+
+	matched map[string]bool
+}
+
+// Snippet returns the best matching part of the body, with the matched
+// words in **bold**. It is computed on demand, since a search may have far
+// more hits than are shown.
+func (h Hit) Snippet() string {
+	return snippet(h.Document.Body, h.matched, snippetWords)
+}
+
+// Result holds every hit, best first, and the number of hits per month
+// ("2006-01").
+type Result struct {
+	Hits   []Hit
+	Months map[string]int
+}
+
+type match struct {
+	score float64
+	terms []string
+}
+
+// Search runs a query; see parseQuery for its syntax. Every word must
+// match. An empty query matches every document, newest first.
+func (ix *Index) Search(query string, opts SearchOptions) *Result {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	avgLength := float64(ix.totalTokens) / float64(max(len(ix.docs), 1))
+
+	var candidates map[string]*match
+	excluded := make(map[string]bool)
+	for _, c := range parseQuery(query) {
+		matches := ix.matchClause(c, avgLength)
+		if c.negated {
+			for id := range matches {
+				excluded[id] = true
+			}
+			continue
+		}
+		if candidates == nil {
+			candidates = matches
+			continue
+		}
+		for id, m := range candidates {
+			other, ok := matches[id]
+			if !ok {
+				delete(candidates, id)
+				continue
+			}
+			m.score += other.score
+			m.terms = append(m.terms, other.terms...)
+		}
+	}
+	if candidates == nil {
+		candidates = make(map[string]*match, len(ix.docs))
+		for id := range ix.docs {
+			candidates[id] = &match{}
+		}
+	}
+
+	result := &Result{Months: make(map[string]int)}
+	for id, m := range candidates {
+		doc := ix.docs[id].doc
+		if excluded[id] || !opts.accepts(doc) {
+			continue
+		}
+		result.Months[doc.Date.Format("2006-01")]++
+
+		matched := make(map[string]bool, len(m.terms))
+		for _, term := range m.terms {
+			matched[term] = true
+		}
+		result.Hits = append(result.Hits, Hit{
+			Document: doc,
+			Score:    m.score,
+			matched:  matched,
+		})
+	}
+
+	sort.Slice(result.Hits, func(i, j int) bool {
+		a, b := result.Hits[i], result.Hits[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if !a.Document.Date.Equal(b.Document.Date) {
+			return a.Document.Date.After(b.Document.Date)
+		}
+		return a.Document.ID < b.Document.ID
+	})
+	return result
+}
+
+func (opts SearchOptions) accepts(doc *Document) bool {
+	if !opts.After.IsZero() && doc.Date.Before(opts.After) {
+		return false
+	}
+	if !opts.Before.IsZero() && !doc.Date.Before(opts.Before) {
+		return false
+	}
+	for _, label := range opts.Labels {
+		found := false
+		for _, l := range doc.Labels {
+			if l == label {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if opts.From != "" && !strings.Contains(strings.ToLower(doc.From), strings.ToLower(opts.From)) {
+		return false
+	}
+	if opts.To != "" && !strings.Contains(strings.ToLower(doc.To+" "+doc.Cc), strings.ToLower(opts.To)) {
+		return false
+	}
+	return true
+}
+
+// matchClause returns the documents a clause matches with their scores.
+func (ix *Index) matchClause(c clause, avgLength float64) map[string]*match {
+	matches := make(map[string]*match)
+	if c.kind == matchPhrase {
+		ix.matchPhrase(c, avgLength, matches)
+		return matches
+	}
+
+	for _, expansion := range ix.expand(c) {
+		docs := ix.postings[expansion.term]
+		idf := ix.idf(len(docs))
+		for id, positions := range docs {
+			e := ix.docs[id]
+			m, ok := matches[id]
+			if !ok {
+				m = &match{}
+				matches[id] = m
+			}
+			m.score += expansion.weight * idf * bm25(e.frequency(positions), float64(e.length), avgLength)
+			m.terms = append(m.terms, expansion.term)
+		}
+	}
+	return matches
+}
+
+type expansion struct {
+	term   string
+	weight float64
+}
+
+// expand returns the index terms a single word clause stands for.
+func (ix *Index) expand(c clause) []expansion {
+	word := c.terms[0]
+	if c.kind == matchExact || (c.kind == matchFuzzy && c.distance == 0) {
+		return []expansion{{word, 1}}
+	}
+
+	var expansions []expansion
+	for term := range ix.postings {
+		switch {
+		case term == word:
+			expansions = append(expansions, expansion{term, 1})
+		case c.kind == matchPrefix && strings.HasPrefix(term, word):
+			expansions = append(expansions, expansion{term, prefixWeight})
+		case c.kind == matchFuzzy && withinDistance(term, word, c.distance):
+			expansions = append(expansions, expansion{term, fuzzyWeight})
+		}
+	}
+
+	// Keep the closest and then the most frequent terms.
+	sort.Slice(expansions, func(i, j int) bool {
+		a, b := expansions[i], expansions[j]
+		if a.weight != b.weight {
+			return a.weight > b.weight
+		}
+		if na, nb := len(ix.postings[a.term]), len(ix.postings[b.term]); na != nb {
+			return na > nb
+		}
+		return a.term < b.term
+	})
+	return expansions[:min(len(expansions), maxExpansions)]
+}
+
+// matchPhrase finds the documents with the words of a phrase in order, or
+// with a slop, within that many extra words of each other in any order.
+func (ix *Index) matchPhrase(c clause, avgLength float64, matches map[string]*match) {
+	lists := make([]map[string][]int32, len(c.terms))
+	for i, term := range c.terms {
+		lists[i] = ix.postings[term]
+		if len(lists[i]) == 0 {
+			return
+		}
+	}
+
+	// Walk the shortest posting list.
+	shortest := 0
+	for i := range lists {
+		if len(lists[i]) < len(lists[shortest]) {
+			shortest = i
+		}
+	}
+
+	for id := range lists[shortest] {
+		positions := make([][]int32, len(lists))
+		found := true
+		for i := range lists {
+			if positions[i], found = lists[i][id]; !found {
+				break
+			}
+		}
+		if !found {
+			continue
+		}
+
+		starts := phraseStarts(positions, c.distance)
+		if len(starts) == 0 {
+			continue
+		}
+
+		e := ix.docs[id]
+		tf := e.frequency(starts)
+		m := &match{terms: c.terms}
+		for _, term := range c.terms {
+			m.score += phraseBonus * ix.idf(len(ix.postings[term])) * bm25(tf, float64(e.length), avgLength)
+		}
+		matches[id] = m
+	}
+}
+
+// phraseStarts returns the positions of the first word where the phrase
+// matches.
+func phraseStarts(positions [][]int32, slop int) []int32 {
+	span := int32(len(positions) - 1 + slop)
+
+	var starts []int32
+	for _, start := range positions[0] {
+		ok := true
+		for i := 1; i < len(positions) && ok; i++ {
+			ok = false
+			for _, p := range positions[i] {
+				if slop == 0 {
+					if p == start+int32(i) {
+						ok = true
+						break
+					}
+				} else if p != start && p >= start-span && p <= start+span {
+					ok = true
+					break
+				}
+			}
+		}
+		if ok {
+			starts = append(starts, start)
+		}
+	}
+	return starts
+}
+
+// frequency weighs the occurrences of a term, counting the subject ones
+// more.
+func (e *entry) frequency(positions []int32) float64 {
+	tf := 0.0
+	for _, p := range positions {
+		if p < e.subjectEnd {
+			tf += subjectBoost
+		} else {
+			tf++
+		}
+	}
+	return tf
+}
+
+func (ix *Index) idf(docFrequency int) float64 {
+	n := float64(len(ix.docs))
+	df := float64(docFrequency)
+	return math.Log(1 + (n-df+0.5)/(df+0.5))
+}
+
+func bm25(tf, length, avgLength float64) float64 {
+	if avgLength == 0 {
+		avgLength = 1
+	}
+	return tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*length/avgLength))
+}
@@ -0,0 +1,166 @@
+package mailindex
+
+import (
+	"reflect"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestSearchSnippet(t *testing.T) {
+	ix := New(Options{})
+	ix.Put(&Document{
+		ID:      "1",
+		Subject: "Invoice",
+		Date:    time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		Body:    "Hello, please find attached the invoice for March. Payment is due in thirty days.",
+	})
+	ix.Put(&Document{
+		ID:      "2",
+		Subject: "Lunch",
+		Date:    time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC),
+		Body:    "Are we still on for lunch?",
+	})
+
+	result := ix.Search("payment due", SearchOptions{})
+	if len(result.Hits) != 1 || result.Hits[0].Document.ID != "1" {
+		t.Fatalf("hits = %+v, want document 1", result.Hits)
+	}
+	want := "Hello, please find attached the invoice for March. **Payment** is **due** in thirty days"
+	if got := result.Hits[0].Snippet(); got != want {
+		t.Errorf("snippet = %q, want %q", got, want)
+	}
+
+	// Without query words the snippet is the start of the body.
+	result = ix.Search("", SearchOptions{})
+	if len(result.Hits) != 2 || result.Hits[0].Document.ID != "2" {
+		t.Fatalf("hits = %+v, want both, newest first", result.Hits)
+	}
+	if got := result.Hits[0].Snippet(); got != "Are we still on for lunch" {
+		t.Errorf("snippet = %q", got)
+	}
+}
+
+// testIndex returns an index of a few messages over three months.
+func testIndex() *Index {
+	ix := New(Options{})
+	for _, doc := range []*Document{
+		{ID: "1", Subject: "Quarterly report", From: "Jane Doe <jane@example.com>", Labels: []string{"INBOX"},
+			Date: time.Date(2024, 1, 10, 9, 0, 0, 0, time.UTC), Body: "The quarterly report is attached. Budget numbers are final."},
+		{ID: "2", Subject: "Budget", From: "Bob <bob@example.com>", Labels: []string{"INBOX", "IMPORTANT"},
+			Date: time.Date(2024, 2, 5, 9, 0, 0, 0, time.UTC), Body: "We need to review the budget before the meeting."},
+		{ID: "3", Subject: "Newsletter", From: "News <news@news.example.com>",
+			Date: time.Date(2024, 2, 20, 9, 0, 0, 0, time.UTC), Body: "Weekly digest: a report on budget trends. Unsubscribe anytime."},
+		{ID: "4", Subject: "Invoice", From: "Billing <billing@example.net>", To: "bob@example.com",
+			Date: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), Body: "Invoice 42 for February. Please acknowledge receipt."},
+		{ID: "5", Subject: "Invoices overdue", From: "Billing <billing@example.net>",
+			Date: time.Date(2024, 3, 15, 9, 0, 0, 0, time.UTC), Body: "Your invoicing account has two invoices overdue."},
+	} {
+		ix.Put(doc)
+	}
+	return ix
+}
+
+func hitIDs(result *Result) []string {
+	ids := make([]string, len(result.Hits))
+	for i, hit := range result.Hits {
+		ids[i] = hit.Document.ID
+	}
+	return ids
+}
+
+func TestSearchMatches(t *testing.T) {
+	ix := testIndex()
+
+	tests := []struct {
+		name  string
+		query string
+		opts  SearchOptions
+		want  []string
+	}{
+		{name: "word", query: "budget", want: []string{"1", "2", "3"}},
+		{name: "every word must match", query: "budget meeting", want: []string{"2"}},
+		{name: "diacritics and case", query: "BÜDGET", want: []string{"1", "2", "3"}},
+		{name: "phrase", query: `"quarterly report"`, want: []string{"1"}},
+		{name: "phrase in the wrong order", query: `"review budget"`, want: nil},
+		{name: "proximity", query: `"review budget"~1`, want: []string{"2"}},
+		{name: "proximity ignores words too far apart", query: `"report budget"~1`, want: []string{"3"}},
+		{name: "phrase across fields", query: `"report jane"`, want: nil},
+		{name: "address", query: "jane@example.com", want: []string{"1"}},
+		{name: "prefix", query: "invoic*", want: []string{"4", "5"}},
+		{name: "fuzzy", query: "invoise~", want: []string{"4"}},
+		{name: "fuzzy with a distance", query: "acknolege~2", want: []string{"4"}},
+		{name: "short words are not fuzzy", query: "bog~", want: nil},
+		{name: "negated word", query: "budget -newsletter", want: []string{"1", "2"}},
+		{name: "negated phrase", query: `budget -"weekly digest"`, want: []string{"1", "2"}},
+		{name: "only negated", query: "-budget", want: []string{"4", "5"}},
+		{name: "label", query: "budget", opts: SearchOptions{Labels: []string{"IMPORTANT"}}, want: []string{"2"}},
+		{name: "from", query: "budget", opts: SearchOptions{From: "NEWS@"}, want: []string{"3"}},
+		{name: "to", opts: SearchOptions{To: "bob@"}, want: []string{"4"}},
+		{
+			name: "dates",
+			opts: SearchOptions{After: time.Date(2024, 2, 5, 9, 0, 0, 0, time.UTC), Before: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+			want: []string{"2", "3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := hitIDs(ix.Search(tt.query, tt.opts))
+			sort.Strings(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchRanking(t *testing.T) {
+	ix := testIndex()
+
+	// A word in the subject outweighs one in the body.
+	if got := hitIDs(ix.Search("budget", SearchOptions{})); got[0] != "2" {
+		t.Errorf("budget ranks %v, want the message with it in the subject first", got)
+	}
+	// An exact match outweighs a prefix one.
+	if got := hitIDs(ix.Search("invoice*", SearchOptions{})); !reflect.DeepEqual(got, []string{"4", "5"}) {
+		t.Errorf("invoice* ranks %v, want [4 5]", got)
+	}
+	// A rarer word counts for more: overdue is only in one message.
+	if got := hitIDs(ix.Search("invoices overdue", SearchOptions{})); !reflect.DeepEqual(got, []string{"5"}) {
+		t.Errorf("invoices overdue = %v, want [5]", got)
+	}
+
+	ix.Put(&Document{ID: "6", Date: time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC),
+		Body: "Budget, budget, budget: the budget is all anyone talks about."})
+	ix.Put(&Document{ID: "7", Date: time.Date(2023, 12, 2, 0, 0, 0, 0, time.UTC),
+		Body: "A long message that mentions the budget once among many other words about travel plans, hotels and trains."})
+	got := hitIDs(ix.Search("budget", SearchOptions{}))
+	if i, j := slices.Index(got, "6"), slices.Index(got, "7"); i > j {
+		t.Errorf("budget ranks %v, want the message that repeats it above the long one that mentions it once", got)
+	}
+
+	// Without a query, newest first.
+	if got := hitIDs(ix.Search("", SearchOptions{})); !reflect.DeepEqual(got, []string{"5", "4", "3", "2", "1", "7", "6"}) {
+		t.Errorf("empty query = %v, want newest first", got)
+	}
+}
+
+func TestSearchMonths(t *testing.T) {
+	ix := testIndex()
+
+	tests := []struct {
+		query string
+		want  map[string]int
+	}{
+		{"", map[string]int{"2024-01": 1, "2024-02": 2, "2024-03": 2}},
+		{"budget", map[string]int{"2024-01": 1, "2024-02": 2}},
+		{"nothing", map[string]int{}},
+	}
+	for _, tt := range tests {
+		if got := ix.Search(tt.query, SearchOptions{}).Months; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Search(%q).Months = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package mailindex
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// The saved index starts with a header of the magic, the format version
+// and flags. The rest is a gzipped gob of the documents, or, when
+// encrypted, a salt, a nonce and that gzipped gob sealed with AES-GCM
+// under a key derived from a passphrase with scrypt. Postings are not
+// saved; they are rebuilt on load.
+const (
+	magic         = "GKMI"
+	formatVersion = 1
+	flagEncrypted = 1
+
+	saltSize = 16
+)
+
+var (
+	// ErrPassphraseRequired is returned when reading an encrypted index
+	// without a passphrase.
+	ErrPassphraseRequired = errors.New("the index is encrypted and needs a passphrase")
+	// ErrWrongPassphrase is returned when an encrypted index cannot be
+	// opened with the given passphrase, or was altered.
+	ErrWrongPassphrase = errors.New("wrong passphrase or corrupted index")
+)
+
+type snapshot struct {
+	Account   string
+	HistoryID uint64
+	UpdatedAt time.Time
+	Documents []*Document
+}
+
+// WriteTo saves the index to w, encrypted when passphrase is not empty.
+func (ix *Index) WriteTo(w io.Writer, passphrase string) error {
+	historyID, updatedAt := ix.Cursor()
+	s := snapshot{Account: ix.Account(), HistoryID: historyID, UpdatedAt: updatedAt, Documents: ix.documents()}
+
+	header := []byte{magic[0], magic[1], magic[2], magic[3], formatVersion, 0}
+	if passphrase == "" {
+		if _, err := w.Write(header); err != nil {
+			return err
+		}
+		return encodeSnapshot(w, &s)
+	}
+	header[5] |= flagEncrypted
+
+	var plain bytes.Buffer
+	if err := encodeSnapshot(&plain, &s); err != nil {
+		return err
+	}
+
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	aead, err := newAEAD(passphrase, salt)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	for _, part := range [][]byte{header, salt, nonce, aead.Seal(nil, nonce, plain.Bytes(), header)} {
+		if _, err := w.Write(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Read loads an index saved by WriteTo. Bodies are cut to the limit of
+// opts, which may be lower than when the index was saved, and documents
+// over the other limits are dropped, oldest first.
+func Read(r io.Reader, passphrase string, opts Options) (*Index, error) {
+	header := make([]byte, 6)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("failed to read index header: %v", err)
+	}
+	if string(header[:4]) != magic {
+		return nil, errors.New("not an index file")
+	}
+	if header[4] != formatVersion {
+		return nil, fmt.Errorf("unsupported index version %d", header[4])
+	}
+
+	var s snapshot
+	if header[5]&flagEncrypted == 0 {
+		if err := decodeSnapshot(r, &s); err != nil {
+			return nil, err
+		}
+	} else {
+		if passphrase == "" {
+			return nil, ErrPassphraseRequired
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) < saltSize {
+			return nil, ErrWrongPassphrase
+		}
+		aead, err := newAEAD(passphrase, data[:saltSize])
+		if err != nil {
+			return nil, err
+		}
+		data = data[saltSize:]
+		if len(data) < aead.NonceSize() {
+			return nil, ErrWrongPassphrase
+		}
+		plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], header)
+		if err != nil {
+			return nil, ErrWrongPassphrase
+		}
+		if err := decodeSnapshot(bytes.NewReader(plain), &s); err != nil {
+			return nil, err
+		}
+	}
+
+	ix := New(opts)
+	ix.account, ix.historyID, ix.updatedAt = s.Account, s.HistoryID, s.UpdatedAt
+	for _, doc := range s.Documents {
+		ix.add(ix.truncateBody(doc))
+	}
+	ix.enforceLimits()
+	return ix, nil
+}
+
+func encodeSnapshot(w io.Writer, s *snapshot) error {
+	zw := gzip.NewWriter(w)
+	if err := gob.NewEncoder(zw).Encode(s); err != nil {
+		return fmt.Errorf("failed to encode index: %v", err)
+	}
+	return zw.Close()
+}
+
+func decodeSnapshot(r io.Reader, s *snapshot) error {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("failed to decode index: %v", err)
+	}
+	defer zr.Close()
+	if err := gob.NewDecoder(zr).Decode(s); err != nil {
+		return fmt.Errorf("failed to decode index: %v", err)
+	}
+	return nil
+}
+
+func newAEAD(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
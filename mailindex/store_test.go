@@ -0,0 +1,131 @@
+package mailindex
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadAppliesBodyLimit(t *testing.T) {
+	saved := New(Options{})
+	saved.Put(&Document{
+		ID:   "1",
+		Date: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		Body: "café au lait " + strings.Repeat("filler ", 100) + "needle",
+	})
+
+	for _, passphrase := range []string{"", "secret"} {
+		var buf bytes.Buffer
+		if err := saved.WriteTo(&buf, passphrase); err != nil {
+			t.Fatal(err)
+		}
+
+		loaded, err := Read(&buf, passphrase, Options{MaxBodyBytes: 4})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hits := loaded.Search("needle", SearchOptions{}).Hits; len(hits) != 0 {
+			t.Errorf("passphrase %q: a word past the body limit is still found", passphrase)
+		}
+		hits := loaded.Search("", SearchOptions{}).Hits
+		if len(hits) != 1 {
+			t.Fatalf("passphrase %q: %d documents loaded, want 1", passphrase, len(hits))
+		}
+		// The cut splits the é, which is dropped.
+		if body := hits[0].Document.Body; body != "caf" {
+			t.Errorf("passphrase %q: body = %q, want %q", passphrase, body, "caf")
+		}
+		if loaded.Size() >= saved.Size() {
+			t.Errorf("passphrase %q: size %d, want less than %d", passphrase, loaded.Size(), saved.Size())
+		}
+	}
+}
+
+func TestWriteToRead(t *testing.T) {
+	saved := testIndex()
+	saved.SetAccount("me@example.com")
+	saved.SetCursor(1234)
+	historyID, updatedAt := saved.Cursor()
+
+	for _, passphrase := range []string{"", "secret"} {
+		var buf bytes.Buffer
+		if err := saved.WriteTo(&buf, passphrase); err != nil {
+			t.Fatal(err)
+		}
+		if passphrase != "" && bytes.Contains(buf.Bytes(), []byte("Quarterly")) {
+			t.Error("the encrypted index holds plain text")
+		}
+
+		loaded, err := Read(&buf, passphrase, Options{})
+		if err != nil {
+			t.Fatalf("passphrase %q: %v", passphrase, err)
+		}
+		if loaded.Account() != "me@example.com" {
+			t.Errorf("passphrase %q: account = %q", passphrase, loaded.Account())
+		}
+		if id, at := loaded.Cursor(); id != historyID || !at.Equal(updatedAt) {
+			t.Errorf("passphrase %q: cursor = %d at %v, want %d at %v", passphrase, id, at, historyID, updatedAt)
+		}
+		if loaded.Len() != saved.Len() || loaded.Size() != saved.Size() {
+			t.Errorf("passphrase %q: %d documents of %d bytes, want %d of %d", passphrase, loaded.Len(), loaded.Size(), saved.Len(), saved.Size())
+		}
+		// Postings are rebuilt on load.
+		if got := hitIDs(loaded.Search(`"quarterly report"`, SearchOptions{})); !slices.Equal(got, []string{"1"}) {
+			t.Errorf("passphrase %q: phrase search = %v, want [1]", passphrase, got)
+		}
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	var encrypted bytes.Buffer
+	if err := testIndex().WriteTo(&encrypted, "secret"); err != nil {
+		t.Fatal(err)
+	}
+	tampered := bytes.Clone(encrypted.Bytes())
+	tampered[len(tampered)-1] ^= 1
+
+	tests := []struct {
+		name       string
+		data       []byte
+		passphrase string
+		want       error
+		wantText   string
+	}{
+		{name: "no passphrase", data: encrypted.Bytes(), want: ErrPassphraseRequired},
+		{name: "wrong passphrase", data: encrypted.Bytes(), passphrase: "guess", want: ErrWrongPassphrase},
+		{name: "altered", data: tampered, passphrase: "secret", want: ErrWrongPassphrase},
+		{name: "cut short", data: encrypted.Bytes()[:10], passphrase: "secret", want: ErrWrongPassphrase},
+		{name: "not an index", data: []byte("{\"documents\": []}"), wantText: "not an index file"},
+		{name: "newer version", data: []byte("GKMI\x09\x00"), wantText: "unsupported index version 9"},
+		{name: "empty", data: nil, wantText: "failed to read index header"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Read(bytes.NewReader(tt.data), tt.passphrase, Options{})
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+			if tt.wantText != "" && (err == nil || !strings.Contains(err.Error(), tt.wantText)) {
+				t.Errorf("err = %v, want it to mention %q", err, tt.wantText)
+			}
+		})
+	}
+}
+
+func TestReadAppliesDocumentLimit(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testIndex().WriteTo(&buf, ""); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Read(&buf, "", Options{MaxDocuments: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hitIDs(loaded.Search("", SearchOptions{})); !slices.Equal(got, []string{"5", "4"}) {
+		t.Errorf("kept %v, want the two newest", got)
+	}
+}
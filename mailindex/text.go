@@ -0,0 +1,187 @@
+package mailindex
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// token is a normalized word with its byte offsets in the original text.
+type token struct {
+	term       string
+	start, end int
+}
+
+// tokenize splits text into words of letters and digits. Terms are
+// lowercased and stripped of diacritics, so that "Café" matches "cafe".
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			tokens = appendToken(tokens, text, start, i)
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = appendToken(tokens, text, start, len(text))
+	}
+	return tokens
+}
+
+func appendToken(tokens []token, text string, start, end int) []token {
+	if term := normalize(text[start:end]); term != "" {
+		tokens = append(tokens, token{term: term, start: start, end: end})
+	}
+	return tokens
+}
+
+// normalize lowercases a word and removes combining marks.
+func normalize(word string) string {
+	word = norm.NFD.String(strings.ToLower(word))
+	return strings.Map(func(r rune) rune {
+		if unicode.Is(unicode.Mn, r) {
+			return -1
+		}
+		return r
+	}, word)
+}
+
+// terms returns the normalized terms of text.
+func terms(text string) []string {
+	tokens := tokenize(text)
+	result := make([]string, len(tokens))
+	for i, t := range tokens {
+		result[i] = t.term
+	}
+	return result
+}
+
+// withinDistance reports whether the Levenshtein distance between a and b
+// is at most max.
+func withinDistance(a, b string, max int) bool {
+	ra, rb := []rune(a), []rune(b)
+	if abs(len(ra)-len(rb)) > max {
+		return false
+	}
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		best := curr[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			best = min(best, curr[j])
+		}
+		if best > max {
+			return false
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)] <= max
+}
+
+// fuzziness is the edit distance allowed for a fuzzy term without an
+// explicit one: none for short words, where it would match too much.
+func fuzziness(term string) int {
+	switch n := utf8.RuneCountInString(term); {
+	case n <= 3:
+		return 0
+	case n <= 7:
+		return 1
+	default:
+		return 2
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// snippet returns the part of text, about width words long, with the most
+// distinct matched terms, which are marked with ** as in Markdown.
+func snippet(text string, matched map[string]bool, width int) string {
+	tokens := tokenize(text)
+	if len(tokens) == 0 {
+		return ""
+	}
+
+	best, bestScore := 0, -1
+	for i := range tokens {
+		if !matched[tokens[i].term] && i != 0 {
+			continue
+		}
+		seen := make(map[string]bool)
+		for _, t := range tokens[i:min(i+width, len(tokens))] {
+			if matched[t.term] {
+				seen[t.term] = true
+			}
+		}
+		if len(seen) > bestScore {
+			best, bestScore = i, len(seen)
+		}
+	}
+
+	// Start a few words before the first match for context.
+	from := max(best-3, 0)
+	to := min(from+width, len(tokens))
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+	pos := tokens[from].start
+	for _, t := range tokens[from:to] {
+		b.WriteString(collapseSpace(text[pos:t.start]))
+		if matched[t.term] {
+			b.WriteString("**" + text[t.start:t.end] + "**")
+		} else {
+			b.WriteString(text[t.start:t.end])
+		}
+		pos = t.end
+	}
+	if to < len(tokens) {
+		b.WriteString("…")
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// collapseSpace turns runs of whitespace into single spaces.
+func collapseSpace(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		if unicode.IsSpace(r) {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
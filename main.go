@@ -1,15 +1,18 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"slices"
 	"strings"
 
 	"github.com/joho/godotenv"
 	"github.com/mark3labs/mcp-go/server"
 	"github.com/nguyenvanduocit/google-kit/tools"
+	"github.com/nguyenvanduocit/google-kit/util"
 )
 
 func main() {
@@ -19,6 +22,22 @@ func main() {
 	if err := godotenv.Load(*envFile); err != nil {
 		fmt.Printf("Warning: Error loading env file %s: %v\n", *envFile, err)
 	}
+
+	// Subcommands run once and exit instead of serving.
+	subcommands := map[string]func(context.Context, []string) error{
+		"index":  tools.RunGmailIndexCommand,
+		"import": tools.RunGmailImportCommand,
+	}
+	if run, ok := subcommands[flag.Arg(0)]; ok {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		err := run(ctx, flag.Args()[1:])
+		stop()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 	mcpServer := server.NewMCPServer(
 		"Fetch Kit",
 		"1.0.0",
@@ -34,19 +53,28 @@ func main() {
 		return allToolsEnabled || slices.Contains(enableTools, toolName)
 	}
 
+	stdioServer := util.NewStdioServer(mcpServer)
+	watcher := tools.NewWatcher(stdioServer)
+	stdioServer.SetSubscriptionHandler(watcher)
+
 	if isEnabled("calendar") {
 		tools.RegisterCalendarTools(mcpServer)
+		tools.RegisterCalendarResources(mcpServer, watcher)
 	}
 
 	if isEnabled("gmail") {
 		tools.RegisterGmailTools(mcpServer)
+		tools.RegisterGmailResources(mcpServer, watcher)
 	}
 
 	if isEnabled("gchat") {
 		tools.RegisterGChatTool(mcpServer)
+		tools.RegisterGChatResources(mcpServer, watcher)
 	}
 
-	if err := server.ServeStdio(mcpServer); err != nil {
+	go watcher.Run(context.Background())
+
+	if err := stdioServer.ServeStdio(); err != nil {
 		panic(fmt.Sprintf("Server error: %v", err))
 	}
 }
@@ -30,8 +30,9 @@ func RegisterCalendarTools(s *server.MCPServer) {
 		mcp.WithString("attendees", mcp.Description("Comma-separated list of attendee email addresses")),
 		mcp.WithString("time_min", mcp.Description("Start time for search in RFC3339 format (list action, default: now)")),
 		mcp.WithString("time_max", mcp.Description("End time for search in RFC3339 format (list action, default: 1 week from now)")),
-		mcp.WithNumber("max_results", mcp.Description("Maximum number of events to return (list action, default: 10)")),
+		mcp.WithNumber("max_results", mcp.Description("Deprecated alias of page_size (list action)")),
 		mcp.WithString("response", mcp.Description("Your response: accepted, declined, or tentative (respond action)")),
+		util.WithPagination(10),
 	)
 	s.AddTool(eventTool, util.ErrorGuard(calendarEventHandler))
 
@@ -154,26 +155,38 @@ func calendarListEventsHandler(arguments map[string]interface{}) (*mcp.CallToolR
 		timeMaxStr = time.Now().AddDate(0, 0, 7).Format(time.RFC3339) // 1 week from now
 	}
 
-	maxResults, ok := arguments["max_results"].(float64)
-	if !ok {
-		maxResults = 10
+	page := util.PageFromArguments(arguments, 10, 2500)
+	// max_results predates page_size and still sets the page size when
+	// page_size is not given.
+	if maxResults, ok := arguments["max_results"].(float64); ok && maxResults > 0 && arguments["page_size"] == nil {
+		page.Size = min(int64(maxResults), 2500)
 	}
 
-	events, err := calendarService().Events.List("primary").
-		ShowDeleted(false).
-		SingleEvents(true).
-		TimeMin(timeMinStr).
-		TimeMax(timeMaxStr).
-		MaxResults(int64(maxResults)).
-		OrderBy("startTime").
-		Do()
+	events, nextPageToken, err := util.Paginate(page, func(pageToken string, pageSize int64) ([]*calendar.Event, string, error) {
+		listCall := calendarService().Events.List("primary").
+			ShowDeleted(false).
+			SingleEvents(true).
+			TimeMin(timeMinStr).
+			TimeMax(timeMaxStr).
+			MaxResults(pageSize).
+			OrderBy("startTime")
+		if pageToken != "" {
+			listCall = listCall.PageToken(pageToken)
+		}
+
+		resp, err := listCall.Do()
+		if err != nil {
+			return nil, "", err
+		}
+		return resp.Items, resp.NextPageToken, nil
+	})
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to list events: %v", err)), nil
 	}
 
 	eventsList := make([]map[string]interface{}, 0)
 
-	for _, item := range events.Items {
+	for _, item := range events {
 		start, _ := time.Parse(time.RFC3339, item.Start.DateTime)
 		end, _ := time.Parse(time.RFC3339, item.End.DateTime)
 
@@ -192,8 +205,9 @@ func calendarListEventsHandler(arguments map[string]interface{}) (*mcp.CallToolR
 	}
 
 	result := map[string]interface{}{
-		"count":  len(events.Items),
-		"events": eventsList,
+		"count":           len(events),
+		"events":          eventsList,
+		"next_page_token": nextPageToken,
 	}
 
 	yamlResult, err := yaml.Marshal(result)
@@ -306,6 +320,8 @@ func calendarFindTimeSlotHandler(arguments map[string]interface{}) (*mcp.CallToo
 		return mcp.NewToolResultError("Invalid end_date format"), nil
 	}
 
+	request := util.RequestFromArguments(arguments)
+
 	// Get all calendars to check (primary + guests)
 	calendarsToCheck := []string{"primary"}
 	if guestsStr != "" {
@@ -317,8 +333,14 @@ func calendarFindTimeSlotHandler(arguments map[string]interface{}) (*mcp.CallToo
 	// Collect all busy times with details
 	allBusyTimes := make([]timeSlot, 0)
 	busyDetails := make([]busyTime, 0)
+	calendarsChecked := 0
 	
-	for _, calendarId := range calendarsToCheck {
+	for i, calendarId := range calendarsToCheck {
+		if request.Cancelled() {
+			break
+		}
+		request.Progress(i, len(calendarsToCheck), fmt.Sprintf("Checking calendar %s", calendarId))
+
 		// Always use event listing to get details
 		events, err := calendarService().Events.List(calendarId).
 			ShowDeleted(false).
@@ -326,8 +348,13 @@ func calendarFindTimeSlotHandler(arguments map[string]interface{}) (*mcp.CallToo
 			TimeMin(startDate.Format(time.RFC3339)).
 			TimeMax(endDate.Format(time.RFC3339)).
 			OrderBy("startTime").
+			Context(request.Context()).
 			Do()
 		
+		if request.Cancelled() {
+			break
+		}
+		calendarsChecked++
 		if err != nil {
 			continue // Skip this calendar if we can't access it
 		}
@@ -382,6 +409,14 @@ func calendarFindTimeSlotHandler(arguments map[string]interface{}) (*mcp.CallToo
 		"busy_times": make([]map[string]string, 0),
 	}
 
+	if request.Cancelled() {
+		// Slots are based only on the calendars checked before cancellation.
+		result["partial"] = true
+		result["calendars_checked"] = calendarsToCheck[:calendarsChecked]
+	} else {
+		request.Progress(len(calendarsToCheck), len(calendarsToCheck), "Done")
+	}
+
 	if guestsStr != "" {
 		result["guests_checked"] = guestsStr
 	}
@@ -0,0 +1,114 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/nguyenvanduocit/google-kit/services"
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/chat/v1"
+	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/option"
+	"gopkg.in/yaml.v3"
+)
+
+// fakeGoogle serves handler and points the Gmail, Calendar and Chat
+// services at it until the test ends. API paths are relative to the
+// services' base paths, e.g. /gmail/v1/users/me/messages, /calendars/primary/events
+// and /v1/spaces.
+func fakeGoogle(tb testing.TB, handler http.Handler) *httptest.Server {
+	tb.Helper()
+
+	server := httptest.NewServer(handler)
+	tb.Cleanup(server.Close)
+
+	ctx := context.Background()
+	opts := []option.ClientOption{option.WithEndpoint(server.URL + "/"), option.WithHTTPClient(server.Client())}
+
+	gmailSrv, err := gmail.NewService(ctx, opts...)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	calendarSrv, err := calendar.NewService(ctx, opts...)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	chatSrv, err := chat.NewService(ctx, opts...)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	oldGmail, oldCalendar, oldChat := gmailService, calendarService, services.DefaultGChatService
+	gmailService = func() *gmail.Service { return gmailSrv }
+	calendarService = func() *calendar.Service { return calendarSrv }
+	services.DefaultGChatService = func() *chat.Service { return chatSrv }
+	tb.Cleanup(func() {
+		gmailService, calendarService, services.DefaultGChatService = oldGmail, oldCalendar, oldChat
+	})
+
+	return server
+}
+
+// fakePage returns the range of a listing of total items that a request
+// asks for. Its page token is the offset of the first item and sizeParam
+// names the query parameter holding the page size. next is empty on the
+// last page.
+func fakePage(r *http.Request, sizeParam string, total int) (start, end int, next string) {
+	start, _ = strconv.Atoi(r.URL.Query().Get("pageToken"))
+	size, err := strconv.Atoi(r.URL.Query().Get(sizeParam))
+	if err != nil || size <= 0 {
+		size = 100
+	}
+	end = min(start+size, total)
+	if end < total {
+		next = strconv.Itoa(end)
+	}
+	return start, end, next
+}
+
+// writeJSON writes v as the JSON response.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// resultYAML decodes the YAML text of a successful tool result.
+func resultYAML(tb testing.TB, result *mcp.CallToolResult, err error) map[string]interface{} {
+	tb.Helper()
+
+	text := resultText(tb, result, err)
+	if result.IsError {
+		tb.Fatalf("tool returned an error: %s", text)
+	}
+
+	var decoded map[string]interface{}
+	if err := yaml.Unmarshal([]byte(text), &decoded); err != nil {
+		tb.Fatalf("result is not YAML: %v\n%s", err, text)
+	}
+	return decoded
+}
+
+// resultText returns the text of a tool result.
+func resultText(tb testing.TB, result *mcp.CallToolResult, err error) string {
+	tb.Helper()
+
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if len(result.Content) == 0 {
+		tb.Fatal("empty tool result")
+	}
+	switch content := result.Content[0].(type) {
+	case mcp.TextContent:
+		return content.Text
+	case *mcp.TextContent:
+		return content.Text
+	}
+	tb.Fatalf("unexpected content %T", result.Content[0])
+	return ""
+}
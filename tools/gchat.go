@@ -1,8 +1,10 @@
 package tools
 
 import (
+	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
@@ -16,6 +18,7 @@ func RegisterGChatTool(s *server.MCPServer) {
 	// List spaces tool
 	listSpacesTool := mcp.NewTool("gchat_list_spaces",
 		mcp.WithDescription("List all available Google Chat spaces/rooms"),
+		util.WithPagination(100),
 	)
 
 	// Send message tool
@@ -29,15 +32,15 @@ func RegisterGChatTool(s *server.MCPServer) {
 
 	// List users tool (simplified)
 	listUsersTool := mcp.NewTool("gchat_list_users",
-		mcp.WithDescription("List all Google Chat users from all spaces in the organization"),
+		mcp.WithDescription("List all Google Chat users from all spaces in the organization, with their space memberships"),
+		mcp.WithBoolean("refresh", mcp.Description("Rebuild the cached user directory instead of using it (default: false)")),
 	)
 
 	// List messages tool (renamed from Get messages tool)
 	listMessagesTool := mcp.NewTool("gchat_list_messages",
 		mcp.WithDescription("Get messages from a Google Chat space"),
 		mcp.WithString("space_name", mcp.Required(), mcp.Description("Name of the space to get messages from (e.g. spaces/1234567890)")),
-		mcp.WithNumber("page_size", mcp.Description("Maximum number of messages to return (default: 100)")),
-		mcp.WithString("page_token", mcp.Description("Page token for pagination")),
+		util.WithPagination(100),
 	)
 
 	// Create chat thread tool
@@ -64,6 +67,15 @@ func RegisterGChatTool(s *server.MCPServer) {
 	// List all organization users tool (simplified)
 	listAllUsersTool := mcp.NewTool("gchat_list_all_users",
 		mcp.WithDescription("List all unique users and their email addresses across all Google Chat spaces"),
+		mcp.WithBoolean("refresh", mcp.Description("Rebuild the cached user directory instead of using it (default: false)")),
+	)
+
+	// Look up users in the cached directory
+	lookupUserTool := mcp.NewTool("gchat_lookup_user",
+		mcp.WithDescription("Find Google Chat users by display name or email in the cached user directory"),
+		mcp.WithString("query", mcp.Required(), mcp.Description("Part of the user's display name or email address (case-insensitive)")),
+		mcp.WithNumber("limit", mcp.Description("Maximum number of users to return (default: 20)")),
+		mcp.WithBoolean("refresh", mcp.Description("Rebuild the cached user directory before searching (default: false)")),
 	)
 
 	// Get thread messages tool
@@ -71,8 +83,7 @@ func RegisterGChatTool(s *server.MCPServer) {
 		mcp.WithDescription("Get messages from a specific Google Chat thread"),
 		mcp.WithString("space_name", mcp.Required(), mcp.Description("Name of the space containing the thread (e.g. spaces/1234567890)")),
 		mcp.WithString("thread_name", mcp.Required(), mcp.Description("Name of the thread to get messages from (e.g. spaces/1234567890/threads/abcdef)")),
-		mcp.WithNumber("page_size", mcp.Description("Maximum number of messages to return (default: 100)")),
-		mcp.WithString("page_token", mcp.Description("Page token for pagination")),
+		util.WithPagination(100),
 	)
 
 	s.AddTool(listSpacesTool, util.ErrorGuard(gChatListSpacesHandler))
@@ -84,22 +95,31 @@ func RegisterGChatTool(s *server.MCPServer) {
 	s.AddTool(archiveChatThreadTool, util.ErrorGuard(gChatArchiveThreadHandler))
 	s.AddTool(deleteChatThreadTool, util.ErrorGuard(gChatDeleteThreadHandler))
 	s.AddTool(listAllUsersTool, util.ErrorGuard(gChatListAllUsersHandler))
+	s.AddTool(lookupUserTool, util.ErrorGuard(gChatLookupUserHandler))
 }
 
 func gChatListSpacesHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
-	spaces, err := services.DefaultGChatService().Spaces.List().Do()
+	page := util.PageFromArguments(arguments, 100, 1000)
+
+	spaces, nextPageToken, err := listGChatSpaces(util.RequestFromArguments(arguments).Context(), page)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to list spaces: %v", err)), nil
 	}
 
-	result := make([]map[string]interface{}, 0)
-	for _, space := range spaces.Spaces {
+	spacesList := make([]map[string]interface{}, 0)
+	for _, space := range spaces {
 		spaceInfo := map[string]interface{}{
 			"name":        space.Name,
 			"displayName": space.DisplayName,
 			"type":        space.Type,
 		}
-		result = append(result, spaceInfo)
+		spacesList = append(spacesList, spaceInfo)
+	}
+
+	result := map[string]interface{}{
+		"count":           len(spacesList),
+		"spaces":          spacesList,
+		"next_page_token": nextPageToken,
 	}
 
 	yamlResult, err := yaml.Marshal(result)
@@ -138,57 +158,21 @@ func gChatSendMessageHandler(arguments map[string]interface{}) (*mcp.CallToolRes
 }
 
 func gChatListUsersHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
-	// Get all spaces
-	spaces, err := services.DefaultGChatService().Spaces.List().Do()
-	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("failed to list spaces: %v", err)), nil
-	}
+	refresh, _ := arguments["refresh"].(bool)
+	request := util.RequestFromArguments(arguments)
 
-	// Collect all users from all spaces with deduplication
-	userEmails := make(map[string]map[string]interface{})
-	
-	for _, space := range spaces.Spaces {
-		spaceUsers, err := getAllUsersFromSpace(space.Name, space.DisplayName)
-		if err != nil {
-			// Continue with other spaces if one fails
-			continue
-		}
-		
-		for _, user := range spaceUsers {
-			if userEmail, ok := user["email"].(string); ok && userEmail != "" {
-				if existingUser, exists := userEmails[userEmail]; exists {
-					// Add this space to existing user's spaces list
-					if existingSpaces, ok := existingUser["spaces"].([]string); ok {
-						existingUser["spaces"] = append(existingSpaces, space.Name)
-					} else {
-						existingUser["spaces"] = []string{space.Name}
-					}
-					if existingSpaceNames, ok := existingUser["spaceNames"].([]string); ok {
-						existingUser["spaceNames"] = append(existingSpaceNames, space.DisplayName)
-					} else {
-						existingUser["spaceNames"] = []string{space.DisplayName}
-					}
-				} else {
-					user["spaces"] = []string{space.Name}
-					user["spaceNames"] = []string{space.DisplayName}
-					userEmails[userEmail] = user
-				}
-			}
-		}
-	}
-	
-	// Convert to slice
-	var allUsers []map[string]interface{}
-	for _, user := range userEmails {
-		user["spaceCount"] = len(user["spaces"].([]string))
-		allUsers = append(allUsers, user)
+	directory, partial, err := loadChatDirectory(request, refresh)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
 	}
 
 	result := map[string]interface{}{
-		"users":       allUsers,
-		"totalUsers":  len(allUsers),
-		"totalSpaces": len(spaces.Spaces),
+		"users":       directory.Users,
+		"totalUsers":  len(directory.Users),
+		"totalSpaces": directory.TotalSpaces,
+		"updatedAt":   directory.UpdatedAt.Format(time.RFC3339),
 	}
+	addChatDirectoryFlags(result, directory, partial)
 
 	yamlResult, err := yaml.Marshal(result)
 	if err != nil {
@@ -198,95 +182,89 @@ func gChatListUsersHandler(arguments map[string]interface{}) (*mcp.CallToolResul
 	return mcp.NewToolResultText(string(yamlResult)), nil
 }
 
-// Simple helper to get all users from a space
-func getAllUsersFromSpace(spaceName, spaceDisplayName string) ([]map[string]interface{}, error) {
-	var allUsers []map[string]interface{}
-	pageToken := ""
-	
-	for {
-		// Get members with pagination
-		listCall := services.DefaultGChatService().Spaces.Members.List(spaceName).
-			PageSize(1000).
-			ShowGroups(true).
-			UseAdminAccess(true)
-		
-		if pageToken != "" {
-			listCall = listCall.PageToken(pageToken)
-		}
+func gChatListAllUsersHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	refresh, _ := arguments["refresh"].(bool)
+	request := util.RequestFromArguments(arguments)
 
-		members, err := listCall.Do()
-		if err != nil {
-			return nil, err
-		}
+	directory, partial, err := loadChatDirectory(request, refresh)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
 
-		// Process all members
-		for _, member := range members.Memberships {
-			if member.Member != nil {
-				userInfo := map[string]interface{}{
-					"name":        member.Member.Name,
-					"displayName": member.Member.DisplayName,
-					"type":        member.Member.Type,
-					"role":        member.Role,
-				}
-				
-				// Extract email from user name
-				if strings.HasPrefix(member.Member.Name, "users/") {
-					userPart := strings.TrimPrefix(member.Member.Name, "users/")
-					if strings.Contains(userPart, "@") {
-						userInfo["email"] = userPart
-					}
-				}
-				
-				allUsers = append(allUsers, userInfo)
-			}
-		}
-		
-		// Check if there are more pages
-		if members.NextPageToken == "" {
-			break
-		}
-		pageToken = members.NextPageToken
+	// Compact listing: one line of identity per user, without memberships.
+	users := make([]map[string]string, 0, len(directory.Users))
+	for _, user := range directory.Users {
+		users = append(users, map[string]string{
+			"name":        user.Name,
+			"displayName": user.DisplayName,
+			"email":       user.Email,
+		})
 	}
 
-	return allUsers, nil
-}
+	result := map[string]interface{}{
+		"users":      users,
+		"totalUsers": len(users),
+		"updatedAt":  directory.UpdatedAt.Format(time.RFC3339),
+	}
+	addChatDirectoryFlags(result, directory, partial)
 
-func gChatListAllUsersHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
-	// This is identical to gChatListUsersHandler now - just get all users
-	return gChatListUsersHandler(arguments)
+	yamlResult, err := yaml.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to marshal users: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(yamlResult)), nil
 }
 
-func gChatListMessagesHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
-	spaceName := arguments["space_name"].(string)
+func gChatLookupUserHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	query, _ := arguments["query"].(string)
+	if strings.TrimSpace(query) == "" {
+		return mcp.NewToolResultError("query is required"), nil
+	}
 
-	// Handle optional parameters
-	pageSize, ok := arguments["page_size"].(float64)
-	if !ok {
-		pageSize = 100
+	refresh, _ := arguments["refresh"].(bool)
+	limit, ok := arguments["limit"].(float64)
+	if !ok || limit <= 0 {
+		limit = 20
 	}
 
-	pageToken, _ := arguments["page_token"].(string)
+	directory, partial, err := loadChatDirectory(util.RequestFromArguments(arguments), refresh)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
 
-	// Create the list messages request
-	listCall := services.DefaultGChatService().Spaces.Messages.List(spaceName).
-		OrderBy("createTime desc").
-		PageSize(int64(pageSize))
+	matches := findChatUsers(directory, query, int(limit))
 
-	if pageToken != "" {
-		listCall = listCall.PageToken(pageToken)
+	result := map[string]interface{}{
+		"query":     query,
+		"users":     matches,
+		"count":     len(matches),
+		"updatedAt": directory.UpdatedAt.Format(time.RFC3339),
 	}
+	addChatDirectoryFlags(result, directory, partial)
 
-	// Execute the request
-	messages, err := listCall.Do()
+	yamlResult, err := yaml.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to marshal users: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(yamlResult)), nil
+}
+
+func gChatListMessagesHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	spaceName := arguments["space_name"].(string)
+	page := util.PageFromArguments(arguments, 100, 1000)
+
+	messages, nextPageToken, err := listGChatMessages(spaceName, "", page)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to get messages: %v", err)), nil
 	}
 
 	result := map[string]interface{}{
-		"messages":      make([]map[string]interface{}, 0),
-		"nextPageToken": messages.NextPageToken,
+		"messages":        make([]map[string]interface{}, 0),
+		"next_page_token": nextPageToken,
 	}
-	for _, msg := range messages.Messages {
+	for _, msg := range messages {
 
 		messageInfo := map[string]interface{}{
 			"name":       msg.Name,
@@ -322,6 +300,44 @@ func gChatListMessagesHandler(arguments map[string]interface{}) (*mcp.CallToolRe
 	return mcp.NewToolResultText(string(yamlResult)), nil
 }
 
+// listGChatSpaces lists the spaces the user is a member of.
+func listGChatSpaces(ctx context.Context, page util.Page) ([]*chat.Space, string, error) {
+	return util.Paginate(page, func(pageToken string, pageSize int64) ([]*chat.Space, string, error) {
+		listCall := services.DefaultGChatService().Spaces.List().PageSize(pageSize).Context(ctx)
+		if pageToken != "" {
+			listCall = listCall.PageToken(pageToken)
+		}
+
+		resp, err := listCall.Do()
+		if err != nil {
+			return nil, "", err
+		}
+		return resp.Spaces, resp.NextPageToken, nil
+	})
+}
+
+// listGChatMessages lists messages of a space, newest first, optionally
+// narrowed by a list filter.
+func listGChatMessages(spaceName, filter string, page util.Page) ([]*chat.Message, string, error) {
+	return util.Paginate(page, func(pageToken string, pageSize int64) ([]*chat.Message, string, error) {
+		listCall := services.DefaultGChatService().Spaces.Messages.List(spaceName).
+			OrderBy("createTime desc").
+			PageSize(pageSize)
+		if filter != "" {
+			listCall = listCall.Filter(filter)
+		}
+		if pageToken != "" {
+			listCall = listCall.PageToken(pageToken)
+		}
+
+		resp, err := listCall.Do()
+		if err != nil {
+			return nil, "", err
+		}
+		return resp.Messages, resp.NextPageToken, nil
+	})
+}
+
 func gChatCreateThreadHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
 	displayName := arguments["display_name"].(string)
 	userEmails := arguments["user_emails"].(string)
@@ -455,38 +471,20 @@ func gChatArchiveThreadHandler(arguments map[string]interface{}) (*mcp.CallToolR
 func gChatGetThreadMessagesHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
 	spaceName := arguments["space_name"].(string)
 	threadName := arguments["thread_name"].(string)
+	page := util.PageFromArguments(arguments, 100, 1000)
 
-	// Handle optional parameters
-	pageSize, ok := arguments["page_size"].(float64)
-	if !ok {
-		pageSize = 100
-	}
-
-	pageToken, _ := arguments["page_token"].(string)
-
-	// Create the list messages request with thread filter
-	listCall := services.DefaultGChatService().Spaces.Messages.List(spaceName).
-		OrderBy("createTime desc").
-		PageSize(int64(pageSize)).
-		Filter(fmt.Sprintf("thread.name = %s", threadName))
-
-	if pageToken != "" {
-		listCall = listCall.PageToken(pageToken)
-	}
-
-	// Execute the request
-	messages, err := listCall.Do()
+	messages, nextPageToken, err := listGChatMessages(spaceName, fmt.Sprintf("thread.name = %s", threadName), page)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to get thread messages: %v", err)), nil
 	}
 
 	result := map[string]interface{}{
-		"messages":      make([]map[string]interface{}, 0),
-		"nextPageToken": messages.NextPageToken,
-		"threadName":    threadName,
+		"messages":        make([]map[string]interface{}, 0),
+		"next_page_token": nextPageToken,
+		"threadName":      threadName,
 	}
 	
-	for _, msg := range messages.Messages {
+	for _, msg := range messages {
 		messageInfo := map[string]interface{}{
 			"name":       msg.Name,
 			"sender":     msg.Sender,
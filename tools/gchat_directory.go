@@ -0,0 +1,284 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nguyenvanduocit/google-kit/services"
+	"github.com/nguyenvanduocit/google-kit/util"
+	"google.golang.org/api/chat/v1"
+)
+
+const gchatDirectoryState = "gchat-directory.json"
+
+// chatDirectoryUser is a Chat user seen as a member of one or more spaces.
+type chatDirectoryUser struct {
+	Name        string   `json:"name" yaml:"name"`
+	DisplayName string   `json:"displayName,omitempty" yaml:"displayName,omitempty"`
+	Email       string   `json:"email,omitempty" yaml:"email,omitempty"`
+	Type        string   `json:"type,omitempty" yaml:"type,omitempty"`
+	Role        string   `json:"role,omitempty" yaml:"role,omitempty"`
+	Spaces      []string `json:"spaces" yaml:"spaces"`
+	SpaceNames  []string `json:"spaceNames" yaml:"spaceNames"`
+}
+
+// chatDirectory is the user directory built from the members of every space
+// and cached on disk.
+type chatDirectory struct {
+	UpdatedAt    time.Time `json:"updatedAt"`
+	TotalSpaces  int       `json:"totalSpaces"`
+	FailedSpaces []string  `json:"failedSpaces,omitempty"`
+	// Truncated is set when there were more spaces than listing them
+	// returns, so the members of some spaces are missing.
+	Truncated bool                 `json:"truncated,omitempty"`
+	Users     []*chatDirectoryUser `json:"users"`
+}
+
+var (
+	chatDirectoryMu     sync.Mutex
+	cachedChatDirectory *chatDirectory
+)
+
+// chatDirectoryTTL is how long the cached directory is served before it is
+// rebuilt, configurable with GCHAT_USER_CACHE_TTL (default 24h).
+func chatDirectoryTTL() time.Duration {
+	return durationFromEnv("GCHAT_USER_CACHE_TTL", 24*time.Hour)
+}
+
+// chatDirectoryRetryTTL is how long a directory missing the members of
+// some spaces is served, from memory only, before it is rebuilt.
+const chatDirectoryRetryTTL = 5 * time.Minute
+
+// chatMemberParallelism is the number of spaces whose members are listed
+// concurrently, configurable with GCHAT_MEMBER_PARALLELISM (default 4).
+func chatMemberParallelism() int {
+	if n, err := strconv.Atoi(os.Getenv("GCHAT_MEMBER_PARALLELISM")); err == nil && n > 0 {
+		return n
+	}
+	return 4
+}
+
+// loadChatDirectory returns the user directory, from memory or disk when it
+// is fresh, or rebuilt from the Chat API when refresh is set or it expired.
+// The boolean result reports a partial directory from a cancelled rebuild.
+// A directory missing the members of some spaces is not saved and is kept
+// for chatDirectoryRetryTTL only; one where every space failed is not kept,
+// so the next call rebuilds it.
+func loadChatDirectory(request *util.Request, refresh bool) (*chatDirectory, bool, error) {
+	chatDirectoryMu.Lock()
+	defer chatDirectoryMu.Unlock()
+
+	if !refresh {
+		if cachedChatDirectory == nil {
+			var stored chatDirectory
+			if err := util.LoadState(gchatDirectoryState, &stored); err != nil {
+				log.Printf("Failed to load Chat user directory: %v", err)
+			} else if !stored.UpdatedAt.IsZero() {
+				cachedChatDirectory = &stored
+			}
+		}
+
+		if cachedChatDirectory != nil && time.Since(cachedChatDirectory.UpdatedAt) < cachedChatDirectory.ttl() {
+			return cachedChatDirectory, false, nil
+		}
+	}
+
+	directory, err := buildChatDirectory(request)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if request.Cancelled() {
+		return directory, true, nil
+	}
+
+	switch {
+	case len(directory.FailedSpaces) == 0:
+		cachedChatDirectory = directory
+		if err := util.SaveState(gchatDirectoryState, directory); err != nil {
+			log.Printf("Failed to save Chat user directory: %v", err)
+		}
+	case len(directory.FailedSpaces) < directory.TotalSpaces:
+		cachedChatDirectory = directory
+	}
+
+	return directory, false, nil
+}
+
+// ttl returns how long the directory is served.
+func (d *chatDirectory) ttl() time.Duration {
+	if len(d.FailedSpaces) > 0 {
+		return min(chatDirectoryTTL(), chatDirectoryRetryTTL)
+	}
+	return chatDirectoryTTL()
+}
+
+// buildChatDirectory lists the members of every space, several spaces at a
+// time, and merges them into one entry per user.
+func buildChatDirectory(request *util.Request) (*chatDirectory, error) {
+	ctx := request.Context()
+
+	spaces, nextPageToken, err := listGChatSpaces(ctx, util.Page{Size: 1000, FetchAll: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list spaces: %v", err)
+	}
+
+	members := make([][]*chatDirectoryUser, len(spaces))
+	errs := make([]error, len(spaces))
+
+	var (
+		wg   sync.WaitGroup
+		done atomic.Int64
+		sem  = make(chan struct{}, chatMemberParallelism())
+	)
+
+	for i, space := range spaces {
+		select {
+		case <-ctx.Done():
+			errs[i] = ctx.Err()
+			continue
+		case sem <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(i int, space *chat.Space) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			members[i], errs[i] = getAllUsersFromSpace(ctx, space.Name)
+			request.Progress(int(done.Add(1)), len(spaces), fmt.Sprintf("Listed members of %s", space.DisplayName))
+		}(i, space)
+	}
+
+	wg.Wait()
+
+	directory := &chatDirectory{
+		UpdatedAt:   time.Now(),
+		TotalSpaces: len(spaces),
+		Truncated:   nextPageToken != "",
+	}
+
+	// Merge in space order so the directory does not depend on which
+	// goroutine finished first.
+	byKey := make(map[string]*chatDirectoryUser)
+	for i, space := range spaces {
+		if errs[i] != nil {
+			directory.FailedSpaces = append(directory.FailedSpaces, space.Name)
+			continue
+		}
+
+		for _, member := range members[i] {
+			key := member.Email
+			if key == "" {
+				key = member.Name
+			}
+
+			user, exists := byKey[key]
+			if !exists {
+				user = member
+				byKey[key] = user
+				directory.Users = append(directory.Users, user)
+			}
+			user.Spaces = append(user.Spaces, space.Name)
+			user.SpaceNames = append(user.SpaceNames, space.DisplayName)
+		}
+	}
+
+	sort.SliceStable(directory.Users, func(i, j int) bool {
+		return strings.ToLower(directory.Users[i].DisplayName) < strings.ToLower(directory.Users[j].DisplayName)
+	})
+
+	return directory, nil
+}
+
+// addChatDirectoryFlags adds to a directory result the flags telling that
+// the directory is incomplete.
+func addChatDirectoryFlags(result map[string]interface{}, directory *chatDirectory, partial bool) {
+	if len(directory.FailedSpaces) > 0 {
+		result["failedSpaces"] = directory.FailedSpaces
+	}
+	if directory.Truncated {
+		result["truncated"] = true
+		result["note"] = fmt.Sprintf("only the members of the first %d spaces are listed", directory.TotalSpaces)
+	}
+	if partial {
+		result["partial"] = true
+	}
+}
+
+// findChatUsers returns the users whose display name, email or user name
+// contains query, ignoring case.
+func findChatUsers(directory *chatDirectory, query string, limit int) []*chatDirectoryUser {
+	query = strings.ToLower(strings.TrimSpace(query))
+
+	matches := make([]*chatDirectoryUser, 0)
+	for _, user := range directory.Users {
+		if strings.Contains(strings.ToLower(user.DisplayName), query) ||
+			strings.Contains(strings.ToLower(user.Email), query) ||
+			strings.Contains(strings.ToLower(user.Name), query) {
+			matches = append(matches, user)
+			if limit > 0 && len(matches) >= limit {
+				break
+			}
+		}
+	}
+
+	return matches
+}
+
+// getAllUsersFromSpace lists every member of a space.
+func getAllUsersFromSpace(ctx context.Context, spaceName string) ([]*chatDirectoryUser, error) {
+	var allUsers []*chatDirectoryUser
+	pageToken := ""
+
+	for {
+		listCall := services.DefaultGChatService().Spaces.Members.List(spaceName).
+			PageSize(1000).
+			ShowGroups(true).
+			UseAdminAccess(true).
+			Context(ctx)
+		if pageToken != "" {
+			listCall = listCall.PageToken(pageToken)
+		}
+
+		members, err := listCall.Do()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, member := range members.Memberships {
+			if member.Member == nil {
+				continue
+			}
+
+			user := &chatDirectoryUser{
+				Name:        member.Member.Name,
+				DisplayName: member.Member.DisplayName,
+				Type:        member.Member.Type,
+				Role:        member.Role,
+			}
+
+			// Extract email from user name
+			if userPart := strings.TrimPrefix(member.Member.Name, "users/"); strings.Contains(userPart, "@") {
+				user.Email = userPart
+			}
+
+			allUsers = append(allUsers, user)
+		}
+
+		if members.NextPageToken == "" {
+			break
+		}
+		pageToken = members.NextPageToken
+	}
+
+	return allUsers, nil
+}
@@ -0,0 +1,100 @@
+package tools
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/nguyenvanduocit/google-kit/util"
+)
+
+func TestChatDirectoryWithFailedSpacesIsRebuilt(t *testing.T) {
+	t.Setenv("STATE_DIR", t.TempDir())
+	cachedChatDirectory = nil
+	t.Cleanup(func() { cachedChatDirectory = nil })
+
+	var (
+		listings atomic.Int64
+		failing  atomic.Value
+	)
+	failing.Store("spaces/1")
+
+	fakeGoogle(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v1/spaces":
+			listings.Add(1)
+			writeJSON(w, map[string]interface{}{"spaces": []map[string]string{
+				{"name": "spaces/1", "displayName": "One"},
+				{"name": "spaces/2", "displayName": "Two"},
+			}})
+		case strings.HasSuffix(r.URL.Path, "/members"):
+			space := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/"), "/members")
+			if failing.Load().(string) == "all" || failing.Load().(string) == space {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				writeJSON(w, map[string]interface{}{"error": map[string]interface{}{"code": 503, "message": "unavailable"}})
+				return
+			}
+			writeJSON(w, map[string]interface{}{"memberships": []map[string]interface{}{
+				{"member": map[string]string{"name": fmt.Sprintf("users/%s@example.com", strings.ReplaceAll(space, "/", "-")), "type": "HUMAN"}},
+			}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	request := util.RequestFromArguments(nil)
+
+	// Every space failing: nothing is kept, the next call rebuilds.
+	failing.Store("all")
+	directory, _, err := loadChatDirectory(request, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(directory.FailedSpaces) != 2 {
+		t.Fatalf("failed spaces = %v, want both", directory.FailedSpaces)
+	}
+	if _, _, err := loadChatDirectory(request, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := listings.Load(); got != 2 {
+		t.Fatalf("spaces listed %d times, want 2", got)
+	}
+
+	// One space failing: kept in memory for a short while, not saved.
+	failing.Store("spaces/1")
+	directory, _, err = loadChatDirectory(request, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(directory.FailedSpaces) != 1 || len(directory.Users) != 1 {
+		t.Fatalf("directory = %+v, want one failed space and one user", directory)
+	}
+	if directory.ttl() != chatDirectoryRetryTTL {
+		t.Errorf("ttl = %s, want %s", directory.ttl(), chatDirectoryRetryTTL)
+	}
+	var stored chatDirectory
+	if err := util.LoadState(gchatDirectoryState, &stored); err != nil {
+		t.Fatal(err)
+	}
+	if !stored.UpdatedAt.IsZero() {
+		t.Error("a directory with failed spaces was saved")
+	}
+
+	// Once every space succeeds the directory is saved for the full TTL.
+	failing.Store("")
+	directory, _, err = loadChatDirectory(request, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(directory.FailedSpaces) != 0 || len(directory.Users) != 2 {
+		t.Fatalf("directory = %+v, want two users", directory)
+	}
+	if err := util.LoadState(gchatDirectoryState, &stored); err != nil {
+		t.Fatal(err)
+	}
+	if len(stored.Users) != 2 {
+		t.Errorf("saved directory has %d users, want 2", len(stored.Users))
+	}
+}
@@ -8,10 +8,9 @@ import (
 	"strings"
 	"sync"
 
-	"encoding/base64"
-
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
+	"github.com/nguyenvanduocit/google-kit/email"
 	"github.com/nguyenvanduocit/google-kit/services"
 	"github.com/nguyenvanduocit/google-kit/util"
 	"google.golang.org/api/gmail/v1"
@@ -24,6 +23,7 @@ func RegisterGmailTools(s *server.MCPServer) {
     searchTool := mcp.NewTool("gmail_search",
         mcp.WithDescription("Search emails in Gmail using Gmail's search syntax"),
         mcp.WithString("query", mcp.Required(), mcp.Description("Gmail search query. Follow Gmail's search syntax")),
+        util.WithPagination(10),
     )
     s.AddTool(searchTool, util.ErrorGuard(gmailSearchHandler))
 
@@ -32,18 +32,166 @@ func RegisterGmailTools(s *server.MCPServer) {
         mcp.WithDescription("Read a specific email's full content including headers and body"),
         mcp.WithString("message_id", mcp.Required(), mcp.Description("ID of the email message to read")),
         mcp.WithBoolean("include_attachments", mcp.Description("Whether to include attachment information")),
+        mcp.WithString("body_format", mcp.Description("Format of the body: text (default; HTML-only mail is converted to Markdown), markdown (HTML converted to Markdown) or html")),
     )
     s.AddTool(readEmailTool, util.ErrorGuard(gmailReadEmailHandler))
 
+    // Mailbox changes tool
+    changesTool := mcp.NewTool("gmail_changes",
+        mcp.WithDescription("List what changed in the mailbox since the last call: messages added and deleted, and label changes. The position is remembered between calls and restarts"),
+        mcp.WithBoolean("peek", mcp.Description("Show the changes without moving the stored position, so the next call sees them again")),
+        mcp.WithBoolean("reset", mcp.Description("Forget the stored position and report changes from now on")),
+    )
+    s.AddTool(changesTool, util.ErrorGuard(gmailChangesHandler))
+
+    // Local index tools, only registered when the index is turned on
+    if gmailIndexEnabled() {
+        localSearchTool := mcp.NewTool("gmail_local_search",
+            mcp.WithDescription("Full-text search of the local mail index, which works offline. Results are ranked, with snippets and the number of hits per month. The index is brought up to date first, and built on first use"),
+            mcp.WithString("query", mcp.Description("Words that must all match. Supports \"exact phrases\", \"words near each other\"~N, prefixes such as invoic*, fuzzy words such as recieve~ or recieve~2 and -excluded words. Empty lists messages newest first")),
+            mcp.WithString("from", mcp.Description("Only messages whose sender contains this text")),
+            mcp.WithString("to", mcp.Description("Only messages whose recipients contain this text")),
+            mcp.WithString("label", mcp.Description("Only messages with all these labels (comma-separated names)")),
+            mcp.WithString("after", mcp.Description("Only messages from this date on (YYYY-MM-DD)")),
+            mcp.WithString("before", mcp.Description("Only messages before this date (YYYY-MM-DD)")),
+            mcp.WithBoolean("sync", mcp.Description("Bring the index up to date before searching (default: only when the last sync is older than GMAIL_INDEX_SYNC_INTERVAL)")),
+            util.WithPagination(20),
+        )
+        s.AddTool(localSearchTool, util.ErrorGuard(gmailLocalSearchHandler))
+
+        indexTool := mcp.NewTool("gmail_index",
+            mcp.WithDescription("Show the status of the local mail index, bring it up to date, or rebuild it from scratch"),
+            mcp.WithString("action", mcp.Required(), mcp.Description("Action: status, sync or rebuild")),
+        )
+        s.AddTool(indexTool, util.ErrorGuard(gmailIndexHandler))
+    }
+
+    // Read thread tool
+    readThreadTool := mcp.NewTool("gmail_read_thread",
+        mcp.WithDescription("Read a whole conversation: every message in order with quoted replies and signatures trimmed, and a summary of participants"),
+        mcp.WithString("thread_id", mcp.Required(), mcp.Description("ID of the thread to read")),
+        mcp.WithNumber("last_n", mcp.Description("Only show the last N messages; earlier ones are collapsed into a list of senders")),
+        mcp.WithBoolean("trim_quotes", mcp.Description("Trim quoted replies and signatures from each message (default: true)")),
+        mcp.WithString("body_format", mcp.Description("Format of the bodies: text (default) or markdown")),
+    )
+    s.AddTool(readThreadTool, util.ErrorGuard(gmailReadThreadHandler))
+
     // Reply to email tool
     replyEmailTool := mcp.NewTool("gmail_reply_email",
         mcp.WithDescription("Reply to a specific email"),
         mcp.WithString("message_id", mcp.Required(), mcp.Description("ID of the email message to reply to")),
         mcp.WithString("reply_text", mcp.Required(), mcp.Description("Text content of the reply")),
-        mcp.WithBoolean("reply_all", mcp.Description("Whether to reply to all recipients")),
+        mcp.WithString("html_body", mcp.Description("HTML content of the reply, sent alongside reply_text as multipart/alternative")),
+        mcp.WithBoolean("reply_all", mcp.Description("Whether to reply to all recipients, including Cc")),
+        mcp.WithString("cc", mcp.Description("Comma-separated Cc recipients, replacing the ones reply_all would add")),
+        mcp.WithString("bcc", mcp.Description("Comma-separated Bcc recipients")),
+        mcp.WithBoolean("quote_original", mcp.Description("Quote the original message below the reply")),
+        mcp.WithString("from", mcp.Description("Send-as alias to reply from (default: the account's default alias)")),
+        mcp.WithBoolean("append_signature", mcp.Description("Append the signature of the send-as alias")),
+        withGmailAttachments(),
     )
     s.AddTool(replyEmailTool, util.ErrorGuard(gmailReplyEmailHandler))
 
+    // Get attachment tool
+    getAttachmentTool := mcp.NewTool("gmail_get_attachment",
+        mcp.WithDescription("Get an email attachment: text is returned inline, binary files as an embedded resource, or the file is saved to the download directory"),
+        mcp.WithString("message_id", mcp.Required(), mcp.Description("ID of the email message")),
+        mcp.WithString("part_id", mcp.Description("Part ID of the attachment, as listed by gmail_read_email")),
+        mcp.WithString("attachment_id", mcp.Description("Attachment ID, as listed by gmail_read_email")),
+        mcp.WithString("filename", mcp.Description("File name of the attachment, used when no ID is given")),
+        mcp.WithBoolean("save", mcp.Description("Save the attachment to GMAIL_DOWNLOAD_DIR instead of returning it")),
+    )
+    s.AddTool(getAttachmentTool, util.ErrorGuard(gmailGetAttachmentHandler))
+
+    // Send email tool
+    sendEmailTool := mcp.NewTool("gmail_send_email",
+        mcp.WithDescription("Compose and send a new email"),
+        mcp.WithString("to", mcp.Required(), mcp.Description("Comma-separated recipients, e.g. \"Jane Doe <jane@example.com>, bob@example.com\"")),
+        mcp.WithString("cc", mcp.Description("Comma-separated Cc recipients")),
+        mcp.WithString("bcc", mcp.Description("Comma-separated Bcc recipients")),
+        mcp.WithString("subject", mcp.Required(), mcp.Description("Subject of the email")),
+        mcp.WithString("body", mcp.Description("Plain-text body. Derived from html_body when omitted")),
+        mcp.WithString("html_body", mcp.Description("HTML body, sent alongside the plain-text body as multipart/alternative")),
+        mcp.WithString("from", mcp.Description("Send-as alias to send from (default: the account's default alias)")),
+        mcp.WithBoolean("append_signature", mcp.Description("Append the signature of the send-as alias")),
+        withGmailAttachments(),
+    )
+    s.AddTool(sendEmailTool, util.ErrorGuard(gmailSendEmailHandler))
+
+    // Unified draft management tool
+    draftTool := mcp.NewTool("gmail_draft",
+        mcp.WithDescription("Manage Gmail drafts - create, list, get, update, send, or delete drafts"),
+        mcp.WithString("action", mcp.Required(), mcp.Description("Action to perform: create, list, get, update, send, delete")),
+        mcp.WithString("draft_id", mcp.Description("Draft ID (required for get, update, send and delete actions)")),
+        mcp.WithString("reply_to_message_id", mcp.Description("Message ID to reply to; threads the draft under it (create action)")),
+        mcp.WithString("to", mcp.Description("Comma-separated recipients (create and update actions)")),
+        mcp.WithString("cc", mcp.Description("Comma-separated Cc recipients (create and update actions)")),
+        mcp.WithString("bcc", mcp.Description("Comma-separated Bcc recipients (create and update actions)")),
+        mcp.WithString("subject", mcp.Description("Subject (create and update actions)")),
+        mcp.WithString("body", mcp.Description("Plain-text body (create and update actions)")),
+        mcp.WithString("html_body", mcp.Description("HTML body (create and update actions)")),
+        mcp.WithString("from", mcp.Description("Send-as alias to send from (create and update actions)")),
+        mcp.WithBoolean("append_signature", mcp.Description("Append the signature of the send-as alias (create and update actions)")),
+        withGmailAttachments(),
+        mcp.WithString("query", mcp.Description("Only list drafts matching this Gmail search query (list action)")),
+        util.WithPagination(20),
+    )
+    s.AddTool(draftTool, util.ErrorGuard(gmailDraftHandler))
+
+    // Modify messages tool
+    modifyTool := mcp.NewTool("gmail_modify",
+        mcp.WithDescription("Change the state of messages: archive, mark read/unread, star, trash, move out of spam, or add and remove labels. Targets messages by ID, whole threads by ID, or every message matching a search query"),
+        util.WithArray("message_ids", map[string]interface{}{"type": "string"}, mcp.Description("IDs of the messages to modify")),
+        util.WithArray("thread_ids", map[string]interface{}{"type": "string"}, mcp.Description("IDs of threads whose messages are all modified")),
+        mcp.WithString("query", mcp.Description("Gmail search query selecting the messages to modify")),
+        mcp.WithNumber("max_messages", mcp.Description(fmt.Sprintf("Maximum number of messages a query may select (default: %d, at most %d); the result has truncated set when more matched", util.MaxFetchAllItems, 10*util.MaxFetchAllItems))),
+        util.WithArray("operations", map[string]interface{}{
+            "type": "string",
+            "enum": []string{"archive", "unarchive", "read", "unread", "star", "unstar", "trash", "untrash", "not_spam"},
+        }, mcp.Description("Operations to apply")),
+        util.WithArray("add_labels", map[string]interface{}{"type": "string"}, mcp.Description("Names or IDs of labels to add")),
+        util.WithArray("remove_labels", map[string]interface{}{"type": "string"}, mcp.Description("Names or IDs of labels to remove")),
+        mcp.WithBoolean("dry_run", mcp.Description("Only list the messages that would be modified")),
+    )
+    s.AddTool(modifyTool, util.ErrorGuard(gmailModifyHandler))
+
+    // Unsubscribe tool
+    unsubscribeTool := mcp.NewTool("gmail_unsubscribe",
+        mcp.WithDescription("Unsubscribe from the senders of messages with their List-Unsubscribe headers: an RFC 8058 one-click POST when offered, otherwise an unsubscribe email sent through Gmail. Optionally creates a filter archiving or trashing future mail from each sender, and reports the method used per sender"),
+        util.WithArray("message_ids", map[string]interface{}{"type": "string"}, mcp.Description("IDs of messages whose senders to unsubscribe from")),
+        util.WithArray("thread_ids", map[string]interface{}{"type": "string"}, mcp.Description("IDs of threads whose senders to unsubscribe from")),
+        mcp.WithString("query", mcp.Description("Gmail search query selecting the messages whose senders to unsubscribe from, e.g. category:promotions older_than:30d")),
+        mcp.WithNumber("max_messages", mcp.Description(fmt.Sprintf("Maximum number of messages a query may select (default: %d, at most %d); the result has truncated set when more matched", util.MaxFetchAllItems, 10*util.MaxFetchAllItems))),
+        mcp.WithString("filter", mcp.Description("Also create a filter per sender for its future mail: archive or trash")),
+        mcp.WithBoolean("dry_run", mcp.Description("Only report the senders and the method that would be used, without unsubscribing or creating filters")),
+    )
+    s.AddTool(unsubscribeTool, util.ErrorGuard(gmailUnsubscribeHandler))
+
+    // Export tool
+    exportTool := mcp.NewTool("gmail_export",
+        mcp.WithDescription("Export messages, exactly as Gmail stores them, to .eml files or an mboxrd file in GMAIL_EXPORT_DIR, with a CSV or JSON manifest. Calling it again with the same name resumes the export"),
+        util.WithArray("message_ids", map[string]interface{}{"type": "string"}, mcp.Description("IDs of the messages to export")),
+        util.WithArray("thread_ids", map[string]interface{}{"type": "string"}, mcp.Description("IDs of threads whose messages are all exported")),
+        mcp.WithString("query", mcp.Description("Gmail search query selecting the messages to export")),
+        mcp.WithNumber("max_messages", mcp.Description("Maximum number of messages a query may select (default: all of them); the result has truncated set when more matched")),
+        mcp.WithBoolean("include_spam_trash", mcp.Description("Also export messages in spam and trash matching the query")),
+        mcp.WithString("format", mcp.Description("eml (default; one file per message) or mbox (a single mboxrd file)")),
+        mcp.WithString("manifest", mcp.Description("Format of the manifest: csv (default) or json. The CSV manifest is always kept as the resume checkpoint")),
+        mcp.WithString("name", mcp.Description("Name of the export directory; give the name of an earlier export to resume it (default: a new timestamped name)")),
+    )
+    s.AddTool(exportTool, util.ErrorGuard(gmailExportHandler))
+
+    // Import tool
+    importTool := mcp.NewTool("gmail_import",
+        mcp.WithDescription("Import an mbox file or a directory of .eml files from GMAIL_IMPORT_DIR into Gmail, keeping the original dates and threading headers. Progress is checkpointed, so calling it again with the same path resumes the import"),
+        mcp.WithString("path", mcp.Required(), mcp.Description("Path of the mbox file, .eml file or directory of .eml files, relative to GMAIL_IMPORT_DIR")),
+        util.WithArray("labels", map[string]interface{}{"type": "string"}, mcp.Description("Names or IDs of labels to add to every message, such as INBOX or UNREAD; missing labels are created")),
+        mcp.WithBoolean("dedupe", mcp.Description("Skip messages whose Message-ID is already in the mailbox (default: true)")),
+        mcp.WithBoolean("restart", mcp.Description("Start over instead of resuming from the checkpoint")),
+        mcp.WithBoolean("retry_failed", mcp.Description("Import the messages that failed in earlier runs again before resuming")),
+    )
+    s.AddTool(importTool, util.ErrorGuard(gmailImportHandler))
+
     // Move to spam tool
     spamTool := mcp.NewTool("gmail_move_to_spam",
         mcp.WithDescription("Move specific emails to spam folder in Gmail by message IDs"),
@@ -53,26 +201,84 @@ func RegisterGmailTools(s *server.MCPServer) {
 
     // Unified filter management tool
     filterTool := mcp.NewTool("gmail_filter",
-        mcp.WithDescription("Manage Gmail filters - create, list, or delete filters"),
-        mcp.WithString("action", mcp.Required(), mcp.Description("Action to perform: create, list, delete")),
-        mcp.WithString("filter_id", mcp.Description("Filter ID (required for delete action)")),
-        mcp.WithString("from", mcp.Description("Filter emails from this sender (create action)")),
-        mcp.WithString("to", mcp.Description("Filter emails to this recipient (create action)")),
-        mcp.WithString("subject", mcp.Description("Filter emails with this subject (create action)")),
-        mcp.WithString("query", mcp.Description("Additional search query criteria (create action)")),
+        mcp.WithDescription("Manage Gmail filters - create, update, list, or delete filters, lint them for duplicates, broken labels, overlaps and conflicts, preview what a filter matches before creating it, and export or import them in the mailFilters.xml format of the Gmail web UI. Update replaces the filter, which gets a new ID, and only changes the given arguments"),
+        mcp.WithString("action", mcp.Required(), mcp.Description("Action to perform: create, update, list, delete, lint, preview, export, import")),
+        mcp.WithString("filter_id", mcp.Description("Filter ID (required for update and delete actions; for preview, an existing filter to preview instead of the criteria arguments)")),
+        mcp.WithString("from", mcp.Description("Filter emails from this sender (create and update actions)")),
+        mcp.WithString("to", mcp.Description("Filter emails to this recipient (create and update actions)")),
+        mcp.WithString("subject", mcp.Description("Filter emails with this subject (create and update actions)")),
+        mcp.WithString("query", mcp.Description("Additional search query criteria (create and update actions)")),
+        mcp.WithString("negated_query", mcp.Description("Only match emails that do not match this search query (create and update actions)")),
+        mcp.WithBoolean("has_attachment", mcp.Description("Only match emails with an attachment (create and update actions)")),
+        mcp.WithBoolean("exclude_chats", mcp.Description("Do not match chats (create and update actions)")),
+        mcp.WithNumber("size", mcp.Description("Size in bytes to compare emails against; 0 removes the size criterion (create and update actions)")),
+        mcp.WithString("size_comparison", mcp.Description("Match emails larger or smaller than size: larger (default) or smaller (create and update actions)")),
+        util.WithArray("add_labels", map[string]interface{}{"type": "string"}, mcp.Description("Names of labels to add to matching messages; missing labels are created (create and update actions)")),
+        util.WithArray("remove_labels", map[string]interface{}{"type": "string"}, mcp.Description("Names or IDs of labels to remove from matching messages (create and update actions)")),
         mcp.WithBoolean("add_label", mcp.Description("Add label to matching messages (create action)")),
         mcp.WithString("label_name", mcp.Description("Name of the label to add (create action, required if add_label is true)")),
-        mcp.WithBoolean("mark_important", mcp.Description("Mark matching messages as important (create action)")),
-        mcp.WithBoolean("mark_read", mcp.Description("Mark matching messages as read (create action)")),
-        mcp.WithBoolean("archive", mcp.Description("Archive matching messages (create action)")),
+        mcp.WithString("category", mcp.Description("Inbox category to file matching messages under: primary, social, updates, forums, promotions (create and update actions)")),
+        mcp.WithString("forward", mcp.Description("Forward matching messages to this address, which must be a verified forwarding address (create and update actions)")),
+        mcp.WithBoolean("trash", mcp.Description("Delete matching messages (create and update actions)")),
+        mcp.WithBoolean("star", mcp.Description("Star matching messages (create and update actions)")),
+        mcp.WithBoolean("mark_important", mcp.Description("Mark matching messages as important (create and update actions)")),
+        mcp.WithBoolean("never_important", mcp.Description("Never mark matching messages as important (create and update actions)")),
+        mcp.WithBoolean("never_spam", mcp.Description("Never send matching messages to spam (create and update actions)")),
+        mcp.WithBoolean("mark_read", mcp.Description("Mark matching messages as read (create and update actions)")),
+        mcp.WithBoolean("archive", mcp.Description("Archive matching messages (create and update actions)")),
+        mcp.WithNumber("sample_size", mcp.Description("Number of matching messages to show (preview action, default: 10, max: 100)")),
+        mcp.WithNumber("max_messages", mcp.Description(fmt.Sprintf("Maximum number of matching messages to count and apply to (preview action, default: %d)", util.MaxFetchAllItems))),
+        mcp.WithBoolean("apply", mcp.Description("Apply the filter's actions to the messages it matches now, in batches (preview action)")),
+        mcp.WithBoolean("save", mcp.Description("Save the export as mailFilters.xml in GMAIL_DOWNLOAD_DIR instead of returning it (export action)")),
+        mcp.WithString("xml", mcp.Description("Contents of a mailFilters.xml file (import action)")),
+        mcp.WithString("file", mcp.Description("Path of a mailFilters.xml file inside GMAIL_ATTACHMENT_DIR (import action)")),
+        mcp.WithBoolean("diff", mcp.Description("Only show which filters would be added or removed, without changing anything (import action)")),
+        mcp.WithBoolean("replace", mcp.Description("Also delete filters that are not in the file, once all of its filters exist (import action)")),
+        util.WithPagination(100),
     )
     s.AddTool(filterTool, util.ErrorGuard(gmailFilterHandler))
 
+    // Mailbox settings tool
+    settingsTool := mcp.NewTool("gmail_settings",
+        mcp.WithDescription("Get or change Gmail settings: the vacation responder, send-as aliases and their signatures, auto-forwarding, forwarding addresses, IMAP, POP and language. Changes only touch the given arguments and show each changed setting before and after"),
+        mcp.WithString("section", mcp.Description("Settings section: vacation, send_as, auto_forwarding, forwarding_addresses, imap, pop, language, or all (default, get action only)")),
+        mcp.WithString("action", mcp.Description("Action to perform: get (default) or set; create and delete for send_as and forwarding_addresses; verify for send_as")),
+        mcp.WithString("email", mcp.Description("Address of the send-as alias or forwarding address (send_as and forwarding_addresses), or to forward to (auto_forwarding; must be a verified forwarding address)")),
+        mcp.WithBoolean("enabled", mcp.Description("Turn the vacation responder, auto-forwarding or IMAP on or off (vacation, auto_forwarding and imap)")),
+        mcp.WithString("subject", mcp.Description("Subject of the auto-reply (vacation)")),
+        mcp.WithString("body", mcp.Description("Plain text body of the auto-reply (vacation)")),
+        mcp.WithString("html_body", mcp.Description("HTML body of the auto-reply, used instead of body (vacation)")),
+        mcp.WithString("start", mcp.Description("First day as YYYY-MM-DD, or time in RFC3339 format, to send auto-replies; empty clears it (vacation)")),
+        mcp.WithString("end", mcp.Description("Last day as YYYY-MM-DD, or time in RFC3339 format, to send auto-replies; empty clears it (vacation)")),
+        mcp.WithBoolean("restrict_to_contacts", mcp.Description("Only reply to contacts (vacation)")),
+        mcp.WithBoolean("restrict_to_domain", mcp.Description("Only reply to the same Workspace domain (vacation)")),
+        mcp.WithString("display_name", mcp.Description("Name shown in the From header (send_as)")),
+        mcp.WithString("reply_to", mcp.Description("Reply-To address; empty removes it (send_as)")),
+        mcp.WithString("signature", mcp.Description("HTML signature; empty removes it (send_as)")),
+        mcp.WithBoolean("is_default", mcp.Description("Make this the default address to send from; can only be set to true (send_as)")),
+        mcp.WithBoolean("treat_as_alias", mcp.Description("Treat the address as an alias of this mailbox (send_as)")),
+        mcp.WithString("disposition", mcp.Description("What to do with messages after forwarding or POP download: leaveInInbox, archive, trash, markRead (auto_forwarding and pop)")),
+        mcp.WithBoolean("auto_expunge", mcp.Description("Expunge messages as soon as they are marked deleted in IMAP (imap)")),
+        mcp.WithString("expunge_behavior", mcp.Description("What expunging does to a message: archive, trash, deleteForever (imap)")),
+        mcp.WithNumber("max_folder_size", mcp.Description("Maximum number of messages in an IMAP folder, one of 0 (no limit), 1000, 2000, 5000 or 10000 (imap)")),
+        mcp.WithString("access_window", mcp.Description("Messages available over POP: disabled, fromNowOn, allMail (pop)")),
+        mcp.WithString("display_language", mcp.Description("Display language as an RFC 3066 tag, e.g. en or fr (language)")),
+    )
+    s.AddTool(settingsTool, util.ErrorGuard(gmailSettingsHandler))
+
     // Unified label management tool
     labelTool := mcp.NewTool("gmail_label",
-        mcp.WithDescription("Manage Gmail labels - list or delete labels"),
-        mcp.WithString("action", mcp.Required(), mcp.Description("Action to perform: list, delete")),
-        mcp.WithString("label_id", mcp.Description("Label ID (required for delete action)")),
+        mcp.WithDescription("Manage Gmail labels - list, create, update, delete or merge labels. Labels are nested with '/' in their names, e.g. Projects/Acme"),
+        mcp.WithString("action", mcp.Required(), mcp.Description("Action to perform: list, create, update, delete, merge")),
+        mcp.WithString("label_id", mcp.Description("ID or name of the label (required for update, delete and merge actions; the label merged away for merge)")),
+        mcp.WithString("name", mcp.Description("Full name of the label for create, or its new name for update. Relative to parent when parent is given")),
+        mcp.WithString("parent", mcp.Description("Name of the label to nest under (create and update actions); missing parents are created")),
+        mcp.WithString("background_color", mcp.Description("Background color from Gmail's palette, e.g. #16a766 (create and update actions)")),
+        mcp.WithString("text_color", mcp.Description("Text color from Gmail's palette, e.g. #ffffff (create and update actions)")),
+        mcp.WithString("label_list_visibility", mcp.Description("Visibility in the label list: labelShow, labelShowIfUnread or labelHide (create and update actions)")),
+        mcp.WithString("message_list_visibility", mcp.Description("Visibility in the message list: show or hide (create and update actions)")),
+        mcp.WithString("target_label", mcp.Description("ID or name of the label messages and nested labels are moved to (required for merge action)")),
+        util.WithPagination(100),
     )
     s.AddTool(labelTool, util.ErrorGuard(gmailLabelHandler))
 
@@ -109,45 +315,52 @@ func gmailSearchHandler(arguments map[string]interface{}) (*mcp.CallToolResult,
     }
 
     user := "me"
-    
-    listCall := gmailService().Users.Messages.List(user).Q(query).MaxResults(10)
-    
-    resp, err := listCall.Do()
+    request := util.RequestFromArguments(arguments)
+    page := util.PageFromArguments(arguments, 10, 500)
+
+    messages, nextPageToken, err := util.Paginate(page, func(pageToken string, pageSize int64) ([]*gmail.Message, string, error) {
+        listCall := gmailService().Users.Messages.List(user).Q(query).MaxResults(pageSize).Context(request.Context())
+        if pageToken != "" {
+            listCall = listCall.PageToken(pageToken)
+        }
+
+        resp, err := listCall.Do()
+        if err != nil {
+            return nil, "", err
+        }
+        return resp.Messages, resp.NextPageToken, nil
+    })
     if err != nil {
         return mcp.NewToolResultError(fmt.Sprintf("failed to search emails: %v", err)), nil
     }
 
-    emails := make([]map[string]interface{}, 0)
-    
-    for _, msg := range resp.Messages {
-        message, err := gmailService().Users.Messages.Get(user, msg.Id).Do()
-        if err != nil {
-            log.Printf("Failed to get message %s: %v", msg.Id, err)
-            continue
-        }
+    ids := make([]string, len(messages))
+    for i, msg := range messages {
+        ids[i] = msg.Id
+    }
 
-        emailInfo := map[string]interface{}{
-            "id": msg.Id,
-            "snippet": message.Snippet,
-        }
+    fetched, errs := fetchGmailSummaries(request.Context(), ids, func(done int) {
+        request.Progress(done, len(ids), "Fetching messages")
+    })
 
-        for _, header := range message.Payload.Headers {
-            switch header.Name {
-            case "From":
-                emailInfo["from"] = header.Value
-            case "Subject":
-                emailInfo["subject"] = header.Value
-            case "Date":
-                emailInfo["date"] = header.Value
+    emails := make([]map[string]interface{}, 0, len(fetched))
+    for i, message := range fetched {
+        if errs[i] != nil {
+            if !request.Cancelled() {
+                log.Printf("Failed to get message %s: %v", ids[i], errs[i])
             }
+            continue
         }
-
-        emails = append(emails, emailInfo)
+        emails = append(emails, gmailSummary(message))
     }
 
     result := map[string]interface{}{
         "count": len(emails),
         "emails": emails,
+        "next_page_token": nextPageToken,
+    }
+    if request.Cancelled() {
+        result["partial"] = true
     }
 
     yamlResult, err := yaml.Marshal(result)
@@ -171,262 +384,26 @@ func gmailMoveToSpamHandler(arguments map[string]interface{}) (*mcp.CallToolResu
     }
 
     user := "me"
+    request := util.RequestFromArguments(arguments)
 
-    for _, messageId := range messageIds {
-        _, err := gmailService().Users.Messages.Modify(user, messageId, &gmail.ModifyMessageRequest{
-            AddLabelIds: []string{"SPAM"},
-        }).Do()
-        if err != nil {
-            return mcp.NewToolResultError(fmt.Sprintf("failed to move email %s to spam: %v", messageId, err)), nil
-        }
-    }
-
-    return mcp.NewToolResultText(fmt.Sprintf("Successfully moved %d emails to spam.", len(messageIds))), nil
-}
-
-func gmailFilterHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
-	action, _ := arguments["action"].(string)
-	
-	switch action {
-	case "create":
-		return gmailCreateFilterHandler(arguments)
-	case "list":
-		return gmailListFiltersHandler(arguments)
-	case "delete":
-		return gmailDeleteFilterHandler(arguments)
-	default:
-		return mcp.NewToolResultError("Invalid action. Must be one of: create, list, delete"), nil
-	}
-}
-
-func gmailCreateFilterHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
-    // Create filter criteria
-    criteria := &gmail.FilterCriteria{}
-    
-    if from, ok := arguments["from"].(string); ok && from != "" {
-        criteria.From = from
-    }
-    if to, ok := arguments["to"].(string); ok && to != "" {
-        criteria.To = to
-    }
-    if subject, ok := arguments["subject"].(string); ok && subject != "" {
-        criteria.Subject = subject
-    }
-    if query, ok := arguments["query"].(string); ok && query != "" {
-        criteria.Query = query
-    }
-
-    // Create filter action
-    action := &gmail.FilterAction{}
-
-    if addLabel, ok := arguments["add_label"].(bool); ok && addLabel {
-        labelName, ok := arguments["label_name"].(string)
-        if !ok || labelName == "" {
-            return mcp.NewToolResultError("label_name is required when add_label is true"), nil
+    for i, messageId := range messageIds {
+        if request.Cancelled() {
+            return mcp.NewToolResultText(fmt.Sprintf("Cancelled after moving %d of %d emails to spam.", i, len(messageIds))), nil
         }
+        request.Progress(i, len(messageIds), fmt.Sprintf("Moving %s to spam", messageId))
 
-        // First, create or get the label
-        label, err := createOrGetLabel(labelName)
+        _, err := gmailService().Users.Messages.Modify(user, messageId, &gmail.ModifyMessageRequest{
+            AddLabelIds: []string{"SPAM"},
+            RemoveLabelIds: []string{"INBOX"},
+        }).Context(request.Context()).Do()
         if err != nil {
-            return mcp.NewToolResultError(fmt.Sprintf("failed to create/get label: %v", err)), nil
-        }
-        action.AddLabelIds = []string{label.Id}
-    }
-
-    if markImportant, ok := arguments["mark_important"].(bool); ok && markImportant {
-        action.AddLabelIds = append(action.AddLabelIds, "IMPORTANT")
-    }
-
-    if markRead, ok := arguments["mark_read"].(bool); ok && markRead {
-        action.RemoveLabelIds = append(action.RemoveLabelIds, "UNREAD")
-    }
-
-    if archive, ok := arguments["archive"].(bool); ok && archive {
-        action.RemoveLabelIds = append(action.RemoveLabelIds, "INBOX")
-    }
-
-    // Create the filter
-    filter := &gmail.Filter{
-        Criteria: criteria,
-        Action:   action,
-    }
-
-    result, err := gmailService().Users.Settings.Filters.Create("me", filter).Do()
-    if err != nil {
-        return mcp.NewToolResultError(fmt.Sprintf("failed to create filter: %v", err)), nil
-    }
-
-    return mcp.NewToolResultText(fmt.Sprintf("Successfully created filter with ID: %s", result.Id)), nil
-}
-
-func createOrGetLabel(name string) (*gmail.Label, error) {
-    // First try to find existing label
-    labels, err := gmailService().Users.Labels.List("me").Do()
-    if err != nil {
-        return nil, fmt.Errorf("failed to list labels: %v", err)
-    }
-
-    for _, label := range labels.Labels {
-        if label.Name == name {
-            return label, nil
-        }
-    }
-
-    // If not found, create new label
-    newLabel := &gmail.Label{
-        Name:                  name,
-        MessageListVisibility: "show",
-        LabelListVisibility:   "labelShow",
-    }
-
-    label, err := gmailService().Users.Labels.Create("me", newLabel).Do()
-    if err != nil {
-        return nil, fmt.Errorf("failed to create label: %v", err)
-    }
-
-    return label, nil
-}
-
-func gmailListFiltersHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
-    filters, err := gmailService().Users.Settings.Filters.List("me").Do()
-    if err != nil {
-        return mcp.NewToolResultError(fmt.Sprintf("failed to list filters: %v", err)), nil
-    }
-
-    filtersResult := make([]map[string]interface{}, 0)
-    
-    for _, filter := range filters.Filter {
-        filterInfo := map[string]interface{}{
-            "id": filter.Id,
-            "criteria": map[string]string{},
-            "actions": map[string]interface{}{},
-        }
-        
-        // Add criteria
-        if filter.Criteria.From != "" {
-            filterInfo["criteria"].(map[string]string)["from"] = filter.Criteria.From
-        }
-        if filter.Criteria.To != "" {
-            filterInfo["criteria"].(map[string]string)["to"] = filter.Criteria.To
+            return mcp.NewToolResultError(fmt.Sprintf("failed to move email %s to spam after moving %d: %v", messageId, i, err)), nil
         }
-        if filter.Criteria.Subject != "" {
-            filterInfo["criteria"].(map[string]string)["subject"] = filter.Criteria.Subject
-        }
-        if filter.Criteria.Query != "" {
-            filterInfo["criteria"].(map[string]string)["query"] = filter.Criteria.Query
-        }
-
-        // Add actions
-        if len(filter.Action.AddLabelIds) > 0 {
-            filterInfo["actions"].(map[string]interface{})["addLabels"] = filter.Action.AddLabelIds
-        }
-        if len(filter.Action.RemoveLabelIds) > 0 {
-            filterInfo["actions"].(map[string]interface{})["removeLabels"] = filter.Action.RemoveLabelIds
-        }
-        
-        filtersResult = append(filtersResult, filterInfo)
     }
 
-    result := map[string]interface{}{
-        "count": len(filtersResult),
-        "filters": filtersResult,
-    }
+    request.Progress(len(messageIds), len(messageIds), "Done")
 
-    yamlResult, err := yaml.Marshal(result)
-    if err != nil {
-        return mcp.NewToolResultError(fmt.Sprintf("failed to marshal filters: %v", err)), nil
-    }
-
-    return mcp.NewToolResultText(string(yamlResult)), nil
-}
-
-func gmailLabelHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
-	action, _ := arguments["action"].(string)
-	
-	switch action {
-	case "list":
-		return gmailListLabelsHandler(arguments)
-	case "delete":
-		return gmailDeleteLabelHandler(arguments)
-	default:
-		return mcp.NewToolResultError("Invalid action. Must be one of: list, delete"), nil
-	}
-}
-
-func gmailListLabelsHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
-    labels, err := gmailService().Users.Labels.List("me").Do()
-    if err != nil {
-        return mcp.NewToolResultError(fmt.Sprintf("failed to list labels: %v", err)), nil
-    }
-
-    systemLabels := make([]map[string]interface{}, 0)
-    userLabels := make([]map[string]interface{}, 0)
-
-    for _, label := range labels.Labels {
-        labelInfo := map[string]interface{}{
-            "id": label.Id,
-            "name": label.Name,
-        }
-        
-        if label.MessagesTotal > 0 {
-            labelInfo["messagesTotal"] = label.MessagesTotal
-        }
-        
-        if label.Type == "system" {
-            systemLabels = append(systemLabels, labelInfo)
-        } else if label.Type == "user" {
-            userLabels = append(userLabels, labelInfo)
-        }
-    }
-
-    result := map[string]interface{}{
-        "count": len(labels.Labels),
-        "systemLabels": systemLabels,
-        "userLabels": userLabels,
-    }
-
-    yamlResult, err := yaml.Marshal(result)
-    if err != nil {
-        return mcp.NewToolResultError(fmt.Sprintf("failed to marshal labels: %v", err)), nil
-    }
-
-    return mcp.NewToolResultText(string(yamlResult)), nil
-}
-
-func gmailDeleteFilterHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
-    filterID, ok := arguments["filter_id"].(string)
-    if !ok {
-        return mcp.NewToolResultError("filter_id must be a string"), nil
-    }
-
-    if filterID == "" {
-        return mcp.NewToolResultError("filter_id cannot be empty"), nil
-    }
-
-    err := gmailService().Users.Settings.Filters.Delete("me", filterID).Do()
-    if err != nil {
-        return mcp.NewToolResultError(fmt.Sprintf("failed to delete filter: %v", err)), nil
-    }
-
-    return mcp.NewToolResultText(fmt.Sprintf("Successfully deleted filter with ID: %s", filterID)), nil
-}
-
-func gmailDeleteLabelHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
-	labelID, ok := arguments["label_id"].(string)
-	if !ok {
-		return mcp.NewToolResultError("label_id must be a string"), nil
-	}
-
-	if labelID == "" {
-		return mcp.NewToolResultError("label_id cannot be empty"), nil
-	}
-
-	err := gmailService().Users.Labels.Delete("me", labelID).Do()
-	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("failed to delete label: %v", err)), nil
-	}
-
-	return mcp.NewToolResultText(fmt.Sprintf("Successfully deleted label with ID: %s", labelID)), nil
+    return mcp.NewToolResultText(fmt.Sprintf("Successfully moved %d emails to spam.", len(messageIds))), nil
 }
 
 func gmailReadEmailHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
@@ -437,6 +414,15 @@ func gmailReadEmailHandler(arguments map[string]interface{}) (*mcp.CallToolResul
 
     includeAttachments, _ := arguments["include_attachments"].(bool)
 
+    bodyFormat, _ := arguments["body_format"].(string)
+    switch bodyFormat {
+    case "":
+        bodyFormat = "text"
+    case "text", "markdown", "html":
+    default:
+        return mcp.NewToolResultError("body_format must be one of: text, markdown, html"), nil
+    }
+
     // Get the full email message
     message, err := gmailService().Users.Messages.Get("me", messageID).Format("full").Do()
     if err != nil {
@@ -453,29 +439,21 @@ func gmailReadEmailHandler(arguments map[string]interface{}) (*mcp.CallToolResul
     for _, header := range message.Payload.Headers {
         switch header.Name {
         case "From", "To", "Cc", "Subject", "Date":
-            emailResult["headers"].(map[string]string)[header.Name] = header.Value
+            emailResult["headers"].(map[string]string)[header.Name] = email.DecodeHeader(header.Value)
         }
     }
 
     // Extract body
-    emailResult["body"] = extractMessageBody(message.Payload)
+    content := gmailContent(message)
+    emailResult["body"] = content.Body(bodyFormat)
 
     // Handle attachments if requested
-    if includeAttachments && len(message.Payload.Parts) > 0 {
-        attachments := make([]map[string]interface{}, 0)
-        for _, part := range message.Payload.Parts {
-            if part.Filename != "" {
-                attachmentInfo := map[string]interface{}{
-                    "filename": part.Filename,
-                    "size": part.Body.Size,
-                }
-                attachments = append(attachments, attachmentInfo)
-            }
-        }
-        
-        if len(attachments) > 0 {
-            emailResult["attachments"] = attachments
+    if includeAttachments && len(content.Attachments) > 0 {
+        attachments := make([]map[string]interface{}, 0, len(content.Attachments))
+        for _, part := range content.Attachments {
+            attachments = append(attachments, gmailAttachmentInfo(part))
         }
+        emailResult["attachments"] = attachments
     }
 
     yamlResult, err := yaml.Marshal(emailResult)
@@ -485,110 +463,3 @@ func gmailReadEmailHandler(arguments map[string]interface{}) (*mcp.CallToolResul
 
     return mcp.NewToolResultText(string(yamlResult)), nil
 }
-
-func extractMessageBody(payload *gmail.MessagePart) string {
-    if payload.MimeType == "text/plain" && payload.Body.Data != "" {
-        data, err := base64.URLEncoding.DecodeString(payload.Body.Data)
-        if err != nil {
-            return fmt.Sprintf("Error decoding body: %v", err)
-        }
-        return string(data)
-    }
-
-    if payload.Parts != nil {
-        for _, part := range payload.Parts {
-            if part.MimeType == "text/plain" {
-                data, err := base64.URLEncoding.DecodeString(part.Body.Data)
-                if err != nil {
-                    continue
-                }
-                return string(data)
-            }
-        }
-    }
-
-    return "No readable text body found"
-}
-
-func gmailReplyEmailHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
-    messageID, ok := arguments["message_id"].(string)
-    if !ok {
-        return mcp.NewToolResultError("message_id must be a string"), nil
-    }
-
-    replyText, ok := arguments["reply_text"].(string)
-    if !ok {
-        return mcp.NewToolResultError("reply_text must be a string"), nil
-    }
-
-    replyAll, _ := arguments["reply_all"].(bool)
-
-    // Get the original message to extract headers
-    originalMessage, err := gmailService().Users.Messages.Get("me", messageID).Format("metadata").Do()
-    if err != nil {
-        return mcp.NewToolResultError(fmt.Sprintf("failed to get original email: %v", err)), nil
-    }
-
-    // Extract necessary headers
-    var from, to, subject, references, messageIDHeader string
-    for _, header := range originalMessage.Payload.Headers {
-        switch header.Name {
-        case "From":
-            to = header.Value // Original sender becomes recipient
-        case "To":
-            from = header.Value // We'll need this for reply-all
-        case "Subject":
-            subject = header.Value
-            if !strings.HasPrefix(strings.ToLower(subject), "re:") {
-                subject = "Re: " + subject
-            }
-        case "Message-ID":
-            messageIDHeader = header.Value
-            references = header.Value
-        case "References":
-            references = header.Value + " " + messageIDHeader
-        }
-    }
-
-    // Create reply message
-    var message gmail.Message
-
-    // Prepare recipients
-    recipients := []string{to}
-    if replyAll {
-        // Add original To recipients (excluding ourselves)
-        originalRecipients := strings.Split(from, ",")
-        for _, recipient := range originalRecipients {
-            recipient = strings.TrimSpace(recipient)
-            if recipient != "" && !strings.Contains(recipient, "me@") {
-                recipients = append(recipients, recipient)
-            }
-        }
-    }
-
-    // Construct email headers
-    headers := make(map[string]string)
-    headers["To"] = strings.Join(recipients, ", ")
-    headers["Subject"] = subject
-    headers["References"] = references
-    headers["In-Reply-To"] = messageIDHeader
-
-    // Construct the raw message
-    var rawMessage strings.Builder
-    for key, value := range headers {
-        rawMessage.WriteString(fmt.Sprintf("%s: %s\r\n", key, value))
-    }
-    rawMessage.WriteString("\r\n")
-    rawMessage.WriteString(replyText)
-
-    // Encode the raw message
-    message.Raw = base64.URLEncoding.EncodeToString([]byte(rawMessage.String()))
-
-    // Send the reply
-    _, err = gmailService().Users.Messages.Send("me", &message).Do()
-    if err != nil {
-        return mcp.NewToolResultError(fmt.Sprintf("failed to send reply: %v", err)), nil
-    }
-
-    return mcp.NewToolResultText("Reply sent successfully"), nil
-}
\ No newline at end of file
@@ -0,0 +1,349 @@
+package tools
+
+import (
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/nguyenvanduocit/google-kit/email"
+	"github.com/nguyenvanduocit/google-kit/util"
+)
+
+// maxInlineAttachmentSize is the largest attachment returned in the tool
+// result; larger ones must be saved to the download directory.
+const maxInlineAttachmentSize = 10 << 20
+
+// embeddedBlob is an embedded resource with binary contents. The
+// mcp.EmbeddedResource type of this mcp-go version only holds the URI and
+// MIME type of a resource, not its contents.
+type embeddedBlob struct {
+	Type     string                   `json:"type"`
+	Resource mcp.BlobResourceContents `json:"resource"`
+}
+
+func gmailGetAttachmentHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	ctx := util.RequestFromArguments(arguments).Context()
+
+	messageID, ok := arguments["message_id"].(string)
+	if !ok || messageID == "" {
+		return mcp.NewToolResultError("message_id must be a string"), nil
+	}
+
+	partID, _ := arguments["part_id"].(string)
+	attachmentID, _ := arguments["attachment_id"].(string)
+	filename, _ := arguments["filename"].(string)
+	if partID == "" && attachmentID == "" && filename == "" {
+		return mcp.NewToolResultError("one of part_id, attachment_id or filename is required"), nil
+	}
+	save, _ := arguments["save"].(bool)
+
+	message, err := gmailService().Users.Messages.Get("me", messageID).Format("full").Context(ctx).Do()
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to get email: %v", err)), nil
+	}
+
+	part := findAttachment(gmailContent(message).Attachments, partID, attachmentID, filename)
+	if part == nil {
+		if attachmentID == "" {
+			return mcp.NewToolResultError("attachment not found; use gmail_read_email with include_attachments to list them"), nil
+		}
+		// Attachment IDs are not stable across fetches, so an ID taken
+		// from an earlier listing may not match; it can still be fetched.
+		part = &email.Part{AttachmentID: attachmentID, Filename: filename}
+	}
+
+	data, err := gmailAttachmentData(ctx, messageID, part)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	mimeType := part.MediaType
+	if mimeType == "" || mimeType == "application/octet-stream" {
+		mimeType = strings.SplitN(http.DetectContentType(data), ";", 2)[0]
+	}
+
+	if save {
+		path, err := saveAttachment(part.Filename, data)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("Saved %s (%s, %d bytes) to %s", part.Filename, mimeType, len(data), path)), nil
+	}
+
+	if len(data) > maxInlineAttachmentSize {
+		return mcp.NewToolResultError(fmt.Sprintf("attachment is %d bytes, larger than the %d bytes that can be returned inline; use save to write it to GMAIL_DOWNLOAD_DIR", len(data), maxInlineAttachmentSize)), nil
+	}
+
+	if isTextMediaType(mimeType) {
+		return mcp.NewToolResultText(email.DecodeCharset(data, part.Params["charset"], mimeType)), nil
+	}
+
+	uri := fmt.Sprintf("gmail://messages/%s/attachments/%s", messageID, part.PartID)
+	if part.PartID == "" {
+		uri = fmt.Sprintf("gmail://messages/%s/attachments/%s", messageID, part.AttachmentID)
+	}
+
+	return &mcp.CallToolResult{
+		Content: []interface{}{
+			mcp.TextContent{
+				Type: "text",
+				Text: fmt.Sprintf("Attachment %s (%s, %d bytes)", part.Filename, mimeType, len(data)),
+			},
+			embeddedBlob{
+				Type: "resource",
+				Resource: mcp.BlobResourceContents{
+					ResourceContents: mcp.ResourceContents{URI: uri, MIMEType: mimeType},
+					Blob:             base64.StdEncoding.EncodeToString(data),
+				},
+			},
+		},
+	}, nil
+}
+
+// findAttachment returns the attachment matching the part ID, attachment ID
+// or file name, in that order of preference.
+func findAttachment(attachments []*email.Part, partID, attachmentID, filename string) *email.Part {
+	for _, part := range attachments {
+		switch {
+		case partID != "" && part.PartID == partID,
+			attachmentID != "" && part.AttachmentID == attachmentID:
+			return part
+		}
+	}
+
+	if filename != "" {
+		for _, part := range attachments {
+			if strings.EqualFold(part.Filename, filename) {
+				return part
+			}
+		}
+	}
+
+	return nil
+}
+
+// gmailAttachmentInfo describes an attachment in listings.
+func gmailAttachmentInfo(part *email.Part) map[string]interface{} {
+	info := map[string]interface{}{
+		"filename": part.Filename,
+		"mimeType": part.MediaType,
+		"size":     part.Size,
+		"partId":   part.PartID,
+		"inline":   isInlinePart(part),
+	}
+	if part.AttachmentID != "" {
+		info["attachmentId"] = part.AttachmentID
+	}
+	if cid := part.ContentID(); cid != "" {
+		info["contentId"] = cid
+	}
+	return info
+}
+
+// saveAttachment writes data to GMAIL_DOWNLOAD_DIR under a sanitized,
+// non-existing file name and returns the path.
+func saveAttachment(filename string, data []byte) (string, error) {
+	dir := os.Getenv("GMAIL_DOWNLOAD_DIR")
+	if dir == "" {
+		return "", fmt.Errorf("GMAIL_DOWNLOAD_DIR must be set to save attachments")
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("failed to create download directory: %v", err)
+	}
+
+	path, err := util.UniquePath(dir, filename)
+	if err != nil {
+		return "", err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s: %v", path, err)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return "", fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("failed to write %s: %v", path, err)
+	}
+
+	return path, nil
+}
+
+// isInlinePart reports whether an attachment is shown inside the body, such
+// as an image referenced by cid: from the HTML.
+func isInlinePart(part *email.Part) bool {
+	disposition := part.Disposition()
+	return disposition == "inline" || part.ContentID() != "" && disposition != "attachment"
+}
+
+func isTextMediaType(mediaType string) bool {
+	switch {
+	case strings.HasPrefix(mediaType, "text/"):
+		return true
+	case strings.HasSuffix(mediaType, "+json"), strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+
+	switch mediaType {
+	case "application/json", "application/xml", "application/javascript", "application/x-yaml", "application/yaml", "message/rfc822":
+		return true
+	}
+	return false
+}
+
+// maxOutgoingAttachmentSize is the total size of the attachments of a
+// message; Gmail rejects messages larger than 35 MB after encoding.
+const maxOutgoingAttachmentSize = 25 << 20
+
+// withGmailAttachments adds the attachments and attachment_blobs arguments
+// of the compose tools.
+func withGmailAttachments() mcp.ToolOption {
+	return func(tool *mcp.Tool) {
+		util.WithArray("attachments", map[string]interface{}{"type": "string"},
+			mcp.Description("Paths of local files to attach, relative to GMAIL_ATTACHMENT_DIR or absolute paths inside it"))(tool)
+		util.WithArray("attachment_blobs", map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"filename":     map[string]interface{}{"type": "string"},
+				"content_type": map[string]interface{}{"type": "string"},
+				"data":         map[string]interface{}{"type": "string", "description": "Base64 encoded contents"},
+			},
+			"required": []string{"filename", "data"},
+		}, mcp.Description("Files to attach given as base64 data"))(tool)
+	}
+}
+
+// attachmentsFromArguments loads the attachments and attachment_blobs
+// arguments.
+func attachmentsFromArguments(arguments map[string]interface{}) ([]email.Attachment, error) {
+	var attachments []email.Attachment
+	total := 0
+
+	paths := util.StringsFromArguments(arguments, "attachments")
+
+	for _, path := range paths {
+		attachment, err := loadAttachmentFile(path)
+		if err != nil {
+			return nil, err
+		}
+		total += len(attachment.Data)
+		attachments = append(attachments, attachment)
+	}
+
+	blobs, _ := arguments["attachment_blobs"].([]interface{})
+	for i, item := range blobs {
+		blob, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("attachment_blobs[%d] must be an object", i)
+		}
+
+		filename, _ := blob["filename"].(string)
+		encoded, _ := blob["data"].(string)
+		contentType, _ := blob["content_type"].(string)
+		if filename == "" {
+			return nil, fmt.Errorf("attachment_blobs[%d] has no filename", i)
+		}
+
+		data, err := email.DecodeBase64(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("attachment_blobs[%d] is not valid base64: %v", i, err)
+		}
+
+		total += len(data)
+		attachments = append(attachments, email.Attachment{
+			Filename:    filename,
+			ContentType: sniffContentType(filename, contentType, data),
+			Data:        data,
+		})
+	}
+
+	if total > maxOutgoingAttachmentSize {
+		return nil, fmt.Errorf("attachments total %d bytes, more than Gmail's limit of %d bytes", total, maxOutgoingAttachmentSize)
+	}
+
+	return attachments, nil
+}
+
+// loadAttachmentFile reads a file that must resolve, after following
+// symlinks, to a regular file inside GMAIL_ATTACHMENT_DIR.
+func loadAttachmentFile(path string) (email.Attachment, error) {
+	if os.Getenv("GMAIL_ATTACHMENT_DIR") == "" {
+		return email.Attachment{}, fmt.Errorf("GMAIL_ATTACHMENT_DIR must be set to attach local files")
+	}
+
+	resolved, err := resolveInsideDir("GMAIL_ATTACHMENT_DIR", path)
+	if err != nil {
+		return email.Attachment{}, fmt.Errorf("cannot attach %s: %v", path, err)
+	}
+
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return email.Attachment{}, fmt.Errorf("cannot attach %s: %v", path, err)
+	}
+	if !info.Mode().IsRegular() {
+		return email.Attachment{}, fmt.Errorf("cannot attach %s: not a regular file", path)
+	}
+	if info.Size() > maxOutgoingAttachmentSize {
+		return email.Attachment{}, fmt.Errorf("cannot attach %s: %d bytes is more than Gmail's limit of %d bytes", path, info.Size(), maxOutgoingAttachmentSize)
+	}
+
+	data, err := os.ReadFile(resolved)
+	if err != nil {
+		return email.Attachment{}, fmt.Errorf("cannot attach %s: %v", path, err)
+	}
+
+	filename := filepath.Base(path)
+	return email.Attachment{
+		Filename:    filename,
+		ContentType: sniffContentType(filename, "", data),
+		Data:        data,
+	}, nil
+}
+
+// resolveInsideDir resolves path, relative to the directory named by the
+// environment variable envName unless absolute, and checks that it is inside
+// that directory after following symlinks.
+func resolveInsideDir(envName, path string) (string, error) {
+	root, err := filepath.EvalSymlinks(os.Getenv(envName))
+	if err != nil {
+		return "", fmt.Errorf("invalid %s: %v", envName, err)
+	}
+	if root, err = filepath.Abs(root); err != nil {
+		return "", fmt.Errorf("invalid %s: %v", envName, err)
+	}
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("it is outside %s", envName)
+	}
+
+	return resolved, nil
+}
+
+// sniffContentType returns contentType when given, otherwise the type
+// registered for the file extension, otherwise the type sniffed from data.
+func sniffContentType(filename, contentType string, data []byte) string {
+	if contentType != "" {
+		return contentType
+	}
+	if byExtension := mime.TypeByExtension(filepath.Ext(filename)); byExtension != "" {
+		return byExtension
+	}
+	return http.DetectContentType(data)
+}
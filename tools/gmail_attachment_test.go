@@ -0,0 +1,111 @@
+package tools
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveInsideDir(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "attachments")
+	if err := os.MkdirAll(filepath.Join(root, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{filepath.Join(root, "report.pdf"), filepath.Join(root, "sub", "notes.txt"), filepath.Join(base, "secret.txt")} {
+		if err := os.WriteFile(name, []byte("data"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(base, "secret.txt"), filepath.Join(root, "escape.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(base, filepath.Join(root, "parent")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "sub", "notes.txt"), filepath.Join(root, "link.txt")); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GMAIL_ATTACHMENT_DIR", root)
+
+	// The temporary directory itself may sit behind a symlink, as /tmp does
+	// on macOS, so expectations are compared after resolving it too.
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		want    string
+		wantErr string
+	}{
+		{name: "relative", path: "report.pdf", want: "report.pdf"},
+		{name: "nested", path: "sub/notes.txt", want: "sub/notes.txt"},
+		{name: "dot dot staying inside", path: "sub/../report.pdf", want: "report.pdf"},
+		{name: "absolute inside", path: filepath.Join(root, "report.pdf"), want: "report.pdf"},
+		{name: "symlink inside", path: "link.txt", want: "sub/notes.txt"},
+		{name: "dot dot", path: "../secret.txt", wantErr: "outside GMAIL_ATTACHMENT_DIR"},
+		{name: "dot dot from nested", path: "sub/../../secret.txt", wantErr: "outside GMAIL_ATTACHMENT_DIR"},
+		{name: "absolute outside", path: filepath.Join(base, "secret.txt"), wantErr: "outside GMAIL_ATTACHMENT_DIR"},
+		{name: "symlink pointing out", path: "escape.txt", wantErr: "outside GMAIL_ATTACHMENT_DIR"},
+		{name: "symlinked directory pointing out", path: "parent/secret.txt", wantErr: "outside GMAIL_ATTACHMENT_DIR"},
+		{name: "missing", path: "missing.txt", wantErr: "no such file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveInsideDir("GMAIL_ATTACHMENT_DIR", tt.path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("resolveInsideDir(%q) = %q, %v; want error containing %q", tt.path, got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveInsideDir(%q): %v", tt.path, err)
+			}
+			if want := filepath.Join(resolvedRoot, filepath.FromSlash(tt.want)); got != want {
+				t.Errorf("resolveInsideDir(%q) = %q, want %q", tt.path, got, want)
+			}
+		})
+	}
+}
+
+func TestResolveInsideDirInvalidRoot(t *testing.T) {
+	t.Setenv("GMAIL_IMPORT_DIR", filepath.Join(t.TempDir(), "missing"))
+
+	if _, err := resolveInsideDir("GMAIL_IMPORT_DIR", "mail.mbox"); err == nil || !strings.Contains(err.Error(), "invalid GMAIL_IMPORT_DIR") {
+		t.Fatalf("err = %v, want invalid GMAIL_IMPORT_DIR", err)
+	}
+}
+
+func TestLoadAttachmentFile(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "dir"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "notes.txt"), []byte("hello"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("GMAIL_ATTACHMENT_DIR", "")
+	if _, err := loadAttachmentFile("notes.txt"); err == nil || !strings.Contains(err.Error(), "GMAIL_ATTACHMENT_DIR must be set") {
+		t.Fatalf("err = %v, want GMAIL_ATTACHMENT_DIR must be set", err)
+	}
+
+	t.Setenv("GMAIL_ATTACHMENT_DIR", root)
+	attachment, err := loadAttachmentFile("notes.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attachment.Filename != "notes.txt" || string(attachment.Data) != "hello" || !strings.HasPrefix(attachment.ContentType, "text/plain") {
+		t.Errorf("attachment = %q %q %q", attachment.Filename, attachment.ContentType, attachment.Data)
+	}
+
+	if _, err := loadAttachmentFile("dir"); err == nil || !strings.Contains(err.Error(), "not a regular file") {
+		t.Errorf("err = %v, want not a regular file", err)
+	}
+}
@@ -0,0 +1,345 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/nguyenvanduocit/google-kit/util"
+	"gopkg.in/yaml.v3"
+)
+
+const gmailHistoryState = "gmail-history.json"
+
+// gmailMaxHistoryRecords caps the history records read by one call; the
+// cursor then stops at the last record read so the next call resumes there.
+const gmailMaxHistoryRecords = 5000
+
+// gmailMaxChangeSummaries caps the added messages whose headers are fetched.
+const gmailMaxChangeSummaries = 100
+
+// gmailHistoryCursor is the stored position in the history of a mailbox.
+type gmailHistoryCursor struct {
+	HistoryID uint64    `json:"historyId"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// gmailHistoryChanges sums up history records. A message added and then
+// deleted within the range only shows up as deleted; label changes are only
+// kept for messages that were neither added nor deleted.
+type gmailHistoryChanges struct {
+	Added         []string
+	Deleted       []string
+	LabelsAdded   map[string][]string
+	LabelsRemoved map[string][]string
+
+	// Next is the history ID to continue from, and More is set when the
+	// records were capped before reaching the present.
+	Next uint64
+	More bool
+}
+
+// gmailHistoryMu serializes reads and updates of the stored cursors.
+var gmailHistoryMu sync.Mutex
+
+// errHistoryExpired is returned by listGmailHistory when the start history
+// ID is too old for users.history.list.
+var errHistoryExpired = errors.New("history ID expired")
+
+// listGmailHistory reads the history records after start, up to
+// gmailMaxHistoryRecords.
+func listGmailHistory(ctx context.Context, start uint64) (*gmailHistoryChanges, error) {
+	type labelDelta struct{ added, removed map[string]bool }
+
+	var (
+		order   []string
+		added   = make(map[string]bool)
+		deleted = make(map[string]bool)
+		deltas  = make(map[string]*labelDelta)
+	)
+	delta := func(id string) *labelDelta {
+		d, ok := deltas[id]
+		if !ok {
+			d = &labelDelta{added: make(map[string]bool), removed: make(map[string]bool)}
+			deltas[id] = d
+			order = append(order, id)
+		}
+		return d
+	}
+
+	changes := &gmailHistoryChanges{Next: start}
+	records := 0
+	pageToken := ""
+
+pages:
+	for {
+		call := gmailService().Users.History.List("me").StartHistoryId(start).Context(ctx)
+		if pageToken != "" {
+			call = call.PageToken(pageToken)
+		}
+
+		resp, err := call.Do()
+		if googleAPIStatus(err) == http.StatusNotFound {
+			return nil, errHistoryExpired
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list history: %v", err)
+		}
+
+		for _, record := range resp.History {
+			if records >= gmailMaxHistoryRecords {
+				changes.More = true
+				break pages
+			}
+			records++
+
+			for _, m := range record.MessagesAdded {
+				if !added[m.Message.Id] {
+					added[m.Message.Id] = true
+					order = append(order, m.Message.Id)
+				}
+			}
+			for _, m := range record.MessagesDeleted {
+				deleted[m.Message.Id] = true
+			}
+			for _, m := range record.LabelsAdded {
+				d := delta(m.Message.Id)
+				for _, label := range m.LabelIds {
+					if d.removed[label] {
+						delete(d.removed, label)
+					} else {
+						d.added[label] = true
+					}
+				}
+			}
+			for _, m := range record.LabelsRemoved {
+				d := delta(m.Message.Id)
+				for _, label := range m.LabelIds {
+					if d.added[label] {
+						delete(d.added, label)
+					} else {
+						d.removed[label] = true
+					}
+				}
+			}
+			changes.Next = record.Id
+		}
+
+		if resp.NextPageToken == "" {
+			if resp.HistoryId != 0 {
+				changes.Next = resp.HistoryId
+			}
+			break
+		}
+		pageToken = resp.NextPageToken
+	}
+
+	changes.LabelsAdded = make(map[string][]string)
+	changes.LabelsRemoved = make(map[string][]string)
+	seen := make(map[string]bool)
+	for _, id := range order {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		switch {
+		case deleted[id]:
+			changes.Deleted = append(changes.Deleted, id)
+		case added[id]:
+			changes.Added = append(changes.Added, id)
+		case deltas[id] != nil:
+			for label := range deltas[id].added {
+				changes.LabelsAdded[id] = append(changes.LabelsAdded[id], label)
+			}
+			for label := range deltas[id].removed {
+				changes.LabelsRemoved[id] = append(changes.LabelsRemoved[id], label)
+			}
+			sort.Strings(changes.LabelsAdded[id])
+			sort.Strings(changes.LabelsRemoved[id])
+		}
+	}
+	// Deleted messages that were never seen otherwise.
+	for id := range deleted {
+		if !seen[id] {
+			changes.Deleted = append(changes.Deleted, id)
+		}
+	}
+	sort.Strings(changes.Deleted)
+
+	return changes, nil
+}
+
+// gmailResyncSince lists the messages received after since, as a fallback
+// when the history cursor expired. truncated reports that more than
+// gmailMaxHistoryRecords messages arrived and only the first were listed.
+func gmailResyncSince(ctx context.Context, since time.Time) (ids []string, truncated bool, err error) {
+	ids, _, truncated, err = gmailModifyTargets(ctx, map[string]interface{}{
+		"query":        fmt.Sprintf("after:%d", since.Unix()),
+		"max_messages": float64(gmailMaxHistoryRecords),
+	}, false)
+	return ids, truncated, err
+}
+
+func gmailChangesHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	request := util.RequestFromArguments(arguments)
+	ctx := request.Context()
+
+	peek, _ := arguments["peek"].(bool)
+	reset, _ := arguments["reset"].(bool)
+
+	gmailHistoryMu.Lock()
+	defer gmailHistoryMu.Unlock()
+
+	profile, err := gmailService().Users.GetProfile("me").Context(ctx).Do()
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to get profile: %v", err)), nil
+	}
+
+	cursors := make(map[string]gmailHistoryCursor)
+	if err := util.LoadState(gmailHistoryState, &cursors); err != nil {
+		log.Printf("Failed to load Gmail history cursors: %v", err)
+	}
+	cursor, ok := cursors[profile.EmailAddress]
+
+	save := func(historyID uint64) {
+		if peek {
+			return
+		}
+		cursors[profile.EmailAddress] = gmailHistoryCursor{HistoryID: historyID, UpdatedAt: time.Now()}
+		if err := util.SaveState(gmailHistoryState, cursors); err != nil {
+			log.Printf("Failed to save Gmail history cursors: %v", err)
+		}
+	}
+
+	result := map[string]interface{}{
+		"account": profile.EmailAddress,
+	}
+
+	if !ok || reset {
+		save(profile.HistoryId)
+		result["historyId"] = strconv.FormatUint(profile.HistoryId, 10)
+		result["note"] = "no earlier cursor; changes are reported from now on"
+		return changesResult(result)
+	}
+	result["since"] = cursor.UpdatedAt.Format(time.RFC3339)
+
+	changes, err := listGmailHistory(ctx, cursor.HistoryID)
+	if err == errHistoryExpired {
+		// Gmail keeps about a week of history. Fall back to listing what
+		// arrived since the last call; deletions and label changes in
+		// between cannot be recovered.
+		ids, truncated, err := gmailResyncSince(ctx, cursor.UpdatedAt)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		// The cursor moves to the present either way: search lists the
+		// newest messages first, so a truncated listing cannot be
+		// continued and more is never set.
+		changes = &gmailHistoryChanges{Added: ids, Next: profile.HistoryId}
+		result["resync"] = true
+		result["note"] = "the stored cursor expired; added lists messages received since the last call, and deletions and label changes are unknown"
+		if truncated {
+			result["truncated"] = true
+			result["note"] = fmt.Sprintf("the stored cursor expired; added lists only the newest %d of the messages received since the last call, and deletions and label changes are unknown", len(ids))
+		}
+	} else if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	if request.Cancelled() {
+		result["partial"] = true
+		return changesResult(result)
+	}
+
+	labels, err := listGmailLabels(ctx)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	labelNames := func(ids []string) []string {
+		names := make([]string, len(ids))
+		for i, id := range ids {
+			names[i] = id
+			if label := labels.find(id); label != nil {
+				names[i] = label.Name
+			}
+		}
+		return names
+	}
+
+	summaryIDs := changes.Added[:min(len(changes.Added), gmailMaxChangeSummaries)]
+	fetched, errs := fetchGmailSummaries(ctx, summaryIDs, func(done int) {
+		request.Progress(done, len(summaryIDs), "Fetching messages")
+	})
+	added := make([]map[string]interface{}, 0, len(changes.Added))
+	for i, message := range fetched {
+		if errs[i] != nil {
+			// The message may have been deleted since.
+			added = append(added, map[string]interface{}{"id": summaryIDs[i]})
+			continue
+		}
+		summary := gmailSummary(message)
+		summary["labels"] = labelNames(message.LabelIds)
+		added = append(added, summary)
+	}
+	for _, id := range changes.Added[len(summaryIDs):] {
+		added = append(added, map[string]interface{}{"id": id})
+	}
+
+	labelChanges := make([]map[string]interface{}, 0, len(changes.LabelsAdded))
+	ids := make([]string, 0, len(changes.LabelsAdded))
+	for id := range changes.LabelsAdded {
+		ids = append(ids, id)
+	}
+	for id := range changes.LabelsRemoved {
+		if _, ok := changes.LabelsAdded[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if len(changes.LabelsAdded[id]) == 0 && len(changes.LabelsRemoved[id]) == 0 {
+			continue
+		}
+		change := map[string]interface{}{"id": id}
+		if len(changes.LabelsAdded[id]) > 0 {
+			change["added"] = labelNames(changes.LabelsAdded[id])
+		}
+		if len(changes.LabelsRemoved[id]) > 0 {
+			change["removed"] = labelNames(changes.LabelsRemoved[id])
+		}
+		labelChanges = append(labelChanges, change)
+	}
+
+	result["added"] = added
+	result["deleted"] = changes.Deleted
+	result["labelChanges"] = labelChanges
+	result["historyId"] = strconv.FormatUint(changes.Next, 10)
+	if changes.More {
+		result["more"] = true
+	}
+
+	if request.Cancelled() {
+		result["partial"] = true
+	} else {
+		save(changes.Next)
+	}
+
+	return changesResult(result)
+}
+
+func changesResult(result map[string]interface{}) (*mcp.CallToolResult, error) {
+	yamlResult, err := yaml.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to marshal changes: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(yamlResult)), nil
+}
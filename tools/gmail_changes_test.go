@@ -0,0 +1,70 @@
+package tools
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nguyenvanduocit/google-kit/util"
+)
+
+func TestGmailChangesTruncatedResync(t *testing.T) {
+	const total = gmailMaxHistoryRecords + 1
+	t.Setenv("STATE_DIR", t.TempDir())
+
+	cursors := map[string]gmailHistoryCursor{
+		"me@example.com": {HistoryID: 100, UpdatedAt: time.Now().Add(-30 * 24 * time.Hour)},
+	}
+	if err := util.SaveState(gmailHistoryState, cursors); err != nil {
+		t.Fatal(err)
+	}
+
+	fakeGoogle(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/gmail/v1/users/me/")
+		switch {
+		case path == "profile":
+			writeJSON(w, map[string]interface{}{"emailAddress": "me@example.com", "historyId": "900"})
+		case path == "history":
+			w.WriteHeader(http.StatusNotFound)
+			writeJSON(w, map[string]interface{}{"error": map[string]interface{}{"code": 404, "message": "Requested entity was not found."}})
+		case path == "labels":
+			writeJSON(w, map[string]interface{}{"labels": []interface{}{}})
+		case path == "messages":
+			start, end, next := fakePage(r, "maxResults", total)
+			messages := make([]map[string]string, 0, end-start)
+			for i := start; i < end; i++ {
+				messages = append(messages, map[string]string{"id": fmt.Sprint(i)})
+			}
+			writeJSON(w, map[string]interface{}{"messages": messages, "nextPageToken": next})
+		case strings.HasPrefix(path, "messages/"):
+			writeJSON(w, map[string]interface{}{"id": strings.TrimPrefix(path, "messages/")})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	result, err := gmailChangesHandler(map[string]interface{}{})
+	decoded := resultYAML(t, result, err)
+
+	if decoded["resync"] != true || decoded["truncated"] != true {
+		t.Errorf("resync = %v, truncated = %v; want both true", decoded["resync"], decoded["truncated"])
+	}
+	if _, ok := decoded["more"]; ok {
+		t.Error("a truncated resync reports more, but cannot be continued")
+	}
+	if added, _ := decoded["added"].([]interface{}); len(added) != gmailMaxHistoryRecords {
+		t.Errorf("%d messages added, want %d", len(added), gmailMaxHistoryRecords)
+	}
+	if note, _ := decoded["note"].(string); !strings.Contains(note, fmt.Sprint(gmailMaxHistoryRecords)) {
+		t.Errorf("note = %q, want it to say how many messages are listed", note)
+	}
+
+	if err := util.LoadState(gmailHistoryState, &cursors); err != nil {
+		t.Fatal(err)
+	}
+	if got := cursors["me@example.com"].HistoryID; got != 900 {
+		t.Errorf("cursor = %d, want 900", got)
+	}
+}
@@ -0,0 +1,297 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/nguyenvanduocit/google-kit/email"
+	"github.com/nguyenvanduocit/google-kit/util"
+	"google.golang.org/api/gmail/v1"
+	"gopkg.in/yaml.v3"
+)
+
+func gmailDraftHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	action, ok := arguments["action"].(string)
+	if !ok {
+		return mcp.NewToolResultError("action must be a string"), nil
+	}
+
+	switch action {
+	case "create":
+		return gmailCreateDraftHandler(arguments)
+	case "list":
+		return gmailListDraftsHandler(arguments)
+	case "get":
+		return gmailGetDraftHandler(arguments)
+	case "update":
+		return gmailUpdateDraftHandler(arguments)
+	case "send":
+		return gmailSendDraftHandler(arguments)
+	case "delete":
+		return gmailDeleteDraftHandler(arguments)
+	default:
+		return mcp.NewToolResultError("Invalid action. Must be one of: create, list, get, update, send, delete"), nil
+	}
+}
+
+func gmailCreateDraftHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	ctx := util.RequestFromArguments(arguments).Context()
+
+	message := &email.Message{}
+	threadID := ""
+
+	if replyToID, _ := arguments["reply_to_message_id"].(string); replyToID != "" {
+		target, err := getReplyTarget(ctx, replyToID)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		self, err := myAddresses(ctx)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		target.apply(message)
+		message.To, _ = target.replyRecipients(false, self)
+		threadID = target.ThreadID
+	}
+
+	if err := applyComposeArguments(ctx, message, arguments); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	raw, err := message.Bytes()
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to build draft: %v", err)), nil
+	}
+
+	draft, err := createGmailDraft(ctx, raw, threadID)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to create draft: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("Successfully created draft with ID: %s", draft.Id)), nil
+}
+
+func gmailListDraftsHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	request := util.RequestFromArguments(arguments)
+	page := util.PageFromArguments(arguments, 20, 500)
+	query, _ := arguments["query"].(string)
+
+	drafts, nextPageToken, err := util.Paginate(page, func(pageToken string, pageSize int64) ([]*gmail.Draft, string, error) {
+		listCall := gmailService().Users.Drafts.List("me").MaxResults(pageSize).Context(request.Context())
+		if query != "" {
+			listCall = listCall.Q(query)
+		}
+		if pageToken != "" {
+			listCall = listCall.PageToken(pageToken)
+		}
+
+		resp, err := listCall.Do()
+		if err != nil {
+			return nil, "", err
+		}
+		return resp.Drafts, resp.NextPageToken, nil
+	})
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to list drafts: %v", err)), nil
+	}
+
+	ids := make([]string, len(drafts))
+	for i, draft := range drafts {
+		ids[i] = draft.Message.Id
+	}
+
+	fetched, errs := fetchGmailSummaries(request.Context(), ids, func(done int) {
+		request.Progress(done, len(ids), "Fetching drafts")
+	}, "To", "Cc", "Bcc", "Subject", "Date")
+
+	draftsList := make([]map[string]interface{}, 0, len(drafts))
+	for i, message := range fetched {
+		if errs[i] != nil {
+			if !request.Cancelled() {
+				log.Printf("Failed to get draft %s: %v", drafts[i].Id, errs[i])
+			}
+			continue
+		}
+
+		draftInfo := gmailSummary(message)
+		draftInfo["messageId"] = draftInfo["id"]
+		draftInfo["id"] = drafts[i].Id
+		draftsList = append(draftsList, draftInfo)
+	}
+
+	result := map[string]interface{}{
+		"count":           len(draftsList),
+		"drafts":          draftsList,
+		"next_page_token": nextPageToken,
+	}
+	if request.Cancelled() {
+		result["partial"] = true
+	}
+
+	yamlResult, err := yaml.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to marshal drafts: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(yamlResult)), nil
+}
+
+func gmailGetDraftHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	draftID, _ := arguments["draft_id"].(string)
+	if draftID == "" {
+		return mcp.NewToolResultError("draft_id is required for get action"), nil
+	}
+
+	draft, err := gmailService().Users.Drafts.Get("me", draftID).Format("full").Do()
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to get draft: %v", err)), nil
+	}
+
+	content := gmailContent(draft.Message)
+
+	draftInfo := map[string]interface{}{
+		"id":        draft.Id,
+		"messageId": draft.Message.Id,
+		"threadId":  draft.Message.ThreadId,
+	}
+	for _, header := range draft.Message.Payload.Headers {
+		switch strings.ToLower(header.Name) {
+		case "from", "to", "cc", "bcc", "subject", "in-reply-to":
+			draftInfo[strings.ToLower(header.Name)] = email.DecodeHeader(header.Value)
+		}
+	}
+
+	draftInfo["body"] = content.Body("text")
+	if content.HTML != "" {
+		draftInfo["html_body"] = content.HTML
+	}
+
+	if len(content.Attachments) > 0 {
+		attachments := make([]map[string]interface{}, 0, len(content.Attachments))
+		for _, part := range content.Attachments {
+			attachments = append(attachments, gmailAttachmentInfo(part))
+		}
+		draftInfo["attachments"] = attachments
+	}
+
+	yamlResult, err := yaml.Marshal(draftInfo)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to marshal draft: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(yamlResult)), nil
+}
+
+func gmailUpdateDraftHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	ctx := util.RequestFromArguments(arguments).Context()
+
+	draftID, _ := arguments["draft_id"].(string)
+	if draftID == "" {
+		return mcp.NewToolResultError("draft_id is required for update action"), nil
+	}
+
+	draft, err := gmailService().Users.Drafts.Get("me", draftID).Format("full").Context(ctx).Do()
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to get draft: %v", err)), nil
+	}
+
+	message, err := draftMessage(ctx, draft.Message)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	if err := applyComposeArguments(ctx, message, arguments); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	raw, err := message.Bytes()
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to build draft: %v", err)), nil
+	}
+
+	updated, err := updateGmailDraft(ctx, draftID, raw, draft.Message.ThreadId)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to update draft: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("Successfully updated draft with ID: %s", updated.Id)), nil
+}
+
+func gmailSendDraftHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	draftID, _ := arguments["draft_id"].(string)
+	if draftID == "" {
+		return mcp.NewToolResultError("draft_id is required for send action"), nil
+	}
+
+	sent, err := gmailService().Users.Drafts.Send("me", &gmail.Draft{Id: draftID}).Do()
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to send draft: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("Draft sent successfully. Message ID: %s, Thread ID: %s", sent.Id, sent.ThreadId)), nil
+}
+
+func gmailDeleteDraftHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	draftID, _ := arguments["draft_id"].(string)
+	if draftID == "" {
+		return mcp.NewToolResultError("draft_id is required for delete action"), nil
+	}
+
+	if err := gmailService().Users.Drafts.Delete("me", draftID).Do(); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to delete draft: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("Successfully deleted draft with ID: %s", draftID)), nil
+}
+
+// draftMessage rebuilds an editable message from a draft fetched in full
+// format, downloading its attachments so they survive the update.
+func draftMessage(ctx context.Context, draft *gmail.Message) (*email.Message, error) {
+	message := &email.Message{}
+
+	for _, header := range draft.Payload.Headers {
+		switch strings.ToLower(header.Name) {
+		case "from":
+			if from := parseHeaderAddresses(header.Value); len(from) > 0 {
+				message.From = from[0]
+			}
+		case "to":
+			message.To = parseHeaderAddresses(header.Value)
+		case "cc":
+			message.Cc = parseHeaderAddresses(header.Value)
+		case "bcc":
+			message.Bcc = parseHeaderAddresses(header.Value)
+		case "reply-to":
+			message.ReplyTo = parseHeaderAddresses(header.Value)
+		case "subject":
+			message.Subject = email.DecodeHeader(header.Value)
+		case "in-reply-to", "references":
+			message.Headers = append(message.Headers, email.Header{Name: header.Name, Value: header.Value})
+		}
+	}
+
+	content := gmailContent(draft)
+	message.Text = content.Text
+	message.HTML = content.HTML
+
+	for _, part := range content.Attachments {
+		data, err := gmailAttachmentData(ctx, draft.Id, part)
+		if err != nil {
+			return nil, err
+		}
+
+		message.Attachments = append(message.Attachments, email.Attachment{
+			Filename:    part.Filename,
+			ContentType: part.MediaType,
+			ContentID:   part.ContentID(),
+			Inline:      isInlinePart(part),
+			Data:        data,
+		})
+	}
+
+	return message, nil
+}
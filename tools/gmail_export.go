@@ -0,0 +1,488 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/nguyenvanduocit/google-kit/email"
+	"github.com/nguyenvanduocit/google-kit/util"
+	"google.golang.org/api/gmail/v1"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	gmailExportManifest     = "manifest.csv"
+	gmailExportManifestJSON = "manifest.json"
+	gmailExportMbox         = "messages.mbox"
+	gmailExportMessages     = "messages"
+)
+
+// gmailExportColumns are the columns of the manifest. offset and length
+// locate a message in the mbox file and are empty for EML exports.
+var gmailExportColumns = []string{"id", "threadId", "date", "from", "subject", "labels", "size", "sha256", "file", "offset", "length"}
+
+// gmailExport is an export directory being written. Its manifest doubles as
+// the checkpoint: a message is done once its row is written, which happens
+// after its file or mbox entry is complete.
+type gmailExport struct {
+	dir      string
+	format   string
+	labels   *gmailLabels
+	done     map[string]bool
+	manifest *os.File
+	mbox     *os.File
+	// offset is where the next mbox entry starts.
+	offset int64
+}
+
+// openGmailExport opens the export in dir, creating it or resuming it.
+// What a crash may have left after the last manifest row is cut off.
+func openGmailExport(dir, format string, labels *gmailLabels) (*gmailExport, error) {
+	messagesDir := dir
+	if format == "eml" {
+		messagesDir = filepath.Join(dir, gmailExportMessages)
+	}
+	if err := os.MkdirAll(messagesDir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create export directory: %v", err)
+	}
+
+	e := &gmailExport{dir: dir, format: format, labels: labels, done: make(map[string]bool)}
+
+	path := filepath.Join(dir, gmailExportManifest)
+	manifest, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open manifest: %v", err)
+	}
+	e.manifest = manifest
+
+	end, err := e.readManifest()
+	if err == nil && end == 0 {
+		_, err = manifest.Write(csvRow(gmailExportColumns))
+	} else if err == nil {
+		if err = manifest.Truncate(end); err == nil {
+			_, err = manifest.Seek(end, io.SeekStart)
+		}
+	}
+	if err != nil {
+		e.close()
+		return nil, err
+	}
+
+	if format == "mbox" {
+		e.mbox, err = os.OpenFile(filepath.Join(dir, gmailExportMbox), os.O_RDWR|os.O_CREATE, 0o600)
+		if err == nil {
+			if err = e.mbox.Truncate(e.offset); err == nil {
+				_, err = e.mbox.Seek(e.offset, io.SeekStart)
+			}
+		}
+		if err != nil {
+			e.close()
+			return nil, fmt.Errorf("failed to open %s: %v", gmailExportMbox, err)
+		}
+	}
+
+	return e, nil
+}
+
+// readManifest loads the messages already exported and returns the offset
+// after the last complete row, or 0 for a new manifest.
+func (e *gmailExport) readManifest() (int64, error) {
+	r := csv.NewReader(e.manifest)
+	r.FieldsPerRecord = len(gmailExportColumns)
+
+	header, err := r.Read()
+	if err == io.EOF {
+		return 0, nil
+	}
+	if err != nil || !slices.Equal(header, gmailExportColumns) {
+		return 0, fmt.Errorf("%s is not an export manifest", filepath.Join(e.dir, gmailExportManifest))
+	}
+
+	end := r.InputOffset()
+	for {
+		record, err := r.Read()
+		if err != nil {
+			// EOF, or a row torn by a crash, which is dropped.
+			return end, nil
+		}
+		// The last row may also have every field but be cut inside the
+		// last one, which only its missing newline shows.
+		var last [1]byte
+		if _, err := e.manifest.ReadAt(last[:], r.InputOffset()-1); err != nil || last[0] != '\n' {
+			return end, nil
+		}
+
+		if isMbox := record[8] == gmailExportMbox; isMbox != (e.format == "mbox") {
+			return 0, fmt.Errorf("%s holds an export in another format; use a new name", e.dir)
+		}
+		if e.format == "mbox" {
+			offset, _ := strconv.ParseInt(record[9], 10, 64)
+			length, _ := strconv.ParseInt(record[10], 10, 64)
+			e.offset = max(e.offset, offset+length)
+		}
+		e.done[record[0]] = true
+		end = r.InputOffset()
+	}
+}
+
+// write stores a message fetched in raw format and records it in the
+// manifest.
+func (e *gmailExport) write(message *gmail.Message, raw []byte) error {
+	var header mail.Header
+	if parsed, err := mail.ReadMessage(bytes.NewReader(raw)); err == nil {
+		header = parsed.Header
+	} else {
+		header = mail.Header{}
+	}
+
+	date := time.UnixMilli(message.InternalDate)
+	sum := sha256.Sum256(raw)
+
+	labels := make([]string, len(message.LabelIds))
+	for i, id := range message.LabelIds {
+		labels[i] = id
+		if label := e.labels.find(id); label != nil {
+			labels[i] = label.Name
+		}
+	}
+
+	row := []string{
+		message.Id,
+		message.ThreadId,
+		date.Format(time.RFC3339),
+		email.DecodeHeader(header.Get("From")),
+		email.DecodeHeader(header.Get("Subject")),
+		strings.Join(labels, "; "),
+		strconv.Itoa(len(raw)),
+		hex.EncodeToString(sum[:]),
+	}
+
+	switch e.format {
+	case "mbox":
+		sender := ""
+		if address, err := mail.ParseAddress(header.Get("From")); err == nil {
+			sender = address.Address
+		}
+		offset := e.offset
+		n, err := email.NewMboxWriter(e.mbox).WriteMessage(sender, date, raw)
+		e.offset += n
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %v", gmailExportMbox, err)
+		}
+		row = append(row, gmailExportMbox, strconv.FormatInt(offset, 10), strconv.FormatInt(n, 10))
+	default:
+		file := filepath.Join(gmailExportMessages, util.SafeFilename(message.Id)+".eml")
+		if err := util.WriteFileAtomic(filepath.Join(e.dir, file), raw, 0o600); err != nil {
+			return err
+		}
+		row = append(row, filepath.ToSlash(file), "", "")
+	}
+
+	// One write per row, so that a crash tears at most the last one.
+	if _, err := e.manifest.Write(csvRow(row)); err != nil {
+		return fmt.Errorf("failed to write manifest: %v", err)
+	}
+	e.done[message.Id] = true
+	return nil
+}
+
+// writeJSONManifest writes manifest.json from the CSV manifest, one row at
+// a time.
+func (e *gmailExport) writeJSONManifest() (string, error) {
+	path := filepath.Join(e.dir, gmailExportManifestJSON)
+	err := util.WriteFileAtomicFunc(path, 0o600, func(w io.Writer) error {
+		manifest, err := os.Open(filepath.Join(e.dir, gmailExportManifest))
+		if err != nil {
+			return err
+		}
+		defer manifest.Close()
+
+		r := csv.NewReader(manifest)
+		if _, err := r.Read(); err != nil {
+			return err
+		}
+
+		if _, err := io.WriteString(w, "[\n"); err != nil {
+			return err
+		}
+		for first := true; ; first = false {
+			record, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+
+			entry := make(map[string]interface{}, len(record))
+			for i, column := range gmailExportColumns {
+				switch {
+				case record[i] == "":
+				case column == "labels":
+					entry[column] = strings.Split(record[i], "; ")
+				case column == "size" || column == "offset" || column == "length":
+					entry[column], _ = strconv.ParseInt(record[i], 10, 64)
+				default:
+					entry[column] = record[i]
+				}
+			}
+			data, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			if !first {
+				data = append([]byte(",\n"), data...)
+			}
+			if _, err := w.Write(data); err != nil {
+				return err
+			}
+		}
+		_, err = io.WriteString(w, "\n]\n")
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to write %s: %v", gmailExportManifestJSON, err)
+	}
+	return path, nil
+}
+
+func (e *gmailExport) close() {
+	e.manifest.Close()
+	if e.mbox != nil {
+		e.mbox.Close()
+	}
+}
+
+// csvRow encodes one CSV row.
+func csvRow(fields []string) []byte {
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	_ = w.Write(fields)
+	w.Flush()
+	return b.Bytes()
+}
+
+// gmailExportHandler writes messages, as Gmail stores them, to EML files or
+// an mboxrd file in GMAIL_EXPORT_DIR, with a manifest. Calling it again
+// with the same name resumes the export, skipping what is already written.
+func gmailExportHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	request := util.RequestFromArguments(arguments)
+
+	dir := os.Getenv("GMAIL_EXPORT_DIR")
+	if dir == "" {
+		return mcp.NewToolResultError("GMAIL_EXPORT_DIR must be set to export messages"), nil
+	}
+
+	format, _ := arguments["format"].(string)
+	if format == "" {
+		format = "eml"
+	}
+	if format != "eml" && format != "mbox" {
+		return mcp.NewToolResultError(fmt.Sprintf("invalid format: %s. Must be one of: eml, mbox", format)), nil
+	}
+	manifestFormat, _ := arguments["manifest"].(string)
+	if manifestFormat == "" {
+		manifestFormat = "csv"
+	}
+	if manifestFormat != "csv" && manifestFormat != "json" {
+		return mcp.NewToolResultError(fmt.Sprintf("invalid manifest: %s. Must be one of: csv, json", manifestFormat)), nil
+	}
+
+	name, _ := arguments["name"].(string)
+	if name == "" {
+		name = "gmail-export-" + time.Now().Format("20060102-150405")
+	}
+	name = util.SafeFilename(name)
+	includeSpamTrash, _ := arguments["include_spam_trash"].(bool)
+
+	// Messages named by ID are collected up front; the messages a query
+	// matches are exported a page at a time, however many there are.
+	query, _ := arguments["query"].(string)
+	limit := 0
+	if value, ok := arguments["max_messages"].(float64); ok && value > 0 {
+		limit = int(value)
+	}
+	var (
+		ids    []string
+		failed []map[string]string
+	)
+	if len(util.StringsFromArguments(arguments, "message_ids")) > 0 || len(util.StringsFromArguments(arguments, "thread_ids")) > 0 {
+		var err error
+		ids, failed, _, err = gmailModifyTargets(request.Context(), map[string]interface{}{
+			"message_ids": arguments["message_ids"],
+			"thread_ids":  arguments["thread_ids"],
+		}, includeSpamTrash)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+	} else if query == "" {
+		return mcp.NewToolResultError("one of message_ids, thread_ids or query is required"), nil
+	}
+
+	labels, err := listGmailLabels(request.Context())
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	export, err := openGmailExport(filepath.Join(dir, name), format, labels)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	defer export.close()
+
+	// Writes are serialized, and a failed write stops the export: the
+	// disk is likely full, and the mbox must stay in one piece.
+	ctx, cancel := context.WithCancel(request.Context())
+	defer cancel()
+	var (
+		mu       sync.Mutex
+		writeErr error
+		exported int
+		already  int
+		fetched  int
+		total    int
+		seen     = make(map[string]bool)
+	)
+	// exportMessages fetches and writes the messages of ids that were not
+	// exported yet.
+	exportMessages := func(ids []string) {
+		pending := make([]string, 0, len(ids))
+		for _, id := range ids {
+			switch {
+			case seen[id]:
+				continue
+			case export.done[id]:
+				already++
+			default:
+				pending = append(pending, id)
+			}
+			seen[id] = true
+		}
+		total = max(total, len(seen))
+
+		errs := gmailParallel(ctx, len(pending), func(done int) {
+			request.Progress(already+fetched+done, total, "Exporting messages")
+		}, func(i int) error {
+			message, err := gmailService().Users.Messages.Get("me", pending[i]).Format("raw").Context(ctx).Do()
+			if err != nil {
+				return err
+			}
+			raw, err := email.DecodeBase64(message.Raw)
+			if err != nil {
+				return fmt.Errorf("failed to decode message: %v", err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if writeErr != nil {
+				return writeErr
+			}
+			if err := export.write(message, raw); err != nil {
+				writeErr = err
+				cancel()
+				return err
+			}
+			exported++
+			return nil
+		})
+		fetched += len(pending)
+
+		for i, err := range errs {
+			if err != nil && err != writeErr && !errors.Is(err, context.Canceled) {
+				failed = append(failed, map[string]string{"id": pending[i], "error": err.Error()})
+			}
+		}
+	}
+
+	exportMessages(ids)
+
+	truncated := false
+	if query != "" && writeErr == nil {
+		queried := 0
+		call := gmailService().Users.Messages.List("me").Q(query).IncludeSpamTrash(includeSpamTrash).MaxResults(500).Context(ctx)
+		err := call.Pages(ctx, func(resp *gmail.ListMessagesResponse) error {
+			if queried == 0 {
+				total = len(seen) + int(resp.ResultSizeEstimate)
+			}
+			page := make([]string, 0, len(resp.Messages))
+			for _, message := range resp.Messages {
+				if limit > 0 && queried >= limit {
+					truncated = true
+					break
+				}
+				queried++
+				page = append(page, message.Id)
+			}
+			exportMessages(page)
+
+			switch {
+			case writeErr != nil:
+				return writeErr
+			case truncated:
+				return errStopPaging
+			}
+			return ctx.Err()
+		})
+		if err != nil && err != errStopPaging && err != writeErr && !errors.Is(err, context.Canceled) {
+			return mcp.NewToolResultError(fmt.Sprintf("export stopped after %d messages: failed to search emails: %v; call again with name %q to resume", exported, err, name)), nil
+		}
+	}
+
+	if writeErr != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("export stopped after %d messages: %v; call again with name %q to resume", exported, writeErr, name)), nil
+	}
+
+	result := map[string]interface{}{
+		"name":             name,
+		"directory":        export.dir,
+		"format":           format,
+		"matched":          len(seen),
+		"exported":         exported,
+		"already_exported": already,
+		"manifest":         filepath.Join(export.dir, gmailExportManifest),
+	}
+	if manifestFormat == "json" {
+		path, err := export.writeJSONManifest()
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		result["manifest"] = path
+	}
+	if format == "mbox" {
+		result["file"] = filepath.Join(export.dir, gmailExportMbox)
+	}
+	if truncated {
+		result["truncated"] = true
+		result["note"] = fmt.Sprintf("the query matched more than max_messages messages; call again with name %q and a higher max_messages to export the rest", name)
+	}
+	if len(failed) > 0 {
+		result["failed"] = failed
+	}
+	if request.Cancelled() {
+		result["partial"] = true
+		result["note"] = fmt.Sprintf("call again with name %q to resume", name)
+	}
+
+	yamlResult, err := yaml.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(yamlResult)), nil
+}
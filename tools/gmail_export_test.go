@@ -0,0 +1,137 @@
+package tools
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeExportMailbox serves a mailbox of total numbered messages.
+func fakeExportMailbox(t *testing.T, total int) {
+	fakeGoogle(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/gmail/v1/users/me/")
+		switch {
+		case path == "labels":
+			writeJSON(w, map[string]interface{}{"labels": []interface{}{}})
+		case path == "messages":
+			start, end, next := fakePage(r, "maxResults", total)
+			messages := make([]map[string]string, 0, end-start)
+			for i := start; i < end; i++ {
+				messages = append(messages, map[string]string{"id": fmt.Sprint(i)})
+			}
+			writeJSON(w, map[string]interface{}{"messages": messages, "nextPageToken": next, "resultSizeEstimate": total})
+		case strings.HasPrefix(path, "messages/"):
+			id := strings.TrimPrefix(path, "messages/")
+			raw := fmt.Sprintf("From: a@example.com\r\nSubject: Message %s\r\n\r\nBody %s\r\n", id, id)
+			writeJSON(w, map[string]interface{}{"id": id, "threadId": "t" + id, "raw": base64.URLEncoding.EncodeToString([]byte(raw))})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestGmailExportPagesThroughQuery(t *testing.T) {
+	const total = 1203
+	dir := t.TempDir()
+	t.Setenv("GMAIL_EXPORT_DIR", dir)
+
+	fakeExportMailbox(t, total)
+
+	manifestRows := func(name string) int {
+		t.Helper()
+		f, err := os.Open(filepath.Join(dir, name, gmailExportManifest))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		rows := 0
+		for scanner := bufio.NewScanner(f); scanner.Scan(); {
+			rows++
+		}
+		return rows - 1
+	}
+
+	t.Run("everything", func(t *testing.T) {
+		result, err := gmailExportHandler(map[string]interface{}{"query": "in:anywhere", "name": "all"})
+		decoded := resultYAML(t, result, err)
+		if decoded["matched"] != total || decoded["exported"] != total {
+			t.Errorf("matched %v and exported %v, want %d", decoded["matched"], decoded["exported"], total)
+		}
+		if _, ok := decoded["truncated"]; ok {
+			t.Error("an export of every match is flagged truncated")
+		}
+		if rows := manifestRows("all"); rows != total {
+			t.Errorf("manifest has %d rows, want %d", rows, total)
+		}
+	})
+
+	t.Run("capped and resumed", func(t *testing.T) {
+		result, err := gmailExportHandler(map[string]interface{}{"query": "in:anywhere", "name": "capped", "max_messages": float64(600)})
+		decoded := resultYAML(t, result, err)
+		if decoded["exported"] != 600 || decoded["truncated"] != true {
+			t.Errorf("exported %v, truncated %v; want 600 and true", decoded["exported"], decoded["truncated"])
+		}
+		if note, _ := decoded["note"].(string); !strings.Contains(note, "max_messages") {
+			t.Errorf("note = %q, want it to mention max_messages", note)
+		}
+
+		result, err = gmailExportHandler(map[string]interface{}{"query": "in:anywhere", "name": "capped", "max_messages": float64(2000)})
+		decoded = resultYAML(t, result, err)
+		if decoded["already_exported"] != 600 || decoded["exported"] != total-600 {
+			t.Errorf("already exported %v and exported %v, want 600 and %d", decoded["already_exported"], decoded["exported"], total-600)
+		}
+		if rows := manifestRows("capped"); rows != total {
+			t.Errorf("manifest has %d rows, want %d", rows, total)
+		}
+	})
+}
+
+func TestGmailExportResumesAfterTornManifestRow(t *testing.T) {
+	const total = 5
+	dir := t.TempDir()
+	t.Setenv("GMAIL_EXPORT_DIR", dir)
+	fakeExportMailbox(t, total)
+
+	arguments := map[string]interface{}{"query": "in:anywhere", "name": "torn", "format": "mbox"}
+	result, err := gmailExportHandler(arguments)
+	resultYAML(t, result, err)
+
+	mboxPath := filepath.Join(dir, "torn", gmailExportMbox)
+	want, err := os.ReadFile(mboxPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A write stopped partway leaves the last row with every field but
+	// its length cut short and no newline.
+	manifestPath := filepath.Join(dir, "torn", gmailExportManifest)
+	manifest, err := os.ReadFile(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	torn := strings.TrimSuffix(string(manifest), "\n")
+	torn = strings.TrimSuffix(torn, "\r")
+	torn = torn[:len(torn)-1]
+	if err := os.WriteFile(manifestPath, []byte(torn), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err = gmailExportHandler(arguments)
+	decoded := resultYAML(t, result, err)
+	if decoded["already_exported"] != total-1 || decoded["exported"] != 1 {
+		t.Errorf("already exported %v and exported %v, want %d and 1", decoded["already_exported"], decoded["exported"], total-1)
+	}
+
+	got, err := os.ReadFile(mboxPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("mbox after resuming differs:\n--- got ---\n%s\n--- want ---\n%s", got, want)
+	}
+}
@@ -0,0 +1,123 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/nguyenvanduocit/google-kit/email"
+	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// gmailSummaryHeaders are the headers fetched for message listings.
+var gmailSummaryHeaders = []string{"From", "To", "Subject", "Date"}
+
+// gmailSummaryFields limits messages.get responses to what listings show.
+const gmailSummaryFields googleapi.Field = "id,threadId,labelIds,snippet,internalDate,payload/headers"
+
+// gmailFetchConcurrency returns the maximum number of concurrent
+// messages.get calls, configurable with GMAIL_FETCH_CONCURRENCY (default 8).
+func gmailFetchConcurrency() int {
+	if n, err := strconv.Atoi(os.Getenv("GMAIL_FETCH_CONCURRENCY")); err == nil && n > 0 {
+		return n
+	}
+	return 8
+}
+
+// fetchGmailSummaries fetches the metadata of the given messages with a
+// bounded worker pool. The result keeps the order of ids; messages that
+// could not be fetched are nil and their error is set at the same index.
+// progress, if not nil, is called after each fetch with the number done.
+// headers overrides gmailSummaryHeaders when given.
+func fetchGmailSummaries(ctx context.Context, ids []string, progress func(done int), headers ...string) ([]*gmail.Message, []error) {
+	if len(headers) == 0 {
+		headers = gmailSummaryHeaders
+	}
+
+	messages := make([]*gmail.Message, len(ids))
+	errs := gmailParallel(ctx, len(ids), progress, func(i int) error {
+		var err error
+		messages[i], err = gmailService().Users.Messages.Get("me", ids[i]).
+			Format("metadata").
+			MetadataHeaders(headers...).
+			Fields(gmailSummaryFields).
+			Context(ctx).
+			Do()
+		return err
+	})
+
+	return messages, errs
+}
+
+// gmailParallel calls fn for 0..n-1 with at most gmailFetchConcurrency calls
+// in flight and returns their errors by index. Calls not started before ctx
+// is done get ctx.Err(). progress, if not nil, is called after each call
+// with the number done.
+func gmailParallel(ctx context.Context, n int, progress func(done int), fn func(i int) error) []error {
+	errs := make([]error, n)
+
+	var (
+		wg   sync.WaitGroup
+		done atomic.Int64
+		sem  = make(chan struct{}, gmailFetchConcurrency())
+	)
+
+	for i := 0; i < n; i++ {
+		select {
+		case <-ctx.Done():
+			errs[i] = ctx.Err()
+			continue
+		case sem <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			errs[i] = fn(i)
+
+			if progress != nil {
+				progress(int(done.Add(1)))
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	return errs
+}
+
+// gmailSummary turns a message fetched by fetchGmailSummaries into the map
+// shown by listing tools.
+func gmailSummary(message *gmail.Message) map[string]interface{} {
+	emailInfo := map[string]interface{}{
+		"id":       message.Id,
+		"threadId": message.ThreadId,
+		"snippet":  message.Snippet,
+	}
+
+	if message.Payload != nil {
+		for _, header := range message.Payload.Headers {
+			switch header.Name {
+			case "From":
+				emailInfo["from"] = email.DecodeHeader(header.Value)
+			case "To":
+				emailInfo["to"] = email.DecodeHeader(header.Value)
+			case "Cc":
+				emailInfo["cc"] = email.DecodeHeader(header.Value)
+			case "Bcc":
+				emailInfo["bcc"] = email.DecodeHeader(header.Value)
+			case "Subject":
+				emailInfo["subject"] = email.DecodeHeader(header.Value)
+			case "Date":
+				emailInfo["date"] = header.Value
+			}
+		}
+	}
+
+	return emailInfo
+}
@@ -0,0 +1,128 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+// fakeMessages serves messages.get for any ID after latency. IDs starting
+// with "missing" get a 404.
+func fakeMessages(tb testing.TB, latency time.Duration, inFlight *atomic.Int64, maxInFlight *atomic.Int64) {
+	fakeGoogle(tb, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := strings.CutPrefix(r.URL.Path, "/gmail/v1/users/me/messages/")
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		if inFlight != nil {
+			n := inFlight.Add(1)
+			defer inFlight.Add(-1)
+			for {
+				seen := maxInFlight.Load()
+				if n <= seen || maxInFlight.CompareAndSwap(seen, n) {
+					break
+				}
+			}
+		}
+		time.Sleep(latency)
+
+		if strings.HasPrefix(id, "missing") {
+			w.WriteHeader(http.StatusNotFound)
+			writeJSON(w, map[string]interface{}{"error": map[string]interface{}{"code": 404, "message": "Requested entity was not found."}})
+			return
+		}
+		writeJSON(w, map[string]interface{}{
+			"id":       id,
+			"threadId": "t" + id,
+			"payload":  map[string]interface{}{"headers": []map[string]string{{"name": "Subject", "value": "Message " + id}}},
+		})
+	}))
+}
+
+func TestFetchGmailSummariesKeepsOrder(t *testing.T) {
+	t.Setenv("GMAIL_FETCH_CONCURRENCY", "4")
+	var inFlight, maxInFlight atomic.Int64
+	fakeMessages(t, 5*time.Millisecond, &inFlight, &maxInFlight)
+
+	ids := []string{"a", "missing-1", "b", "c", "missing-2", "d", "e", "f", "g", "missing-3"}
+	var progressCalls atomic.Int64
+	messages, errs := fetchGmailSummaries(context.Background(), ids, func(done int) {
+		progressCalls.Add(1)
+	})
+
+	for i, id := range ids {
+		if strings.HasPrefix(id, "missing") {
+			if messages[i] != nil {
+				t.Errorf("message %d (%s) = %v, want nil", i, id, messages[i])
+			}
+			apiErr, ok := errs[i].(*googleapi.Error)
+			if !ok || apiErr.Code != http.StatusNotFound {
+				t.Errorf("error %d (%s) = %v, want a 404", i, id, errs[i])
+			}
+			continue
+		}
+		if errs[i] != nil {
+			t.Errorf("error %d (%s) = %v, want nil", i, id, errs[i])
+			continue
+		}
+		if messages[i] == nil || messages[i].Id != id {
+			t.Errorf("message %d = %v, want %s", i, messages[i], id)
+		}
+	}
+
+	if got := progressCalls.Load(); got != int64(len(ids)) {
+		t.Errorf("progress called %d times, want %d", got, len(ids))
+	}
+	if got := maxInFlight.Load(); got > 4 {
+		t.Errorf("%d requests in flight, want at most 4", got)
+	}
+}
+
+func TestFetchGmailSummariesCancelled(t *testing.T) {
+	fakeMessages(t, 0, nil, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	ids := []string{"a", "b", "c"}
+	messages, errs := fetchGmailSummaries(ctx, ids, nil)
+	for i := range ids {
+		if messages[i] != nil || errs[i] == nil {
+			t.Errorf("message %d = %v, error %v; want nil and an error", i, messages[i], errs[i])
+		}
+	}
+}
+
+// BenchmarkFetchGmailSummaries fetches a page of 50 messages from a server
+// answering each in 20ms, sequentially and with the default concurrency.
+func BenchmarkFetchGmailSummaries(b *testing.B) {
+	fakeMessages(b, 20*time.Millisecond, nil, nil)
+
+	ids := make([]string, 50)
+	for i := range ids {
+		ids[i] = strconv.Itoa(i)
+	}
+
+	for _, concurrency := range []int{1, 8} {
+		b.Run(fmt.Sprintf("concurrency=%d", concurrency), func(b *testing.B) {
+			b.Setenv("GMAIL_FETCH_CONCURRENCY", strconv.Itoa(concurrency))
+			for i := 0; i < b.N; i++ {
+				_, errs := fetchGmailSummaries(context.Background(), ids, nil)
+				for _, err := range errs {
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
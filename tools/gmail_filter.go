@@ -0,0 +1,428 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/nguyenvanduocit/google-kit/util"
+	"google.golang.org/api/gmail/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// gmailFilterCategories maps the category argument of filters to the
+// labels of Gmail's inbox tabs.
+var gmailFilterCategories = map[string]string{
+	"primary":    "CATEGORY_PERSONAL",
+	"social":     "CATEGORY_SOCIAL",
+	"updates":    "CATEGORY_UPDATES",
+	"forums":     "CATEGORY_FORUMS",
+	"promotions": "CATEGORY_PROMOTIONS",
+}
+
+// gmailFilterFlags maps the boolean filter arguments to the system label
+// they add or remove.
+var gmailFilterFlags = []struct {
+	argument string
+	label    string
+	add      bool
+}{
+	{"trash", "TRASH", true},
+	{"star", "STARRED", true},
+	{"mark_important", "IMPORTANT", true},
+	{"never_important", "IMPORTANT", false},
+	{"never_spam", "SPAM", false},
+	{"mark_read", "UNREAD", false},
+	{"archive", "INBOX", false},
+}
+
+// gmailFilterCriteria lists the criteria arguments of filters.
+var gmailFilterCriteria = []string{"from", "to", "subject", "query", "negated_query", "has_attachment", "exclude_chats", "size", "size_comparison"}
+
+// gmailFilterActions lists the action arguments of filters.
+var gmailFilterActions = []string{"add_labels", "remove_labels", "category", "forward", "trash", "star", "mark_important", "never_important", "never_spam", "mark_read", "archive"}
+
+func gmailFilterHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	action, _ := arguments["action"].(string)
+
+	switch action {
+	case "create":
+		return gmailCreateFilterHandler(arguments)
+	case "update":
+		return gmailUpdateFilterHandler(arguments)
+	case "list":
+		return gmailListFiltersHandler(arguments)
+	case "delete":
+		return gmailDeleteFilterHandler(arguments)
+	case "lint":
+		return gmailLintFiltersHandler(arguments)
+	case "preview":
+		return gmailPreviewFilterHandler(arguments)
+	case "export":
+		return gmailExportFiltersHandler(arguments)
+	case "import":
+		return gmailImportFiltersHandler(arguments)
+	default:
+		return mcp.NewToolResultError("Invalid action. Must be one of: create, update, list, delete, lint, preview, export, import"), nil
+	}
+}
+
+// filterArguments describes a filter with the arguments that create it,
+// with label IDs replaced by names. Only set criteria and actions are
+// included.
+func filterArguments(filter *gmail.Filter, labels *gmailLabels) (criteria, actions map[string]interface{}) {
+	criteria = make(map[string]interface{})
+	actions = make(map[string]interface{})
+
+	if c := filter.Criteria; c != nil {
+		for name, value := range map[string]string{
+			"from":          c.From,
+			"to":            c.To,
+			"subject":       c.Subject,
+			"query":         c.Query,
+			"negated_query": c.NegatedQuery,
+		} {
+			if value != "" {
+				criteria[name] = value
+			}
+		}
+		if c.HasAttachment {
+			criteria["has_attachment"] = true
+		}
+		if c.ExcludeChats {
+			criteria["exclude_chats"] = true
+		}
+		if c.Size > 0 {
+			criteria["size"] = c.Size
+			if c.SizeComparison != "" && c.SizeComparison != "unspecified" {
+				criteria["size_comparison"] = c.SizeComparison
+			}
+		}
+	}
+
+	if a := filter.Action; a != nil {
+		if a.Forward != "" {
+			actions["forward"] = a.Forward
+		}
+
+		labelName := func(id string) string {
+			if label := labels.find(id); label != nil {
+				return label.Name
+			}
+			return id
+		}
+
+		var addLabels, removeLabels []string
+	addIDs:
+		for _, id := range a.AddLabelIds {
+			for _, flag := range gmailFilterFlags {
+				if flag.add && flag.label == id {
+					actions[flag.argument] = true
+					continue addIDs
+				}
+			}
+			for category, label := range gmailFilterCategories {
+				if label == id {
+					actions["category"] = category
+					continue addIDs
+				}
+			}
+			addLabels = append(addLabels, labelName(id))
+		}
+	removeIDs:
+		for _, id := range a.RemoveLabelIds {
+			for _, flag := range gmailFilterFlags {
+				if !flag.add && flag.label == id {
+					actions[flag.argument] = true
+					continue removeIDs
+				}
+			}
+			removeLabels = append(removeLabels, labelName(id))
+		}
+
+		if len(addLabels) > 0 {
+			actions["add_labels"] = addLabels
+		}
+		if len(removeLabels) > 0 {
+			actions["remove_labels"] = removeLabels
+		}
+	}
+
+	return criteria, actions
+}
+
+// criteriaFromArguments builds filter criteria from the criteria
+// arguments.
+func criteriaFromArguments(arguments map[string]interface{}) (*gmail.FilterCriteria, error) {
+	criteria := &gmail.FilterCriteria{}
+	criteria.From, _ = arguments["from"].(string)
+	criteria.To, _ = arguments["to"].(string)
+	criteria.Subject, _ = arguments["subject"].(string)
+	criteria.Query, _ = arguments["query"].(string)
+	criteria.NegatedQuery, _ = arguments["negated_query"].(string)
+	criteria.HasAttachment, _ = arguments["has_attachment"].(bool)
+	criteria.ExcludeChats, _ = arguments["exclude_chats"].(bool)
+
+	switch size := arguments["size"].(type) {
+	case float64:
+		criteria.Size = int64(size)
+	case int64:
+		criteria.Size = size
+	}
+	if comparison, _ := arguments["size_comparison"].(string); comparison != "" {
+		if comparison != "larger" && comparison != "smaller" {
+			return nil, fmt.Errorf("size_comparison must be one of: larger, smaller")
+		}
+		criteria.SizeComparison = comparison
+	}
+	if criteria.Size > 0 && criteria.SizeComparison == "" {
+		criteria.SizeComparison = "larger"
+	}
+	if criteria.Size <= 0 {
+		criteria.Size, criteria.SizeComparison = 0, ""
+	}
+
+	if reflect.DeepEqual(criteria, &gmail.FilterCriteria{}) {
+		return nil, fmt.Errorf("at least one criterion is required")
+	}
+
+	return criteria, nil
+}
+
+// filterFromArguments builds a filter from the criteria and action
+// arguments. Labels to add are given by name or ID, and created when no
+// label has that name yet.
+func filterFromArguments(ctx context.Context, labels *gmailLabels, arguments map[string]interface{}) (*gmail.Filter, error) {
+	criteria, err := criteriaFromArguments(arguments)
+	if err != nil {
+		return nil, err
+	}
+
+	action := &gmail.FilterAction{}
+	action.Forward, _ = arguments["forward"].(string)
+
+	addNames := util.StringsFromArguments(arguments, "add_labels")
+	if addLabel, _ := arguments["add_label"].(bool); addLabel {
+		labelName, _ := arguments["label_name"].(string)
+		if labelName == "" {
+			return nil, fmt.Errorf("label_name is required when add_label is true")
+		}
+		addNames = append(addNames, labelName)
+	}
+	for _, name := range addNames {
+		label := labels.find(name)
+		if label == nil {
+			var err error
+			if label, err = labels.createOrGet(ctx, name); err != nil {
+				return nil, fmt.Errorf("failed to create/get label: %v", err)
+			}
+		}
+		action.AddLabelIds = append(action.AddLabelIds, label.Id)
+	}
+
+	for _, name := range util.StringsFromArguments(arguments, "remove_labels") {
+		label := labels.find(name)
+		if label == nil {
+			return nil, fmt.Errorf("label %q not found", name)
+		}
+		action.RemoveLabelIds = append(action.RemoveLabelIds, label.Id)
+	}
+
+	if category, _ := arguments["category"].(string); category != "" {
+		label, ok := gmailFilterCategories[category]
+		if !ok {
+			return nil, fmt.Errorf("category must be one of: primary, social, updates, forums, promotions")
+		}
+		action.AddLabelIds = append(action.AddLabelIds, label)
+	}
+
+	for _, flag := range gmailFilterFlags {
+		if set, _ := arguments[flag.argument].(bool); !set {
+			continue
+		}
+		if flag.add {
+			action.AddLabelIds = append(action.AddLabelIds, flag.label)
+		} else {
+			action.RemoveLabelIds = append(action.RemoveLabelIds, flag.label)
+		}
+	}
+	action.AddLabelIds = dedupeStrings(action.AddLabelIds)
+	action.RemoveLabelIds = dedupeStrings(action.RemoveLabelIds)
+
+	for _, id := range action.AddLabelIds {
+		for _, other := range action.RemoveLabelIds {
+			if id == other {
+				return nil, fmt.Errorf("label %s is both added and removed", id)
+			}
+		}
+	}
+
+	if action.Forward == "" && len(action.AddLabelIds) == 0 && len(action.RemoveLabelIds) == 0 {
+		return nil, fmt.Errorf("at least one action is required")
+	}
+
+	return &gmail.Filter{Criteria: criteria, Action: action}, nil
+}
+
+func gmailCreateFilterHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	ctx := util.RequestFromArguments(arguments).Context()
+
+	labels, err := listGmailLabels(ctx)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	filter, err := filterFromArguments(ctx, labels, arguments)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	result, err := gmailService().Users.Settings.Filters.Create("me", filter).Context(ctx).Do()
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to create filter: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("Successfully created filter with ID: %s", result.Id)), nil
+}
+
+// gmailUpdateFilterHandler replaces a filter. Gmail filters cannot be
+// edited, so the new filter is created first and the old one deleted
+// afterwards; if that fails the new filter is removed again, so that the
+// old filter is never lost.
+func gmailUpdateFilterHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	ctx := util.RequestFromArguments(arguments).Context()
+
+	filterID, _ := arguments["filter_id"].(string)
+	if filterID == "" {
+		return mcp.NewToolResultError("filter_id is required for update action"), nil
+	}
+
+	old, err := gmailService().Users.Settings.Filters.Get("me", filterID).Context(ctx).Do()
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to get filter: %v", err)), nil
+	}
+
+	labels, err := listGmailLabels(ctx)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	// Start from the current filter so that only the given arguments
+	// change; a false boolean or an empty string clears a setting.
+	criteria, actions := filterArguments(old, labels)
+
+	// Labels the caller does not replace are carried over; filterArguments
+	// names them, and the names resolve back to the same IDs. A label
+	// deleted since the filter was made is left as its ID, which must not
+	// be created again as a label of that name.
+	var missing []string
+	for _, argument := range []string{"add_labels", "remove_labels"} {
+		if _, ok := arguments[argument]; ok {
+			continue
+		}
+		names, _ := actions[argument].([]string)
+		for _, name := range names {
+			if labels.find(name) == nil {
+				missing = append(missing, name)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return mcp.NewToolResultError(fmt.Sprintf("filter %s refers to deleted labels %s; give add_labels and remove_labels to replace them", filterID, strings.Join(missing, ", "))), nil
+	}
+
+	merged := flatFilterArguments(criteria, actions)
+	for _, name := range append(append([]string{}, gmailFilterCriteria...), gmailFilterActions...) {
+		if value, ok := arguments[name]; ok {
+			merged[name] = value
+		}
+	}
+	merged["add_label"], merged["label_name"] = arguments["add_label"], arguments["label_name"]
+
+	filter, err := filterFromArguments(ctx, labels, merged)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	newCriteria, newActions := filterArguments(filter, labels)
+	if reflect.DeepEqual(newCriteria, criteria) && reflect.DeepEqual(newActions, actions) {
+		return mcp.NewToolResultText(fmt.Sprintf("Filter %s is unchanged", filterID)), nil
+	}
+
+	created, err := gmailService().Users.Settings.Filters.Create("me", filter).Context(ctx).Do()
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to create updated filter, the old filter is unchanged: %v", err)), nil
+	}
+
+	if err := gmailService().Users.Settings.Filters.Delete("me", filterID).Context(ctx).Do(); err != nil {
+		if rollbackErr := gmailService().Users.Settings.Filters.Delete("me", created.Id).Context(ctx).Do(); rollbackErr != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to delete old filter %s: %v; failed to remove new filter %s as well, both now exist: %v", filterID, err, created.Id, rollbackErr)), nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("failed to delete old filter, the update was rolled back: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("Successfully updated filter %s, its new ID is: %s", filterID, created.Id)), nil
+}
+
+func gmailListFiltersHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	ctx := util.RequestFromArguments(arguments).Context()
+
+	filters, err := gmailService().Users.Settings.Filters.List("me").Context(ctx).Do()
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to list filters: %v", err)), nil
+	}
+
+	// The filters API has no paging of its own.
+	pageFilters, nextPageToken, err := util.PaginateSlice(util.PageFromArguments(arguments, 100, 1000), filters.Filter)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	labels, err := listGmailLabels(ctx)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	filtersResult := make([]map[string]interface{}, 0)
+
+	for _, filter := range pageFilters {
+		criteria, actions := filterArguments(filter, labels)
+		filtersResult = append(filtersResult, map[string]interface{}{
+			"id":       filter.Id,
+			"criteria": criteria,
+			"actions":  actions,
+		})
+	}
+
+	result := map[string]interface{}{
+		"count":           len(filtersResult),
+		"filters":         filtersResult,
+		"next_page_token": nextPageToken,
+	}
+
+	yamlResult, err := yaml.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to marshal filters: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(yamlResult)), nil
+}
+
+func gmailDeleteFilterHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	filterID, ok := arguments["filter_id"].(string)
+	if !ok {
+		return mcp.NewToolResultError("filter_id must be a string"), nil
+	}
+
+	if filterID == "" {
+		return mcp.NewToolResultError("filter_id cannot be empty"), nil
+	}
+
+	err := gmailService().Users.Settings.Filters.Delete("me", filterID).Do()
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to delete filter: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("Successfully deleted filter with ID: %s", filterID)), nil
+}
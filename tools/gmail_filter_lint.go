@@ -0,0 +1,299 @@
+package tools
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/nguyenvanduocit/google-kit/util"
+	"google.golang.org/api/gmail/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// filterConflicts lists pairs of label changes that work against each
+// other when two filters match the same message, besides adding and
+// removing the same label.
+var filterConflicts = []struct {
+	a, b        string
+	description string
+}{
+	{"-INBOX", "+IMPORTANT", "one archives while the other marks important"},
+	{"+TRASH", "+STARRED", "one deletes while the other stars"},
+	{"+TRASH", "-SPAM", "one deletes while the other only keeps out of spam"},
+}
+
+// gmailLintFiltersHandler looks for filters that are duplicated, broken,
+// redundant or in conflict with each other, and suggests a cleanup for
+// each.
+func gmailLintFiltersHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	ctx := util.RequestFromArguments(arguments).Context()
+
+	resp, err := gmailService().Users.Settings.Filters.List("me").Context(ctx).Do()
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to list filters: %v", err)), nil
+	}
+
+	labels, err := listGmailLabels(ctx)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	findings := make([]map[string]interface{}, 0)
+	referenced := make(map[string]bool)
+	finding := func(kind string, ids []string, description, suggestion string) {
+		for _, id := range ids {
+			referenced[id] = true
+		}
+		findings = append(findings, map[string]interface{}{
+			"type":        kind,
+			"filters":     ids,
+			"description": description,
+			"suggestion":  suggestion,
+		})
+	}
+
+	// Exact duplicates are reported once; only the first of each group
+	// takes part in the pairwise checks below.
+	var unique []*gmail.Filter
+	firstByKey := make(map[string]*gmail.Filter)
+	duplicates := make(map[string][]string)
+	var duplicateKeys []string
+	for _, filter := range resp.Filter {
+		key := filterKey(flatFilterArguments(filterArguments(filter, labels)))
+		if first, ok := firstByKey[key]; ok {
+			if duplicates[key] == nil {
+				duplicateKeys = append(duplicateKeys, key)
+				duplicates[key] = []string{first.Id}
+			}
+			duplicates[key] = append(duplicates[key], filter.Id)
+			continue
+		}
+		firstByKey[key] = filter
+		unique = append(unique, filter)
+	}
+	for _, key := range duplicateKeys {
+		ids := duplicates[key]
+		finding("duplicate", ids,
+			fmt.Sprintf("%d filters have the same criteria and actions", len(ids)),
+			fmt.Sprintf("keep %s and delete %s", ids[0], strings.Join(ids[1:], ", ")))
+	}
+
+	for _, filter := range resp.Filter {
+		if filter.Action == nil {
+			continue
+		}
+		var missing []string
+		for _, id := range append(append([]string{}, filter.Action.AddLabelIds...), filter.Action.RemoveLabelIds...) {
+			if labels.find(id) == nil {
+				missing = append(missing, id)
+			}
+		}
+		if len(missing) > 0 {
+			finding("missing_label", []string{filter.Id},
+				fmt.Sprintf("the filter uses deleted labels %s", strings.Join(missing, ", ")),
+				"update the filter with an existing label, or delete it if the label is no longer needed")
+		}
+	}
+
+	for i, a := range unique {
+		for _, b := range unique[i+1:] {
+			aCoversB := criteriaSubsumes(a.Criteria, b.Criteria)
+			bCoversA := criteriaSubsumes(b.Criteria, a.Criteria)
+			if !aCoversB && !bCoversA {
+				continue
+			}
+
+			if conflict := actionConflict(a.Action, b.Action); conflict != "" {
+				finding("conflict", []string{a.Id, b.Id},
+					fmt.Sprintf("the filters match the same messages but %s", conflict),
+					"decide which action should win and remove the other one from its filter")
+				continue
+			}
+
+			switch {
+			case aCoversB && bCoversA:
+				finding("same_criteria", []string{a.Id, b.Id},
+					"the filters have the same criteria but different actions",
+					fmt.Sprintf("merge them into one filter with the actions of both, then delete %s", b.Id))
+			default:
+				broad, narrow := a, b
+				if bCoversA {
+					broad, narrow = b, a
+				}
+				if actionsCovered(narrow.Action, broad.Action) {
+					finding("redundant", []string{broad.Id, narrow.Id},
+						fmt.Sprintf("%s matches everything %s matches and already does all it does", broad.Id, narrow.Id),
+						fmt.Sprintf("delete %s", narrow.Id))
+				} else {
+					finding("subsumed", []string{broad.Id, narrow.Id},
+						fmt.Sprintf("%s matches everything %s matches, so %s's actions also apply to those messages", broad.Id, narrow.Id, broad.Id),
+						fmt.Sprintf("remove the actions %s shares with %s from %s", narrow.Id, broad.Id, narrow.Id))
+				}
+			}
+		}
+	}
+
+	details := make(map[string]interface{}, len(referenced))
+	for _, filter := range resp.Filter {
+		if referenced[filter.Id] {
+			criteria, actions := filterArguments(filter, labels)
+			details[filter.Id] = map[string]interface{}{
+				"criteria": criteria,
+				"actions":  actions,
+			}
+		}
+	}
+
+	result := map[string]interface{}{
+		"filters_checked": len(resp.Filter),
+		"findings":        findings,
+		"details":         details,
+	}
+
+	yamlResult, err := yaml.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(yamlResult)), nil
+}
+
+// criteriaSubsumes reports whether every message matching b also matches
+// a. It is conservative: search queries only subsume equal queries, and
+// senders and recipients only their own address or domain, given as
+// example.com or @example.com.
+func criteriaSubsumes(a, b *gmail.FilterCriteria) bool {
+	if a == nil {
+		return true
+	}
+	if b == nil {
+		b = &gmail.FilterCriteria{}
+	}
+
+	for _, field := range []struct {
+		a, b    string
+		address bool
+	}{
+		{a.From, b.From, true},
+		{a.To, b.To, true},
+		{a.Subject, b.Subject, false},
+		{a.Query, b.Query, false},
+		{a.NegatedQuery, b.NegatedQuery, false},
+	} {
+		if field.a == "" {
+			continue
+		}
+		av := strings.ToLower(strings.TrimSpace(field.a))
+		bv := strings.ToLower(strings.TrimSpace(field.b))
+		if av == bv {
+			continue
+		}
+		if !field.address || bv == "" || strings.ContainsAny(av+bv, " (){}") {
+			return false
+		}
+		// A domain covers its addresses and subdomains, and @domain the
+		// addresses of that domain only.
+		if !strings.HasSuffix(bv, av) {
+			return false
+		}
+		if strings.HasPrefix(av, "@") {
+			continue
+		}
+		if c := bv[len(bv)-len(av)-1]; c != '@' && c != '.' {
+			return false
+		}
+	}
+
+	if a.HasAttachment && !b.HasAttachment {
+		return false
+	}
+	if a.ExcludeChats && !b.ExcludeChats {
+		return false
+	}
+
+	if a.Size > 0 {
+		if b.Size <= 0 || a.SizeComparison != b.SizeComparison {
+			return false
+		}
+		if a.SizeComparison == "smaller" && b.Size > a.Size {
+			return false
+		}
+		if a.SizeComparison != "smaller" && b.Size < a.Size {
+			return false
+		}
+	}
+
+	return true
+}
+
+// labelChanges returns the label changes of an action as "+ID" and "-ID".
+func labelChanges(action *gmail.FilterAction) map[string]bool {
+	changes := make(map[string]bool)
+	if action == nil {
+		return changes
+	}
+	for _, id := range action.AddLabelIds {
+		changes["+"+id] = true
+	}
+	for _, id := range action.RemoveLabelIds {
+		changes["-"+id] = true
+	}
+	return changes
+}
+
+// actionConflict describes how two actions work against each other, or
+// returns "" when they do not.
+func actionConflict(a, b *gmail.FilterAction) string {
+	ac, bc := labelChanges(a), labelChanges(b)
+
+	// Sorted so that the same pair is always described the same way.
+	changes := make([]string, 0, len(ac))
+	for change := range ac {
+		changes = append(changes, change)
+	}
+	sort.Strings(changes)
+
+	for _, change := range changes {
+		opposite := "-" + change[1:]
+		if change[0] == '-' {
+			opposite = "+" + change[1:]
+		}
+		if bc[opposite] {
+			return fmt.Sprintf("one adds and the other removes %s", change[1:])
+		}
+	}
+
+	for _, conflict := range filterConflicts {
+		if (ac[conflict.a] && bc[conflict.b]) || (ac[conflict.b] && bc[conflict.a]) {
+			return conflict.description
+		}
+	}
+
+	for _, change := range changes {
+		if !strings.HasPrefix(change, "+CATEGORY_") {
+			continue
+		}
+		for other := range bc {
+			if strings.HasPrefix(other, "+CATEGORY_") && other != change {
+				return "they file messages under different categories"
+			}
+		}
+	}
+
+	return ""
+}
+
+// actionsCovered reports whether broad already does everything narrow does.
+func actionsCovered(narrow, broad *gmail.FilterAction) bool {
+	broadChanges := labelChanges(broad)
+	for change := range labelChanges(narrow) {
+		if !broadChanges[change] {
+			return false
+		}
+	}
+	if narrow != nil && narrow.Forward != "" && (broad == nil || !strings.EqualFold(narrow.Forward, broad.Forward)) {
+		return false
+	}
+	return true
+}
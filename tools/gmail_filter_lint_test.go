@@ -0,0 +1,37 @@
+package tools
+
+import (
+	"testing"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+func TestCriteriaSubsumes(t *testing.T) {
+	tests := []struct {
+		a, b gmail.FilterCriteria
+		want bool
+	}{
+		{gmail.FilterCriteria{From: "x@example.com"}, gmail.FilterCriteria{From: "X@Example.com"}, true},
+		{gmail.FilterCriteria{From: "example.com"}, gmail.FilterCriteria{From: "x@example.com"}, true},
+		{gmail.FilterCriteria{From: "example.com"}, gmail.FilterCriteria{From: "x@mail.example.com"}, true},
+		{gmail.FilterCriteria{From: "example.com"}, gmail.FilterCriteria{From: "x@badexample.com"}, false},
+		{gmail.FilterCriteria{From: "@example.com"}, gmail.FilterCriteria{From: "x@example.com"}, true},
+		{gmail.FilterCriteria{From: "@example.com"}, gmail.FilterCriteria{From: "@example.com"}, true},
+		{gmail.FilterCriteria{From: "example.com"}, gmail.FilterCriteria{From: "@example.com"}, true},
+		{gmail.FilterCriteria{From: "@example.com"}, gmail.FilterCriteria{From: "x@mail.example.com"}, false},
+		{gmail.FilterCriteria{From: "@example.com"}, gmail.FilterCriteria{From: "x@badexample.com"}, false},
+		{gmail.FilterCriteria{To: "@example.com"}, gmail.FilterCriteria{To: "team@example.com", From: "boss@example.org"}, true},
+		{gmail.FilterCriteria{From: "@example.com"}, gmail.FilterCriteria{To: "x@example.com"}, false},
+		{gmail.FilterCriteria{From: "x@example.com"}, gmail.FilterCriteria{From: "example.com"}, false},
+		{gmail.FilterCriteria{Subject: "invoice"}, gmail.FilterCriteria{Subject: "invoice 2024"}, false},
+		{gmail.FilterCriteria{From: "example.com", HasAttachment: true}, gmail.FilterCriteria{From: "x@example.com"}, false},
+		{gmail.FilterCriteria{Size: 1000, SizeComparison: "larger"}, gmail.FilterCriteria{Size: 5000, SizeComparison: "larger"}, true},
+		{gmail.FilterCriteria{Size: 1000, SizeComparison: "smaller"}, gmail.FilterCriteria{Size: 5000, SizeComparison: "smaller"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := criteriaSubsumes(&tt.a, &tt.b); got != tt.want {
+			t.Errorf("criteriaSubsumes(%+v, %+v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
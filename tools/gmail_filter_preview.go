@@ -0,0 +1,186 @@
+package tools
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/nguyenvanduocit/google-kit/util"
+	"google.golang.org/api/gmail/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// filterQuery compiles filter criteria into the Gmail search query that
+// matches the same messages.
+func filterQuery(criteria *gmail.FilterCriteria) string {
+	var terms []string
+	for _, term := range []struct{ operator, value string }{
+		{"from", criteria.From},
+		{"to", criteria.To},
+		{"subject", criteria.Subject},
+	} {
+		if term.value != "" {
+			terms = append(terms, fmt.Sprintf("%s:(%s)", term.operator, term.value))
+		}
+	}
+	if criteria.Query != "" {
+		terms = append(terms, "("+criteria.Query+")")
+	}
+	if criteria.NegatedQuery != "" {
+		terms = append(terms, "-("+criteria.NegatedQuery+")")
+	}
+	if criteria.HasAttachment {
+		terms = append(terms, "has:attachment")
+	}
+	if criteria.ExcludeChats {
+		terms = append(terms, "-in:chats")
+	}
+	if criteria.Size > 0 {
+		operator := "larger"
+		if criteria.SizeComparison == "smaller" {
+			operator = "smaller"
+		}
+		terms = append(terms, fmt.Sprintf("%s:%d", operator, criteria.Size))
+	}
+	return strings.Join(terms, " ")
+}
+
+// gmailPreviewFilterHandler shows what a filter, existing or given by its
+// arguments, matches in the mailbox, and optionally applies its actions to
+// those messages.
+func gmailPreviewFilterHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	request := util.RequestFromArguments(arguments)
+	ctx := request.Context()
+
+	apply, _ := arguments["apply"].(bool)
+
+	var filter *gmail.Filter
+	if filterID, _ := arguments["filter_id"].(string); filterID != "" {
+		var err error
+		filter, err = gmailService().Users.Settings.Filters.Get("me", filterID).Context(ctx).Do()
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to get filter: %v", err)), nil
+		}
+	} else if apply {
+		// Applying needs the actions too, so resolve the labels as
+		// create would.
+		labels, err := listGmailLabels(ctx)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		filter, err = filterFromArguments(ctx, labels, arguments)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+	} else {
+		criteria, err := criteriaFromArguments(arguments)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		filter = &gmail.Filter{Criteria: criteria}
+	}
+
+	query := filterQuery(filter.Criteria)
+	ids, _, truncated, err := gmailModifyTargets(ctx, map[string]interface{}{
+		"query":        query,
+		"max_messages": arguments["max_messages"],
+	}, false)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	sampleSize := 10
+	if value, ok := arguments["sample_size"].(float64); ok && value >= 0 {
+		sampleSize = min(int(value), 100)
+	}
+	sampleIDs := ids[:min(sampleSize, len(ids))]
+
+	fetched, errs := fetchGmailSummaries(ctx, sampleIDs, nil)
+	sample := make([]map[string]interface{}, 0, len(fetched))
+	for i, message := range fetched {
+		if errs[i] != nil {
+			if !request.Cancelled() {
+				log.Printf("Failed to get message %s: %v", sampleIDs[i], errs[i])
+			}
+			continue
+		}
+		sample = append(sample, gmailSummary(message))
+	}
+
+	result := map[string]interface{}{
+		"query":  query,
+		"count":  len(ids),
+		"sample": sample,
+	}
+	if truncated {
+		// Counting stopped at max_messages; there are more matches.
+		result["more"] = true
+	}
+
+	if apply {
+		applied, err := applyFilterActions(request, filter.Action, ids)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		result["applied"] = applied
+	}
+
+	yamlResult, err := yaml.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(yamlResult)), nil
+}
+
+// applyFilterActions applies the label changes of a filter to existing
+// messages, in batches. Gmail only forwards new mail, so forwarding is
+// not applied.
+func applyFilterActions(request *util.Request, action *gmail.FilterAction, ids []string) (map[string]interface{}, error) {
+	if action == nil {
+		return nil, fmt.Errorf("the filter has no actions to apply")
+	}
+
+	// Trashing goes through messages.trash, as in gmail_modify.
+	trash := false
+	addIDs := make([]string, 0, len(action.AddLabelIds))
+	for _, id := range action.AddLabelIds {
+		if id == "TRASH" {
+			trash = true
+			continue
+		}
+		addIDs = append(addIDs, id)
+	}
+	if len(addIDs) == 0 && len(action.RemoveLabelIds) == 0 && !trash {
+		return nil, fmt.Errorf("the filter has no actions that can be applied to existing messages")
+	}
+
+	pending := ids
+	var failed []map[string]string
+	if len(addIDs) > 0 || len(action.RemoveLabelIds) > 0 {
+		var batchFailed []map[string]string
+		pending, batchFailed = gmailBatchModify(request, pending, addIDs, action.RemoveLabelIds)
+		failed = append(failed, batchFailed...)
+	}
+	if trash && !request.Cancelled() {
+		var trashFailed []map[string]string
+		pending, trashFailed = gmailTrashMessages(request, pending, false)
+		failed = append(failed, trashFailed...)
+	}
+	request.Progress(len(ids), len(ids), "Done")
+
+	applied := map[string]interface{}{
+		"modified": len(pending),
+	}
+	if len(failed) > 0 {
+		applied["failed"] = failed
+	}
+	if action.Forward != "" {
+		applied["note"] = "forwarding only applies to new messages and was skipped"
+	}
+	if request.Cancelled() {
+		applied["partial"] = true
+	}
+	return applied, nil
+}
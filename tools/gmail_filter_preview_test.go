@@ -0,0 +1,93 @@
+package tools
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+func TestFilterQuery(t *testing.T) {
+	tests := []struct {
+		name     string
+		criteria gmail.FilterCriteria
+		want     string
+	}{
+		{"empty", gmail.FilterCriteria{}, ""},
+		{"from", gmail.FilterCriteria{From: "billing@example.com"}, "from:(billing@example.com)"},
+		{"several addresses", gmail.FilterCriteria{From: "a@example.com OR b@example.com"}, "from:(a@example.com OR b@example.com)"},
+		{"to and subject", gmail.FilterCriteria{To: "team@example.com", Subject: "Weekly report"}, "to:(team@example.com) subject:(Weekly report)"},
+		{"quoted subject", gmail.FilterCriteria{Subject: `"build failed"`}, `subject:("build failed")`},
+		{"query is grouped", gmail.FilterCriteria{From: "a@example.com", Query: "invoice OR receipt"}, "from:(a@example.com) (invoice OR receipt)"},
+		{"negated query is grouped", gmail.FilterCriteria{NegatedQuery: "urgent OR asap"}, "-(urgent OR asap)"},
+		{"has attachment", gmail.FilterCriteria{HasAttachment: true}, "has:attachment"},
+		{"exclude chats", gmail.FilterCriteria{Query: "lunch", ExcludeChats: true}, "(lunch) -in:chats"},
+		{"larger", gmail.FilterCriteria{Size: 5 << 20, SizeComparison: "larger"}, "larger:5242880"},
+		{"smaller", gmail.FilterCriteria{Size: 1024, SizeComparison: "smaller"}, "smaller:1024"},
+		{"unspecified comparison is larger", gmail.FilterCriteria{Size: 1024, SizeComparison: "unspecified"}, "larger:1024"},
+		{"comparison without a size", gmail.FilterCriteria{SizeComparison: "smaller"}, ""},
+		{
+			"everything",
+			gmail.FilterCriteria{From: "a@example.com", To: "me@example.com", Subject: "Q&A", Query: "list:dev", NegatedQuery: "draft", HasAttachment: true, ExcludeChats: true, Size: 100, SizeComparison: "smaller"},
+			"from:(a@example.com) to:(me@example.com) subject:(Q&A) (list:dev) -(draft) has:attachment -in:chats smaller:100",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := filterQuery(&tt.criteria); got != tt.want {
+				t.Errorf("filterQuery() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGmailPreviewFilterApply(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		queries []string
+		batch   gmail.BatchModifyMessagesRequest
+	)
+	fakeGoogle(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		path := strings.TrimPrefix(r.URL.Path, "/gmail/v1/users/me/")
+		switch {
+		case path == "settings/filters/f1":
+			writeJSON(w, gmail.Filter{
+				Id:       "f1",
+				Criteria: &gmail.FilterCriteria{From: "news@example.com", NegatedQuery: "invoice", Size: 1024, SizeComparison: "larger"},
+				Action:   &gmail.FilterAction{RemoveLabelIds: []string{"INBOX"}},
+			})
+		case path == "messages":
+			queries = append(queries, r.URL.Query().Get("q"))
+			writeJSON(w, map[string]interface{}{"messages": []map[string]string{{"id": "m1"}, {"id": "m2"}}})
+		case path == "messages/batchModify":
+			json.NewDecoder(r.Body).Decode(&batch)
+			w.WriteHeader(http.StatusNoContent)
+		case strings.HasPrefix(path, "messages/"):
+			writeJSON(w, gmail.Message{Id: strings.TrimPrefix(path, "messages/")})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	result, err := gmailPreviewFilterHandler(map[string]interface{}{"filter_id": "f1", "apply": true})
+	decoded := resultYAML(t, result, err)
+
+	wantQuery := "from:(news@example.com) -(invoice) larger:1024"
+	if len(queries) != 1 || queries[0] != wantQuery {
+		t.Errorf("searched %q, want %q", queries, wantQuery)
+	}
+	if decoded["count"] != 2 {
+		t.Errorf("count = %v, want 2", decoded["count"])
+	}
+	if !slices.Equal(batch.Ids, []string{"m1", "m2"}) || !slices.Equal(batch.RemoveLabelIds, []string{"INBOX"}) {
+		t.Errorf("batchModify = %+v, want INBOX removed from m1 and m2", batch)
+	}
+}
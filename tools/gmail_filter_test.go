@@ -0,0 +1,132 @@
+package tools
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+func TestGmailUpdateFilterLabels(t *testing.T) {
+	labels := []map[string]string{
+		{"id": "INBOX", "name": "INBOX", "type": "system"},
+		{"id": "Label_1", "name": "Work", "type": "user"},
+		{"id": "Label_2", "name": "Old", "type": "user"},
+	}
+
+	tests := []struct {
+		name       string
+		old        gmail.FilterAction
+		arguments  map[string]interface{}
+		wantAdd    []string
+		wantRemove []string
+		wantError  string
+	}{
+		{
+			name:       "labels are carried over",
+			old:        gmail.FilterAction{AddLabelIds: []string{"Label_1"}, RemoveLabelIds: []string{"Label_2", "INBOX"}},
+			arguments:  map[string]interface{}{"subject": "report"},
+			wantAdd:    []string{"Label_1"},
+			wantRemove: []string{"Label_2", "INBOX"},
+		},
+		{
+			name:      "a deleted label is reported",
+			old:       gmail.FilterAction{AddLabelIds: []string{"Label_1", "Label_9"}},
+			arguments: map[string]interface{}{"subject": "report"},
+			wantError: "Label_9",
+		},
+		{
+			name:      "a deleted label to remove is reported",
+			old:       gmail.FilterAction{AddLabelIds: []string{"Label_1"}, RemoveLabelIds: []string{"Label_8"}},
+			arguments: map[string]interface{}{"subject": "report"},
+			wantError: "Label_8",
+		},
+		{
+			name:      "a deleted label can be replaced",
+			old:       gmail.FilterAction{AddLabelIds: []string{"Label_9"}},
+			arguments: map[string]interface{}{"subject": "report", "add_labels": []interface{}{"Work"}},
+			wantAdd:   []string{"Label_1"},
+		},
+		{
+			name:       "labels can be given by ID",
+			old:        gmail.FilterAction{AddLabelIds: []string{"Label_1"}},
+			arguments:  map[string]interface{}{"add_labels": []interface{}{"Label_2"}, "remove_labels": []interface{}{"Label_1"}},
+			wantAdd:    []string{"Label_2"},
+			wantRemove: []string{"Label_1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				mu            sync.Mutex
+				created       *gmail.Filter
+				labelsCreated []string
+			)
+			fakeGoogle(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				path := strings.TrimPrefix(r.URL.Path, "/gmail/v1/users/me/")
+				switch {
+				case path == "labels" && r.Method == http.MethodGet:
+					writeJSON(w, map[string]interface{}{"labels": labels})
+				case path == "labels":
+					var label gmail.Label
+					json.NewDecoder(r.Body).Decode(&label)
+					labelsCreated = append(labelsCreated, label.Name)
+					label.Id = "Label_new"
+					writeJSON(w, label)
+				case path == "settings/filters/f1" && r.Method == http.MethodGet:
+					action := tt.old
+					writeJSON(w, gmail.Filter{Id: "f1", Criteria: &gmail.FilterCriteria{From: "boss@example.com"}, Action: &action})
+				case path == "settings/filters/f1" && r.Method == http.MethodDelete:
+					w.WriteHeader(http.StatusNoContent)
+				case path == "settings/filters":
+					created = &gmail.Filter{}
+					json.NewDecoder(r.Body).Decode(created)
+					created.Id = "f2"
+					writeJSON(w, created)
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+
+			arguments := map[string]interface{}{"filter_id": "f1"}
+			for name, value := range tt.arguments {
+				arguments[name] = value
+			}
+			result, err := gmailUpdateFilterHandler(arguments)
+			text := resultText(t, result, err)
+
+			if len(labelsCreated) > 0 {
+				t.Errorf("labels %v were created", labelsCreated)
+			}
+			if tt.wantError != "" {
+				if !result.IsError || !strings.Contains(text, tt.wantError) {
+					t.Errorf("result = %q, want an error mentioning %s", text, tt.wantError)
+				}
+				if created != nil {
+					t.Error("a filter was created")
+				}
+				return
+			}
+			if result.IsError {
+				t.Fatalf("update failed: %s", text)
+			}
+			if created == nil {
+				t.Fatal("no filter was created")
+			}
+			if !reflect.DeepEqual(created.Action.AddLabelIds, tt.wantAdd) {
+				t.Errorf("added labels = %v, want %v", created.Action.AddLabelIds, tt.wantAdd)
+			}
+			if !reflect.DeepEqual(created.Action.RemoveLabelIds, tt.wantRemove) {
+				t.Errorf("removed labels = %v, want %v", created.Action.RemoveLabelIds, tt.wantRemove)
+			}
+		})
+	}
+}
@@ -0,0 +1,499 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/nguyenvanduocit/google-kit/util"
+	"gopkg.in/yaml.v3"
+)
+
+// mailFilterProperties maps the string and boolean filter arguments to the
+// apps:property names of mailFilters.xml, the format the Gmail web UI
+// imports and exports. Labels, categories and size are handled separately.
+var mailFilterProperties = []struct{ argument, property string }{
+	{"from", "from"},
+	{"to", "to"},
+	{"subject", "subject"},
+	{"query", "hasTheWord"},
+	{"negated_query", "doesNotHaveTheWord"},
+	{"has_attachment", "hasAttachment"},
+	{"exclude_chats", "excludeChats"},
+	{"forward", "forwardTo"},
+	{"trash", "shouldTrash"},
+	{"star", "shouldStar"},
+	{"mark_important", "shouldAlwaysMarkAsImportant"},
+	{"never_important", "shouldNeverMarkAsImportant"},
+	{"never_spam", "shouldNeverSpam"},
+	{"mark_read", "shouldMarkAsRead"},
+	{"archive", "shouldArchive"},
+}
+
+// mailFilterCategories maps the category argument to the smart labels of
+// mailFilters.xml.
+var mailFilterCategories = map[string]string{
+	"primary":    "^smartlabel_personal",
+	"social":     "^smartlabel_social",
+	"updates":    "^smartlabel_notification",
+	"forums":     "^smartlabel_group",
+	"promotions": "^smartlabel_promo",
+}
+
+// mailFilterSizeUnits maps the sizeUnit values of mailFilters.xml to bytes.
+var mailFilterSizeUnits = map[string]int64{
+	"s_sb":  1,
+	"s_skb": 1 << 10,
+	"s_smb": 1 << 20,
+}
+
+type mailFilterFeed struct {
+	Entries []struct {
+		Properties []struct {
+			Name  string `xml:"name,attr"`
+			Value string `xml:"value,attr"`
+		} `xml:"property"`
+	} `xml:"entry"`
+}
+
+// marshalMailFilters writes filters, given as flat filter arguments, as a
+// mailFilters.xml document. Settings the format cannot express are
+// returned as warnings.
+func marshalMailFilters(filters []map[string]interface{}, ids []string, author string) ([]byte, []string) {
+	var warnings []string
+	updated := time.Now().UTC().Format(time.RFC3339)
+
+	var buf bytes.Buffer
+	attr := func(value string) string {
+		var escaped strings.Builder
+		xml.EscapeText(&escaped, []byte(value))
+		return escaped.String()
+	}
+
+	buf.WriteString("<?xml version='1.0' encoding='UTF-8'?>\n")
+	buf.WriteString("<feed xmlns='http://www.w3.org/2005/Atom' xmlns:apps='http://schemas.google.com/apps/2006'>\n")
+	buf.WriteString("\t<title>Mail Filters</title>\n")
+	fmt.Fprintf(&buf, "\t<id>tag:mail.google.com,2008:filters:%s</id>\n", attr(strings.Join(ids, ",")))
+	fmt.Fprintf(&buf, "\t<updated>%s</updated>\n", updated)
+	if author != "" {
+		fmt.Fprintf(&buf, "\t<author>\n\t\t<name>%s</name>\n\t\t<email>%s</email>\n\t</author>\n", attr(author), attr(author))
+	}
+
+	for i, filter := range filters {
+		buf.WriteString("\t<entry>\n")
+		buf.WriteString("\t\t<category term='filter'></category>\n")
+		buf.WriteString("\t\t<title>Mail Filter</title>\n")
+		fmt.Fprintf(&buf, "\t\t<id>tag:mail.google.com,2008:filter:%s</id>\n", attr(ids[i]))
+		fmt.Fprintf(&buf, "\t\t<updated>%s</updated>\n", updated)
+		buf.WriteString("\t\t<content></content>\n")
+
+		property := func(name, value string) {
+			fmt.Fprintf(&buf, "\t\t<apps:property name='%s' value='%s'/>\n", name, attr(value))
+		}
+
+		for _, p := range mailFilterProperties {
+			switch value := filter[p.argument].(type) {
+			case string:
+				if value != "" {
+					property(p.property, value)
+				}
+			case bool:
+				if value {
+					property(p.property, "true")
+				}
+			}
+		}
+		if size, ok := filter["size"].(int64); ok && size > 0 {
+			property("size", strconv.FormatInt(size, 10))
+			if filter["size_comparison"] == "smaller" {
+				property("sizeOperator", "s_ss")
+			} else {
+				property("sizeOperator", "s_sl")
+			}
+			property("sizeUnit", "s_sb")
+		}
+		for _, label := range util.StringsFromArguments(filter, "add_labels") {
+			property("label", label)
+		}
+		if category, ok := filter["category"].(string); ok {
+			property("smartLabelToApply", mailFilterCategories[category])
+		}
+		if removeLabels := util.StringsFromArguments(filter, "remove_labels"); len(removeLabels) > 0 {
+			warnings = append(warnings, fmt.Sprintf("filter %s: removing labels %s cannot be exported", ids[i], strings.Join(removeLabels, ", ")))
+		}
+
+		buf.WriteString("\t</entry>\n")
+	}
+
+	buf.WriteString("</feed>\n")
+	return buf.Bytes(), warnings
+}
+
+// parseMailFilters reads a mailFilters.xml document into flat filter
+// arguments. Properties the API has no equivalent for, such as canned
+// responses, are skipped with a warning.
+func parseMailFilters(data []byte) ([]map[string]interface{}, []string, error) {
+	var feed mailFilterFeed
+	if err := xml.Unmarshal(data, &feed); err != nil {
+		return nil, nil, fmt.Errorf("invalid mailFilters.xml: %v", err)
+	}
+
+	var warnings []string
+	filters := make([]map[string]interface{}, 0, len(feed.Entries))
+
+entries:
+	for i, entry := range feed.Entries {
+		filter := make(map[string]interface{})
+		var labels []string
+		var size int64
+		unit, operator := "s_sb", "s_sl"
+
+	properties:
+		for _, p := range entry.Properties {
+			for _, known := range mailFilterProperties {
+				if known.property != p.Name {
+					continue
+				}
+				if strings.HasPrefix(known.property, "should") || known.property == "hasAttachment" || known.property == "excludeChats" {
+					filter[known.argument] = p.Value == "true"
+				} else {
+					filter[known.argument] = p.Value
+				}
+				continue properties
+			}
+
+			switch p.Name {
+			case "label":
+				labels = append(labels, p.Value)
+			case "smartLabelToApply":
+				for category, smartLabel := range mailFilterCategories {
+					if strings.EqualFold(smartLabel, p.Value) {
+						filter["category"] = category
+					}
+				}
+				if filter["category"] == nil {
+					warnings = append(warnings, fmt.Sprintf("entry %d: unknown category %s skipped", i+1, p.Value))
+				}
+			case "size":
+				n, err := strconv.ParseInt(p.Value, 10, 64)
+				if err != nil {
+					warnings = append(warnings, fmt.Sprintf("entry %d: invalid size %q, filter skipped", i+1, p.Value))
+					continue entries
+				}
+				size = n
+			case "sizeUnit":
+				unit = p.Value
+			case "sizeOperator":
+				operator = p.Value
+			default:
+				warnings = append(warnings, fmt.Sprintf("entry %d: property %s is not supported and was skipped", i+1, p.Name))
+			}
+		}
+
+		if size > 0 {
+			multiplier, ok := mailFilterSizeUnits[unit]
+			if !ok {
+				warnings = append(warnings, fmt.Sprintf("entry %d: unknown size unit %s, filter skipped", i+1, unit))
+				continue
+			}
+			filter["size"] = size * multiplier
+			filter["size_comparison"] = "larger"
+			if operator == "s_ss" {
+				filter["size_comparison"] = "smaller"
+			}
+		}
+		if len(labels) > 0 {
+			filter["add_labels"] = labels
+		}
+
+		filters = append(filters, filter)
+	}
+
+	return filters, warnings, nil
+}
+
+// flatFilterArguments returns the arguments of a filter as one map, as
+// taken by filterFromArguments.
+func flatFilterArguments(criteria, actions map[string]interface{}) map[string]interface{} {
+	flat := make(map[string]interface{}, len(criteria)+len(actions))
+	for _, values := range []map[string]interface{}{criteria, actions} {
+		for name, value := range values {
+			flat[name] = value
+		}
+	}
+	return flat
+}
+
+// splitFilterArguments is the reverse of flatFilterArguments, for display.
+func splitFilterArguments(flat map[string]interface{}) map[string]interface{} {
+	criteria := make(map[string]interface{})
+	actions := make(map[string]interface{})
+	for name, value := range flat {
+		if b, ok := value.(bool); ok && !b {
+			continue
+		}
+		actions[name] = value
+	}
+	for _, name := range gmailFilterCriteria {
+		if value, ok := actions[name]; ok {
+			criteria[name] = value
+			delete(actions, name)
+		}
+	}
+	return map[string]interface{}{"criteria": criteria, "actions": actions}
+}
+
+// filterKey identifies a filter by what it does, so that the same filter
+// from the account and from a file compare equal.
+func filterKey(flat map[string]interface{}) string {
+	normalized := make(map[string]interface{}, len(flat))
+	for name, value := range flat {
+		switch v := value.(type) {
+		case bool:
+			if !v {
+				continue
+			}
+		case string:
+			if v == "" {
+				continue
+			}
+		case float64:
+			value = int64(v)
+		}
+		normalized[name] = value
+	}
+
+	if _, ok := normalized["size"]; ok && normalized["size_comparison"] == nil {
+		normalized["size_comparison"] = "larger"
+	}
+
+	for _, name := range []string{"add_labels", "remove_labels"} {
+		if _, ok := normalized[name]; !ok {
+			continue
+		}
+		labels := util.StringsFromArguments(normalized, name)
+		for i := range labels {
+			labels[i] = strings.ToLower(labels[i])
+		}
+		sort.Strings(labels)
+		normalized[name] = labels
+	}
+
+	key, _ := yaml.Marshal(normalized)
+	return string(key)
+}
+
+func gmailExportFiltersHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	ctx := util.RequestFromArguments(arguments).Context()
+
+	resp, err := gmailService().Users.Settings.Filters.List("me").Context(ctx).Do()
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to list filters: %v", err)), nil
+	}
+
+	labels, err := listGmailLabels(ctx)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	author := ""
+	if profile, err := gmailService().Users.GetProfile("me").Context(ctx).Do(); err == nil {
+		author = profile.EmailAddress
+	}
+
+	filters := make([]map[string]interface{}, 0, len(resp.Filter))
+	ids := make([]string, 0, len(resp.Filter))
+	for _, filter := range resp.Filter {
+		filters = append(filters, flatFilterArguments(filterArguments(filter, labels)))
+		ids = append(ids, filter.Id)
+	}
+
+	data, warnings := marshalMailFilters(filters, ids, author)
+
+	if save, _ := arguments["save"].(bool); save {
+		path, err := saveAttachment("mailFilters.xml", data)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to save filters: %v", err)), nil
+		}
+
+		result := map[string]interface{}{
+			"count": len(filters),
+			"path":  path,
+		}
+		if len(warnings) > 0 {
+			result["warnings"] = warnings
+		}
+
+		yamlResult, err := yaml.Marshal(result)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %v", err)), nil
+		}
+		return mcp.NewToolResultText(string(yamlResult)), nil
+	}
+
+	// Warnings go into an XML comment so the output stays a valid file.
+	if len(warnings) > 0 {
+		comment := "<!--\n" + strings.ReplaceAll(strings.Join(warnings, "\n"), "--", "- -") + "\n-->\n"
+		data = append(data, comment...)
+	}
+
+	return mcp.NewToolResultText(string(data)), nil
+}
+
+// gmailImportFiltersHandler creates the filters of a mailFilters.xml file
+// that the account does not have yet. With replace, filters missing from
+// the file are deleted too; with diff, nothing is changed and the
+// differences are listed instead.
+func gmailImportFiltersHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	request := util.RequestFromArguments(arguments)
+	ctx := request.Context()
+
+	var data []byte
+	if content, ok := arguments["xml"].(string); ok && content != "" {
+		data = []byte(content)
+	} else if file, ok := arguments["file"].(string); ok && file != "" {
+		attachment, err := loadAttachmentFile(file)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		data = attachment.Data
+	} else {
+		return mcp.NewToolResultError("xml or file is required for import action"), nil
+	}
+
+	wanted, warnings, err := parseMailFilters(data)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	resp, err := gmailService().Users.Settings.Filters.List("me").Context(ctx).Do()
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to list filters: %v", err)), nil
+	}
+
+	labels, err := listGmailLabels(ctx)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	existing := make(map[string]bool, len(resp.Filter))
+	for _, filter := range resp.Filter {
+		existing[filterKey(flatFilterArguments(filterArguments(filter, labels)))] = true
+	}
+
+	var toAdd []map[string]interface{}
+	inFile := make(map[string]bool, len(wanted))
+	unchanged := 0
+	for _, filter := range wanted {
+		key := filterKey(filter)
+		if inFile[key] {
+			continue
+		}
+		inFile[key] = true
+		if existing[key] {
+			unchanged++
+			continue
+		}
+		toAdd = append(toAdd, filter)
+	}
+
+	type removal struct {
+		id     string
+		filter map[string]interface{}
+	}
+	var toRemove []removal
+	for _, filter := range resp.Filter {
+		flat := flatFilterArguments(filterArguments(filter, labels))
+		if !inFile[filterKey(flat)] {
+			toRemove = append(toRemove, removal{filter.Id, flat})
+		}
+	}
+
+	replace, _ := arguments["replace"].(bool)
+	result := map[string]interface{}{
+		"unchanged": unchanged,
+	}
+	if len(warnings) > 0 {
+		result["warnings"] = warnings
+	}
+
+	if diff, _ := arguments["diff"].(bool); diff {
+		added := make([]map[string]interface{}, 0, len(toAdd))
+		for _, filter := range toAdd {
+			added = append(added, splitFilterArguments(filter))
+		}
+		removed := make([]map[string]interface{}, 0, len(toRemove))
+		for _, r := range toRemove {
+			entry := splitFilterArguments(r.filter)
+			entry["id"] = r.id
+			removed = append(removed, entry)
+		}
+		result["add"] = added
+		result["remove"] = removed
+		if !replace && len(removed) > 0 {
+			result["note"] = "filters under remove are only deleted when importing with replace"
+		}
+	} else {
+		var created []string
+		var failed []map[string]string
+		total := len(toAdd)
+		if replace {
+			total += len(toRemove)
+		}
+
+		for i, filter := range toAdd {
+			if request.Cancelled() {
+				break
+			}
+			request.Progress(i, total, "Creating filters")
+
+			gmailFilter, err := filterFromArguments(ctx, labels, filter)
+			if err == nil {
+				gmailFilter, err = gmailService().Users.Settings.Filters.Create("me", gmailFilter).Context(ctx).Do()
+				if err == nil {
+					created = append(created, gmailFilter.Id)
+					continue
+				}
+			}
+			failed = append(failed, map[string]string{"filter": strings.TrimSpace(filterKey(filter)), "error": err.Error()})
+		}
+
+		// Filters are only deleted once every new one exists, so a failed
+		// import never leaves the account with fewer filters than before.
+		var deleted []string
+		if replace && len(failed) == 0 && !request.Cancelled() {
+			for i, r := range toRemove {
+				request.Progress(len(toAdd)+i, total, "Deleting filters")
+				if err := gmailService().Users.Settings.Filters.Delete("me", r.id).Context(ctx).Do(); err != nil {
+					failed = append(failed, map[string]string{"id": r.id, "error": err.Error()})
+					continue
+				}
+				deleted = append(deleted, r.id)
+			}
+		}
+		request.Progress(total, total, "Done")
+
+		result["created"] = created
+		if replace {
+			result["deleted"] = deleted
+		}
+		if len(failed) > 0 {
+			result["failed"] = failed
+		}
+		if request.Cancelled() {
+			result["partial"] = true
+		}
+	}
+
+	yamlResult, err := yaml.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(yamlResult)), nil
+}
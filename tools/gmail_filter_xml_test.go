@@ -0,0 +1,197 @@
+package tools
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fixtureMailFilters are the filters of testdata/mailFilters.xml.
+var fixtureMailFilters = []map[string]interface{}{
+	{"from": "billing@example.com", "add_labels": []string{"Finance/Invoices"}, "archive": true, "mark_read": true},
+	{"query": `list:announce.example.com subject:"Q&A"`, "negated_query": "urgent", "category": "promotions", "never_spam": true, "star": false},
+	{"subject": "Build failed", "has_attachment": true, "size": int64(5 << 20), "size_comparison": "larger", "forward": "ops@example.com", "mark_important": true},
+	{"to": "jane+news@example.com", "trash": true},
+}
+
+func readMailFiltersFixture(t *testing.T) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "mailFilters.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestParseMailFilters(t *testing.T) {
+	filters, warnings, err := parseMailFilters(readMailFiltersFixture(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(filters, fixtureMailFilters) {
+		t.Errorf("filters = %#v\nwant %#v", filters, fixtureMailFilters)
+	}
+	wantWarnings := []string{"entry 4: property cannedResponse is not supported and was skipped"}
+	if !reflect.DeepEqual(warnings, wantWarnings) {
+		t.Errorf("warnings = %q, want %q", warnings, wantWarnings)
+	}
+}
+
+func TestParseMailFiltersSkipped(t *testing.T) {
+	entry := func(properties string) string {
+		return "<feed xmlns='http://www.w3.org/2005/Atom' xmlns:apps='http://schemas.google.com/apps/2006'><entry>" + properties + "</entry></feed>"
+	}
+
+	tests := []struct {
+		name        string
+		xml         string
+		wantFilters int
+		wantWarning string
+	}{
+		{"invalid size", entry(`<apps:property name='from' value='a@example.com'/><apps:property name='size' value='lots'/>`), 0, "invalid size"},
+		{"unknown size unit", entry(`<apps:property name='size' value='2'/><apps:property name='sizeUnit' value='s_sgb'/>`), 0, "unknown size unit s_sgb"},
+		{"unknown category", entry(`<apps:property name='from' value='a@example.com'/><apps:property name='smartLabelToApply' value='^smartlabel_travel'/>`), 1, "unknown category"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filters, warnings, err := parseMailFilters([]byte(tt.xml))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(filters) != tt.wantFilters {
+				t.Errorf("%d filters, want %d", len(filters), tt.wantFilters)
+			}
+			if len(warnings) != 1 || !strings.Contains(warnings[0], tt.wantWarning) {
+				t.Errorf("warnings = %q, want one mentioning %q", warnings, tt.wantWarning)
+			}
+		})
+	}
+
+	if _, _, err := parseMailFilters([]byte("<feed><entry>")); err == nil {
+		t.Error("a truncated file parses")
+	}
+}
+
+func TestMarshalMailFiltersRoundTrip(t *testing.T) {
+	ids := []string{"f1", "f2", "f3", "f4"}
+	data, warnings := marshalMailFilters(fixtureMailFilters, ids, "jane@example.com")
+	if len(warnings) > 0 {
+		t.Errorf("warnings = %q, want none", warnings)
+	}
+	for _, want := range []string{
+		"<id>tag:mail.google.com,2008:filters:f1,f2,f3,f4</id>",
+		"<email>jane@example.com</email>",
+		"<apps:property name='hasTheWord' value='list:announce.example.com subject:&#34;Q&amp;A&#34;'/>",
+		"<apps:property name='sizeOperator' value='s_sl'/>",
+		"<apps:property name='smartLabelToApply' value='^smartlabel_promo'/>",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("output lacks %s:\n%s", want, data)
+		}
+	}
+
+	parsed, warnings, err := parseMailFilters(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) > 0 {
+		t.Errorf("parse warnings = %q, want none", warnings)
+	}
+	if len(parsed) != len(fixtureMailFilters) {
+		t.Fatalf("%d filters parse back, want %d", len(parsed), len(fixtureMailFilters))
+	}
+	for i := range parsed {
+		if got, want := filterKey(parsed[i]), filterKey(fixtureMailFilters[i]); got != want {
+			t.Errorf("filter %d parses back as\n%s\nwant\n%s", i+1, got, want)
+		}
+	}
+
+	// Gmail's XML has no way to remove labels other than the inbox.
+	_, warnings = marshalMailFilters([]map[string]interface{}{{"from": "a@example.com", "remove_labels": []string{"Work"}}}, []string{"f9"}, "")
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "Work") {
+		t.Errorf("warnings = %q, want one about removing Work", warnings)
+	}
+}
+
+func TestFilterKey(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  map[string]interface{}
+		equal bool
+	}{
+		{"false flags and empty strings are ignored",
+			map[string]interface{}{"from": "a@example.com", "star": false, "subject": ""},
+			map[string]interface{}{"from": "a@example.com"}, true},
+		{"label order and case",
+			map[string]interface{}{"add_labels": []string{"Work", "Clients/Acme"}},
+			map[string]interface{}{"add_labels": []interface{}{"clients/acme", "WORK"}}, true},
+		{"size comparison defaults to larger",
+			map[string]interface{}{"size": int64(1024)},
+			map[string]interface{}{"size": float64(1024), "size_comparison": "larger"}, true},
+		{"different size comparison",
+			map[string]interface{}{"size": int64(1024)},
+			map[string]interface{}{"size": int64(1024), "size_comparison": "smaller"}, false},
+		{"different action",
+			map[string]interface{}{"from": "a@example.com", "archive": true},
+			map[string]interface{}{"from": "a@example.com", "trash": true}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if equal := filterKey(tt.a) == filterKey(tt.b); equal != tt.equal {
+				t.Errorf("keys equal = %v, want %v:\n%s\n%s", equal, tt.equal, filterKey(tt.a), filterKey(tt.b))
+			}
+		})
+	}
+}
+
+func TestGmailImportFiltersDiff(t *testing.T) {
+	fakeGoogle(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			t.Errorf("diff made a %s request to %s", r.Method, r.URL.Path)
+			http.Error(w, "unexpected", http.StatusBadRequest)
+			return
+		}
+		switch strings.TrimPrefix(r.URL.Path, "/gmail/v1/users/me/") {
+		case "labels":
+			writeJSON(w, map[string]interface{}{"labels": []map[string]string{
+				{"id": "INBOX", "name": "INBOX", "type": "system"},
+				{"id": "Label_1", "name": "Finance/Invoices", "type": "user"},
+			}})
+		case "settings/filters":
+			writeJSON(w, map[string]interface{}{"filter": []map[string]interface{}{
+				// The first filter of the file, as the API has it.
+				{"id": "f1", "criteria": map[string]interface{}{"from": "billing@example.com"},
+					"action": map[string]interface{}{"addLabelIds": []string{"Label_1"}, "removeLabelIds": []string{"INBOX", "UNREAD"}}},
+				{"id": "f2", "criteria": map[string]interface{}{"from": "old@example.com"},
+					"action": map[string]interface{}{"addLabelIds": []string{"TRASH"}}},
+			}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	result, err := gmailImportFiltersHandler(map[string]interface{}{"xml": string(readMailFiltersFixture(t)), "diff": true})
+	decoded := resultYAML(t, result, err)
+
+	if decoded["unchanged"] != 1 {
+		t.Errorf("unchanged = %v, want 1", decoded["unchanged"])
+	}
+	if added, _ := decoded["add"].([]interface{}); len(added) != 3 {
+		t.Errorf("add = %v, want the 3 filters the account lacks", decoded["add"])
+	}
+	removed, _ := decoded["remove"].([]interface{})
+	if len(removed) != 1 || removed[0].(map[string]interface{})["id"] != "f2" {
+		t.Errorf("remove = %v, want f2", decoded["remove"])
+	}
+	if note, _ := decoded["note"].(string); !strings.Contains(note, "replace") {
+		t.Errorf("note = %q, want it to explain replace", note)
+	}
+	if _, ok := decoded["created"]; ok {
+		t.Error("diff created filters")
+	}
+}
@@ -0,0 +1,583 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/nguyenvanduocit/google-kit/email"
+	"github.com/nguyenvanduocit/google-kit/util"
+	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/googleapi"
+	"gopkg.in/yaml.v3"
+)
+
+// gmailImportMaxFailures caps the failures listed in a report; the
+// checkpoint keeps all of them.
+const gmailImportMaxFailures = 100
+
+// gmailImportAttempts is how many times an import is tried when Gmail is
+// rate limiting or failing.
+const gmailImportAttempts = 3
+
+// gmailImportCheckpoint is the progress of an import, saved in STATE_DIR
+// after every batch so that an interrupted import resumes where it stopped.
+type gmailImportCheckpoint struct {
+	Source string `json:"source"`
+	// Position is the mbox offset, or the number of EML files, up to which
+	// every message was processed.
+	Position   int64 `json:"position"`
+	Imported   int   `json:"imported"`
+	Duplicates int   `json:"duplicates"`
+	Failed     int   `json:"failed"`
+	// Failures are the messages before Position that failed, and can be
+	// retried with RetryFailed.
+	Failures  []gmailImportFailure `json:"failures,omitempty"`
+	UpdatedAt time.Time            `json:"updatedAt"`
+}
+
+// gmailImportFailure is a message that could not be imported.
+type gmailImportFailure struct {
+	Message string `json:"message" yaml:"message"`
+	// At is where the message is in the archive, for reading it again.
+	// Checkpoints saved before it was kept lack it.
+	At    string `json:"at,omitempty" yaml:"-"`
+	Error string `json:"error" yaml:"error"`
+}
+
+// gmailImportCheckpointName returns the state file name of the checkpoint
+// of an archive.
+func gmailImportCheckpointName(source string) string {
+	sum := sha256.Sum256([]byte(source))
+	return "gmail-import-" + hex.EncodeToString(sum[:8]) + ".json"
+}
+
+// gmailImportOptions are the settings of an import.
+type gmailImportOptions struct {
+	// Labels are names or IDs of labels added to every message; missing
+	// user labels are created.
+	Labels []string
+	// Dedupe skips messages whose Message-ID is already in the mailbox.
+	Dedupe bool
+	// Restart ignores the checkpoint of an earlier import.
+	Restart bool
+	// RetryFailed imports the messages that failed in earlier runs again
+	// before resuming.
+	RetryFailed bool
+}
+
+// gmailImportSource yields the messages of an archive in a fixed order.
+type gmailImportSource interface {
+	// next returns the next message, a name for it in reports and where
+	// it is, or io.EOF. Errors with a name only concern that message.
+	next() (name, at string, raw []byte, err error)
+	// read returns the message at a place next returned.
+	read(at string) (name string, raw []byte, err error)
+	// position is where the messages after those returned so far start.
+	position() int64
+	// progress returns how far reading is, in bytes or files.
+	progress() (done, total int64)
+	close()
+}
+
+type mboxImportSource struct {
+	file   *os.File
+	reader *email.MboxReader
+	name   string
+	start  int64
+	size   int64
+}
+
+func (s *mboxImportSource) next() (string, string, []byte, error) {
+	raw, offset, err := s.reader.Next()
+	if err != nil {
+		return "", "", nil, err
+	}
+	at := s.start + offset
+	return fmt.Sprintf("%s at byte %d", s.name, at), strconv.FormatInt(at, 10), raw, nil
+}
+
+func (s *mboxImportSource) read(at string) (string, []byte, error) {
+	offset, err := strconv.ParseInt(at, 10, 64)
+	if err != nil || offset < 0 || offset >= s.size {
+		return "", nil, fmt.Errorf("no message at %q", at)
+	}
+	raw, _, err := email.NewMboxReader(io.NewSectionReader(s.file, offset, s.size-offset)).Next()
+	return fmt.Sprintf("%s at byte %d", s.name, offset), raw, err
+}
+
+func (s *mboxImportSource) position() int64 {
+	return s.start + s.reader.Offset()
+}
+
+func (s *mboxImportSource) progress() (int64, int64) {
+	return s.position(), s.size
+}
+
+func (s *mboxImportSource) close() {
+	s.file.Close()
+}
+
+type emlImportSource struct {
+	dir   string
+	files []string
+	i     int
+}
+
+func (s *emlImportSource) next() (string, string, []byte, error) {
+	if s.i >= len(s.files) {
+		return "", "", nil, io.EOF
+	}
+	name := s.files[s.i]
+	s.i++
+	raw, err := os.ReadFile(filepath.Join(s.dir, name))
+	return name, name, raw, err
+}
+
+func (s *emlImportSource) read(at string) (string, []byte, error) {
+	if !filepath.IsLocal(at) {
+		return "", nil, fmt.Errorf("no message at %q", at)
+	}
+	raw, err := os.ReadFile(filepath.Join(s.dir, at))
+	return at, raw, err
+}
+
+func (s *emlImportSource) position() int64 {
+	return int64(s.i)
+}
+
+func (s *emlImportSource) progress() (int64, int64) {
+	return int64(s.i), int64(len(s.files))
+}
+
+func (s *emlImportSource) close() {}
+
+// openGmailImportSource opens an mbox file, a single .eml file or a
+// directory searched for .eml files, at the given checkpoint position.
+func openGmailImportSource(path string, position int64) (gmailImportSource, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		var files []string
+		err := filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.Type().IsRegular() && strings.EqualFold(filepath.Ext(file), ".eml") {
+				rel, err := filepath.Rel(path, file)
+				if err != nil {
+					return err
+				}
+				files = append(files, rel)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %v", path, err)
+		}
+		sort.Strings(files)
+		return &emlImportSource{dir: path, files: files, i: int(min(position, int64(len(files))))}, nil
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".eml") {
+		return &emlImportSource{dir: filepath.Dir(path), files: []string{filepath.Base(path)}, i: int(min(position, 1))}, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(position, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &mboxImportSource{
+		file:   file,
+		reader: email.NewMboxReader(file),
+		name:   filepath.Base(path),
+		start:  position,
+		size:   info.Size(),
+	}, nil
+}
+
+// runGmailImport imports the messages of an archive, resuming from its
+// checkpoint, and returns a report.
+func runGmailImport(request *util.Request, path string, opts gmailImportOptions) (map[string]interface{}, error) {
+	ctx := request.Context()
+
+	source, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	checkpointName := gmailImportCheckpointName(source)
+
+	var checkpoint gmailImportCheckpoint
+	if !opts.Restart {
+		if err := util.LoadState(checkpointName, &checkpoint); err != nil {
+			log.Printf("Failed to load import checkpoint: %v", err)
+		}
+	}
+	if checkpoint.Source != source {
+		checkpoint = gmailImportCheckpoint{Source: source}
+	}
+	resumedAt := checkpoint.Position
+
+	archive, err := openGmailImportSource(source, checkpoint.Position)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer archive.close()
+
+	labels, err := listGmailLabels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	labelIDs := make([]string, 0, len(opts.Labels))
+	for _, name := range opts.Labels {
+		label := labels.find(name)
+		if label == nil {
+			if label, err = labels.createOrGet(ctx, name); err != nil {
+				return nil, err
+			}
+		}
+		labelIDs = append(labelIDs, label.Id)
+	}
+
+	seen := &gmailImportSeen{ids: make(map[string]bool)}
+
+	type item struct {
+		name string
+		at   string
+		raw  []byte
+		err  error
+	}
+
+	imported, duplicates, failed, retried := 0, 0, 0, 0
+	// importBatch imports a batch and counts the outcomes, adding the
+	// messages that failed to the checkpoint. It reports false when the
+	// request was cancelled, in which case nothing is counted: the batch
+	// is processed again on resume, where messages already imported are
+	// skipped as duplicates.
+	importBatch := func(batch []item) bool {
+		outcomes := make([]string, len(batch))
+		errs := gmailParallel(ctx, len(batch), nil, func(i int) error {
+			if batch[i].err != nil {
+				return batch[i].err
+			}
+			var err error
+			outcomes[i], err = importGmailMessage(ctx, batch[i].raw, labelIDs, opts.Dedupe, seen)
+			return err
+		})
+		if request.Cancelled() {
+			return false
+		}
+
+		for i, err := range errs {
+			switch {
+			case err != nil:
+				failed++
+				checkpoint.Failed++
+				checkpoint.Failures = append(checkpoint.Failures, gmailImportFailure{Message: batch[i].name, At: batch[i].at, Error: err.Error()})
+			case outcomes[i] == "duplicate":
+				duplicates++
+				checkpoint.Duplicates++
+			default:
+				imported++
+				checkpoint.Imported++
+			}
+		}
+		return true
+	}
+	saveCheckpoint := func() {
+		checkpoint.UpdatedAt = time.Now()
+		if err := util.SaveState(checkpointName, checkpoint); err != nil {
+			log.Printf("Failed to save import checkpoint: %v", err)
+		}
+	}
+
+	batchSize := gmailFetchConcurrency() * 4
+
+	// Failures are taken out of the checkpoint as they are retried, and
+	// those that fail again are added back.
+	if opts.RetryFailed {
+		var retry, kept []gmailImportFailure
+		for _, failure := range checkpoint.Failures {
+			if failure.At == "" {
+				kept = append(kept, failure)
+			} else {
+				retry = append(retry, failure)
+			}
+		}
+		for len(retry) > 0 {
+			chunk := retry[:min(batchSize, len(retry))]
+			batch := make([]item, len(chunk))
+			for i, failure := range chunk {
+				name, raw, err := archive.read(failure.At)
+				if name == "" {
+					name = failure.Message
+				}
+				batch[i] = item{name, failure.At, raw, err}
+			}
+
+			checkpoint.Failures = kept
+			if !importBatch(batch) {
+				break
+			}
+			kept = slices.Clip(checkpoint.Failures)
+			checkpoint.Failed -= len(chunk)
+			retried += len(chunk)
+			retry = retry[len(chunk):]
+			checkpoint.Failures = append(kept, retry...)
+			saveCheckpoint()
+		}
+		checkpoint.Failures = append(kept, retry...)
+	}
+
+	for done := false; !done && !request.Cancelled(); {
+		var batch []item
+		for len(batch) < batchSize {
+			name, at, raw, err := archive.next()
+			if err == io.EOF {
+				done = true
+				break
+			}
+			if err != nil && name == "" {
+				return nil, fmt.Errorf("failed to read %s: %v", path, err)
+			}
+			batch = append(batch, item{name, at, raw, err})
+		}
+
+		if !importBatch(batch) {
+			break
+		}
+		checkpoint.Position = archive.position()
+		saveCheckpoint()
+
+		read, total := archive.progress()
+		request.Progress(int(read), int(total), fmt.Sprintf("Imported %d messages", imported))
+	}
+
+	report := map[string]interface{}{
+		"source":     source,
+		"imported":   imported,
+		"duplicates": duplicates,
+		"failed":     failed,
+		"total": map[string]interface{}{
+			"imported":   checkpoint.Imported,
+			"duplicates": checkpoint.Duplicates,
+			"failed":     checkpoint.Failed,
+		},
+	}
+	if resumedAt > 0 {
+		report["resumed"] = true
+	}
+	if retried > 0 {
+		report["retried"] = retried
+	}
+	if len(checkpoint.Failures) > 0 {
+		report["failures"] = checkpoint.Failures[:min(len(checkpoint.Failures), gmailImportMaxFailures)]
+		report["note"] = "import again with retry_failed to retry the failed messages"
+	}
+	if dir, err := util.StateDir(); err == nil {
+		report["checkpoint"] = filepath.Join(dir, checkpointName)
+	}
+	if request.Cancelled() {
+		report["partial"] = true
+		report["note"] = "import again to resume from the checkpoint"
+	}
+	return report, nil
+}
+
+// gmailImportSeen holds the Message-IDs imported in a run, to skip
+// duplicates within an archive that the search index may not show yet.
+type gmailImportSeen struct {
+	mu  sync.Mutex
+	ids map[string]bool
+}
+
+// claim reports whether messageID was not claimed yet, and claims it.
+func (s *gmailImportSeen) claim(messageID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ids[messageID] {
+		return false
+	}
+	s.ids[messageID] = true
+	return true
+}
+
+// release gives up a claim after the message could not be imported.
+func (s *gmailImportSeen) release(messageID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.ids, messageID)
+}
+
+// importGmailMessage imports one message with its original date and
+// headers, unless dedupe is set and its Message-ID is already in the
+// mailbox or in seen. It returns "imported" or "duplicate".
+func importGmailMessage(ctx context.Context, raw []byte, labelIDs []string, dedupe bool, seen *gmailImportSeen) (outcome string, err error) {
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return "", errors.New("empty message")
+	}
+
+	if dedupe {
+		messageID := ""
+		if parsed, err := mail.ReadMessage(bytes.NewReader(raw)); err == nil {
+			messageID = strings.Trim(strings.TrimSpace(parsed.Header.Get("Message-Id")), "<>")
+		}
+		if messageID != "" {
+			if !seen.claim(messageID) {
+				return "duplicate", nil
+			}
+			defer func() {
+				if err != nil {
+					seen.release(messageID)
+				}
+			}()
+			resp, err := gmailService().Users.Messages.List("me").
+				Q("rfc822msgid:" + messageID).
+				IncludeSpamTrash(true).
+				MaxResults(1).
+				Fields("messages/id").
+				Context(ctx).
+				Do()
+			if err != nil {
+				return "", fmt.Errorf("failed to check for duplicates: %v", err)
+			}
+			if len(resp.Messages) > 0 {
+				return "duplicate", nil
+			}
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		_, err = gmailService().Users.Messages.Import("me", &gmail.Message{LabelIds: labelIDs}).
+			InternalDateSource("dateHeader").
+			NeverMarkSpam(true).
+			Media(bytes.NewReader(raw), googleapi.ContentType("message/rfc822")).
+			Context(ctx).
+			Do()
+		status := googleAPIStatus(err)
+		if err == nil || attempt == gmailImportAttempts || (status != http.StatusTooManyRequests && status < 500) {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(time.Duration(attempt) * 2 * time.Second):
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to import: %v", err)
+	}
+	return "imported", nil
+}
+
+// gmailImportHandler imports an archive from GMAIL_IMPORT_DIR.
+func gmailImportHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	if os.Getenv("GMAIL_IMPORT_DIR") == "" {
+		return mcp.NewToolResultError("GMAIL_IMPORT_DIR must be set to import archives"), nil
+	}
+
+	path, _ := arguments["path"].(string)
+	if path == "" {
+		return mcp.NewToolResultError("path is required"), nil
+	}
+	resolved, err := resolveInsideDir("GMAIL_IMPORT_DIR", path)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("cannot import %s: %v", path, err)), nil
+	}
+
+	opts := gmailImportOptions{
+		Labels: util.StringsFromArguments(arguments, "labels"),
+		Dedupe: true,
+	}
+	if value, ok := arguments["dedupe"].(bool); ok {
+		opts.Dedupe = value
+	}
+	opts.Restart, _ = arguments["restart"].(bool)
+	opts.RetryFailed, _ = arguments["retry_failed"].(bool)
+
+	report, err := runGmailImport(util.RequestFromArguments(arguments), resolved, opts)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	yamlResult, err := yaml.Marshal(report)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(yamlResult)), nil
+}
+
+// RunGmailImportCommand runs the import subcommand of the command line,
+// which can read archives anywhere:
+//
+//	import [-label NAME]... [-no-dedupe] [-restart] [-retry-failed] PATH
+func RunGmailImportCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	var opts gmailImportOptions
+	flags.Func("label", "label to add to every message; repeat for more", func(value string) error {
+		opts.Labels = append(opts.Labels, value)
+		return nil
+	})
+	noDedupe := flags.Bool("no-dedupe", false, "import messages whose Message-ID is already in the mailbox")
+	flags.BoolVar(&opts.Restart, "restart", false, "ignore the checkpoint of an earlier import")
+	flags.BoolVar(&opts.RetryFailed, "retry-failed", false, "import the messages that failed earlier again before resuming")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: import [-label NAME]... [-no-dedupe] [-restart] [-retry-failed] PATH")
+	}
+	opts.Dedupe = !*noDedupe
+
+	reported := false
+	request := util.NewRequest(ctx, func(done, total int, message string) {
+		reported = true
+		if total > 0 {
+			fmt.Fprintf(os.Stderr, "\r%s (%d%%)", message, done*100/total)
+		} else {
+			fmt.Fprintf(os.Stderr, "\r%s", message)
+		}
+	})
+
+	report, err := runGmailImport(request, flags.Arg(0), opts)
+	if reported {
+		fmt.Fprintln(os.Stderr)
+	}
+	if err != nil {
+		return err
+	}
+
+	out, err := yaml.Marshal(report)
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(out))
+	return nil
+}
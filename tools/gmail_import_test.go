@@ -0,0 +1,111 @@
+package tools
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nguyenvanduocit/google-kit/email"
+	"github.com/nguyenvanduocit/google-kit/util"
+)
+
+func TestGmailImportRetryFailed(t *testing.T) {
+	messages := []string{
+		"Subject: one\r\n\r\nfirst\r\n",
+		"Subject: two\r\n\r\nbroken\r\n",
+		"Subject: three\r\n\r\nthird\r\n",
+	}
+
+	dir := t.TempDir()
+	var mbox bytes.Buffer
+	w := email.NewMboxWriter(&mbox)
+	for i, message := range messages {
+		if _, err := w.WriteMessage("a@example.com", time.Now(), []byte(message)); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("%d.eml", i)), []byte(message), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mboxPath := filepath.Join(t.TempDir(), "archive.mbox")
+	if err := os.WriteFile(mboxPath, mbox.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		broken   atomic.Bool
+		imported atomic.Int64
+	)
+	fakeGoogle(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/labels"):
+			writeJSON(w, map[string]interface{}{"labels": []interface{}{}})
+		case strings.HasSuffix(r.URL.Path, "/messages/import"):
+			body, _ := io.ReadAll(r.Body)
+			if broken.Load() && bytes.Contains(body, []byte("broken")) {
+				w.WriteHeader(http.StatusBadRequest)
+				writeJSON(w, map[string]interface{}{"error": map[string]interface{}{"code": 400, "message": "Invalid message"}})
+				return
+			}
+			imported.Add(1)
+			writeJSON(w, map[string]string{"id": "m"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	for name, path := range map[string]string{"mbox": mboxPath, "eml": dir} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("STATE_DIR", t.TempDir())
+			imported.Store(0)
+			request := util.RequestFromArguments(nil)
+
+			broken.Store(true)
+			report, err := runGmailImport(request, path, gmailImportOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report["imported"] != 2 || report["failed"] != 1 {
+				t.Fatalf("report = %v, want 2 imported and 1 failed", report)
+			}
+			failures, _ := report["failures"].([]gmailImportFailure)
+			if len(failures) != 1 || failures[0].At == "" {
+				t.Fatalf("failures = %+v, want one that can be found again", failures)
+			}
+
+			// Resuming without retry_failed leaves the failure alone.
+			broken.Store(false)
+			report, err = runGmailImport(request, path, gmailImportOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report["imported"] != 0 || imported.Load() != 2 {
+				t.Fatalf("report = %v after %d imports, want nothing imported again", report, imported.Load())
+			}
+
+			report, err = runGmailImport(request, path, gmailImportOptions{RetryFailed: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report["retried"] != 1 || report["imported"] != 1 || report["failed"] != 0 {
+				t.Errorf("report = %v, want the failed message retried and imported", report)
+			}
+			if total := report["total"].(map[string]interface{}); total["imported"] != 3 || total["failed"] != 0 {
+				t.Errorf("total = %v, want 3 imported and none failed", total)
+			}
+			if _, ok := report["failures"]; ok {
+				t.Errorf("failures = %v, want none left", report["failures"])
+			}
+			if imported.Load() != 3 {
+				t.Errorf("%d imports, want 3", imported.Load())
+			}
+		})
+	}
+}
@@ -0,0 +1,638 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/nguyenvanduocit/google-kit/email"
+	"github.com/nguyenvanduocit/google-kit/mailindex"
+	"github.com/nguyenvanduocit/google-kit/util"
+	"google.golang.org/api/gmail/v1"
+	"gopkg.in/yaml.v3"
+)
+
+const gmailIndexFile = "gmail-index.bin"
+
+// gmailIndexBatch is the number of messages fetched in full before they
+// are added to the index, which bounds memory during a rebuild.
+const gmailIndexBatch = 200
+
+// gmailIndexExcluded lists the labels of messages kept out of the index.
+var gmailIndexExcluded = []string{"SPAM", "TRASH", "DRAFT"}
+
+var (
+	// gmailIndexMu serializes loading, syncing and saving the index.
+	gmailIndexMu sync.Mutex
+	// gmailIndex is the loaded index, nil until first used.
+	gmailIndex *mailindex.Index
+)
+
+// gmailIndexEnabled reports whether the local index is turned on with
+// GMAIL_LOCAL_INDEX. It is off by default, since it keeps a copy of the
+// mail on disk.
+func gmailIndexEnabled() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("GMAIL_LOCAL_INDEX"))
+	return enabled
+}
+
+// gmailIndexOptions returns the limits of the index, configurable with
+// GMAIL_INDEX_MAX_MESSAGES (default 20000), GMAIL_INDEX_MAX_BODY_KB
+// (default 64) and GMAIL_INDEX_MAX_MB (default 512).
+func gmailIndexOptions() mailindex.Options {
+	return mailindex.Options{
+		MaxDocuments:  intFromEnv("GMAIL_INDEX_MAX_MESSAGES", 20000),
+		MaxBodyBytes:  intFromEnv("GMAIL_INDEX_MAX_BODY_KB", 64) << 10,
+		MaxTotalBytes: int64(intFromEnv("GMAIL_INDEX_MAX_MB", 512)) << 20,
+	}
+}
+
+// gmailIndexSyncInterval is how old the last sync may be before a search
+// syncs again, configurable with GMAIL_INDEX_SYNC_INTERVAL (default 5m), so
+// that a burst of searches does not sync before each one.
+func gmailIndexSyncInterval() time.Duration {
+	return durationFromEnv("GMAIL_INDEX_SYNC_INTERVAL", 5*time.Minute)
+}
+
+// intFromEnv parses a positive number from the named environment variable.
+func intFromEnv(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	if n, err := strconv.Atoi(value); err == nil && n > 0 {
+		return n
+	}
+
+	log.Printf("Invalid %s %q, using %d", name, value, fallback)
+	return fallback
+}
+
+// gmailIndexPath returns where the index is saved, in STATE_DIR.
+func gmailIndexPath() (string, error) {
+	dir, err := util.StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, gmailIndexFile), nil
+}
+
+// loadGmailIndex returns the index, from memory or from its file. A
+// missing file gives an empty index. Callers hold gmailIndexMu.
+func loadGmailIndex() (*mailindex.Index, error) {
+	if gmailIndex != nil {
+		return gmailIndex, nil
+	}
+
+	path, err := gmailIndexPath()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		gmailIndex = mailindex.New(gmailIndexOptions())
+		return gmailIndex, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the local index: %v", err)
+	}
+	defer f.Close()
+
+	ix, err := mailindex.Read(bufio.NewReader(f), os.Getenv("GMAIL_INDEX_KEY"), gmailIndexOptions())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the local index %s: %v; set GMAIL_INDEX_KEY to the key it was saved with, or rebuild it", path, err)
+	}
+
+	gmailIndex = ix
+	return gmailIndex, nil
+}
+
+// saveGmailIndex writes the index to its file, encrypted with
+// GMAIL_INDEX_KEY when set. Callers hold gmailIndexMu.
+func saveGmailIndex(ix *mailindex.Index) error {
+	path, err := gmailIndexPath()
+	if err != nil {
+		return err
+	}
+
+	return util.WriteFileAtomicFunc(path, 0o600, func(w io.Writer) error {
+		return ix.WriteTo(w, os.Getenv("GMAIL_INDEX_KEY"))
+	})
+}
+
+// gmailIndexSync is what a sync of the index did.
+type gmailIndexSync struct {
+	Rebuilt bool `yaml:"rebuilt,omitempty"`
+	Added   int  `yaml:"added"`
+	Removed int  `yaml:"removed"`
+	Updated int  `yaml:"updated"`
+	Failed  int  `yaml:"failed,omitempty"`
+	// More is set when the history was capped and the next sync continues.
+	More bool `yaml:"more,omitempty"`
+	// Partial is set when the sync was cancelled; a cancelled rebuild
+	// keeps the previous index.
+	Partial bool `yaml:"partial,omitempty"`
+	// Error is why the sync failed, such as being offline.
+	Error string `yaml:"error,omitempty"`
+}
+
+// syncGmailIndex brings the index up to date through the history API. It
+// rebuilds the index instead when it was never built, belongs to another
+// account, its cursor expired or rebuild is set, and returns the index to
+// use from then on. Callers hold gmailIndexMu.
+func syncGmailIndex(request *util.Request, ix *mailindex.Index, rebuild bool) (*mailindex.Index, *gmailIndexSync, error) {
+	ctx := request.Context()
+
+	profile, err := gmailService().Users.GetProfile("me").Context(ctx).Do()
+	if err != nil {
+		return ix, nil, fmt.Errorf("failed to get profile: %v", err)
+	}
+
+	historyID, _ := ix.Cursor()
+	if rebuild || historyID == 0 || ix.Account() != profile.EmailAddress {
+		return rebuildGmailIndex(request, ix, profile)
+	}
+
+	stats := &gmailIndexSync{}
+	for {
+		changes, err := listGmailHistory(ctx, historyID)
+		if err == errHistoryExpired {
+			return rebuildGmailIndex(request, ix, profile)
+		}
+		if err != nil {
+			return ix, stats, err
+		}
+
+		applyGmailIndexChanges(request, ix, changes, stats)
+		if request.Cancelled() {
+			// Changes already applied are seen again next time, which
+			// does no harm.
+			stats.Partial = true
+			return ix, stats, nil
+		}
+
+		historyID = changes.Next
+		ix.SetCursor(historyID)
+		if !changes.More {
+			return ix, stats, nil
+		}
+	}
+}
+
+// rebuildGmailIndex indexes the newest messages, up to the limits of the
+// index, matching GMAIL_INDEX_QUERY when set. A cancelled rebuild returns
+// the previous index.
+func rebuildGmailIndex(request *util.Request, previous *mailindex.Index, profile *gmail.Profile) (*mailindex.Index, *gmailIndexSync, error) {
+	ctx := request.Context()
+	opts := gmailIndexOptions()
+	stats := &gmailIndexSync{Rebuilt: true}
+
+	var ids []string
+	call := gmailService().Users.Messages.List("me").Q(os.Getenv("GMAIL_INDEX_QUERY")).MaxResults(500).Context(ctx)
+	err := call.Pages(ctx, func(resp *gmail.ListMessagesResponse) error {
+		for _, message := range resp.Messages {
+			if len(ids) >= opts.MaxDocuments {
+				return errStopPaging
+			}
+			ids = append(ids, message.Id)
+		}
+		request.Progress(0, 0, fmt.Sprintf("Listed %d messages", len(ids)))
+		return nil
+	})
+	if err != nil && err != errStopPaging {
+		if request.Cancelled() {
+			stats.Partial = true
+			return previous, stats, nil
+		}
+		return previous, nil, fmt.Errorf("failed to list messages: %v", err)
+	}
+
+	ix := mailindex.New(opts)
+	ix.SetAccount(profile.EmailAddress)
+	for start := 0; start < len(ids); start += gmailIndexBatch {
+		batch := ids[start:min(start+gmailIndexBatch, len(ids))]
+		added, failed := putGmailIndexMessages(ctx, ix, batch, func(done int) {
+			request.Progress(start+done, len(ids), "Indexing messages")
+		})
+		stats.Added += added
+		stats.Failed += failed
+
+		if request.Cancelled() {
+			stats.Partial = true
+			return previous, stats, nil
+		}
+	}
+
+	// Changes made while listing and fetching are picked up by the next
+	// sync from the history ID read before listing.
+	ix.SetCursor(profile.HistoryId)
+	return ix, stats, nil
+}
+
+// applyGmailIndexChanges applies history records to the index.
+func applyGmailIndexChanges(request *util.Request, ix *mailindex.Index, changes *gmailHistoryChanges, stats *gmailIndexSync) {
+	for _, id := range changes.Deleted {
+		if ix.Has(id) {
+			ix.Remove(id)
+			stats.Removed++
+		}
+	}
+
+	fetch := append([]string(nil), changes.Added...)
+	for id, removed := range changes.LabelsRemoved {
+		if !ix.Has(id) && gmailIndexExcludes(removed) {
+			// Restored from spam or trash.
+			fetch = append(fetch, id)
+		}
+	}
+
+	for _, id := range dedupeStrings(append(mapKeys(changes.LabelsAdded), mapKeys(changes.LabelsRemoved)...)) {
+		current, ok := ix.Labels(id)
+		if !ok {
+			continue
+		}
+		labels := make([]string, 0, len(current))
+		for _, label := range current {
+			if !slices.Contains(changes.LabelsRemoved[id], label) {
+				labels = append(labels, label)
+			}
+		}
+		for _, label := range changes.LabelsAdded[id] {
+			if !slices.Contains(labels, label) {
+				labels = append(labels, label)
+			}
+		}
+
+		if gmailIndexExcludes(labels) {
+			ix.Remove(id)
+			stats.Removed++
+			continue
+		}
+		ix.SetLabels(id, labels)
+		stats.Updated++
+	}
+
+	added, failed := putGmailIndexMessages(request.Context(), ix, fetch, func(done int) {
+		request.Progress(done, len(fetch), "Indexing new messages")
+	})
+	stats.Added += added
+	stats.Failed += failed
+	stats.More = changes.More
+}
+
+// putGmailIndexMessages fetches messages in full and adds them to the
+// index. Messages deleted meanwhile are skipped silently.
+func putGmailIndexMessages(ctx context.Context, ix *mailindex.Index, ids []string, progress func(done int)) (int, int) {
+	messages := make([]*gmail.Message, len(ids))
+	errs := gmailParallel(ctx, len(ids), progress, func(i int) error {
+		var err error
+		messages[i], err = gmailService().Users.Messages.Get("me", ids[i]).Format("full").Context(ctx).Do()
+		return err
+	})
+
+	added, failed := 0, 0
+	for i, message := range messages {
+		switch {
+		case errs[i] == nil:
+		case ctx.Err() != nil || googleAPIStatus(errs[i]) == http.StatusNotFound:
+			continue
+		default:
+			log.Printf("Failed to index message %s: %v", ids[i], errs[i])
+			failed++
+			continue
+		}
+
+		if gmailIndexExcludes(message.LabelIds) {
+			ix.Remove(message.Id)
+			continue
+		}
+		ix.Put(gmailIndexDocument(message))
+		added++
+	}
+	return added, failed
+}
+
+// gmailIndexDocument turns a message fetched in full into a document.
+func gmailIndexDocument(message *gmail.Message) *mailindex.Document {
+	headers := gmailHeaders(message)
+	return &mailindex.Document{
+		ID:       message.Id,
+		ThreadID: message.ThreadId,
+		From:     email.DecodeHeader(headers["from"]),
+		To:       email.DecodeHeader(headers["to"]),
+		Cc:       email.DecodeHeader(headers["cc"]),
+		Subject:  email.DecodeHeader(headers["subject"]),
+		Date:     time.UnixMilli(message.InternalDate),
+		Labels:   message.LabelIds,
+		Body:     gmailContent(message).Body("text"),
+	}
+}
+
+func gmailIndexExcludes(labels []string) bool {
+	for _, label := range gmailIndexExcluded {
+		if slices.Contains(labels, label) {
+			return true
+		}
+	}
+	return false
+}
+
+func mapKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// openSyncedGmailIndex loads the index and syncs it when sync or rebuild is
+// set, saving it when the sync changed it. A failed sync is reported in the
+// stats with the loaded index, which can still be searched offline. Callers
+// hold gmailIndexMu.
+func openSyncedGmailIndex(request *util.Request, sync, rebuild bool) (*mailindex.Index, *gmailIndexSync, error) {
+	ix, err := loadGmailIndex()
+	if err != nil && !rebuild {
+		return nil, nil, err
+	}
+	if ix == nil {
+		// The file could not be loaded, and is about to be replaced.
+		ix = mailindex.New(gmailIndexOptions())
+	}
+	if !sync && !rebuild {
+		return ix, nil, nil
+	}
+
+	before, _ := ix.Cursor()
+	synced, stats, err := syncGmailIndex(request, ix, rebuild)
+	if err != nil {
+		if stats == nil {
+			stats = &gmailIndexSync{}
+		}
+		stats.Error = err.Error()
+	}
+
+	after, _ := synced.Cursor()
+	if synced != ix || after != before {
+		gmailIndex = synced
+		if err := saveGmailIndex(synced); err != nil {
+			return synced, stats, err
+		}
+	}
+	return synced, stats, nil
+}
+
+func gmailLocalSearchHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	if !gmailIndexEnabled() {
+		return mcp.NewToolResultError("the local index is off; set GMAIL_LOCAL_INDEX=true to turn it on"), nil
+	}
+
+	request := util.RequestFromArguments(arguments)
+	ctx := request.Context()
+
+	query, _ := arguments["query"].(string)
+	sync, forced := arguments["sync"].(bool)
+
+	opts := mailindex.SearchOptions{}
+	opts.From, _ = arguments["from"].(string)
+	opts.To, _ = arguments["to"].(string)
+	for _, bound := range []struct {
+		name string
+		date *time.Time
+	}{
+		{"after", &opts.After},
+		{"before", &opts.Before},
+	} {
+		value, _ := arguments[bound.name].(string)
+		if value == "" {
+			continue
+		}
+		date, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("%s must be a date as YYYY-MM-DD", bound.name)), nil
+		}
+		*bound.date = date
+	}
+
+	gmailIndexMu.Lock()
+	defer gmailIndexMu.Unlock()
+
+	if !forced {
+		// An index that was never built has a zero cursor time, so it is
+		// built on first use.
+		ix, err := loadGmailIndex()
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		_, updatedAt := ix.Cursor()
+		sync = time.Since(updatedAt) >= gmailIndexSyncInterval()
+	}
+
+	ix, stats, err := openSyncedGmailIndex(request, sync, false)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	offline := stats != nil && stats.Error != ""
+
+	// Label names need the labels API; offline, the names are taken as
+	// IDs, which works for system labels such as INBOX.
+	var (
+		labels    *gmailLabels
+		labelsErr = errors.New("offline")
+	)
+	if !offline {
+		labels, labelsErr = listGmailLabels(ctx)
+	}
+	for _, name := range util.StringsFromArguments(arguments, "label") {
+		if labelsErr == nil {
+			label := labels.find(name)
+			if label == nil {
+				return mcp.NewToolResultError(fmt.Sprintf("label %q not found", name)), nil
+			}
+			name = label.Id
+		}
+		opts.Labels = append(opts.Labels, name)
+	}
+
+	found := ix.Search(query, opts)
+	pageHits, nextPageToken, err := util.PaginateSlice(util.PageFromArguments(arguments, 20, 100), found.Hits)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	hits := make([]map[string]interface{}, 0, len(pageHits))
+	for _, hit := range pageHits {
+		doc := hit.Document
+		names := make([]string, len(doc.Labels))
+		for i, id := range doc.Labels {
+			names[i] = id
+			if labelsErr == nil {
+				if label := labels.find(id); label != nil {
+					names[i] = label.Name
+				}
+			}
+		}
+
+		info := map[string]interface{}{
+			"id":       doc.ID,
+			"threadId": doc.ThreadID,
+			"from":     doc.From,
+			"subject":  doc.Subject,
+			"date":     doc.Date.Format(time.RFC3339),
+			"labels":   names,
+		}
+		if hit.Score > 0 {
+			info["score"] = math.Round(hit.Score*1000) / 1000
+		}
+		if snippet := hit.Snippet(); snippet != "" {
+			info["snippet"] = snippet
+		}
+		hits = append(hits, info)
+	}
+
+	_, updatedAt := ix.Cursor()
+	result := map[string]interface{}{
+		"total":           len(found.Hits),
+		"hits":            hits,
+		"months":          found.Months,
+		"indexed":         ix.Len(),
+		"next_page_token": nextPageToken,
+	}
+	if !updatedAt.IsZero() {
+		result["synced_at"] = updatedAt.Format(time.RFC3339)
+	}
+	if stats != nil && (stats.Rebuilt || stats.More || stats.Partial || stats.Failed > 0 || offline) {
+		result["sync"] = stats
+	}
+	if offline {
+		result["note"] = "the index could not be synced; results are from the last sync"
+	}
+
+	yamlResult, err := yaml.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to marshal results: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(yamlResult)), nil
+}
+
+func gmailIndexHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	if !gmailIndexEnabled() {
+		return mcp.NewToolResultError("the local index is off; set GMAIL_LOCAL_INDEX=true to turn it on"), nil
+	}
+
+	action, _ := arguments["action"].(string)
+	result, err := runGmailIndexAction(util.RequestFromArguments(arguments), action)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	yamlResult, err := yaml.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to marshal index status: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(yamlResult)), nil
+}
+
+// runGmailIndexAction runs status, sync or rebuild on the index and
+// returns its status, with what the sync did.
+func runGmailIndexAction(request *util.Request, action string) (map[string]interface{}, error) {
+	gmailIndexMu.Lock()
+	defer gmailIndexMu.Unlock()
+
+	var (
+		ix    *mailindex.Index
+		stats *gmailIndexSync
+		err   error
+	)
+	switch action {
+	case "status", "":
+		ix, err = loadGmailIndex()
+	case "sync", "rebuild":
+		ix, stats, err = openSyncedGmailIndex(request, true, action == "rebuild")
+		if err == nil && stats.Error != "" {
+			err = fmt.Errorf("failed to %s the local index: %s", action, stats.Error)
+		}
+	default:
+		return nil, fmt.Errorf("invalid action: %s. Must be one of: status, sync, rebuild", action)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	opts := gmailIndexOptions()
+	historyID, updatedAt := ix.Cursor()
+	status := map[string]interface{}{
+		"messages":   ix.Len(),
+		"text_bytes": ix.Size(),
+		"encrypted":  os.Getenv("GMAIL_INDEX_KEY") != "",
+		"limits": map[string]interface{}{
+			"max_messages":   opts.MaxDocuments,
+			"max_body_bytes": opts.MaxBodyBytes,
+			"max_bytes":      opts.MaxTotalBytes,
+		},
+	}
+	if account := ix.Account(); account != "" {
+		status["account"] = account
+	}
+	if historyID != 0 {
+		status["historyId"] = strconv.FormatUint(historyID, 10)
+		status["synced_at"] = updatedAt.Format(time.RFC3339)
+	}
+	if path, err := gmailIndexPath(); err == nil {
+		status["file"] = path
+		if info, err := os.Stat(path); err == nil {
+			status["file_bytes"] = info.Size()
+		}
+	}
+	if stats != nil {
+		status["sync"] = stats
+	}
+	return status, nil
+}
+
+// RunGmailIndexCommand runs the index subcommand of the command line:
+// status, sync or rebuild, printing progress and then the status.
+func RunGmailIndexCommand(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: index status|sync|rebuild")
+	}
+
+	reported := false
+	request := util.NewRequest(ctx, func(done, total int, message string) {
+		reported = true
+		if total > 0 {
+			fmt.Fprintf(os.Stderr, "\r%s: %d/%d", message, done, total)
+		} else {
+			fmt.Fprintf(os.Stderr, "\r%s", message)
+		}
+	})
+
+	status, err := runGmailIndexAction(request, args[0])
+	if reported {
+		fmt.Fprintln(os.Stderr)
+	}
+	if err != nil {
+		return err
+	}
+
+	out, err := yaml.Marshal(status)
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(out))
+	return nil
+}
@@ -0,0 +1,154 @@
+package tools
+
+import (
+	"encoding/base64"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nguyenvanduocit/google-kit/mailindex"
+	"github.com/nguyenvanduocit/google-kit/util"
+	"google.golang.org/api/gmail/v1"
+)
+
+func TestGmailLocalSearchSyncInterval(t *testing.T) {
+	t.Setenv("GMAIL_LOCAL_INDEX", "true")
+	t.Setenv("STATE_DIR", t.TempDir())
+	t.Cleanup(func() { gmailIndex = nil })
+
+	gmailIndex = mailindex.New(gmailIndexOptions())
+	gmailIndex.SetAccount("me@example.com")
+	gmailIndex.Put(&mailindex.Document{ID: "1", Subject: "Hello", Date: time.Now(), Body: "hello world"})
+	gmailIndex.SetCursor(5)
+
+	var syncs atomic.Int64
+	fakeGoogle(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch strings.TrimPrefix(r.URL.Path, "/gmail/v1/users/me/") {
+		case "profile":
+			syncs.Add(1)
+			writeJSON(w, map[string]interface{}{"emailAddress": "me@example.com", "historyId": "5"})
+		case "history":
+			writeJSON(w, map[string]interface{}{"historyId": "5"})
+		case "labels":
+			writeJSON(w, map[string]interface{}{"labels": []interface{}{}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	search := func(arguments map[string]interface{}) {
+		t.Helper()
+		arguments["query"] = "hello"
+		result, err := gmailLocalSearchHandler(arguments)
+		if decoded := resultYAML(t, result, err); decoded["total"] != 1 {
+			t.Fatalf("total = %v, want 1", decoded["total"])
+		}
+	}
+
+	// Synced just now: no sync within the interval, unless asked for.
+	search(map[string]interface{}{})
+	if got := syncs.Load(); got != 0 {
+		t.Fatalf("synced %d times within the interval, want 0", got)
+	}
+	search(map[string]interface{}{"sync": true})
+	if got := syncs.Load(); got != 1 {
+		t.Fatalf("synced %d times with sync: true, want 1", got)
+	}
+
+	// Past the interval a search syncs by itself, unless told not to.
+	t.Setenv("GMAIL_INDEX_SYNC_INTERVAL", "1ns")
+	search(map[string]interface{}{"sync": false})
+	if got := syncs.Load(); got != 1 {
+		t.Fatalf("synced %d times with sync: false, want 1", got)
+	}
+	search(map[string]interface{}{})
+	if got := syncs.Load(); got != 2 {
+		t.Fatalf("synced %d times past the interval, want 2", got)
+	}
+}
+
+func TestApplyGmailIndexChanges(t *testing.T) {
+	// The messages the fake mailbox has, with their labels now.
+	mailbox := map[string][]string{
+		"9":  {"INBOX"},
+		"10": {"INBOX", "UNREAD"},
+		"11": {"SPAM"},
+	}
+	var fetched atomic.Int64
+	fakeGoogle(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/gmail/v1/users/me/messages/")
+		labels, ok := mailbox[id]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fetched.Add(1)
+		writeJSON(w, gmail.Message{Id: id, LabelIds: labels, InternalDate: time.Now().UnixMilli(), Payload: &gmail.MessagePart{
+			MimeType: "text/plain",
+			Headers:  []*gmail.MessagePartHeader{{Name: "Subject", Value: "Message " + id}},
+			Body:     &gmail.MessagePartBody{Data: base64.URLEncoding.EncodeToString([]byte("body of message " + id))},
+		}})
+	}))
+
+	ix := mailindex.New(mailindex.Options{})
+	for _, id := range []string{"1", "2", "3", "4", "5"} {
+		ix.Put(&mailindex.Document{ID: id, Date: time.Now(), Labels: []string{"INBOX"}, Body: "indexed " + id})
+	}
+
+	// 11 arrived in spam, and 12 was deleted before it could be fetched.
+	changes := &gmailHistoryChanges{
+		Added:   []string{"10", "11", "12"},
+		Deleted: []string{"1", "99"},
+		LabelsAdded: map[string][]string{
+			"2": {"STARRED", "INBOX"},
+			"4": {"TRASH"},
+			// Not indexed: nothing to do.
+			"8": {"Label_1"},
+		},
+		LabelsRemoved: map[string][]string{
+			"3": {"INBOX"},
+			// Restored from spam: fetched and indexed.
+			"9": {"SPAM"},
+		},
+		More: true,
+	}
+	var stats gmailIndexSync
+	applyGmailIndexChanges(util.RequestFromArguments(nil), ix, changes, &stats)
+
+	want := gmailIndexSync{Added: 2, Removed: 2, Updated: 2, More: true}
+	if stats != want {
+		t.Errorf("stats = %+v, want %+v", stats, want)
+	}
+	if got := fetched.Load(); got != 3 {
+		t.Errorf("fetched %d messages, want 3", got)
+	}
+
+	labels := map[string][]string{
+		"2":  {"INBOX", "STARRED"},
+		"3":  {},
+		"5":  {"INBOX"},
+		"9":  {"INBOX"},
+		"10": {"INBOX", "UNREAD"},
+	}
+	for _, id := range []string{"1", "4", "11", "12", "8"} {
+		if ix.Has(id) {
+			t.Errorf("message %s is indexed", id)
+		}
+	}
+	for id, want := range labels {
+		got, ok := ix.Labels(id)
+		if !ok {
+			t.Errorf("message %s is not indexed", id)
+			continue
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("labels of %s = %v, want %v", id, got, want)
+		}
+	}
+	if hits := ix.Search("body message 10", mailindex.SearchOptions{}).Hits; len(hits) != 1 {
+		t.Errorf("the new message is not searchable: %d hits", len(hits))
+	}
+}
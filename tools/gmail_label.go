@@ -0,0 +1,547 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/nguyenvanduocit/google-kit/util"
+	"google.golang.org/api/gmail/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// gmailLabels indexes the labels of the mailbox by ID and by name. Label
+// names are case-insensitive in Gmail, and "/" in a name nests the label
+// under the label named by the part before it.
+type gmailLabels struct {
+	labels []*gmail.Label
+	byID   map[string]*gmail.Label
+	byName map[string]*gmail.Label
+}
+
+func listGmailLabels(ctx context.Context) (*gmailLabels, error) {
+	resp, err := gmailService().Users.Labels.List("me").Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list labels: %v", err)
+	}
+
+	index := &gmailLabels{
+		byID:   make(map[string]*gmail.Label, len(resp.Labels)),
+		byName: make(map[string]*gmail.Label, len(resp.Labels)),
+	}
+	for _, label := range resp.Labels {
+		index.add(label)
+	}
+	return index, nil
+}
+
+func (l *gmailLabels) add(label *gmail.Label) {
+	if old, ok := l.byID[label.Id]; ok {
+		delete(l.byName, strings.ToLower(old.Name))
+		*old = *label
+		label = old
+	} else {
+		l.labels = append(l.labels, label)
+	}
+	l.byID[label.Id] = label
+	l.byName[strings.ToLower(label.Name)] = label
+}
+
+// find returns the label with the given ID or name, or nil.
+func (l *gmailLabels) find(nameOrID string) *gmail.Label {
+	if label, ok := l.byID[nameOrID]; ok {
+		return label
+	}
+	return l.byName[strings.ToLower(nameOrID)]
+}
+
+// descendants returns the labels nested under label, at any depth.
+func (l *gmailLabels) descendants(label *gmail.Label) []*gmail.Label {
+	prefix := strings.ToLower(label.Name) + "/"
+	var result []*gmail.Label
+	for _, other := range l.labels {
+		if strings.HasPrefix(strings.ToLower(other.Name), prefix) {
+			result = append(result, other)
+		}
+	}
+	return result
+}
+
+// createOrGet returns the label with the given name, creating it if it
+// does not exist yet. Missing parents are created too, so that nested
+// labels show up under them.
+func (l *gmailLabels) createOrGet(ctx context.Context, name string) (*gmail.Label, error) {
+	return l.create(ctx, &gmail.Label{
+		Name:                  name,
+		MessageListVisibility: "show",
+		LabelListVisibility:   "labelShow",
+	}, true)
+}
+
+func (l *gmailLabels) create(ctx context.Context, label *gmail.Label, existingOK bool) (*gmail.Label, error) {
+	if existing := l.byName[strings.ToLower(label.Name)]; existing != nil {
+		if existingOK {
+			return existing, nil
+		}
+		return nil, fmt.Errorf("label %q already exists", existing.Name)
+	}
+
+	if i := strings.LastIndex(label.Name, "/"); i > 0 {
+		if _, err := l.createOrGet(ctx, label.Name[:i]); err != nil {
+			return nil, err
+		}
+	}
+
+	created, err := gmailService().Users.Labels.Create("me", label).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create label %s: %v", label.Name, err)
+	}
+	l.add(created)
+	return created, nil
+}
+
+// resolveGmailLabels turns label names or IDs into label IDs. Names are
+// matched case-insensitively, as Gmail does; system labels can be given as
+// their IDs, e.g. INBOX or STARRED.
+func resolveGmailLabels(ctx context.Context, names []string) ([]string, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	labels, err := listGmailLabels(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(names))
+	for _, name := range names {
+		label := labels.find(name)
+		if label == nil {
+			return nil, fmt.Errorf("label %q not found", name)
+		}
+		ids = append(ids, label.Id)
+	}
+
+	return ids, nil
+}
+
+func gmailLabelHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	action, _ := arguments["action"].(string)
+
+	switch action {
+	case "list":
+		return gmailListLabelsHandler(arguments)
+	case "create":
+		return gmailCreateLabelHandler(arguments)
+	case "update":
+		return gmailUpdateLabelHandler(arguments)
+	case "delete":
+		return gmailDeleteLabelHandler(arguments)
+	case "merge":
+		return gmailMergeLabelHandler(arguments)
+	default:
+		return mcp.NewToolResultError("Invalid action. Must be one of: list, create, update, delete, merge"), nil
+	}
+}
+
+func gmailListLabelsHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	ctx := util.RequestFromArguments(arguments).Context()
+
+	labels, err := listGmailLabels(ctx)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	// System labels come first. User labels are sorted by name so that a
+	// label directly follows its parent and a page splits the tree as
+	// little as possible.
+	sorted := append([]*gmail.Label(nil), labels.labels...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if (sorted[i].Type == "system") != (sorted[j].Type == "system") {
+			return sorted[i].Type == "system"
+		}
+		return labelSortKey(sorted[i].Name) < labelSortKey(sorted[j].Name)
+	})
+
+	// The labels API has no paging of its own.
+	pageLabels, nextPageToken, err := util.PaginateSlice(util.PageFromArguments(arguments, 100, 1000), sorted)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	// Message counts are only returned by labels.get.
+	detailed := make([]*gmail.Label, len(pageLabels))
+	errs := gmailParallel(ctx, len(pageLabels), nil, func(i int) error {
+		var err error
+		detailed[i], err = gmailService().Users.Labels.Get("me", pageLabels[i].Id).Context(ctx).Do()
+		return err
+	})
+	for i, err := range errs {
+		if err != nil {
+			detailed[i] = pageLabels[i]
+		}
+	}
+
+	systemLabels := make([]map[string]interface{}, 0)
+	userLabels := make([]map[string]interface{}, 0)
+	nodes := make(map[string]map[string]interface{})
+
+	for _, label := range detailed {
+		labelInfo := map[string]interface{}{
+			"id":   label.Id,
+			"name": label.Name,
+		}
+		if label.MessagesTotal > 0 {
+			labelInfo["messagesTotal"] = label.MessagesTotal
+		}
+		if label.MessagesUnread > 0 {
+			labelInfo["messagesUnread"] = label.MessagesUnread
+		}
+		if label.Color != nil {
+			labelInfo["color"] = map[string]string{
+				"background": label.Color.BackgroundColor,
+				"text":       label.Color.TextColor,
+			}
+		}
+		if label.LabelListVisibility != "" && label.LabelListVisibility != "labelShow" {
+			labelInfo["labelListVisibility"] = label.LabelListVisibility
+		}
+		if label.MessageListVisibility == "hide" {
+			labelInfo["messageListVisibility"] = label.MessageListVisibility
+		}
+
+		if label.Type == "system" {
+			systemLabels = append(systemLabels, labelInfo)
+			continue
+		}
+
+		// Nest the label under the closest ancestor on this page.
+		key := strings.ToLower(label.Name)
+		nodes[key] = labelInfo
+		var parent map[string]interface{}
+		for i := strings.LastIndex(key, "/"); i > 0 && parent == nil; i = strings.LastIndex(key[:i], "/") {
+			parent = nodes[key[:i]]
+		}
+		if parent == nil {
+			userLabels = append(userLabels, labelInfo)
+			continue
+		}
+		children, _ := parent["children"].([]map[string]interface{})
+		parent["children"] = append(children, labelInfo)
+	}
+
+	result := map[string]interface{}{
+		"count":           len(pageLabels),
+		"total":           len(labels.labels),
+		"systemLabels":    systemLabels,
+		"userLabels":      userLabels,
+		"next_page_token": nextPageToken,
+	}
+
+	yamlResult, err := yaml.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to marshal labels: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(yamlResult)), nil
+}
+
+// labelSortKey orders label names case-insensitively with nested labels
+// right after their parent.
+func labelSortKey(name string) string {
+	return strings.ReplaceAll(strings.ToLower(name), "/", "\x00")
+}
+
+// labelName returns the full name given by the name and parent arguments.
+// current is the label's present name, used when only parent is given.
+func labelName(arguments map[string]interface{}, current string) string {
+	name, _ := arguments["name"].(string)
+	parent, _ := arguments["parent"].(string)
+	name = strings.Trim(strings.TrimSpace(name), "/")
+	parent = strings.Trim(strings.TrimSpace(parent), "/")
+
+	if parent == "" {
+		return name
+	}
+	if name == "" {
+		name = current[strings.LastIndex(current, "/")+1:]
+	}
+	return parent + "/" + name
+}
+
+// applyLabelSettings sets the color and visibility arguments on label.
+func applyLabelSettings(label *gmail.Label, arguments map[string]interface{}) error {
+	background, _ := arguments["background_color"].(string)
+	text, _ := arguments["text_color"].(string)
+	if background != "" || text != "" {
+		if background == "" || text == "" {
+			return fmt.Errorf("background_color and text_color must be given together")
+		}
+		label.Color = &gmail.LabelColor{BackgroundColor: background, TextColor: text}
+	}
+
+	if visibility, ok := arguments["label_list_visibility"].(string); ok && visibility != "" {
+		switch visibility {
+		case "labelShow", "labelShowIfUnread", "labelHide":
+		default:
+			return fmt.Errorf("label_list_visibility must be one of: labelShow, labelShowIfUnread, labelHide")
+		}
+		label.LabelListVisibility = visibility
+	}
+
+	if visibility, ok := arguments["message_list_visibility"].(string); ok && visibility != "" {
+		switch visibility {
+		case "show", "hide":
+		default:
+			return fmt.Errorf("message_list_visibility must be one of: show, hide")
+		}
+		label.MessageListVisibility = visibility
+	}
+
+	return nil
+}
+
+func gmailCreateLabelHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	ctx := util.RequestFromArguments(arguments).Context()
+
+	name := labelName(arguments, "")
+	if name == "" {
+		return mcp.NewToolResultError("name is required for create action"), nil
+	}
+
+	label := &gmail.Label{
+		Name:                  name,
+		MessageListVisibility: "show",
+		LabelListVisibility:   "labelShow",
+	}
+	if err := applyLabelSettings(label, arguments); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	labels, err := listGmailLabels(ctx)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	created, err := labels.create(ctx, label, false)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("Successfully created label %s with ID: %s", created.Name, created.Id)), nil
+}
+
+func gmailUpdateLabelHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	ctx := util.RequestFromArguments(arguments).Context()
+
+	labelID, _ := arguments["label_id"].(string)
+	if labelID == "" {
+		return mcp.NewToolResultError("label_id is required for update action"), nil
+	}
+
+	labels, err := listGmailLabels(ctx)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	label := labels.find(labelID)
+	if label == nil {
+		return mcp.NewToolResultError(fmt.Sprintf("label %q not found", labelID)), nil
+	}
+	if label.Type == "system" {
+		return mcp.NewToolResultError(fmt.Sprintf("system label %s cannot be changed", label.Id)), nil
+	}
+
+	patch := &gmail.Label{}
+	if err := applyLabelSettings(patch, arguments); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	oldName := label.Name
+	newName := labelName(arguments, oldName)
+	renamed := newName != "" && newName != oldName
+	if renamed {
+		if existing := labels.byName[strings.ToLower(newName)]; existing != nil && existing.Id != label.Id {
+			return mcp.NewToolResultError(fmt.Sprintf("label %q already exists", existing.Name)), nil
+		}
+		if strings.HasPrefix(strings.ToLower(newName)+"/", strings.ToLower(oldName)+"/") && !strings.EqualFold(newName, oldName) {
+			return mcp.NewToolResultError("a label cannot be moved under itself"), nil
+		}
+		patch.Name = newName
+
+		// Make sure the new parent exists so the label is shown nested.
+		if i := strings.LastIndex(newName, "/"); i > 0 {
+			if _, err := labels.createOrGet(ctx, newName[:i]); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+		}
+	}
+
+	children := labels.descendants(label)
+
+	updated, err := gmailService().Users.Labels.Patch("me", label.Id, patch).Context(ctx).Do()
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to update label: %v", err)), nil
+	}
+
+	message := fmt.Sprintf("Successfully updated label %s", updated.Name)
+
+	// Gmail stores nesting in the names only, so nested labels have to be
+	// renamed along with their parent.
+	if renamed && len(children) > 0 {
+		var failed []string
+		for _, child := range children {
+			childName := updated.Name + child.Name[len(oldName):]
+			if _, err := gmailService().Users.Labels.Patch("me", child.Id, &gmail.Label{Name: childName}).Context(ctx).Do(); err != nil {
+				failed = append(failed, fmt.Sprintf("%s: %v", child.Name, err))
+			}
+		}
+		message += fmt.Sprintf(" and %d nested labels", len(children)-len(failed))
+		if len(failed) > 0 {
+			message += fmt.Sprintf("; failed to rename: %s", strings.Join(failed, "; "))
+		}
+	}
+
+	return mcp.NewToolResultText(message), nil
+}
+
+func gmailDeleteLabelHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	ctx := util.RequestFromArguments(arguments).Context()
+
+	labelID, ok := arguments["label_id"].(string)
+	if !ok {
+		return mcp.NewToolResultError("label_id must be a string"), nil
+	}
+
+	if labelID == "" {
+		return mcp.NewToolResultError("label_id cannot be empty"), nil
+	}
+
+	labels, err := listGmailLabels(ctx)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	label := labels.find(labelID)
+	if label == nil {
+		return mcp.NewToolResultError(fmt.Sprintf("label %q not found", labelID)), nil
+	}
+
+	err = gmailService().Users.Labels.Delete("me", label.Id).Context(ctx).Do()
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to delete label: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("Successfully deleted label %s with ID: %s", label.Name, label.Id)), nil
+}
+
+func gmailMergeLabelHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	request := util.RequestFromArguments(arguments)
+	ctx := request.Context()
+
+	sourceID, _ := arguments["label_id"].(string)
+	targetID, _ := arguments["target_label"].(string)
+	if sourceID == "" || targetID == "" {
+		return mcp.NewToolResultError("label_id and target_label are required for merge action"), nil
+	}
+
+	labels, err := listGmailLabels(ctx)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	source, target := labels.find(sourceID), labels.find(targetID)
+	switch {
+	case source == nil:
+		return mcp.NewToolResultError(fmt.Sprintf("label %q not found", sourceID)), nil
+	case target == nil:
+		return mcp.NewToolResultError(fmt.Sprintf("label %q not found", targetID)), nil
+	case source.Type == "system":
+		return mcp.NewToolResultError(fmt.Sprintf("system label %s cannot be merged", source.Id)), nil
+	case source.Id == target.Id:
+		return mcp.NewToolResultError("a label cannot be merged into itself"), nil
+	case strings.HasPrefix(strings.ToLower(target.Name), strings.ToLower(source.Name)+"/"):
+		return mcp.NewToolResultError("a label cannot be merged into one of its nested labels"), nil
+	}
+
+	// Gmail stores nesting in the names only, so the labels nested under
+	// the source move under the target; deleting the source would leave
+	// them without a parent. A nested label the target already has would
+	// need merging too, so that is refused before anything changes.
+	children := labels.descendants(source)
+	childNames := make([]string, len(children))
+	var conflicts []string
+	for i, child := range children {
+		childNames[i] = target.Name + child.Name[len(source.Name):]
+		if labels.find(childNames[i]) != nil {
+			conflicts = append(conflicts, childNames[i])
+		}
+	}
+	if len(conflicts) > 0 {
+		return mcp.NewToolResultError(fmt.Sprintf("%s already has nested labels named like those of %s: %s; merge them first", target.Name, source.Name, strings.Join(conflicts, ", "))), nil
+	}
+
+	var renameFailed []string
+	for i, child := range children {
+		if _, err := gmailService().Users.Labels.Patch("me", child.Id, &gmail.Label{Name: childNames[i]}).Context(ctx).Do(); err != nil {
+			renameFailed = append(renameFailed, fmt.Sprintf("%s: %v", child.Name, err))
+		}
+	}
+
+	var ids []string
+	err = gmailService().Users.Messages.List("me").
+		LabelIds(source.Id).
+		IncludeSpamTrash(true).
+		Context(ctx).
+		Pages(ctx, func(resp *gmail.ListMessagesResponse) error {
+			for _, message := range resp.Messages {
+				ids = append(ids, message.Id)
+			}
+			return nil
+		})
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to list messages of %s: %v", source.Name, err)), nil
+	}
+
+	modified, failed := gmailBatchModify(request, ids, []string{target.Id}, []string{source.Id})
+	request.Progress(len(ids), len(ids), "Done")
+
+	result := map[string]interface{}{
+		"source":    source.Name,
+		"target":    target.Name,
+		"matched":   len(ids),
+		"relabeled": len(modified),
+	}
+	if len(children) > 0 {
+		result["moved_labels"] = len(children) - len(renameFailed)
+	}
+	if len(renameFailed) > 0 {
+		result["failed_labels"] = renameFailed
+	}
+	if len(failed) > 0 {
+		result["failed"] = failed
+	}
+
+	// The source label is only deleted once every message and nested
+	// label has moved, so that nothing loses its label or its parent.
+	switch {
+	case request.Cancelled():
+		result["partial"] = true
+	case len(failed) > 0 || len(renameFailed) > 0:
+		result["deleted"] = false
+	default:
+		if err := gmailService().Users.Labels.Delete("me", source.Id).Context(ctx).Do(); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("relabeled %d messages but failed to delete label %s: %v", len(modified), source.Name, err)), nil
+		}
+		result["deleted"] = true
+	}
+
+	yamlResult, err := yaml.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(yamlResult)), nil
+}
@@ -0,0 +1,118 @@
+package tools
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeLabels serves a mailbox with the given labels, one message on each,
+// and records label renames and deletions.
+func fakeLabels(t *testing.T, labels map[string]string) (renamed map[string]string, deleted *[]string) {
+	var mu sync.Mutex
+	renamed = make(map[string]string)
+	deleted = new([]string)
+
+	fakeGoogle(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		path := strings.TrimPrefix(r.URL.Path, "/gmail/v1/users/me/")
+		switch {
+		case path == "labels":
+			list := make([]map[string]string, 0, len(labels))
+			for id, name := range labels {
+				list = append(list, map[string]string{"id": id, "name": name, "type": "user"})
+			}
+			writeJSON(w, map[string]interface{}{"labels": list})
+		case strings.HasPrefix(path, "labels/") && r.Method == http.MethodPatch:
+			var label map[string]string
+			json.NewDecoder(r.Body).Decode(&label)
+			id := strings.TrimPrefix(path, "labels/")
+			renamed[id] = label["name"]
+			writeJSON(w, map[string]string{"id": id, "name": label["name"]})
+		case strings.HasPrefix(path, "labels/") && r.Method == http.MethodDelete:
+			*deleted = append(*deleted, strings.TrimPrefix(path, "labels/"))
+			w.WriteHeader(http.StatusNoContent)
+		case path == "messages":
+			id := r.URL.Query().Get("labelIds")
+			writeJSON(w, map[string]interface{}{"messages": []map[string]string{{"id": "m-" + id}}})
+		case path == "messages/batchModify":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	return renamed, deleted
+}
+
+func TestGmailMergeLabelMovesNestedLabels(t *testing.T) {
+	renamed, deleted := fakeLabels(t, map[string]string{
+		"Label_1": "Clients",
+		"Label_2": "Clients/Acme",
+		"Label_3": "Clients/Acme/2024",
+		"Label_4": "Customers",
+		"Label_5": "Clientsx",
+	})
+
+	result, err := gmailMergeLabelHandler(map[string]interface{}{"label_id": "Clients", "target_label": "Customers"})
+	decoded := resultYAML(t, result, err)
+
+	want := map[string]string{"Label_2": "Customers/Acme", "Label_3": "Customers/Acme/2024"}
+	if len(renamed) != len(want) {
+		t.Errorf("renamed = %v, want %v", renamed, want)
+	}
+	for id, name := range want {
+		if renamed[id] != name {
+			t.Errorf("%s renamed to %q, want %q", id, renamed[id], name)
+		}
+	}
+	if decoded["moved_labels"] != 2 || decoded["deleted"] != true {
+		t.Errorf("result = %v, want 2 moved labels and the source deleted", decoded)
+	}
+	if len(*deleted) != 1 || (*deleted)[0] != "Label_1" {
+		t.Errorf("deleted = %v, want Label_1", *deleted)
+	}
+}
+
+func TestGmailMergeLabelRefused(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels map[string]string
+		source string
+		target string
+		want   string
+	}{
+		{
+			name:   "target has a nested label of the same name",
+			labels: map[string]string{"Label_1": "Clients", "Label_2": "Clients/Acme", "Label_3": "Customers", "Label_4": "Customers/acme"},
+			source: "Clients",
+			target: "Customers",
+			want:   "Customers/Acme",
+		},
+		{
+			name:   "target is nested under the source",
+			labels: map[string]string{"Label_1": "Clients", "Label_2": "Clients/Acme"},
+			source: "Clients",
+			target: "Clients/Acme",
+			want:   "nested labels",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			renamed, deleted := fakeLabels(t, tt.labels)
+
+			result, err := gmailMergeLabelHandler(map[string]interface{}{"label_id": tt.source, "target_label": tt.target})
+			text := resultText(t, result, err)
+			if !result.IsError || !strings.Contains(text, tt.want) {
+				t.Errorf("result = %q, want an error mentioning %q", text, tt.want)
+			}
+			if len(renamed) > 0 || len(*deleted) > 0 {
+				t.Errorf("renamed %v and deleted %v, want nothing changed", renamed, *deleted)
+			}
+		})
+	}
+}
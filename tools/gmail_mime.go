@@ -0,0 +1,74 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"net/textproto"
+
+	"github.com/nguyenvanduocit/google-kit/email"
+	"google.golang.org/api/gmail/v1"
+)
+
+// gmailPart converts a payload fetched in full format to an email.Part tree.
+// Gmail has already removed the transfer encoding of inline bodies; bodies
+// stored as attachments are only referenced by AttachmentID.
+func gmailPart(payload *gmail.MessagePart) *email.Part {
+	header := textproto.MIMEHeader{}
+	for _, h := range payload.Headers {
+		header.Add(h.Name, h.Value)
+	}
+	if header.Get("Content-Type") == "" && payload.MimeType != "" {
+		header.Set("Content-Type", payload.MimeType)
+	}
+
+	part := email.NewPart(header)
+	part.PartID = payload.PartId
+	if payload.Filename != "" {
+		part.Filename = email.DecodeHeader(payload.Filename)
+	}
+
+	if payload.Body != nil {
+		part.AttachmentID = payload.Body.AttachmentId
+		part.Size = payload.Body.Size
+		if payload.Body.Data != "" {
+			if data, err := email.DecodeBase64(payload.Body.Data); err == nil {
+				part.Body = data
+			}
+		}
+	}
+
+	for _, child := range payload.Parts {
+		part.Parts = append(part.Parts, gmailPart(child))
+	}
+
+	return part
+}
+
+// gmailContent returns the body and attachments of a message fetched in
+// full format.
+func gmailContent(message *gmail.Message) *email.Content {
+	if message.Payload == nil {
+		return &email.Content{}
+	}
+	return gmailPart(message.Payload).Content()
+}
+
+// gmailAttachmentData returns the body of part, downloading it when Gmail
+// stores it as an attachment of messageID.
+func gmailAttachmentData(ctx context.Context, messageID string, part *email.Part) ([]byte, error) {
+	if part.AttachmentID == "" {
+		return part.Body, nil
+	}
+
+	attachment, err := gmailService().Users.Messages.Attachments.Get("me", messageID, part.AttachmentID).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attachment %s: %v", part.Filename, err)
+	}
+
+	data, err := email.DecodeBase64(attachment.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode attachment %s: %v", part.Filename, err)
+	}
+
+	return data, nil
+}
@@ -0,0 +1,299 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/nguyenvanduocit/google-kit/util"
+	"google.golang.org/api/gmail/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// gmailBatchModifyLimit is the maximum number of IDs messages.batchModify
+// accepts per call.
+const gmailBatchModifyLimit = 1000
+
+// gmailModifyOperations maps the gmail_modify operations done with label
+// changes to the labels they add and remove. trash and untrash have their
+// own API calls and are handled separately.
+var gmailModifyOperations = map[string]struct{ add, remove []string }{
+	"archive":   {remove: []string{"INBOX"}},
+	"unarchive": {add: []string{"INBOX"}},
+	"read":      {remove: []string{"UNREAD"}},
+	"unread":    {add: []string{"UNREAD"}},
+	"star":      {add: []string{"STARRED"}},
+	"unstar":    {remove: []string{"STARRED"}},
+	"not_spam":  {add: []string{"INBOX"}, remove: []string{"SPAM"}},
+	"trash":     {},
+	"untrash":   {},
+}
+
+func gmailModifyHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	request := util.RequestFromArguments(arguments)
+	ctx := request.Context()
+
+	operations := make(map[string]bool)
+	for _, operation := range util.StringsFromArguments(arguments, "operations") {
+		operation = strings.ReplaceAll(strings.ToLower(operation), "-", "_")
+		if _, ok := gmailModifyOperations[operation]; !ok {
+			return mcp.NewToolResultError(fmt.Sprintf("unknown operation %q, must be one of: archive, unarchive, read, unread, star, unstar, trash, untrash, not_spam", operation)), nil
+		}
+		operations[operation] = true
+	}
+	if operations["trash"] && operations["untrash"] {
+		return mcp.NewToolResultError("trash and untrash cannot be combined"), nil
+	}
+
+	addIDs, err := resolveGmailLabels(ctx, util.StringsFromArguments(arguments, "add_labels"))
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	removeIDs, err := resolveGmailLabels(ctx, util.StringsFromArguments(arguments, "remove_labels"))
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	for operation := range operations {
+		addIDs = append(addIDs, gmailModifyOperations[operation].add...)
+		removeIDs = append(removeIDs, gmailModifyOperations[operation].remove...)
+	}
+	addIDs, removeIDs = dedupeStrings(addIDs), dedupeStrings(removeIDs)
+	for _, id := range addIDs {
+		for _, other := range removeIDs {
+			if id == other {
+				return mcp.NewToolResultError(fmt.Sprintf("label %s is both added and removed", id)), nil
+			}
+		}
+	}
+
+	if len(addIDs) == 0 && len(removeIDs) == 0 && !operations["trash"] && !operations["untrash"] {
+		return mcp.NewToolResultError("at least one of operations, add_labels or remove_labels is required"), nil
+	}
+
+	// Messages in spam and trash are only listed when the caller wants to
+	// take them out again.
+	includeSpamTrash := operations["untrash"] || operations["not_spam"]
+
+	ids, failed, truncated, err := gmailModifyTargets(ctx, arguments, includeSpamTrash)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	if dryRun, _ := arguments["dry_run"].(bool); dryRun {
+		yamlResult, err := yaml.Marshal(map[string]interface{}{
+			"matched":     len(ids),
+			"truncated":   truncated,
+			"message_ids": ids,
+			"failed":      failed,
+		})
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %v", err)), nil
+		}
+		return mcp.NewToolResultText(string(yamlResult)), nil
+	}
+
+	// pending holds the messages every step so far succeeded for; a
+	// message is only counted as modified once all steps are done.
+	pending := ids
+	total := len(ids)
+	if len(addIDs) > 0 || len(removeIDs) > 0 {
+		var batchFailed []map[string]string
+		pending, batchFailed = gmailBatchModify(request, pending, addIDs, removeIDs)
+		failed = append(failed, batchFailed...)
+	}
+
+	if operations["trash"] || operations["untrash"] {
+		var trashFailed []map[string]string
+		pending, trashFailed = gmailTrashMessages(request, pending, operations["untrash"])
+		failed = append(failed, trashFailed...)
+	}
+
+	request.Progress(total, total, "Done")
+
+	result := map[string]interface{}{
+		"matched":  len(ids),
+		"modified": len(pending),
+	}
+	if truncated {
+		result["truncated"] = true
+	}
+	if len(failed) > 0 {
+		result["failed"] = failed
+	}
+	if request.Cancelled() {
+		result["partial"] = true
+	}
+
+	yamlResult, err := yaml.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(yamlResult)), nil
+}
+
+// gmailBatchModify adds and removes labels on messages with batchModify
+// calls of up to gmailBatchModifyLimit IDs, stopping early when the request
+// is cancelled. It returns the messages that were modified and the ones
+// that failed, with their error.
+func gmailBatchModify(request *util.Request, ids, addIDs, removeIDs []string) ([]string, []map[string]string) {
+	ctx := request.Context()
+	modified := make([]string, 0, len(ids))
+	var failed []map[string]string
+
+	for start := 0; start < len(ids) && !request.Cancelled(); start += gmailBatchModifyLimit {
+		chunk := ids[start:min(start+gmailBatchModifyLimit, len(ids))]
+		request.Progress(start, len(ids), "Modifying messages")
+
+		err := gmailService().Users.Messages.BatchModify("me", &gmail.BatchModifyMessagesRequest{
+			Ids:            chunk,
+			AddLabelIds:    addIDs,
+			RemoveLabelIds: removeIDs,
+		}).Context(ctx).Do()
+		if err == nil {
+			modified = append(modified, chunk...)
+			continue
+		}
+
+		// batchModify fails as a whole; retry one by one to find out
+		// which messages are at fault.
+		errs := gmailParallel(ctx, len(chunk), nil, func(i int) error {
+			_, err := gmailService().Users.Messages.Modify("me", chunk[i], &gmail.ModifyMessageRequest{
+				AddLabelIds:    addIDs,
+				RemoveLabelIds: removeIDs,
+			}).Context(ctx).Do()
+			return err
+		})
+		for i, err := range errs {
+			if err != nil {
+				failed = append(failed, map[string]string{"id": chunk[i], "error": err.Error()})
+			}
+		}
+		modified = append(modified, keepSucceeded(chunk, errs)...)
+	}
+
+	return modified, failed
+}
+
+// gmailTrashMessages moves messages to the trash, or out of it with
+// untrash. It returns the messages that were moved and the ones that
+// failed; messages skipped because the request was cancelled are in
+// neither.
+func gmailTrashMessages(request *util.Request, ids []string, untrash bool) ([]string, []map[string]string) {
+	ctx := request.Context()
+
+	errs := gmailParallel(ctx, len(ids), func(done int) {
+		request.Progress(done, len(ids), "Moving messages")
+	}, func(i int) error {
+		var err error
+		if untrash {
+			_, err = gmailService().Users.Messages.Untrash("me", ids[i]).Context(ctx).Do()
+		} else {
+			_, err = gmailService().Users.Messages.Trash("me", ids[i]).Context(ctx).Do()
+		}
+		return err
+	})
+
+	moved := make([]string, 0, len(ids))
+	var failed []map[string]string
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			moved = append(moved, ids[i])
+		case err != ctx.Err():
+			failed = append(failed, map[string]string{"id": ids[i], "error": err.Error()})
+		}
+	}
+	return moved, failed
+}
+
+// keepSucceeded returns the ids whose error is nil.
+func keepSucceeded(ids []string, errs []error) []string {
+	succeeded := make([]string, 0, len(ids))
+	for i, id := range ids {
+		if errs[i] == nil {
+			succeeded = append(succeeded, id)
+		}
+	}
+	return succeeded
+}
+
+// gmailModifyTargets collects the message IDs named by the message_ids,
+// thread_ids and query arguments, without duplicates. Threads that cannot
+// be read are returned as failures rather than aborting the whole call.
+// truncated reports that the query matched more than max_messages
+// messages and only the first ones were returned.
+func gmailModifyTargets(ctx context.Context, arguments map[string]interface{}, includeSpamTrash bool) (ids []string, failed []map[string]string, truncated bool, err error) {
+	ids = util.StringsFromArguments(arguments, "message_ids")
+	threadIDs := util.StringsFromArguments(arguments, "thread_ids")
+	query, _ := arguments["query"].(string)
+
+	if len(ids) == 0 && len(threadIDs) == 0 && query == "" {
+		return nil, nil, false, fmt.Errorf("one of message_ids, thread_ids or query is required")
+	}
+
+	threads := make([]*gmail.Thread, len(threadIDs))
+	errs := gmailParallel(ctx, len(threadIDs), nil, func(i int) error {
+		var err error
+		threads[i], err = gmailService().Users.Threads.Get("me", threadIDs[i]).
+			Format("minimal").
+			Fields("messages/id").
+			Context(ctx).
+			Do()
+		return err
+	})
+	for i, thread := range threads {
+		if errs[i] != nil {
+			failed = append(failed, map[string]string{"id": threadIDs[i], "error": fmt.Sprintf("failed to get thread: %v", errs[i])})
+			continue
+		}
+		for _, message := range thread.Messages {
+			ids = append(ids, message.Id)
+		}
+	}
+
+	if query != "" {
+		limit := int64(util.MaxFetchAllItems)
+		if value, ok := arguments["max_messages"].(float64); ok && value > 0 {
+			limit = min(int64(value), 10*util.MaxFetchAllItems)
+		}
+
+		matched := int64(0)
+		call := gmailService().Users.Messages.List("me").Q(query).IncludeSpamTrash(includeSpamTrash).Context(ctx)
+		err := call.Pages(ctx, func(resp *gmail.ListMessagesResponse) error {
+			for _, message := range resp.Messages {
+				if matched >= limit {
+					truncated = true
+					return errStopPaging
+				}
+				matched++
+				ids = append(ids, message.Id)
+			}
+			return nil
+		})
+		if err != nil && err != errStopPaging {
+			return nil, nil, false, fmt.Errorf("failed to search emails: %v", err)
+		}
+	}
+
+	return dedupeStrings(ids), failed, truncated, nil
+}
+
+// errStopPaging ends a Pages iteration early.
+var errStopPaging = errors.New("stop paging")
+
+// dedupeStrings removes repeated values, keeping the first occurrence.
+func dedupeStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	return result
+}
@@ -0,0 +1,54 @@
+package tools
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestGmailModifyTargetsTruncated(t *testing.T) {
+	const total = 250
+
+	fakeGoogle(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/gmail/v1/users/me/messages" {
+			http.NotFound(w, r)
+			return
+		}
+		start, end, next := fakePage(r, "maxResults", total)
+		messages := make([]map[string]string, 0, end-start)
+		for i := start; i < end; i++ {
+			messages = append(messages, map[string]string{"id": fmt.Sprint(i)})
+		}
+		writeJSON(w, map[string]interface{}{"messages": messages, "nextPageToken": next})
+	}))
+
+	tests := []struct {
+		name          string
+		maxMessages   float64
+		wantMatched   int
+		wantTruncated bool
+	}{
+		{"below the limit", 0, total, false},
+		{"exactly the limit", total, total, false},
+		{"limit within a page", 42, 42, true},
+		{"limit at a page boundary", 100, 100, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			arguments := map[string]interface{}{"query": "in:inbox", "operations": []interface{}{"archive"}, "dry_run": true}
+			if tt.maxMessages > 0 {
+				arguments["max_messages"] = tt.maxMessages
+			}
+			result, err := gmailModifyHandler(arguments)
+			decoded := resultYAML(t, result, err)
+
+			if decoded["matched"] != tt.wantMatched {
+				t.Errorf("matched = %v, want %d", decoded["matched"], tt.wantMatched)
+			}
+			if decoded["truncated"] != tt.wantTruncated {
+				t.Errorf("truncated = %v, want %v", decoded["truncated"], tt.wantTruncated)
+			}
+		})
+	}
+}
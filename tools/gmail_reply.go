@@ -0,0 +1,259 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"net/mail"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/nguyenvanduocit/google-kit/email"
+	"github.com/nguyenvanduocit/google-kit/util"
+)
+
+func gmailReplyEmailHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	ctx := util.RequestFromArguments(arguments).Context()
+
+	messageID, ok := arguments["message_id"].(string)
+	if !ok {
+		return mcp.NewToolResultError("message_id must be a string"), nil
+	}
+
+	replyText, ok := arguments["reply_text"].(string)
+	if !ok {
+		return mcp.NewToolResultError("reply_text must be a string"), nil
+	}
+
+	replyAll, _ := arguments["reply_all"].(bool)
+	quoteOriginal, _ := arguments["quote_original"].(bool)
+
+	target, err := getReplyTarget(ctx, messageID)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	self, err := myAddresses(ctx)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	message := &email.Message{}
+	target.apply(message)
+	message.To, message.Cc = target.replyRecipients(replyAll, self)
+
+	// The reply text is the body; cc and bcc override the computed lists.
+	compose := map[string]interface{}{"body": replyText}
+	for _, name := range []string{"html_body", "cc", "bcc", "from", "append_signature", "attachments", "attachment_blobs"} {
+		if value, ok := arguments[name]; ok {
+			compose[name] = value
+		}
+	}
+	if err := applyComposeArguments(ctx, message, compose); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	if len(message.To)+len(message.Cc)+len(message.Bcc) == 0 {
+		return mcp.NewToolResultError("the reply has no recipients left after removing your own addresses"), nil
+	}
+
+	if quoteOriginal {
+		original, err := gmailService().Users.Messages.Get("me", messageID).Format("full").Context(ctx).Do()
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to get original email: %v", err)), nil
+		}
+		target.quote(message, gmailContent(original))
+	}
+
+	raw, err := message.Bytes()
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to build reply: %v", err)), nil
+	}
+
+	sent, err := sendGmailMessage(ctx, raw, target.ThreadID)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to send reply: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("Reply sent successfully. Message ID: %s, Thread ID: %s", sent.Id, sent.ThreadId)), nil
+}
+
+// gmailReplyTarget holds what a reply needs to know about the message it
+// answers.
+type gmailReplyTarget struct {
+	ThreadID   string
+	MessageID  string
+	References string
+	Subject    string
+	Date       string
+	From       []*mail.Address
+	ReplyTo    []*mail.Address
+	To         []*mail.Address
+	Cc         []*mail.Address
+}
+
+// getReplyTarget fetches the headers of the message being replied to.
+func getReplyTarget(ctx context.Context, messageID string) (*gmailReplyTarget, error) {
+	original, err := gmailService().Users.Messages.Get("me", messageID).
+		Format("metadata").
+		MetadataHeaders("From", "Reply-To", "To", "Cc", "Subject", "Date", "Message-ID", "References").
+		Context(ctx).
+		Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get original email: %v", err)
+	}
+
+	target := &gmailReplyTarget{ThreadID: original.ThreadId}
+	for _, header := range original.Payload.Headers {
+		switch strings.ToLower(header.Name) {
+		case "from":
+			target.From = parseHeaderAddresses(header.Value)
+		case "reply-to":
+			target.ReplyTo = parseHeaderAddresses(header.Value)
+		case "to":
+			target.To = parseHeaderAddresses(header.Value)
+		case "cc":
+			target.Cc = parseHeaderAddresses(header.Value)
+		case "subject":
+			target.Subject = email.DecodeHeader(header.Value)
+		case "date":
+			target.Date = header.Value
+		case "message-id":
+			target.MessageID = header.Value
+		case "references":
+			target.References = header.Value
+		}
+	}
+
+	return target, nil
+}
+
+// apply sets the subject and the In-Reply-To and References headers that
+// thread message under the target.
+func (t *gmailReplyTarget) apply(message *email.Message) {
+	message.Subject = t.Subject
+	if !strings.HasPrefix(strings.ToLower(message.Subject), "re:") {
+		message.Subject = "Re: " + message.Subject
+	}
+
+	if t.MessageID == "" {
+		return
+	}
+
+	references := strings.TrimSpace(t.References + " " + t.MessageID)
+	message.Headers = append(message.Headers,
+		email.Header{Name: "In-Reply-To", Value: t.MessageID},
+		email.Header{Name: "References", Value: references},
+	)
+}
+
+// recipients returns who a reply goes to: Reply-To when set, otherwise From.
+func (t *gmailReplyTarget) recipients() []*mail.Address {
+	if len(t.ReplyTo) > 0 {
+		return t.ReplyTo
+	}
+	return t.From
+}
+
+// replyRecipients returns the To and Cc lists of a reply. To is Reply-To or
+// From; reply-all adds the original To and Cc as Cc. The user's own
+// addresses are removed and duplicates dropped. When the original was sent
+// by the user, the reply goes to its recipients instead.
+func (t *gmailReplyTarget) replyRecipients(replyAll bool, self map[string]bool) ([]*mail.Address, []*mail.Address) {
+	seen := make(map[string]bool)
+	for address := range self {
+		seen[address] = true
+	}
+
+	to := dedupeAddresses(t.recipients(), seen)
+	if len(to) == 0 {
+		to = dedupeAddresses(t.To, seen)
+	}
+
+	if !replyAll {
+		return to, nil
+	}
+
+	cc := dedupeAddresses(append(append([]*mail.Address{}, t.To...), t.Cc...), seen)
+	return to, cc
+}
+
+// quote appends the original message, quoted, to the bodies of message.
+func (t *gmailReplyTarget) quote(message *email.Message, original *email.Content) {
+	from := ""
+	if len(t.From) > 0 {
+		from = formatAddress(t.From[0])
+	}
+	attribution := fmt.Sprintf("On %s, %s wrote:", t.Date, from)
+
+	text := original.Body("text")
+
+	var quoted strings.Builder
+	for _, line := range strings.Split(strings.TrimRight(text, "\r\n"), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.HasPrefix(line, ">") {
+			quoted.WriteString(">" + line + "\n")
+		} else {
+			quoted.WriteString("> " + line + "\n")
+		}
+	}
+	message.Text = strings.TrimRight(message.Text, "\r\n") + "\n\n" + attribution + "\n" + quoted.String()
+
+	if message.HTML == "" {
+		return
+	}
+
+	originalHTML := original.HTML
+	if originalHTML == "" {
+		originalHTML = strings.ReplaceAll(html.EscapeString(text), "\n", "<br>")
+	}
+	message.HTML += `<br><div class="gmail_quote">` + html.EscapeString(attribution) +
+		`<br><blockquote class="gmail_quote" style="margin:0 0 0 .8ex;border-left:1px #ccc solid;padding-left:1ex">` +
+		originalHTML + `</blockquote></div>`
+}
+
+// myAddresses returns the lowercased addresses of the user: the account
+// address and every send-as alias.
+func myAddresses(ctx context.Context) (map[string]bool, error) {
+	profile, err := gmailService().Users.GetProfile("me").Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get profile: %v", err)
+	}
+
+	addresses := map[string]bool{strings.ToLower(profile.EmailAddress): true}
+
+	sendAs, err := gmailService().Users.Settings.SendAs.List("me").Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list send-as aliases: %v", err)
+	}
+	for _, alias := range sendAs.SendAs {
+		addresses[strings.ToLower(alias.SendAsEmail)] = true
+	}
+
+	return addresses, nil
+}
+
+// dedupeAddresses returns the addresses not yet in seen, in order, and adds
+// them to seen. Addresses are compared case-insensitively.
+func dedupeAddresses(addresses []*mail.Address, seen map[string]bool) []*mail.Address {
+	var unique []*mail.Address
+	for _, address := range addresses {
+		key := strings.ToLower(address.Address)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, address)
+	}
+	return unique
+}
+
+// parseHeaderAddresses parses an address header, skipping it when it is
+// malformed.
+func parseHeaderAddresses(value string) []*mail.Address {
+	addresses, err := email.ParseAddressList(value)
+	if err != nil {
+		return nil
+	}
+	return addresses
+}
@@ -0,0 +1,193 @@
+package tools
+
+import (
+	"context"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nguyenvanduocit/google-kit/email"
+	"google.golang.org/api/gmail/v1"
+)
+
+func addressList(tb testing.TB, list string) []*mail.Address {
+	tb.Helper()
+	addresses, err := email.ParseAddressList(list)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return addresses
+}
+
+func addressStrings(addresses []*mail.Address) []string {
+	var list []string
+	for _, address := range addresses {
+		list = append(list, address.Address)
+	}
+	return list
+}
+
+func TestReplyRecipients(t *testing.T) {
+	self := map[string]bool{"me@example.com": true, "me@alias.example.com": true}
+
+	tests := []struct {
+		name           string
+		from, replyTo  string
+		to, cc         string
+		replyAll       bool
+		wantTo, wantCc []string
+	}{
+		{
+			name:   "reply goes to the sender",
+			from:   "Jane <jane@example.com>",
+			to:     "me@example.com, bob@example.com",
+			wantTo: []string{"jane@example.com"},
+		},
+		{
+			name:    "reply-to wins over from",
+			from:    "Jane <jane@example.com>",
+			replyTo: "Support <support@example.com>",
+			to:      "me@example.com",
+			wantTo:  []string{"support@example.com"},
+		},
+		{
+			name:     "reply-all copies the other recipients",
+			from:     "Jane <jane@example.com>",
+			to:       "Me <ME@example.com>, bob@example.com",
+			cc:       "carol@example.com, jane@example.com",
+			replyAll: true,
+			wantTo:   []string{"jane@example.com"},
+			wantCc:   []string{"bob@example.com", "carol@example.com"},
+		},
+		{
+			name:     "reply-all drops send-as aliases",
+			from:     "jane@example.com",
+			to:       "me@alias.example.com",
+			cc:       "Me@Example.com, bob@example.com, BOB@example.com",
+			replyAll: true,
+			wantTo:   []string{"jane@example.com"},
+			wantCc:   []string{"bob@example.com"},
+		},
+		{
+			name:     "reply-all with reply-to skips the list in copy",
+			from:     "jane@example.com",
+			replyTo:  "list@example.com",
+			to:       "list@example.com, me@example.com",
+			replyAll: true,
+			wantTo:   []string{"list@example.com"},
+			wantCc:   nil,
+		},
+		{
+			name:   "my own message goes to its recipients",
+			from:   "Me <me@example.com>",
+			to:     "bob@example.com, carol@example.com",
+			cc:     "dave@example.com",
+			wantTo: []string{"bob@example.com", "carol@example.com"},
+		},
+		{
+			name:     "reply-all to my own message",
+			from:     "me@alias.example.com",
+			to:       "bob@example.com",
+			cc:       "dave@example.com, me@example.com",
+			replyAll: true,
+			wantTo:   []string{"bob@example.com"},
+			wantCc:   []string{"dave@example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := &gmailReplyTarget{
+				From:    addressList(t, tt.from),
+				ReplyTo: addressList(t, tt.replyTo),
+				To:      addressList(t, tt.to),
+				Cc:      addressList(t, tt.cc),
+			}
+			to, cc := target.replyRecipients(tt.replyAll, self)
+			if got := addressStrings(to); !reflect.DeepEqual(got, tt.wantTo) {
+				t.Errorf("to = %v, want %v", got, tt.wantTo)
+			}
+			if got := addressStrings(cc); !reflect.DeepEqual(got, tt.wantCc) {
+				t.Errorf("cc = %v, want %v", got, tt.wantCc)
+			}
+		})
+	}
+}
+
+func TestReplyTargetApply(t *testing.T) {
+	tests := []struct {
+		name           string
+		target         gmailReplyTarget
+		wantSubject    string
+		wantReferences string
+	}{
+		{
+			name:           "first reply",
+			target:         gmailReplyTarget{Subject: "Lunch", MessageID: "<a@example.com>"},
+			wantSubject:    "Re: Lunch",
+			wantReferences: "<a@example.com>",
+		},
+		{
+			name:           "reply in a thread",
+			target:         gmailReplyTarget{Subject: "RE: Lunch", MessageID: "<c@example.com>", References: "<a@example.com> <b@example.com>"},
+			wantSubject:    "RE: Lunch",
+			wantReferences: "<a@example.com> <b@example.com> <c@example.com>",
+		},
+		{
+			name:        "no message ID",
+			target:      gmailReplyTarget{Subject: "Lunch"},
+			wantSubject: "Re: Lunch",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := &email.Message{}
+			tt.target.apply(message)
+
+			if message.Subject != tt.wantSubject {
+				t.Errorf("subject = %q, want %q", message.Subject, tt.wantSubject)
+			}
+			headers := make(map[string]string)
+			for _, header := range message.Headers {
+				headers[header.Name] = header.Value
+			}
+			if headers["References"] != tt.wantReferences {
+				t.Errorf("References = %q, want %q", headers["References"], tt.wantReferences)
+			}
+			if tt.target.MessageID != "" && headers["In-Reply-To"] != tt.target.MessageID {
+				t.Errorf("In-Reply-To = %q, want %q", headers["In-Reply-To"], tt.target.MessageID)
+			}
+			if tt.target.MessageID == "" && len(message.Headers) > 0 {
+				t.Errorf("headers = %v, want none without a message ID", message.Headers)
+			}
+		})
+	}
+}
+
+func TestMyAddresses(t *testing.T) {
+	fakeGoogle(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch strings.TrimPrefix(r.URL.Path, "/gmail/v1/users/me/") {
+		case "profile":
+			writeJSON(w, gmail.Profile{EmailAddress: "Me@Example.com"})
+		case "settings/sendAs":
+			writeJSON(w, gmail.ListSendAsResponse{SendAs: []*gmail.SendAs{
+				{SendAsEmail: "me@example.com", IsPrimary: true},
+				{SendAsEmail: "Support@Example.com"},
+			}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	got, err := myAddresses(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{"me@example.com": true, "support@example.com": true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("myAddresses() = %v, want %v", got, want)
+	}
+}
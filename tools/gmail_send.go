@@ -0,0 +1,235 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/mail"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/nguyenvanduocit/google-kit/email"
+	"github.com/nguyenvanduocit/google-kit/util"
+	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/googleapi"
+)
+
+func gmailSendEmailHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	ctx := util.RequestFromArguments(arguments).Context()
+
+	message := &email.Message{}
+	if err := applyComposeArguments(ctx, message, arguments); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if len(message.To)+len(message.Cc)+len(message.Bcc) == 0 {
+		return mcp.NewToolResultError("at least one recipient is required"), nil
+	}
+	if message.Text == "" && message.HTML == "" {
+		return mcp.NewToolResultError("body or html_body is required"), nil
+	}
+
+	raw, err := message.Bytes()
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to build email: %v", err)), nil
+	}
+
+	sent, err := sendGmailMessage(ctx, raw, "")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to send email: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("Email sent successfully. Message ID: %s, Thread ID: %s", sent.Id, sent.ThreadId)), nil
+}
+
+// applyComposeArguments applies the to, cc, bcc, subject, body, html_body,
+// from, append_signature, attachments and attachment_blobs arguments shared
+// by the compose tools to
+// message. Arguments that are absent leave the message unchanged, so drafts
+// can be edited field by field; attachments are added to existing ones.
+func applyComposeArguments(ctx context.Context, message *email.Message, arguments map[string]interface{}) error {
+	for _, field := range []struct {
+		name string
+		list *[]*mail.Address
+	}{{"to", &message.To}, {"cc", &message.Cc}, {"bcc", &message.Bcc}} {
+		value, ok := arguments[field.name].(string)
+		if !ok {
+			continue
+		}
+
+		addresses, err := email.ParseAddressList(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %v", field.name, err)
+		}
+		*field.list = addresses
+	}
+
+	if subject, ok := arguments["subject"].(string); ok {
+		message.Subject = subject
+	}
+
+	// A new body replaces both alternatives, so an edited plain-text body
+	// never ships next to a stale HTML one.
+	text, hasText := arguments["body"].(string)
+	htmlBody, hasHTML := arguments["html_body"].(string)
+	if hasText || hasHTML {
+		message.Text = text
+		message.HTML = htmlBody
+	}
+
+	from, _ := arguments["from"].(string)
+	appendSignature, _ := arguments["append_signature"].(bool)
+	if from == "" && message.From != nil && appendSignature {
+		// Look up the signature of the alias the draft is already from.
+		from = message.From.Address
+	}
+
+	if from != "" || message.From == nil {
+		sendAs, err := resolveSendAs(ctx, from)
+		if err != nil {
+			return err
+		}
+
+		if sendAs != nil {
+			message.From = &mail.Address{Name: sendAs.DisplayName, Address: sendAs.SendAsEmail}
+			message.ReplyTo = nil
+			if sendAs.ReplyToAddress != "" {
+				replyTo, err := email.ParseAddressList(sendAs.ReplyToAddress)
+				if err != nil {
+					return fmt.Errorf("invalid reply-to address of %s: %v", sendAs.SendAsEmail, err)
+				}
+				message.ReplyTo = replyTo
+			}
+
+			if appendSignature {
+				addSignature(message, sendAs.Signature)
+			}
+		}
+	}
+
+	if message.Text == "" && message.HTML != "" {
+		message.Text = email.HTMLToText(message.HTML)
+	}
+
+	attachments, err := attachmentsFromArguments(arguments)
+	if err != nil {
+		return err
+	}
+	message.Attachments = append(message.Attachments, attachments...)
+
+	return nil
+}
+
+// gmailSimpleUploadLimit is the size above which messages are uploaded
+// with the resumable media protocol instead of inline in the request body.
+const gmailSimpleUploadLimit = 5 << 20
+
+// gmailUploadChunkSize is the chunk size of resumable uploads; media larger
+// than one chunk is uploaded resumably by the client library.
+const gmailUploadChunkSize = 1 << 20
+
+// sendGmailMessage sends a raw RFC 5322 message, in threadID when set.
+func sendGmailMessage(ctx context.Context, raw []byte, threadID string) (*gmail.Message, error) {
+	call := gmailService().Users.Messages.Send("me", gmailUploadMessage(raw, threadID)).Context(ctx)
+	if len(raw) > gmailSimpleUploadLimit {
+		call = call.Media(bytes.NewReader(raw), gmailUploadOptions()...)
+	}
+	return call.Do()
+}
+
+// createGmailDraft creates a draft from a raw RFC 5322 message.
+func createGmailDraft(ctx context.Context, raw []byte, threadID string) (*gmail.Draft, error) {
+	draft := &gmail.Draft{Message: gmailUploadMessage(raw, threadID)}
+	call := gmailService().Users.Drafts.Create("me", draft).Context(ctx)
+	if len(raw) > gmailSimpleUploadLimit {
+		call = call.Media(bytes.NewReader(raw), gmailUploadOptions()...)
+	}
+	return call.Do()
+}
+
+// updateGmailDraft replaces the message of a draft.
+func updateGmailDraft(ctx context.Context, draftID string, raw []byte, threadID string) (*gmail.Draft, error) {
+	draft := &gmail.Draft{Id: draftID, Message: gmailUploadMessage(raw, threadID)}
+	call := gmailService().Users.Drafts.Update("me", draftID, draft).Context(ctx)
+	if len(raw) > gmailSimpleUploadLimit {
+		call = call.Media(bytes.NewReader(raw), gmailUploadOptions()...)
+	}
+	return call.Do()
+}
+
+// gmailUploadMessage returns the message metadata of an upload. Small
+// messages carry the raw message inline; large ones are sent as media.
+func gmailUploadMessage(raw []byte, threadID string) *gmail.Message {
+	message := &gmail.Message{ThreadId: threadID}
+	if len(raw) <= gmailSimpleUploadLimit {
+		message.Raw = base64.URLEncoding.EncodeToString(raw)
+	}
+	return message
+}
+
+func gmailUploadOptions() []googleapi.MediaOption {
+	return []googleapi.MediaOption{
+		googleapi.ContentType("message/rfc822"),
+		googleapi.ChunkSize(gmailUploadChunkSize),
+	}
+}
+
+// resolveSendAs returns the send-as alias matching address, or the default
+// alias when address is empty. It returns nil, nil when the account has no
+// default alias, leaving the From header to Gmail.
+func resolveSendAs(ctx context.Context, address string) (*gmail.SendAs, error) {
+	resp, err := gmailService().Users.Settings.SendAs.List("me").Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list send-as aliases: %v", err)
+	}
+
+	if address == "" {
+		for _, sendAs := range resp.SendAs {
+			if sendAs.IsDefault {
+				return sendAs, nil
+			}
+		}
+		return nil, nil
+	}
+
+	if parsed, err := mail.ParseAddress(address); err == nil {
+		address = parsed.Address
+	}
+
+	available := make([]string, 0, len(resp.SendAs))
+	for _, sendAs := range resp.SendAs {
+		if strings.EqualFold(sendAs.SendAsEmail, address) {
+			if sendAs.VerificationStatus != "" && sendAs.VerificationStatus != "accepted" {
+				return nil, fmt.Errorf("send-as alias %s is not verified", sendAs.SendAsEmail)
+			}
+			return sendAs, nil
+		}
+		available = append(available, sendAs.SendAsEmail)
+	}
+
+	return nil, fmt.Errorf("%s is not a send-as alias of this account (available: %s)", address, strings.Join(available, ", "))
+}
+
+// addSignature appends the alias signature, which Gmail stores as HTML, to
+// the bodies of message. A body that already ends with the signature, such
+// as that of a draft updated again, is left as it is.
+func addSignature(message *email.Message, signature string) {
+	if strings.TrimSpace(signature) == "" {
+		return
+	}
+
+	textSignature := email.HTMLToText(signature)
+	if message.Text != "" && !endsWithSignature(message.Text, textSignature) {
+		message.Text = strings.TrimRight(message.Text, "\r\n") + "\n\n-- \n" + textSignature + "\n"
+	}
+	htmlSignature := `<div class="gmail_signature">` + signature + "</div>"
+	if message.HTML != "" && !endsWithSignature(message.HTML, htmlSignature) {
+		message.HTML += "<br><br>" + htmlSignature
+	}
+}
+
+// endsWithSignature reports whether body ends with signature, ignoring
+// differences in whitespace and line endings.
+func endsWithSignature(body, signature string) bool {
+	return strings.HasSuffix(strings.Join(strings.Fields(body), " "), strings.Join(strings.Fields(signature), " "))
+}
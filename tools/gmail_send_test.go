@@ -0,0 +1,37 @@
+package tools
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nguyenvanduocit/google-kit/email"
+)
+
+func TestAddSignatureOnce(t *testing.T) {
+	const signature = "<b>Jane Doe</b><br>Example Inc."
+
+	message := &email.Message{Text: "Hello Bob,\n\nSee you soon.", HTML: "<p>Hello Bob,</p><p>See you soon.</p>"}
+	addSignature(message, signature)
+	text, html := message.Text, message.HTML
+
+	if !strings.Contains(text, "-- \nJane Doe") {
+		t.Fatalf("text signature missing: %q", text)
+	}
+	if !strings.HasSuffix(html, `<div class="gmail_signature">`+signature+"</div>") {
+		t.Fatalf("HTML signature missing: %q", html)
+	}
+
+	// Updating the draft again, as read back from Gmail with CRLF line
+	// endings, must not add a second signature.
+	message.Text = strings.ReplaceAll(message.Text, "\n", "\r\n")
+	addSignature(message, signature)
+	if got := strings.ReplaceAll(message.Text, "\r\n", "\n"); got != text {
+		t.Errorf("text changed on the second call:\n%q\nwant\n%q", got, text)
+	}
+	if message.HTML != html {
+		t.Errorf("HTML changed on the second call:\n%q\nwant\n%q", message.HTML, html)
+	}
+	if n := strings.Count(message.HTML, "gmail_signature"); n != 1 {
+		t.Errorf("HTML has %d signatures", n)
+	}
+}
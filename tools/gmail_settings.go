@@ -0,0 +1,600 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/nguyenvanduocit/google-kit/util"
+	"google.golang.org/api/gmail/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// sharingSettingsError explains the 403 Gmail returns when send-as aliases,
+// forwarding addresses or auto-forwarding are changed without the
+// gmail.settings.sharing scope, which it only grants to service accounts with
+// domain-wide delegation.
+func sharingSettingsError(err error) error {
+	if googleAPIStatus(err) != http.StatusForbidden {
+		return err
+	}
+	return fmt.Errorf("%v (changing send-as aliases, forwarding addresses and auto-forwarding needs the %s scope, which Gmail only grants to a service account with domain-wide delegation)", err, gmail.GmailSettingsSharingScope)
+}
+
+// gmailSettingsSection is one section of the settings of the mailbox.
+type gmailSettingsSection interface {
+	// get returns the settings, as shown to the user.
+	get(ctx context.Context) (interface{}, error)
+	// handle runs an action other than get.
+	handle(ctx context.Context, action string, arguments map[string]interface{}) (*mcp.CallToolResult, error)
+}
+
+// gmailSettingsSections lists the sections in the order get shows them.
+var gmailSettingsSections = []string{"vacation", "send_as", "auto_forwarding", "forwarding_addresses", "imap", "pop", "language"}
+
+func gmailSettingsSectionByName(name string) gmailSettingsSection {
+	switch name {
+	case "vacation":
+		return gmailVacationSettings
+	case "send_as":
+		return gmailSendAsSettings{}
+	case "auto_forwarding":
+		return gmailAutoForwardingSettings
+	case "forwarding_addresses":
+		return gmailForwardingAddressSettings{}
+	case "imap":
+		return gmailImapSettings
+	case "pop":
+		return gmailPopSettings
+	case "language":
+		return gmailLanguageSettings
+	}
+	return nil
+}
+
+func gmailSettingsHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	ctx := util.RequestFromArguments(arguments).Context()
+
+	action, _ := arguments["action"].(string)
+	if action == "" {
+		action = "get"
+	}
+	name, _ := arguments["section"].(string)
+
+	if name == "" || name == "all" {
+		if action != "get" {
+			return mcp.NewToolResultError(fmt.Sprintf("section is required for %s action", action)), nil
+		}
+		return gmailAllSettingsHandler(ctx)
+	}
+
+	section := gmailSettingsSectionByName(name)
+	if section == nil {
+		return mcp.NewToolResultError(fmt.Sprintf("invalid section: %s. Must be one of: all, %s", name, strings.Join(gmailSettingsSections, ", "))), nil
+	}
+
+	if action != "get" {
+		return section.handle(ctx, action, arguments)
+	}
+	settings, err := section.get(ctx)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to get %s settings: %v", name, err)), nil
+	}
+	return settingsResult(map[string]interface{}{name: settings})
+}
+
+// gmailAllSettingsHandler shows every section; a section that cannot be
+// read, for instance for lack of a scope, shows its error instead.
+func gmailAllSettingsHandler(ctx context.Context) (*mcp.CallToolResult, error) {
+	result := make(map[string]interface{}, len(gmailSettingsSections))
+	for _, name := range gmailSettingsSections {
+		settings, err := gmailSettingsSectionByName(name).get(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("failed to get %s settings: %v", name, err)), nil
+			}
+			settings = map[string]interface{}{"error": err.Error()}
+		}
+		result[name] = settings
+	}
+	return settingsResult(result)
+}
+
+func settingsResult(result interface{}) (*mcp.CallToolResult, error) {
+	yamlResult, err := yaml.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to marshal settings: %v", err)), nil
+	}
+	return mcp.NewToolResultText(string(yamlResult)), nil
+}
+
+// settingsChanges lists the settings that differ between before and after,
+// by name. A missing setting is shown as null.
+func settingsChanges(before, after map[string]interface{}) []map[string]interface{} {
+	names := make([]string, 0, len(before)+len(after))
+	for name := range before {
+		names = append(names, name)
+	}
+	for name := range after {
+		if _, ok := before[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	changes := []map[string]interface{}{}
+	for _, name := range names {
+		if !reflect.DeepEqual(before[name], after[name]) {
+			changes = append(changes, map[string]interface{}{
+				"setting": name,
+				"before":  before[name],
+				"after":   after[name],
+			})
+		}
+	}
+	return changes
+}
+
+// settingsChangeResult shows the changes a write made, with the settings
+// after it.
+func settingsChangeResult(section string, before, after map[string]interface{}) (*mcp.CallToolResult, error) {
+	return settingsResult(map[string]interface{}{
+		"section":  section,
+		"changes":  settingsChanges(before, after),
+		"settings": after,
+	})
+}
+
+// settingArguments copies the given arguments into settings fields. It
+// records whether any was given and the first invalid one.
+type settingArguments struct {
+	arguments map[string]interface{}
+	given     bool
+	err       error
+}
+
+func (a *settingArguments) lookup(name string) (interface{}, bool) {
+	value, ok := a.arguments[name]
+	if ok && value != nil {
+		a.given = true
+		return value, true
+	}
+	return nil, false
+}
+
+func (a *settingArguments) fail(format string, args ...interface{}) {
+	if a.err == nil {
+		a.err = fmt.Errorf(format, args...)
+	}
+}
+
+func (a *settingArguments) bool(name string, field *bool) {
+	if value, ok := a.lookup(name); ok {
+		b, ok := value.(bool)
+		if !ok {
+			a.fail("%s must be a boolean", name)
+			return
+		}
+		*field = b
+	}
+}
+
+func (a *settingArguments) string(name string, field *string) {
+	if value, ok := a.lookup(name); ok {
+		s, ok := value.(string)
+		if !ok {
+			a.fail("%s must be a string", name)
+			return
+		}
+		*field = s
+	}
+}
+
+// oneOf sets a string setting that takes one of the given values.
+func (a *settingArguments) oneOf(name string, field *string, values ...string) {
+	if value, ok := a.lookup(name); ok {
+		s, _ := value.(string)
+		for _, allowed := range values {
+			if s == allowed {
+				*field = s
+				return
+			}
+		}
+		a.fail("%s must be one of: %s", name, strings.Join(values, ", "))
+	}
+}
+
+func (a *settingArguments) number(name string, field *int64) {
+	if value, ok := a.lookup(name); ok {
+		n, ok := value.(float64)
+		if !ok || n < 0 || n != float64(int64(n)) {
+			a.fail("%s must be a non-negative integer", name)
+			return
+		}
+		*field = int64(n)
+	}
+}
+
+// time sets a time in milliseconds since the epoch from an RFC3339 time or
+// a date, which is taken in the local time zone. A date means its start,
+// or with endOfDay its end. An empty string clears the time.
+func (a *settingArguments) time(name string, field *int64, endOfDay bool) {
+	value, ok := a.lookup(name)
+	if !ok {
+		return
+	}
+	s, _ := value.(string)
+	if s == "" {
+		*field = 0
+		return
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		*field = t.UnixMilli()
+		return
+	}
+	date, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		a.fail("%s must be a date as YYYY-MM-DD or a time in RFC3339 format", name)
+		return
+	}
+	if endOfDay {
+		date = date.AddDate(0, 0, 1)
+	}
+	*field = date.UnixMilli()
+}
+
+// settingsTime shows a time in milliseconds since the epoch, or nothing when
+// it is not set.
+func settingsTime(ms int64) interface{} {
+	if ms == 0 {
+		return nil
+	}
+	return time.UnixMilli(ms).Format(time.RFC3339)
+}
+
+// gmailSetting is a section holding a single settings object, which is
+// read, changed with the given arguments and written back whole.
+type gmailSetting[T any] struct {
+	name   string
+	read   func(ctx context.Context) (*T, error)
+	write  func(ctx context.Context, settings *T) (*T, error)
+	view   func(settings *T) map[string]interface{}
+	update func(settings *T, arguments *settingArguments)
+}
+
+func (s gmailSetting[T]) get(ctx context.Context) (interface{}, error) {
+	settings, err := s.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.view(settings), nil
+}
+
+func (s gmailSetting[T]) handle(ctx context.Context, action string, arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	if action != "set" {
+		return mcp.NewToolResultError(fmt.Sprintf("invalid action for %s: %s. Must be one of: get, set", s.name, action)), nil
+	}
+
+	settings, err := s.read(ctx)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to get %s settings: %v", s.name, err)), nil
+	}
+	before := s.view(settings)
+
+	// Only the given arguments change; the rest is written back as it was.
+	args := &settingArguments{arguments: arguments}
+	s.update(settings, args)
+	if args.err != nil {
+		return mcp.NewToolResultError(args.err.Error()), nil
+	}
+	if !args.given {
+		return mcp.NewToolResultError(fmt.Sprintf("no %s settings given to set", s.name)), nil
+	}
+	if reflect.DeepEqual(s.view(settings), before) {
+		return mcp.NewToolResultText(fmt.Sprintf("The %s settings are unchanged", s.name)), nil
+	}
+
+	updated, err := s.write(ctx, settings)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to update %s settings: %v", s.name, err)), nil
+	}
+	return settingsChangeResult(s.name, before, s.view(updated))
+}
+
+var gmailVacationSettings = gmailSetting[gmail.VacationSettings]{
+	name: "vacation",
+	read: func(ctx context.Context) (*gmail.VacationSettings, error) {
+		return gmailService().Users.Settings.GetVacation("me").Context(ctx).Do()
+	},
+	write: func(ctx context.Context, settings *gmail.VacationSettings) (*gmail.VacationSettings, error) {
+		return gmailService().Users.Settings.UpdateVacation("me", settings).Context(ctx).Do()
+	},
+	view: func(v *gmail.VacationSettings) map[string]interface{} {
+		return map[string]interface{}{
+			"enabled":              v.EnableAutoReply,
+			"subject":              v.ResponseSubject,
+			"body":                 v.ResponseBodyPlainText,
+			"html_body":            v.ResponseBodyHtml,
+			"start":                settingsTime(v.StartTime),
+			"end":                  settingsTime(v.EndTime),
+			"restrict_to_contacts": v.RestrictToContacts,
+			"restrict_to_domain":   v.RestrictToDomain,
+		}
+	},
+	update: func(v *gmail.VacationSettings, a *settingArguments) {
+		a.bool("enabled", &v.EnableAutoReply)
+		a.string("subject", &v.ResponseSubject)
+		a.string("body", &v.ResponseBodyPlainText)
+		a.string("html_body", &v.ResponseBodyHtml)
+		a.time("start", &v.StartTime, false)
+		a.time("end", &v.EndTime, true)
+		a.bool("restrict_to_contacts", &v.RestrictToContacts)
+		a.bool("restrict_to_domain", &v.RestrictToDomain)
+		if v.StartTime != 0 && v.EndTime != 0 && v.EndTime <= v.StartTime {
+			a.fail("end must be after start")
+		}
+	},
+}
+
+var gmailAutoForwardingSettings = gmailSetting[gmail.AutoForwarding]{
+	name: "auto_forwarding",
+	read: func(ctx context.Context) (*gmail.AutoForwarding, error) {
+		return gmailService().Users.Settings.GetAutoForwarding("me").Context(ctx).Do()
+	},
+	write: func(ctx context.Context, settings *gmail.AutoForwarding) (*gmail.AutoForwarding, error) {
+		updated, err := gmailService().Users.Settings.UpdateAutoForwarding("me", settings).Context(ctx).Do()
+		return updated, sharingSettingsError(err)
+	},
+	view: func(f *gmail.AutoForwarding) map[string]interface{} {
+		return map[string]interface{}{
+			"enabled":     f.Enabled,
+			"email":       f.EmailAddress,
+			"disposition": f.Disposition,
+		}
+	},
+	update: func(f *gmail.AutoForwarding, a *settingArguments) {
+		a.bool("enabled", &f.Enabled)
+		a.string("email", &f.EmailAddress)
+		a.oneOf("disposition", &f.Disposition, "leaveInInbox", "archive", "trash", "markRead")
+		if f.Enabled && f.EmailAddress == "" {
+			a.fail("email is required to enable auto-forwarding")
+		}
+	},
+}
+
+var gmailImapSettings = gmailSetting[gmail.ImapSettings]{
+	name: "imap",
+	read: func(ctx context.Context) (*gmail.ImapSettings, error) {
+		return gmailService().Users.Settings.GetImap("me").Context(ctx).Do()
+	},
+	write: func(ctx context.Context, settings *gmail.ImapSettings) (*gmail.ImapSettings, error) {
+		return gmailService().Users.Settings.UpdateImap("me", settings).Context(ctx).Do()
+	},
+	view: func(i *gmail.ImapSettings) map[string]interface{} {
+		return map[string]interface{}{
+			"enabled":          i.Enabled,
+			"auto_expunge":     i.AutoExpunge,
+			"expunge_behavior": i.ExpungeBehavior,
+			"max_folder_size":  i.MaxFolderSize,
+		}
+	},
+	update: func(i *gmail.ImapSettings, a *settingArguments) {
+		a.bool("enabled", &i.Enabled)
+		a.bool("auto_expunge", &i.AutoExpunge)
+		a.oneOf("expunge_behavior", &i.ExpungeBehavior, "archive", "trash", "deleteForever")
+		a.number("max_folder_size", &i.MaxFolderSize)
+	},
+}
+
+var gmailPopSettings = gmailSetting[gmail.PopSettings]{
+	name: "pop",
+	read: func(ctx context.Context) (*gmail.PopSettings, error) {
+		return gmailService().Users.Settings.GetPop("me").Context(ctx).Do()
+	},
+	write: func(ctx context.Context, settings *gmail.PopSettings) (*gmail.PopSettings, error) {
+		return gmailService().Users.Settings.UpdatePop("me", settings).Context(ctx).Do()
+	},
+	view: func(p *gmail.PopSettings) map[string]interface{} {
+		return map[string]interface{}{
+			"access_window": p.AccessWindow,
+			"disposition":   p.Disposition,
+		}
+	},
+	update: func(p *gmail.PopSettings, a *settingArguments) {
+		a.oneOf("access_window", &p.AccessWindow, "disabled", "fromNowOn", "allMail")
+		a.oneOf("disposition", &p.Disposition, "leaveInInbox", "archive", "trash", "markRead")
+	},
+}
+
+var gmailLanguageSettings = gmailSetting[gmail.LanguageSettings]{
+	name: "language",
+	read: func(ctx context.Context) (*gmail.LanguageSettings, error) {
+		return gmailService().Users.Settings.GetLanguage("me").Context(ctx).Do()
+	},
+	write: func(ctx context.Context, settings *gmail.LanguageSettings) (*gmail.LanguageSettings, error) {
+		return gmailService().Users.Settings.UpdateLanguage("me", settings).Context(ctx).Do()
+	},
+	view: func(l *gmail.LanguageSettings) map[string]interface{} {
+		return map[string]interface{}{
+			"display_language": l.DisplayLanguage,
+		}
+	},
+	update: func(l *gmail.LanguageSettings, a *settingArguments) {
+		a.string("display_language", &l.DisplayLanguage)
+	},
+}
+
+// gmailSendAsSettings is the section of send-as aliases and their
+// signatures.
+type gmailSendAsSettings struct{}
+
+func sendAsView(s *gmail.SendAs) map[string]interface{} {
+	return map[string]interface{}{
+		"email":               s.SendAsEmail,
+		"display_name":        s.DisplayName,
+		"reply_to":            s.ReplyToAddress,
+		"signature":           s.Signature,
+		"is_primary":          s.IsPrimary,
+		"is_default":          s.IsDefault,
+		"treat_as_alias":      s.TreatAsAlias,
+		"verification_status": s.VerificationStatus,
+	}
+}
+
+// updateSendAs copies the given arguments into an alias and returns the
+// fields to send, so that cleared fields are sent as well.
+func updateSendAs(s *gmail.SendAs, a *settingArguments) []string {
+	var fields []string
+	for _, field := range []struct {
+		argument string
+		name     string
+		set      func()
+	}{
+		{"display_name", "DisplayName", func() { a.string("display_name", &s.DisplayName) }},
+		{"reply_to", "ReplyToAddress", func() { a.string("reply_to", &s.ReplyToAddress) }},
+		{"signature", "Signature", func() { a.string("signature", &s.Signature) }},
+		{"is_default", "IsDefault", func() { a.bool("is_default", &s.IsDefault) }},
+		{"treat_as_alias", "TreatAsAlias", func() { a.bool("treat_as_alias", &s.TreatAsAlias) }},
+	} {
+		if value, ok := a.arguments[field.argument]; ok && value != nil {
+			field.set()
+			fields = append(fields, field.name)
+		}
+	}
+	return fields
+}
+
+func (gmailSendAsSettings) get(ctx context.Context) (interface{}, error) {
+	list, err := gmailService().Users.Settings.SendAs.List("me").Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	aliases := make([]map[string]interface{}, len(list.SendAs))
+	for i, alias := range list.SendAs {
+		aliases[i] = sendAsView(alias)
+	}
+	return aliases, nil
+}
+
+func (gmailSendAsSettings) handle(ctx context.Context, action string, arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	email, _ := arguments["email"].(string)
+	if email == "" {
+		return mcp.NewToolResultError(fmt.Sprintf("email is required for %s action on send_as", action)), nil
+	}
+	aliases := gmailService().Users.Settings.SendAs
+
+	switch action {
+	case "create":
+		alias := &gmail.SendAs{SendAsEmail: email}
+		args := &settingArguments{arguments: arguments}
+		updateSendAs(alias, args)
+		if args.err != nil {
+			return mcp.NewToolResultError(args.err.Error()), nil
+		}
+		created, err := aliases.Create("me", alias).Context(ctx).Do()
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to create send-as alias: %v", sharingSettingsError(err))), nil
+		}
+		return settingsChangeResult("send_as", map[string]interface{}{}, sendAsView(created))
+
+	case "set":
+		current, err := aliases.Get("me", email).Context(ctx).Do()
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to get send-as alias: %v", err)), nil
+		}
+		before := sendAsView(current)
+
+		patch := &gmail.SendAs{}
+		args := &settingArguments{arguments: arguments}
+		patch.ForceSendFields = updateSendAs(patch, args)
+		if args.err != nil {
+			return mcp.NewToolResultError(args.err.Error()), nil
+		}
+		if !args.given {
+			return mcp.NewToolResultError("no send_as settings given to set"), nil
+		}
+
+		updated, err := aliases.Patch("me", email, patch).Context(ctx).Do()
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to update send-as alias: %v", err)), nil
+		}
+		return settingsChangeResult("send_as", before, sendAsView(updated))
+
+	case "delete":
+		current, err := aliases.Get("me", email).Context(ctx).Do()
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to get send-as alias: %v", err)), nil
+		}
+		if err := aliases.Delete("me", email).Context(ctx).Do(); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to delete send-as alias: %v", sharingSettingsError(err))), nil
+		}
+		return settingsChangeResult("send_as", sendAsView(current), map[string]interface{}{})
+
+	case "verify":
+		if err := aliases.Verify("me", email).Context(ctx).Do(); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to send verification email: %v", err)), nil
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("Sent a verification email to %s", email)), nil
+
+	default:
+		return mcp.NewToolResultError(fmt.Sprintf("invalid action for send_as: %s. Must be one of: get, create, set, delete, verify", action)), nil
+	}
+}
+
+// gmailForwardingAddressSettings is the section of addresses mail can be
+// forwarded to, by auto-forwarding or filters.
+type gmailForwardingAddressSettings struct{}
+
+func forwardingAddressView(f *gmail.ForwardingAddress) map[string]interface{} {
+	return map[string]interface{}{
+		"email":               f.ForwardingEmail,
+		"verification_status": f.VerificationStatus,
+	}
+}
+
+func (gmailForwardingAddressSettings) get(ctx context.Context) (interface{}, error) {
+	list, err := gmailService().Users.Settings.ForwardingAddresses.List("me").Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	addresses := make([]map[string]interface{}, len(list.ForwardingAddresses))
+	for i, address := range list.ForwardingAddresses {
+		addresses[i] = forwardingAddressView(address)
+	}
+	return addresses, nil
+}
+
+func (gmailForwardingAddressSettings) handle(ctx context.Context, action string, arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	email, _ := arguments["email"].(string)
+	if email == "" {
+		return mcp.NewToolResultError(fmt.Sprintf("email is required for %s action on forwarding_addresses", action)), nil
+	}
+	addresses := gmailService().Users.Settings.ForwardingAddresses
+
+	switch action {
+	case "create":
+		created, err := addresses.Create("me", &gmail.ForwardingAddress{ForwardingEmail: email}).Context(ctx).Do()
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to create forwarding address: %v", sharingSettingsError(err))), nil
+		}
+		return settingsChangeResult("forwarding_addresses", map[string]interface{}{}, forwardingAddressView(created))
+
+	case "delete":
+		current, err := addresses.Get("me", email).Context(ctx).Do()
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to get forwarding address: %v", err)), nil
+		}
+		if err := addresses.Delete("me", email).Context(ctx).Do(); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to delete forwarding address: %v", sharingSettingsError(err))), nil
+		}
+		return settingsChangeResult("forwarding_addresses", forwardingAddressView(current), map[string]interface{}{})
+
+	default:
+		return mcp.NewToolResultError(fmt.Sprintf("invalid action for forwarding_addresses: %s. Must be one of: get, create, delete", action)), nil
+	}
+}
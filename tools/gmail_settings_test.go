@@ -0,0 +1,194 @@
+package tools
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+func TestGmailSettingsSharingScopeError(t *testing.T) {
+	fakeGoogle(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			writeJSON(w, map[string]interface{}{})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"error": {"code": 403, "message": "Access restricted to service accounts that have been delegated domain-wide authority"}}`))
+	}))
+
+	tests := []map[string]interface{}{
+		{"action": "create", "section": "forwarding_addresses", "email": "archive@example.com"},
+		{"action": "create", "section": "send_as", "email": "alias@example.com"},
+		{"action": "set", "section": "auto_forwarding", "enabled": true, "email": "archive@example.com"},
+	}
+
+	for _, arguments := range tests {
+		t.Run(arguments["section"].(string), func(t *testing.T) {
+			result, err := gmailSettingsHandler(arguments)
+			text := resultText(t, result, err)
+			if !result.IsError || !strings.Contains(text, "gmail.settings.sharing") {
+				t.Errorf("result = %q, want an error naming the gmail.settings.sharing scope", text)
+			}
+		})
+	}
+}
+
+func TestSettingsChanges(t *testing.T) {
+	before := map[string]interface{}{"enabled": false, "subject": "Away", "end": nil, "removed": "x"}
+	after := map[string]interface{}{"enabled": true, "subject": "Away", "end": "2024-07-15T00:00:00Z", "added": "y"}
+
+	want := []map[string]interface{}{
+		{"setting": "added", "before": nil, "after": "y"},
+		{"setting": "enabled", "before": false, "after": true},
+		{"setting": "end", "before": nil, "after": "2024-07-15T00:00:00Z"},
+		{"setting": "removed", "before": "x", "after": nil},
+	}
+	if got := settingsChanges(before, after); !reflect.DeepEqual(got, want) {
+		t.Errorf("settingsChanges() = %v, want %v", got, want)
+	}
+	if got := settingsChanges(before, before); len(got) != 0 {
+		t.Errorf("settingsChanges() of the same settings = %v, want none", got)
+	}
+}
+
+// fakeSettings serves the vacation settings and one send-as alias, and
+// records the bodies of the writes by path.
+func fakeSettings(t *testing.T, vacation gmail.VacationSettings, alias gmail.SendAs) map[string]map[string]interface{} {
+	var mu sync.Mutex
+	writes := make(map[string]map[string]interface{})
+
+	fakeGoogle(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		path := strings.TrimPrefix(r.URL.Path, "/gmail/v1/users/me/settings/")
+		if r.Method != http.MethodGet {
+			body, _ := io.ReadAll(r.Body)
+			var fields map[string]interface{}
+			json.Unmarshal(body, &fields)
+			writes[path] = fields
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(body)
+			return
+		}
+		switch path {
+		case "vacation":
+			writeJSON(w, vacation)
+		case "sendAs/" + alias.SendAsEmail:
+			writeJSON(w, alias)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	return writes
+}
+
+func TestGmailVacationSettingsSet(t *testing.T) {
+	start := time.Date(2024, 7, 1, 0, 0, 0, 0, time.Local)
+	current := gmail.VacationSettings{
+		ResponseSubject:       "Out of office",
+		ResponseBodyPlainText: "Back soon.",
+		RestrictToContacts:    true,
+		StartTime:             start.UnixMilli(),
+	}
+	writes := fakeSettings(t, current, gmail.SendAs{})
+
+	result, err := gmailSettingsHandler(map[string]interface{}{"action": "set", "section": "vacation", "enabled": true, "end": "2024-07-14"})
+	decoded := resultYAML(t, result, err)
+
+	written := writes["vacation"]
+	if written == nil {
+		t.Fatal("the vacation settings were not written")
+	}
+	// The end date means the end of that day.
+	wantEnd := time.Date(2024, 7, 15, 0, 0, 0, 0, time.Local)
+	want := map[string]interface{}{
+		"enableAutoReply":       true,
+		"responseSubject":       "Out of office",
+		"responseBodyPlainText": "Back soon.",
+		"restrictToContacts":    true,
+		"startTime":             strconv.FormatInt(start.UnixMilli(), 10),
+		"endTime":               strconv.FormatInt(wantEnd.UnixMilli(), 10),
+	}
+	for name, value := range want {
+		if written[name] != value {
+			t.Errorf("written %s = %v, want %v", name, written[name], value)
+		}
+	}
+
+	changes, _ := decoded["changes"].([]interface{})
+	var changed []string
+	for _, change := range changes {
+		changed = append(changed, change.(map[string]interface{})["setting"].(string))
+	}
+	if !reflect.DeepEqual(changed, []string{"enabled", "end"}) {
+		t.Errorf("changes = %v, want enabled and end", changes)
+	}
+	if end := changes[1].(map[string]interface{})["after"]; end != wantEnd.Format(time.RFC3339) {
+		t.Errorf("end shown as %v, want %s", end, wantEnd.Format(time.RFC3339))
+	}
+}
+
+func TestGmailVacationSettingsNotWritten(t *testing.T) {
+	current := gmail.VacationSettings{EnableAutoReply: true, StartTime: time.Date(2024, 7, 1, 0, 0, 0, 0, time.Local).UnixMilli()}
+
+	tests := []struct {
+		name      string
+		arguments map[string]interface{}
+		wantError string
+		wantText  string
+	}{
+		{name: "unchanged", arguments: map[string]interface{}{"enabled": true}, wantText: "unchanged"},
+		{name: "nothing given", arguments: map[string]interface{}{}, wantError: "no vacation settings"},
+		{name: "end before start", arguments: map[string]interface{}{"end": "2024-06-30"}, wantError: "end must be after start"},
+		{name: "invalid date", arguments: map[string]interface{}{"start": "next monday"}, wantError: "YYYY-MM-DD"},
+		{name: "wrong type", arguments: map[string]interface{}{"enabled": "yes"}, wantError: "enabled must be a boolean"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writes := fakeSettings(t, current, gmail.SendAs{})
+			arguments := map[string]interface{}{"action": "set", "section": "vacation"}
+			for name, value := range tt.arguments {
+				arguments[name] = value
+			}
+
+			result, err := gmailSettingsHandler(arguments)
+			text := resultText(t, result, err)
+			if tt.wantError != "" && (!result.IsError || !strings.Contains(text, tt.wantError)) {
+				t.Errorf("result = %q, want an error mentioning %q", text, tt.wantError)
+			}
+			if tt.wantText != "" && (result.IsError || !strings.Contains(text, tt.wantText)) {
+				t.Errorf("result = %q, want %q", text, tt.wantText)
+			}
+			if len(writes) > 0 {
+				t.Errorf("settings were written: %v", writes)
+			}
+		})
+	}
+}
+
+func TestGmailSendAsPatchSendsClearedFields(t *testing.T) {
+	alias := gmail.SendAs{SendAsEmail: "jane@example.com", DisplayName: "J", ReplyToAddress: "team@example.com", Signature: "<b>Jane</b>"}
+	writes := fakeSettings(t, gmail.VacationSettings{}, alias)
+
+	result, err := gmailSettingsHandler(map[string]interface{}{
+		"action": "set", "section": "send_as", "email": "jane@example.com", "display_name": "Jane Doe", "signature": "",
+	})
+	resultYAML(t, result, err)
+
+	written := writes["sendAs/jane@example.com"]
+	want := map[string]interface{}{"displayName": "Jane Doe", "signature": ""}
+	if !reflect.DeepEqual(written, want) {
+		t.Errorf("patch = %v, want only %v, with the cleared signature", written, want)
+	}
+}
@@ -0,0 +1,182 @@
+package tools
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/nguyenvanduocit/google-kit/email"
+	"github.com/nguyenvanduocit/google-kit/util"
+	"google.golang.org/api/gmail/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// threadParticipant summarizes one person taking part in a thread.
+type threadParticipant struct {
+	Name     string `yaml:"name,omitempty"`
+	Email    string `yaml:"email"`
+	Sent     int    `yaml:"sent"`
+	Received int    `yaml:"received"`
+}
+
+func gmailReadThreadHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	ctx := util.RequestFromArguments(arguments).Context()
+
+	threadID, ok := arguments["thread_id"].(string)
+	if !ok || threadID == "" {
+		return mcp.NewToolResultError("thread_id must be a string"), nil
+	}
+
+	bodyFormat, _ := arguments["body_format"].(string)
+	switch bodyFormat {
+	case "":
+		bodyFormat = "text"
+	case "text", "markdown":
+	default:
+		return mcp.NewToolResultError("body_format must be one of: text, markdown"), nil
+	}
+
+	trimQuotes := true
+	if value, ok := arguments["trim_quotes"].(bool); ok {
+		trimQuotes = value
+	}
+
+	lastN := 0
+	if value, ok := arguments["last_n"].(float64); ok && value > 0 {
+		lastN = int(value)
+	}
+
+	thread, err := gmailService().Users.Threads.Get("me", threadID).Format("full").Context(ctx).Do()
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to get thread: %v", err)), nil
+	}
+
+	participants := make([]*threadParticipant, 0)
+	byEmail := make(map[string]*threadParticipant)
+	participant := func(address *mail.Address) *threadParticipant {
+		key := strings.ToLower(address.Address)
+		p, exists := byEmail[key]
+		if !exists {
+			p = &threadParticipant{Email: address.Address}
+			byEmail[key] = p
+			participants = append(participants, p)
+		}
+		if p.Name == "" {
+			p.Name = address.Name
+		}
+		return p
+	}
+
+	subject := ""
+	messages := make([]map[string]interface{}, 0, len(thread.Messages))
+	earlierSenders := make([]string, 0)
+
+	collapseBefore := 0
+	if lastN > 0 && len(thread.Messages) > lastN {
+		collapseBefore = len(thread.Messages) - lastN
+	}
+
+	for i, message := range thread.Messages {
+		raw := gmailHeaders(message)
+		headers := make(map[string]string, len(raw))
+		for name, value := range raw {
+			headers[name] = email.DecodeHeader(value)
+		}
+		if subject == "" {
+			subject = headers["subject"]
+		}
+
+		from := parseHeaderAddresses(raw["from"])
+		for _, address := range from {
+			participant(address).Sent++
+		}
+		for _, name := range []string{"to", "cc"} {
+			for _, address := range parseHeaderAddresses(raw[name]) {
+				participant(address).Received++
+			}
+		}
+
+		if i < collapseBefore {
+			if len(from) > 0 {
+				earlierSenders = append(earlierSenders, formatAddress(from[0]))
+			}
+			continue
+		}
+
+		content := gmailContent(message)
+		body := content.Body(bodyFormat)
+		if trimQuotes {
+			body = email.TrimReply(body)
+		}
+
+		messageInfo := map[string]interface{}{
+			"id":   message.Id,
+			"from": headers["from"],
+			"date": headers["date"],
+			"body": body,
+		}
+		for _, name := range []string{"to", "cc"} {
+			if headers[name] != "" {
+				messageInfo[name] = headers[name]
+			}
+		}
+		if headers["subject"] != subject {
+			messageInfo["subject"] = headers["subject"]
+		}
+		if len(content.Attachments) > 0 {
+			filenames := make([]string, 0, len(content.Attachments))
+			for _, part := range content.Attachments {
+				filenames = append(filenames, part.Filename)
+			}
+			messageInfo["attachments"] = filenames
+		}
+		messages = append(messages, messageInfo)
+	}
+
+	result := map[string]interface{}{
+		"threadId":     thread.Id,
+		"subject":      subject,
+		"messageCount": len(thread.Messages),
+		"participants": participants,
+		"messages":     messages,
+	}
+	if collapseBefore > 0 {
+		result["collapsed"] = map[string]interface{}{
+			"count":   collapseBefore,
+			"senders": earlierSenders,
+		}
+	}
+
+	yamlResult, err := yaml.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to marshal thread: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(yamlResult)), nil
+}
+
+// gmailHeaders returns the top-level headers of a message, keyed by
+// lowercased name. Repeated headers keep their first value.
+func gmailHeaders(message *gmail.Message) map[string]string {
+	headers := make(map[string]string)
+	if message.Payload == nil {
+		return headers
+	}
+
+	for _, header := range message.Payload.Headers {
+		name := strings.ToLower(header.Name)
+		if _, exists := headers[name]; !exists {
+			headers[name] = header.Value
+		}
+	}
+	return headers
+}
+
+// formatAddress formats an address for display, without encoding.
+func formatAddress(address *mail.Address) string {
+	if address.Name == "" {
+		return address.Address
+	}
+	return fmt.Sprintf("%s <%s>", address.Name, address.Address)
+}
@@ -0,0 +1,75 @@
+package tools
+
+import (
+	"encoding/base64"
+	"net/http"
+	"slices"
+	"testing"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// threadMessage builds a plain text message of a thread.
+func threadMessage(id, from, to, subject, body string) *gmail.Message {
+	return &gmail.Message{Id: id, ThreadId: "t1", Payload: &gmail.MessagePart{
+		MimeType: "text/plain",
+		Headers: []*gmail.MessagePartHeader{
+			{Name: "From", Value: from},
+			{Name: "To", Value: to},
+			{Name: "Subject", Value: subject},
+			{Name: "Date", Value: "Mon, 1 Jan 2024 10:00:00 +0000"},
+		},
+		Body: &gmail.MessagePartBody{Data: base64.URLEncoding.EncodeToString([]byte(body))},
+	}}
+}
+
+func TestGmailReadThreadTrimsQuotes(t *testing.T) {
+	thread := gmail.Thread{Id: "t1", Messages: []*gmail.Message{
+		threadMessage("m1", "Jane Doe <jane@example.com>", "bob@example.com", "Lunch", "Lunch tomorrow?\n\n-- \nJane"),
+		threadMessage("m2", "Bob <bob@example.com>", "Jane Doe <jane@example.com>", "Re: Lunch",
+			"Sure, noon?\n\nOn Mon, 1 Jan 2024 at 09:00, Jane Doe <jane@example.com> wrote:\n> Lunch tomorrow?\n"),
+		threadMessage("m3", "Jane Doe <jane@example.com>", "Bob <bob@example.com>", "Re: Lunch",
+			"Noon works.\n\nSent from my iPhone\n\nOn Mon, 1 Jan 2024 at 09:30, Bob <bob@example.com> wrote:\n> Sure, noon?\n"),
+	}}
+	fakeGoogle(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/gmail/v1/users/me/threads/t1" {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, thread)
+	}))
+
+	bodies := func(decoded map[string]interface{}) []string {
+		var bodies []string
+		for _, message := range decoded["messages"].([]interface{}) {
+			bodies = append(bodies, message.(map[string]interface{})["body"].(string))
+		}
+		return bodies
+	}
+
+	result, err := gmailReadThreadHandler(map[string]interface{}{"thread_id": "t1"})
+	decoded := resultYAML(t, result, err)
+	want := []string{"Lunch tomorrow?", "Sure, noon?", "Noon works."}
+	if got := bodies(decoded); !slices.Equal(got, want) {
+		t.Errorf("bodies = %q, want %q", got, want)
+	}
+	if decoded["subject"] != "Lunch" || decoded["messageCount"] != 3 {
+		t.Errorf("subject %v and %v messages, want Lunch and 3", decoded["subject"], decoded["messageCount"])
+	}
+	participants := decoded["participants"].([]interface{})
+	if len(participants) != 2 {
+		t.Fatalf("participants = %v, want Jane and Bob", participants)
+	}
+	if jane := participants[0].(map[string]interface{}); jane["email"] != "jane@example.com" || jane["sent"] != 2 || jane["received"] != 1 {
+		t.Errorf("first participant = %v, want Jane with 2 sent and 1 received", jane)
+	}
+
+	result, err = gmailReadThreadHandler(map[string]interface{}{"thread_id": "t1", "trim_quotes": false, "last_n": float64(1)})
+	decoded = resultYAML(t, result, err)
+	if got := bodies(decoded); len(got) != 1 || got[0] != "Noon works.\n\nSent from my iPhone\n\nOn Mon, 1 Jan 2024 at 09:30, Bob <bob@example.com> wrote:\n> Sure, noon?\n" {
+		t.Errorf("bodies = %q, want the last message untrimmed", got)
+	}
+	if collapsed := decoded["collapsed"].(map[string]interface{}); collapsed["count"] != 2 {
+		t.Errorf("collapsed = %v, want 2 messages", collapsed)
+	}
+}
@@ -0,0 +1,593 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/netip"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/nguyenvanduocit/google-kit/email"
+	"github.com/nguyenvanduocit/google-kit/util"
+	"google.golang.org/api/gmail/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// gmailUnsubscribeHeaders are the headers fetched to unsubscribe from a
+// sender.
+var gmailUnsubscribeHeaders = []string{"From", "Subject", "List-Unsubscribe", "List-Unsubscribe-Post", "Authentication-Results"}
+
+// gmailUnsubscribeTimeout bounds each one-click unsubscribe request.
+const gmailUnsubscribeTimeout = 30 * time.Second
+
+// gmailAuthservID identifies the Authentication-Results headers Gmail
+// writes (RFC 8601).
+const gmailAuthservID = "mx.google.com"
+
+// gmailUnsubscribeFilters maps the filter argument to the action of the
+// filter created for each sender.
+var gmailUnsubscribeFilters = map[string]*gmail.FilterAction{
+	"archive": {RemoveLabelIds: []string{"INBOX"}},
+	"trash":   {AddLabelIds: []string{"TRASH"}},
+}
+
+// listUnsubscribeURI matches the URIs of a List-Unsubscribe header, which
+// are enclosed in angle brackets (RFC 2369).
+var listUnsubscribeURI = regexp.MustCompile(`<([^>]*)>`)
+
+// listUnsubscribe holds the ways a message offers to unsubscribe.
+type listUnsubscribe struct {
+	// oneClick is the HTTPS URI to POST to (RFC 8058), when the message
+	// allows it.
+	oneClick string
+	// mailto is the first mailto URI.
+	mailto string
+	// link is the first web URI, which needs a browser when it is not
+	// one-click.
+	link string
+}
+
+// parseListUnsubscribe parses the List-Unsubscribe and
+// List-Unsubscribe-Post headers of a message.
+func parseListUnsubscribe(header, post string) listUnsubscribe {
+	var methods listUnsubscribe
+	var https string
+	for _, match := range listUnsubscribeURI.FindAllStringSubmatch(header, -1) {
+		// URIs may be folded across lines.
+		uri := strings.Join(strings.Fields(match[1]), "")
+		switch scheme, _, _ := strings.Cut(uri, ":"); strings.ToLower(scheme) {
+		case "mailto":
+			if methods.mailto == "" {
+				methods.mailto = uri
+			}
+		case "https":
+			if https == "" {
+				https = uri
+			}
+			fallthrough
+		case "http":
+			if methods.link == "" {
+				methods.link = uri
+			}
+		}
+	}
+
+	// RFC 8058 only allows one-click over HTTPS.
+	if https != "" && strings.EqualFold(strings.Join(strings.Fields(post), ""), "List-Unsubscribe=One-Click") {
+		methods.oneClick = https
+	}
+	return methods
+}
+
+// dkimPassed reports whether Gmail found a valid DKIM signature on the
+// message from a domain aligned with one of the given domains: the same
+// domain, or one of them a subdomain of the other. RFC 8058 requires one
+// before acting on a one-click header, and without one the headers may be
+// forged; a signature from an unrelated domain proves nothing about them.
+// Only results written by Gmail count: a sender can add an
+// Authentication-Results header of its own, which is all an imported
+// message has. Gmail puts its header above any the message came with, and
+// gmailHeaders keeps the first.
+func dkimPassed(authenticationResults string, domains ...string) bool {
+	results := strings.Split(authenticationResults, ";")
+	if authservID := strings.Fields(results[0]); len(authservID) == 0 || !strings.EqualFold(authservID[0], gmailAuthservID) {
+		return false
+	}
+	for _, result := range results[1:] {
+		fields := strings.Fields(strings.ToLower(result))
+		if len(fields) == 0 || fields[0] != "dkim=pass" {
+			continue
+		}
+		for _, field := range fields[1:] {
+			var signer string
+			if value, ok := strings.CutPrefix(field, "header.d="); ok {
+				signer = value
+			} else if value, ok := strings.CutPrefix(field, "header.i="); ok {
+				_, signer, _ = strings.Cut(value, "@")
+			} else {
+				continue
+			}
+			signer = strings.Trim(signer, `"`)
+			for _, domain := range domains {
+				if domainsAligned(signer, strings.ToLower(domain)) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// addressDomain returns the lowercased domain of an email address.
+func addressDomain(address string) string {
+	return strings.ToLower(address[strings.LastIndex(address, "@")+1:])
+}
+
+// domainsAligned reports whether two domains are the same or one is a
+// subdomain of the other.
+func domainsAligned(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	return a == b || strings.HasSuffix(a, "."+b) || strings.HasSuffix(b, "."+a)
+}
+
+// gmailUnsubscribeSender is one sender to unsubscribe from, with the newest
+// of its messages that offers a way to unsubscribe.
+type gmailUnsubscribeSender struct {
+	address  string
+	name     string
+	messages int
+	message  *gmail.Message
+	methods  listUnsubscribe
+	signed   bool
+
+	report map[string]interface{}
+}
+
+func gmailUnsubscribeHandler(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	request := util.RequestFromArguments(arguments)
+	ctx := request.Context()
+
+	dryRun, _ := arguments["dry_run"].(bool)
+	filterAction, _ := arguments["filter"].(string)
+	if filterAction != "" && gmailUnsubscribeFilters[filterAction] == nil {
+		return mcp.NewToolResultError("filter must be one of: archive, trash"), nil
+	}
+
+	ids, failed, truncated, err := gmailModifyTargets(ctx, arguments, false)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	messages, errs := fetchGmailSummaries(ctx, ids, func(done int) {
+		request.Progress(done, len(ids), "Reading headers")
+	}, gmailUnsubscribeHeaders...)
+	for i := range ids {
+		if errs[i] != nil {
+			failed = append(failed, map[string]string{"id": ids[i], "error": fmt.Sprintf("failed to get message: %v", errs[i])})
+		}
+	}
+	if request.Cancelled() {
+		return mcp.NewToolResultError("cancelled while reading messages"), nil
+	}
+
+	senders := gmailUnsubscribeSenders(messages)
+	if len(senders) == 0 {
+		return mcp.NewToolResultError("no senders found in the selected messages"), nil
+	}
+
+	if !dryRun {
+		// Mailto unsubscribes are sent from the default alias.
+		var (
+			from     *mail.Address
+			fromErr  error
+			fromOnce sync.Once
+		)
+		sender := func() (*mail.Address, error) {
+			fromOnce.Do(func() {
+				var sendAs *gmail.SendAs
+				if sendAs, fromErr = resolveSendAs(ctx, ""); sendAs != nil {
+					from = &mail.Address{Name: sendAs.DisplayName, Address: sendAs.SendAsEmail}
+				}
+			})
+			return from, fromErr
+		}
+
+		gmailParallel(ctx, len(senders), func(done int) {
+			request.Progress(done, len(senders), "Unsubscribing")
+		}, func(i int) error {
+			unsubscribeGmailSender(ctx, senders[i], sender)
+			return nil
+		})
+	} else {
+		for _, sender := range senders {
+			sender.report["status"] = "dry run"
+		}
+	}
+
+	if filterAction != "" {
+		createUnsubscribeFilters(ctx, senders, filterAction, dryRun)
+	}
+
+	reports := make([]map[string]interface{}, len(senders))
+	counts := make(map[string]int)
+	for i, sender := range senders {
+		reports[i] = sender.report
+		counts[sender.report["method"].(string)]++
+	}
+
+	result := map[string]interface{}{
+		"senders": reports,
+		"methods": counts,
+	}
+	if truncated {
+		result["truncated"] = true
+	}
+	if len(failed) > 0 {
+		result["failed"] = failed
+	}
+	if request.Cancelled() {
+		result["partial"] = true
+	}
+
+	yamlResult, err := yaml.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %v", err)), nil
+	}
+	return mcp.NewToolResultText(string(yamlResult)), nil
+}
+
+// gmailUnsubscribeSenders groups messages by sender and picks the method to
+// unsubscribe from each: one-click when offered, otherwise mailto. The
+// newest message offering a method is used, since the URIs often carry a
+// token that expires.
+func gmailUnsubscribeSenders(messages []*gmail.Message) []*gmailUnsubscribeSender {
+	bySender := make(map[string]*gmailUnsubscribeSender)
+	for _, message := range messages {
+		if message == nil {
+			continue
+		}
+		headers := gmailHeaders(message)
+
+		from := email.DecodeHeader(headers["from"])
+		name, address := from, from
+		if parsed, err := mail.ParseAddress(from); err == nil {
+			name, address = parsed.Name, parsed.Address
+		}
+		address = strings.ToLower(address)
+		if address == "" {
+			continue
+		}
+
+		sender, ok := bySender[address]
+		if !ok {
+			sender = &gmailUnsubscribeSender{address: address, name: name}
+			bySender[address] = sender
+		}
+		sender.messages++
+
+		methods := parseListUnsubscribe(headers["list-unsubscribe"], headers["list-unsubscribe-post"])
+		if methods == (listUnsubscribe{}) {
+			continue
+		}
+		if sender.message == nil || message.InternalDate > sender.message.InternalDate {
+			sender.message = message
+			sender.methods = methods
+			domains := []string{addressDomain(address)}
+			if parsed, err := url.Parse(methods.oneClick); err == nil && methods.oneClick != "" {
+				domains = append(domains, parsed.Hostname())
+			}
+			sender.signed = dkimPassed(headers["authentication-results"], domains...)
+		}
+	}
+
+	senders := make([]*gmailUnsubscribeSender, 0, len(bySender))
+	for _, sender := range bySender {
+		report := map[string]interface{}{
+			"sender":   sender.address,
+			"messages": sender.messages,
+		}
+		if sender.name != "" && sender.name != sender.address {
+			report["name"] = sender.name
+		}
+
+		switch {
+		case sender.message == nil:
+			report["method"] = "none"
+			report["note"] = "no List-Unsubscribe header"
+		case !sender.signed:
+			report["method"] = "none"
+			report["note"] = "the message has no valid DKIM signature from the sender's domain, so its unsubscribe headers may be forged"
+		case sender.methods.oneClick != "":
+			report["method"] = "one-click"
+			report["url"] = sender.methods.oneClick
+		case sender.methods.mailto != "":
+			report["mailto"] = sender.methods.mailto
+			// The unsubscribe email is sent from the user's account, so it
+			// only goes back to the sender's own domain.
+			if to, err := mailtoAddress(sender.methods.mailto); err != nil || !domainsAligned(addressDomain(to), addressDomain(sender.address)) {
+				report["method"] = "none"
+				report["note"] = "the mailto address is not at the sender's domain, so no unsubscribe email is sent"
+			} else {
+				report["method"] = "mailto"
+			}
+		default:
+			report["method"] = "link"
+			report["note"] = "the sender only offers a web page; open the url to unsubscribe"
+		}
+		if sender.message != nil {
+			report["message_id"] = sender.message.Id
+			report["subject"] = email.DecodeHeader(gmailHeaders(sender.message)["subject"])
+			if sender.methods.link != "" && report["method"] != "one-click" {
+				report["url"] = sender.methods.link
+			}
+		}
+
+		sender.report = report
+		senders = append(senders, sender)
+	}
+
+	sort.Slice(senders, func(i, j int) bool {
+		if senders[i].messages != senders[j].messages {
+			return senders[i].messages > senders[j].messages
+		}
+		return senders[i].address < senders[j].address
+	})
+	return senders
+}
+
+// unsubscribeGmailSender unsubscribes with the method picked for the
+// sender and records the outcome in its report.
+func unsubscribeGmailSender(ctx context.Context, sender *gmailUnsubscribeSender, from func() (*mail.Address, error)) {
+	var err error
+	switch sender.report["method"] {
+	case "one-click":
+		err = postOneClickUnsubscribe(ctx, sender.methods.oneClick)
+	case "mailto":
+		err = sendMailtoUnsubscribe(ctx, sender.methods.mailto, from)
+	default:
+		sender.report["status"] = "skipped"
+		return
+	}
+
+	if err != nil {
+		sender.report["status"] = "failed"
+		sender.report["error"] = err.Error()
+		return
+	}
+	sender.report["status"] = "unsubscribed"
+}
+
+// unsubscribeTransport connects to one-click unsubscribe URLs. The URLs
+// come from mail anyone can send, so it only connects to public addresses,
+// checked after DNS resolution, and never through PROXY_URL, behind which
+// the address could not be checked.
+var unsubscribeTransport = &http.Transport{
+	DialContext: (&net.Dialer{
+		Timeout: gmailUnsubscribeTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip, err := netip.ParseAddr(host)
+			if err != nil {
+				return err
+			}
+			if !publicAddress(ip) {
+				return fmt.Errorf("refusing to connect to non-public address %s", ip)
+			}
+			return nil
+		},
+	}).DialContext,
+	TLSHandshakeTimeout: 10 * time.Second,
+	MaxIdleConns:        10,
+	IdleConnTimeout:     90 * time.Second,
+}
+
+// nonPublicPrefixes are the special-purpose ranges netip has no method
+// for, through which internal services may still be reached.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),      // "this network"
+	netip.MustParsePrefix("100.64.0.0/10"),  // carrier-grade NAT, also used for cloud metadata services
+	netip.MustParsePrefix("192.0.0.0/24"),   // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"),  // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),    // reserved, and the broadcast address
+	netip.MustParsePrefix("64:ff9b::/96"),   // NAT64, which embeds any IPv4 address
+	netip.MustParsePrefix("64:ff9b:1::/48"), // local-use NAT64
+}
+
+// publicAddress reports whether ip may be reached from an unsubscribe URL:
+// not loopback, private, link-local, multicast, unspecified or in
+// nonPublicPrefixes.
+func publicAddress(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsValid() || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// postOneClickUnsubscribe sends the POST request of RFC 8058. It carries
+// no cookies or credentials, redirects are not followed, and it only
+// connects to public addresses.
+func postOneClickUnsubscribe(ctx context.Context, uri string) error {
+	ctx, cancel := context.WithTimeout(ctx, gmailUnsubscribeTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, strings.NewReader("List-Unsubscribe=One-Click"))
+	if err != nil {
+		return fmt.Errorf("invalid unsubscribe URL: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	client := &http.Client{
+		Transport: unsubscribeTransport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unsubscribe request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("unsubscribe request failed: %s", resp.Status)
+	}
+	return nil
+}
+
+// mailtoAddress returns the address in the path of a mailto URI, which must
+// hold exactly one.
+func mailtoAddress(uri string) (string, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return "", fmt.Errorf("invalid mailto URI: %v", err)
+	}
+	to, err := url.PathUnescape(parsed.Opaque)
+	if err != nil {
+		return "", fmt.Errorf("invalid mailto URI: %v", err)
+	}
+	addresses, err := email.ParseAddressList(to)
+	if err != nil {
+		return "", err
+	}
+	if len(addresses) != 1 {
+		return "", fmt.Errorf("mailto URI %s must have exactly one address", uri)
+	}
+	return strings.ToLower(addresses[0].Address), nil
+}
+
+// sendMailtoUnsubscribe sends the message a mailto URI (RFC 6068)
+// describes, with "unsubscribe" as subject and body when it gives none.
+func sendMailtoUnsubscribe(ctx context.Context, uri string, from func() (*mail.Address, error)) error {
+	to, err := mailtoAddress(uri)
+	if err != nil {
+		return err
+	}
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return fmt.Errorf("invalid mailto URI: %v", err)
+	}
+
+	// The to, cc and bcc fields are ignored: they could make the user's
+	// account mail anyone the sender picks.
+	message := &email.Message{To: []*mail.Address{{Address: to}}, Subject: "unsubscribe", Text: "unsubscribe"}
+	for key, values := range parsed.Query() {
+		switch strings.ToLower(key) {
+		case "subject":
+			if values[0] != "" {
+				message.Subject = values[0]
+			}
+		case "body":
+			if values[0] != "" {
+				message.Text = values[0]
+			}
+		}
+	}
+
+	if message.From, err = from(); err != nil {
+		return err
+	}
+
+	raw, err := message.Bytes()
+	if err != nil {
+		return fmt.Errorf("failed to build email: %v", err)
+	}
+	if _, err := sendGmailMessage(ctx, raw, ""); err != nil {
+		return fmt.Errorf("failed to send unsubscribe email: %v", err)
+	}
+	return nil
+}
+
+// createUnsubscribeFilters creates a filter per sender applying action to
+// its future mail, unless a filter from that sender already does.
+func createUnsubscribeFilters(ctx context.Context, senders []*gmailUnsubscribeSender, action string, dryRun bool) {
+	existing, err := gmailService().Users.Settings.Filters.List("me").Context(ctx).Do()
+	if err != nil {
+		for _, sender := range senders {
+			sender.report["filter"] = fmt.Sprintf("failed to list filters: %v", err)
+		}
+		return
+	}
+
+	want := gmailUnsubscribeFilters[action]
+	for _, sender := range senders {
+		if id := findUnsubscribeFilter(existing.Filter, sender.address, want); id != "" {
+			sender.report["filter"] = "exists: " + id
+			continue
+		}
+		if dryRun {
+			sender.report["filter"] = "would " + action
+			continue
+		}
+
+		created, err := gmailService().Users.Settings.Filters.Create("me", &gmail.Filter{
+			Criteria: &gmail.FilterCriteria{From: sender.address},
+			Action:   want,
+		}).Context(ctx).Do()
+		if err != nil {
+			sender.report["filter"] = fmt.Sprintf("failed: %v", err)
+			continue
+		}
+		sender.report["filter"] = "created: " + created.Id
+	}
+}
+
+// findUnsubscribeFilter returns the ID of a filter matching only mail from
+// address that already does what action does.
+func findUnsubscribeFilter(filters []*gmail.Filter, address string, action *gmail.FilterAction) string {
+	for _, filter := range filters {
+		if filter.Criteria == nil || filter.Action == nil || !strings.EqualFold(filter.Criteria.From, address) {
+			continue
+		}
+		criteria := *filter.Criteria
+		criteria.From = ""
+		if !reflect.DeepEqual(criteria, gmail.FilterCriteria{}) {
+			continue
+		}
+		if containsAll(filter.Action.AddLabelIds, action.AddLabelIds) && containsAll(filter.Action.RemoveLabelIds, action.RemoveLabelIds) {
+			return filter.Id
+		}
+	}
+	return ""
+}
+
+// containsAll reports whether list contains every value of values.
+func containsAll(list, values []string) bool {
+	for _, value := range values {
+		found := false
+		for _, item := range list {
+			if item == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,217 @@
+package tools
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+func TestDkimPassed(t *testing.T) {
+	tests := []struct {
+		name    string
+		results string
+		domains []string
+		want    bool
+	}{
+		{"signed by the sender", "mx.google.com; dkim=pass header.i=@news.example.com header.s=s1 header.b=abc; spf=pass", []string{"news.example.com"}, true},
+		{"signed by the parent domain", "mx.google.com; dkim=pass header.d=example.com", []string{"news.example.com"}, true},
+		{"signed by a subdomain", "mx.google.com; dkim=pass header.i=@mail.example.com", []string{"example.com"}, true},
+		{"signed by the unsubscribe host", "mx.google.com; dkim=pass header.i=@esp.example.net", []string{"example.com", "links.esp.example.net"}, true},
+		{"signed by another domain", "mx.google.com; dkim=pass header.i=@attacker.example", []string{"example.com"}, false},
+		{"suffix that is not a subdomain", "mx.google.com; dkim=pass header.d=badexample.com", []string{"example.com"}, false},
+		{"failed signature", "mx.google.com; dkim=fail header.i=@example.com; spf=pass", []string{"example.com"}, false},
+		{"no signer", "mx.google.com; dkim=pass", []string{"example.com"}, false},
+		{"no results", "", []string{"example.com"}, false},
+		{"written by the sender", "mail.example.com; dkim=pass header.i=@example.com", []string{"example.com"}, false},
+		{"no authserv-id", "dkim=pass header.i=@example.com", []string{"example.com"}, false},
+		{"authserv-id with a version", "mx.google.com 1; dkim=pass header.d=example.com", []string{"example.com"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dkimPassed(tt.results, tt.domains...); got != tt.want {
+				t.Errorf("dkimPassed(%q, %q) = %v, want %v", tt.results, tt.domains, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPublicAddress(t *testing.T) {
+	tests := map[string]bool{
+		"93.184.216.34":          true,
+		"2606:2800:220:1::":      true,
+		"127.0.0.1":              false,
+		"::1":                    false,
+		"10.1.2.3":               false,
+		"172.16.0.1":             false,
+		"192.168.1.1":            false,
+		"169.254.169.254":        false,
+		"fe80::1":                false,
+		"fd00::1":                false,
+		"0.0.0.0":                false,
+		"::":                     false,
+		"224.0.0.1":              false,
+		"::ffff:127.0.0.1":       false,
+		"::ffff:169.254.169.254": false,
+		"0.1.2.3":                false,
+		"100.64.0.1":             false,
+		"100.100.100.200":        false,
+		"100.127.255.254":        false,
+		"100.128.0.1":            true,
+		"192.0.0.8":              false,
+		"192.0.1.1":              true,
+		"198.18.0.1":             false,
+		"198.19.255.254":         false,
+		"198.20.0.1":             true,
+		"240.0.0.1":              false,
+		"255.255.255.255":        false,
+		"64:ff9b::a9fe:a9fe":     false,
+		"64:ff9b:1::1":           false,
+	}
+
+	for address, want := range tests {
+		if got := publicAddress(netip.MustParseAddr(address)); got != want {
+			t.Errorf("publicAddress(%s) = %v, want %v", address, got, want)
+		}
+	}
+}
+
+func TestPostOneClickUnsubscribeRefusesLocalAddresses(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	defer server.Close()
+
+	err := postOneClickUnsubscribe(context.Background(), server.URL+"/unsubscribe")
+	if err == nil || !strings.Contains(err.Error(), "non-public address") {
+		t.Errorf("err = %v, want the local address refused", err)
+	}
+	if requests.Load() > 0 {
+		t.Error("the request reached the local server")
+	}
+}
+
+func TestSendMailtoUnsubscribeIgnoresExtraRecipients(t *testing.T) {
+	var sent []byte
+	fakeGoogle(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/gmail/v1/users/me/messages/send" {
+			http.NotFound(w, r)
+			return
+		}
+		var message gmail.Message
+		json.NewDecoder(r.Body).Decode(&message)
+		sent, _ = base64.URLEncoding.DecodeString(message.Raw)
+		writeJSON(w, gmail.Message{Id: "sent"})
+	}))
+
+	from := func() (*mail.Address, error) { return &mail.Address{Address: "me@example.org"}, nil }
+	uri := "mailto:unsubscribe@news.example.com?to=victim@other.example,second@other.example&cc=cc@other.example&bcc=bcc@other.example&subject=Stop"
+	if err := sendMailtoUnsubscribe(context.Background(), uri, from); err != nil {
+		t.Fatal(err)
+	}
+
+	message, err := mail.ReadMessage(strings.NewReader(string(sent)))
+	if err != nil {
+		t.Fatalf("sent message does not parse: %v", err)
+	}
+	if to := message.Header.Get("To"); to != "<unsubscribe@news.example.com>" {
+		t.Errorf("To = %q, want only the address in the mailto path", to)
+	}
+	if strings.Contains(string(sent), "other.example") {
+		t.Errorf("sent message mentions the extra recipients:\n%s", sent)
+	}
+	if subject := message.Header.Get("Subject"); subject != "Stop" {
+		t.Errorf("Subject = %q, want %q", subject, "Stop")
+	}
+}
+
+func TestGmailUnsubscribeSendersMailto(t *testing.T) {
+	tests := []struct {
+		name       string
+		mailto     string
+		wantMethod string
+	}{
+		{"sender's domain", "mailto:leave@news.example.com", "mailto"},
+		{"parent domain", "mailto:leave@example.com?subject=unsubscribe", "mailto"},
+		{"another domain", "mailto:leave@other.example", "none"},
+		{"extra to addresses", "mailto:leave@news.example.com,victim@other.example", "none"},
+		{"no address", "mailto:?to=leave@news.example.com", "none"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := &gmail.Message{Id: "m1", Payload: &gmail.MessagePart{Headers: []*gmail.MessagePartHeader{
+				{Name: "From", Value: "News <news@news.example.com>"},
+				{Name: "List-Unsubscribe", Value: "<" + tt.mailto + ">"},
+				{Name: "Authentication-Results", Value: "mx.google.com; dkim=pass header.i=@news.example.com"},
+			}}}
+
+			senders := gmailUnsubscribeSenders([]*gmail.Message{message})
+			if len(senders) != 1 {
+				t.Fatalf("%d senders, want 1", len(senders))
+			}
+			if method := senders[0].report["method"]; method != tt.wantMethod {
+				t.Errorf("method = %v, want %s (report %v)", method, tt.wantMethod, senders[0].report)
+			}
+		})
+	}
+}
+
+func TestGmailUnsubscribeSendersForgedAuthenticationResults(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []*gmail.MessagePartHeader
+		want    string
+	}{
+		{
+			// An imported message carries only the header its sender
+			// wrote.
+			name: "imported message",
+			headers: []*gmail.MessagePartHeader{
+				{Name: "Authentication-Results", Value: "relay.example.com; dkim=pass header.i=@news.example.com"},
+			},
+			want: "none",
+		},
+		{
+			name: "forged header below Gmail's",
+			headers: []*gmail.MessagePartHeader{
+				{Name: "Authentication-Results", Value: "mx.google.com; dkim=fail header.i=@news.example.com"},
+				{Name: "Authentication-Results", Value: "mx.google.com; dkim=pass header.i=@news.example.com"},
+			},
+			want: "none",
+		},
+		{
+			name: "Gmail's header",
+			headers: []*gmail.MessagePartHeader{
+				{Name: "Authentication-Results", Value: "mx.google.com; dkim=pass header.i=@news.example.com"},
+			},
+			want: "one-click",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := append(tt.headers,
+				&gmail.MessagePartHeader{Name: "From", Value: "news@news.example.com"},
+				&gmail.MessagePartHeader{Name: "List-Unsubscribe", Value: "<https://news.example.com/u/1>"},
+				&gmail.MessagePartHeader{Name: "List-Unsubscribe-Post", Value: "List-Unsubscribe=One-Click"},
+			)
+			message := &gmail.Message{Id: "m1", Payload: &gmail.MessagePart{Headers: headers}}
+
+			senders := gmailUnsubscribeSenders([]*gmail.Message{message})
+			if method := senders[0].report["method"]; method != tt.want {
+				t.Errorf("method = %v, want %s (report %v)", method, tt.want, senders[0].report)
+			}
+		})
+	}
+}
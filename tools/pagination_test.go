@@ -0,0 +1,193 @@
+package tools
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nguyenvanduocit/google-kit/util"
+)
+
+// listTest is a call of a list handler against a fake listing of numbered
+// items, with the range of items and the next_page_token it should return.
+type listTest struct {
+	name      string
+	arguments map[string]interface{}
+	wantFirst int
+	wantLen   int
+	wantNext  string
+}
+
+func runListTests(t *testing.T, tests []listTest, call func(arguments map[string]interface{}) map[string]interface{}, items string, id func(item interface{}) string) {
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := call(tt.arguments)
+
+			list, _ := result[items].([]interface{})
+			if len(list) != tt.wantLen {
+				t.Fatalf("got %d %s, want %d", len(list), items, tt.wantLen)
+			}
+			for i, item := range list {
+				if got, want := id(item), fmt.Sprint(tt.wantFirst+i); got != want {
+					t.Fatalf("%s %d has ID %s, want %s", items, i, got, want)
+				}
+			}
+			if next, _ := result["next_page_token"].(string); next != tt.wantNext {
+				t.Errorf("next_page_token = %q, want %q", next, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestGmailSearchPagination(t *testing.T) {
+	const total = 1200
+
+	fakeGoogle(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/gmail/v1/users/me/messages":
+			start, end, next := fakePage(r, "maxResults", total)
+			messages := make([]map[string]string, 0, end-start)
+			for i := start; i < end; i++ {
+				messages = append(messages, map[string]string{"id": fmt.Sprint(i)})
+			}
+			writeJSON(w, map[string]interface{}{"messages": messages, "nextPageToken": next})
+		case strings.HasPrefix(r.URL.Path, "/gmail/v1/users/me/messages/"):
+			id := strings.TrimPrefix(r.URL.Path, "/gmail/v1/users/me/messages/")
+			writeJSON(w, map[string]interface{}{
+				"id":       id,
+				"threadId": "t" + id,
+				"payload":  map[string]interface{}{"headers": []map[string]string{{"name": "Subject", "value": "Message " + id}}},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	runListTests(t, []listTest{
+		{"default page size", map[string]interface{}{"query": "in:inbox"}, 0, 10, "10"},
+		{"page size", map[string]interface{}{"query": "in:inbox", "page_size": float64(50)}, 0, 50, "50"},
+		{"page token", map[string]interface{}{"query": "in:inbox", "page_token": "1190"}, 1190, 10, ""},
+		{"fetch all stops at the cap", map[string]interface{}{"query": "in:inbox", "page_size": float64(500), "fetch_all": true}, 0, util.MaxFetchAllItems, fmt.Sprint(util.MaxFetchAllItems)},
+		{"fetch all from a token", map[string]interface{}{"query": "in:inbox", "page_size": float64(500), "page_token": "1000", "fetch_all": true}, 1000, 200, ""},
+	}, func(arguments map[string]interface{}) map[string]interface{} {
+		result, err := gmailSearchHandler(arguments)
+		return resultYAML(t, result, err)
+	}, "emails", func(item interface{}) string {
+		return item.(map[string]interface{})["id"].(string)
+	})
+}
+
+func TestCalendarListEventsPagination(t *testing.T) {
+	const total = 30
+	start := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	var asked []string
+	fakeGoogle(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/calendars/primary/events" {
+			http.NotFound(w, r)
+			return
+		}
+		asked = append(asked, r.URL.Query().Get("maxResults"))
+
+		first, end, next := fakePage(r, "maxResults", total)
+		items := make([]map[string]interface{}, 0, end-first)
+		for i := first; i < end; i++ {
+			at := start.Add(time.Duration(i) * time.Hour)
+			items = append(items, map[string]interface{}{
+				"id":      fmt.Sprint(i),
+				"summary": fmt.Sprintf("Event %d", i),
+				"start":   map[string]string{"dateTime": at.Format(time.RFC3339)},
+				"end":     map[string]string{"dateTime": at.Add(30 * time.Minute).Format(time.RFC3339)},
+			})
+		}
+		writeJSON(w, map[string]interface{}{"items": items, "nextPageToken": next})
+	}))
+
+	runListTests(t, []listTest{
+		{"default page size", map[string]interface{}{}, 0, 10, "10"},
+		{"max_results sets the page size", map[string]interface{}{"max_results": float64(7)}, 0, 7, "7"},
+		{"page_size wins over max_results", map[string]interface{}{"max_results": float64(7), "page_size": float64(12)}, 0, 12, "12"},
+		{"page token", map[string]interface{}{"page_token": "25"}, 25, 5, ""},
+		{"fetch all", map[string]interface{}{"page_size": float64(8), "fetch_all": true}, 0, total, ""},
+	}, func(arguments map[string]interface{}) map[string]interface{} {
+		result, err := calendarListEventsHandler(arguments)
+		return resultYAML(t, result, err)
+	}, "events", func(item interface{}) string {
+		return item.(map[string]interface{})["id"].(string)
+	})
+
+	// The handler must not write page_size back into the caller's
+	// arguments.
+	arguments := map[string]interface{}{"max_results": float64(3)}
+	calendarListEventsHandler(arguments)
+	if _, ok := arguments["page_size"]; ok {
+		t.Error("calendarListEventsHandler modified its arguments")
+	}
+	if len(asked) == 0 || asked[len(asked)-1] != "3" {
+		t.Errorf("last page size asked = %v, want 3", asked)
+	}
+}
+
+func TestGChatListSpacesPagination(t *testing.T) {
+	const total = 2300
+
+	fakeGoogle(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/spaces" {
+			http.NotFound(w, r)
+			return
+		}
+		start, end, next := fakePage(r, "pageSize", total)
+		spaces := make([]map[string]string, 0, end-start)
+		for i := start; i < end; i++ {
+			spaces = append(spaces, map[string]string{"name": fmt.Sprintf("spaces/%d", i), "displayName": fmt.Sprint(i), "type": "ROOM"})
+		}
+		writeJSON(w, map[string]interface{}{"spaces": spaces, "nextPageToken": next})
+	}))
+
+	runListTests(t, []listTest{
+		{"default page size", map[string]interface{}{}, 0, 100, "100"},
+		{"page token", map[string]interface{}{"page_token": "2250"}, 2250, 50, ""},
+		{"fetch all stops at the cap", map[string]interface{}{"page_size": float64(1000), "fetch_all": true}, 0, util.MaxFetchAllItems, fmt.Sprint(util.MaxFetchAllItems)},
+		{"fetch all resumes", map[string]interface{}{"page_size": float64(1000), "page_token": "2000", "fetch_all": true}, 2000, 300, ""},
+	}, func(arguments map[string]interface{}) map[string]interface{} {
+		result, err := gChatListSpacesHandler(arguments)
+		return resultYAML(t, result, err)
+	}, "spaces", func(item interface{}) string {
+		return item.(map[string]interface{})["displayName"].(string)
+	})
+}
+
+func TestGChatDirectoryTruncated(t *testing.T) {
+	const total = util.MaxFetchAllItems + 5
+	t.Setenv("STATE_DIR", t.TempDir())
+	t.Cleanup(func() { cachedChatDirectory = nil })
+
+	fakeGoogle(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v1/spaces":
+			start, end, next := fakePage(r, "pageSize", total)
+			spaces := make([]map[string]string, 0, end-start)
+			for i := start; i < end; i++ {
+				spaces = append(spaces, map[string]string{"name": fmt.Sprintf("spaces/%d", i), "displayName": fmt.Sprint(i)})
+			}
+			writeJSON(w, map[string]interface{}{"spaces": spaces, "nextPageToken": next})
+		case strings.HasSuffix(r.URL.Path, "/members"):
+			writeJSON(w, map[string]interface{}{"memberships": []map[string]interface{}{
+				{"member": map[string]string{"name": "users/someone@example.com", "displayName": "Someone", "type": "HUMAN"}},
+			}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	result, err := gChatListUsersHandler(map[string]interface{}{"refresh": true})
+	decoded := resultYAML(t, result, err)
+	if decoded["truncated"] != true {
+		t.Errorf("truncated = %v, want true", decoded["truncated"])
+	}
+	if decoded["totalSpaces"] != util.MaxFetchAllItems {
+		t.Errorf("totalSpaces = %v, want %d", decoded["totalSpaces"], util.MaxFetchAllItems)
+	}
+}
@@ -0,0 +1,320 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/nguyenvanduocit/google-kit/services"
+	"google.golang.org/api/googleapi"
+	"gopkg.in/yaml.v3"
+)
+
+// RegisterGmailResources exposes Gmail labels as subscribable resources.
+func RegisterGmailResources(s *server.MCPServer, w *Watcher) {
+	inbox := mcp.NewResource("gmail://labels/INBOX", "Gmail inbox",
+		mcp.WithResourceDescription("Latest messages in the Gmail inbox"),
+		mcp.WithMIMEType("text/yaml"),
+	)
+	s.AddResource(inbox, gmailLabelResourceHandler)
+
+	label := mcp.NewResourceTemplate("gmail://labels/{label}", "Gmail label",
+		mcp.WithTemplateDescription("Latest messages carrying a Gmail label ID (e.g. INBOX, UNREAD, Label_123)"),
+		mcp.WithTemplateMIMEType("text/yaml"),
+	)
+	s.AddResourceTemplate(label, gmailLabelResourceHandler)
+
+	w.addSource("gmail://labels/{label}", gmailWatchSource{})
+}
+
+// RegisterCalendarResources exposes calendars as subscribable resources.
+func RegisterCalendarResources(s *server.MCPServer, w *Watcher) {
+	primary := mcp.NewResource("calendar://primary/events", "Primary calendar",
+		mcp.WithResourceDescription("Upcoming events in the primary calendar"),
+		mcp.WithMIMEType("text/yaml"),
+	)
+	s.AddResource(primary, calendarEventsResourceHandler)
+
+	events := mcp.NewResourceTemplate("calendar://{calendar}/events", "Calendar events",
+		mcp.WithTemplateDescription("Upcoming events in a calendar (calendar ID or email address)"),
+		mcp.WithTemplateMIMEType("text/yaml"),
+	)
+	s.AddResourceTemplate(events, calendarEventsResourceHandler)
+
+	w.addSource("calendar://{calendar}/events", calendarWatchSource{})
+}
+
+// RegisterGChatResources exposes Google Chat spaces as subscribable resources.
+func RegisterGChatResources(s *server.MCPServer, w *Watcher) {
+	messages := mcp.NewResourceTemplate("gchat://spaces/{space}/messages", "Chat space messages",
+		mcp.WithTemplateDescription("Latest messages in a Google Chat space (e.g. gchat://spaces/AAAA1234/messages)"),
+		mcp.WithTemplateMIMEType("text/yaml"),
+	)
+	s.AddResourceTemplate(messages, gChatMessagesResourceHandler)
+
+	w.addSource("gchat://spaces/{space}/messages", gChatWatchSource{})
+}
+
+// resourceSegment returns the path segment of uri that follows prefix,
+// e.g. resourceSegment("gmail://labels/INBOX", "gmail://labels/") is "INBOX".
+func resourceSegment(uri, prefix string) string {
+	rest := strings.TrimPrefix(uri, prefix)
+	if i := strings.Index(rest, "/"); i >= 0 {
+		rest = rest[:i]
+	}
+	return rest
+}
+
+func yamlResourceContents(uri string, v interface{}) ([]interface{}, error) {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal resource: %v", err)
+	}
+
+	return []interface{}{
+		mcp.TextResourceContents{
+			ResourceContents: mcp.ResourceContents{URI: uri, MIMEType: "text/yaml"},
+			Text:             string(data),
+		},
+	}, nil
+}
+
+// googleAPIStatus returns the HTTP status code of a Google API error, or 0.
+func googleAPIStatus(err error) int {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	return 0
+}
+
+func gmailLabelResourceHandler(request mcp.ReadResourceRequest) ([]interface{}, error) {
+	uri := request.Params.URI
+	labelID := resourceSegment(uri, "gmail://labels/")
+
+	resp, err := gmailService().Users.Messages.List("me").LabelIds(labelID).MaxResults(10).Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list messages: %v", err)
+	}
+
+	ids := make([]string, len(resp.Messages))
+	for i, msg := range resp.Messages {
+		ids[i] = msg.Id
+	}
+
+	emails := make([]map[string]interface{}, 0, len(ids))
+	messages, _ := fetchGmailSummaries(context.Background(), ids, nil)
+	for _, message := range messages {
+		if message != nil {
+			emails = append(emails, gmailSummary(message))
+		}
+	}
+
+	return yamlResourceContents(uri, map[string]interface{}{
+		"label":  labelID,
+		"emails": emails,
+	})
+}
+
+// gmailWatchSource uses the history ID of the mailbox as cursor and asks
+// users.history.list for changes to the watched label.
+type gmailWatchSource struct{}
+
+func (gmailWatchSource) Poll(ctx context.Context, uri string, cursor string) (bool, string, error) {
+	labelID := resourceSegment(uri, "gmail://labels/")
+
+	if cursor == "" {
+		profile, err := gmailService().Users.GetProfile("me").Context(ctx).Do()
+		if err != nil {
+			return false, "", fmt.Errorf("failed to get profile: %v", err)
+		}
+		return false, strconv.FormatUint(profile.HistoryId, 10), nil
+	}
+
+	startHistoryID, err := strconv.ParseUint(cursor, 10, 64)
+	if err != nil {
+		return false, "", nil
+	}
+
+	changed := false
+	next := cursor
+	pageToken := ""
+	for {
+		call := gmailService().Users.History.List("me").
+			StartHistoryId(startHistoryID).
+			LabelId(labelID).
+			Context(ctx)
+		if pageToken != "" {
+			call = call.PageToken(pageToken)
+		}
+
+		resp, err := call.Do()
+		if googleAPIStatus(err) == http.StatusNotFound {
+			// The history ID expired; start over from the current mailbox state.
+			profile, err := gmailService().Users.GetProfile("me").Context(ctx).Do()
+			if err != nil {
+				return false, cursor, fmt.Errorf("failed to get profile: %v", err)
+			}
+			return true, strconv.FormatUint(profile.HistoryId, 10), nil
+		}
+		if err != nil {
+			return false, cursor, fmt.Errorf("failed to list history: %v", err)
+		}
+
+		if len(resp.History) > 0 {
+			changed = true
+		}
+		if resp.HistoryId != 0 {
+			next = strconv.FormatUint(resp.HistoryId, 10)
+		}
+
+		if resp.NextPageToken == "" {
+			break
+		}
+		pageToken = resp.NextPageToken
+	}
+
+	return changed, next, nil
+}
+
+func calendarEventsResourceHandler(request mcp.ReadResourceRequest) ([]interface{}, error) {
+	uri := request.Params.URI
+	calendarID := resourceSegment(uri, "calendar://")
+
+	events, err := calendarService().Events.List(calendarID).
+		ShowDeleted(false).
+		SingleEvents(true).
+		TimeMin(time.Now().Format(time.RFC3339)).
+		TimeMax(time.Now().AddDate(0, 0, 7).Format(time.RFC3339)).
+		MaxResults(50).
+		OrderBy("startTime").
+		Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events: %v", err)
+	}
+
+	eventsList := make([]map[string]interface{}, 0, len(events.Items))
+	for _, item := range events.Items {
+		eventInfo := map[string]interface{}{
+			"id":      item.Id,
+			"summary": item.Summary,
+		}
+		if item.Start != nil {
+			eventInfo["start"] = item.Start.DateTime + item.Start.Date
+		}
+		if item.End != nil {
+			eventInfo["end"] = item.End.DateTime + item.End.Date
+		}
+		eventsList = append(eventsList, eventInfo)
+	}
+
+	return yamlResourceContents(uri, map[string]interface{}{
+		"calendar": calendarID,
+		"events":   eventsList,
+	})
+}
+
+// calendarWatchSource uses the Calendar incremental sync token as cursor.
+type calendarWatchSource struct{}
+
+func (calendarWatchSource) Poll(ctx context.Context, uri string, cursor string) (bool, string, error) {
+	calendarID := resourceSegment(uri, "calendar://")
+
+	changed := false
+	pageToken := ""
+	for {
+		call := calendarService().Events.List(calendarID).MaxResults(2500).Context(ctx)
+		if cursor != "" {
+			call = call.SyncToken(cursor)
+		}
+		if pageToken != "" {
+			call = call.PageToken(pageToken)
+		}
+
+		events, err := call.Do()
+		if cursor != "" && googleAPIStatus(err) == http.StatusGone {
+			// The sync token was invalidated; do a full sync and report a change.
+			_, next, err := calendarWatchSource{}.Poll(ctx, uri, "")
+			return err == nil, next, err
+		}
+		if err != nil {
+			return false, cursor, fmt.Errorf("failed to list events: %v", err)
+		}
+
+		if cursor != "" && len(events.Items) > 0 {
+			changed = true
+		}
+
+		if events.NextPageToken == "" {
+			return changed, events.NextSyncToken, nil
+		}
+		pageToken = events.NextPageToken
+	}
+}
+
+func gChatMessagesResourceHandler(request mcp.ReadResourceRequest) ([]interface{}, error) {
+	uri := request.Params.URI
+	spaceName := "spaces/" + resourceSegment(uri, "gchat://spaces/")
+
+	messages, err := services.DefaultGChatService().Spaces.Messages.List(spaceName).
+		OrderBy("createTime desc").
+		PageSize(25).
+		Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get messages: %v", err)
+	}
+
+	messagesList := make([]map[string]interface{}, 0, len(messages.Messages))
+	for _, msg := range messages.Messages {
+		messageInfo := map[string]interface{}{
+			"name":       msg.Name,
+			"createTime": msg.CreateTime,
+			"text":       msg.Text,
+		}
+		if msg.Sender != nil {
+			messageInfo["sender"] = msg.Sender.DisplayName
+		}
+		if msg.Thread != nil {
+			messageInfo["thread"] = msg.Thread.Name
+		}
+		messagesList = append(messagesList, messageInfo)
+	}
+
+	return yamlResourceContents(uri, map[string]interface{}{
+		"space":    spaceName,
+		"messages": messagesList,
+	})
+}
+
+// gChatWatchSource uses the createTime of the newest seen message as cursor.
+type gChatWatchSource struct{}
+
+func (gChatWatchSource) Poll(ctx context.Context, uri string, cursor string) (bool, string, error) {
+	spaceName := "spaces/" + resourceSegment(uri, "gchat://spaces/")
+
+	if cursor == "" {
+		return false, time.Now().UTC().Format(time.RFC3339Nano), nil
+	}
+
+	messages, err := services.DefaultGChatService().Spaces.Messages.List(spaceName).
+		Filter(fmt.Sprintf("createTime > %q", cursor)).
+		OrderBy("createTime desc").
+		PageSize(1).
+		Context(ctx).
+		Do()
+	if err != nil {
+		return false, cursor, fmt.Errorf("failed to list messages: %v", err)
+	}
+
+	if len(messages.Messages) == 0 {
+		return false, cursor, nil
+	}
+
+	return true, messages.Messages[0].CreateTime, nil
+}
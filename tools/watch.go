@@ -0,0 +1,248 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nguyenvanduocit/google-kit/util"
+)
+
+const watchCursorsState = "watch-cursors.json"
+
+// watchSource detects changes to a family of subscribable resources.
+type watchSource interface {
+	// Poll reports whether the resource changed since cursor and returns the
+	// cursor for the next poll. An empty cursor asks the source to establish a
+	// baseline without reporting a change.
+	Poll(ctx context.Context, uri string, cursor string) (changed bool, next string, err error)
+}
+
+type watchRoute struct {
+	pattern *regexp.Regexp
+	source  watchSource
+}
+
+type watchSubscription struct {
+	source   watchSource
+	failures int
+	nextPoll time.Time
+	// polling is set while a poll of the subscription is in flight.
+	polling bool
+}
+
+// Watcher polls subscribed resources in the background and emits
+// notifications/resources/updated when one of them changes. Each poll runs
+// on its own goroutine, so a slow source does not delay the others.
+//
+// It is configured with WATCH_INTERVAL (poll interval, default 1m),
+// WATCH_MAX_BACKOFF (upper bound for the retry delay after failures,
+// default 15m) and WATCH_PERSIST_CURSORS (set to false to keep sync cursors
+// in memory only).
+type Watcher struct {
+	stdio      *util.StdioServer
+	interval   time.Duration
+	maxBackoff time.Duration
+	persist    bool
+
+	mu            sync.Mutex
+	routes        []watchRoute
+	subscriptions map[string]*watchSubscription
+	cursors       map[string]string
+
+	// saveMu serializes writes of the cursors file.
+	saveMu sync.Mutex
+}
+
+// NewWatcher creates a watcher that sends its notifications through stdio.
+func NewWatcher(stdio *util.StdioServer) *Watcher {
+	w := &Watcher{
+		stdio:         stdio,
+		interval:      durationFromEnv("WATCH_INTERVAL", time.Minute),
+		maxBackoff:    durationFromEnv("WATCH_MAX_BACKOFF", 15*time.Minute),
+		persist:       os.Getenv("WATCH_PERSIST_CURSORS") != "false",
+		subscriptions: make(map[string]*watchSubscription),
+		cursors:       make(map[string]string),
+	}
+
+	if w.persist {
+		if err := util.LoadState(watchCursorsState, &w.cursors); err != nil {
+			log.Printf("Failed to load watch cursors: %v", err)
+		}
+	}
+
+	return w
+}
+
+// addSource routes subscriptions whose URI matches the template (using the
+// same {name} placeholders as resource templates) to source.
+func (w *Watcher) addSource(uriTemplate string, source watchSource) {
+	pattern := regexp.QuoteMeta(uriTemplate)
+	pattern = regexp.MustCompile(`\\\{[^}]+\\\}`).ReplaceAllString(pattern, `([^/]+)`)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.routes = append(w.routes, watchRoute{
+		pattern: regexp.MustCompile("^" + pattern + "$"),
+		source:  source,
+	})
+}
+
+// Subscribe starts watching uri. It implements util.SubscriptionHandler.
+func (w *Watcher) Subscribe(uri string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, ok := w.subscriptions[uri]; ok {
+		return nil
+	}
+
+	for _, route := range w.routes {
+		if route.pattern.MatchString(uri) {
+			w.subscriptions[uri] = &watchSubscription{source: route.source}
+			return nil
+		}
+	}
+
+	return fmt.Errorf("resource %s does not support subscriptions", uri)
+}
+
+// Unsubscribe stops watching uri. Its cursor is kept so a later subscription
+// resumes where this one stopped.
+func (w *Watcher) Unsubscribe(uri string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	delete(w.subscriptions, uri)
+	return nil
+}
+
+// Run polls due subscriptions until ctx is cancelled, then waits for the
+// polls in flight to return.
+func (w *Watcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for uri, sub := range w.due(now) {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					w.poll(ctx, uri, sub)
+				}()
+			}
+		}
+	}
+}
+
+func (w *Watcher) due(now time.Time) map[string]*watchSubscription {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	due := make(map[string]*watchSubscription)
+	for uri, sub := range w.subscriptions {
+		if !sub.polling && !now.Before(sub.nextPoll) {
+			sub.polling = true
+			due[uri] = sub
+		}
+	}
+	return due
+}
+
+func (w *Watcher) poll(ctx context.Context, uri string, sub *watchSubscription) {
+	w.mu.Lock()
+	cursor := w.cursors[uri]
+	w.mu.Unlock()
+
+	changed, next, err := safePoll(ctx, sub.source, uri, cursor)
+
+	w.mu.Lock()
+	sub.polling = false
+	if err != nil {
+		sub.failures++
+		delay := w.interval << min(sub.failures, 16)
+		if delay <= 0 || delay > w.maxBackoff {
+			delay = w.maxBackoff
+		}
+		sub.nextPoll = time.Now().Add(delay)
+		w.mu.Unlock()
+		log.Printf("Failed to poll %s (retrying in %s): %v", uri, delay, err)
+		return
+	}
+
+	sub.failures = 0
+	sub.nextPoll = time.Now().Add(w.interval)
+	cursorChanged := next != cursor
+	w.cursors[uri] = next
+	w.mu.Unlock()
+
+	if cursorChanged && w.persist {
+		w.saveCursors()
+	}
+
+	if changed {
+		if err := w.stdio.SendNotification("notifications/resources/updated", map[string]string{"uri": uri}); err != nil {
+			log.Printf("Failed to notify update of %s: %v", uri, err)
+		}
+	}
+}
+
+// safePoll turns a panic in a source (e.g. a service that cannot be
+// initialized) into an error so it does not take down the server.
+func safePoll(ctx context.Context, source watchSource, uri, cursor string) (changed bool, next string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			changed, next, err = false, cursor, fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return source.Poll(ctx, uri, cursor)
+}
+
+func (w *Watcher) saveCursors() {
+	// Polls finish concurrently; holding saveMu from the copy to the write
+	// keeps an older copy from replacing a newer one.
+	w.saveMu.Lock()
+	defer w.saveMu.Unlock()
+
+	w.mu.Lock()
+	cursors := make(map[string]string, len(w.cursors))
+	for uri, cursor := range w.cursors {
+		cursors[uri] = cursor
+	}
+	w.mu.Unlock()
+
+	if err := util.SaveState(watchCursorsState, cursors); err != nil {
+		log.Printf("Failed to save watch cursors: %v", err)
+	}
+}
+
+// durationFromEnv parses a Go duration (e.g. "90s") or a number of seconds
+// from the named environment variable.
+func durationFromEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		return d
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	log.Printf("Invalid %s %q, using %s", name, value, fallback)
+	return fallback
+}
@@ -0,0 +1,64 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// SafeFilename turns an untrusted name, such as an attachment file name,
+// into a single path element: directories, control characters and
+// characters that are invalid on common file systems are removed, and
+// leading dots are dropped so the file is neither hidden nor "..".
+func SafeFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsControl(r):
+			return -1
+		case strings.ContainsRune(`<>:"/\|?*`, r):
+			return '_'
+		}
+		return r
+	}, name)
+
+	name = strings.TrimLeft(strings.TrimSpace(name), ".")
+	if len(name) > 200 {
+		ext := filepath.Ext(name)
+		if len(ext) > 20 {
+			ext = ""
+		}
+		name = strings.ToValidUTF8(name[:200-len(ext)], "") + ext
+	}
+
+	if name == "" {
+		return "unnamed"
+	}
+	return name
+}
+
+// UniquePath returns a path in dir for the file name that does not exist
+// yet, adding " (1)", " (2)", ... before the extension when needed. The
+// name is passed through SafeFilename, so the result is always inside dir.
+func UniquePath(dir, name string) (string, error) {
+	name = SafeFilename(name)
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	for i := 0; i < 1000; i++ {
+		candidate := name
+		if i > 0 {
+			candidate = fmt.Sprintf("%s (%d)%s", base, i, ext)
+		}
+
+		path := filepath.Join(dir, candidate)
+		if _, err := os.Lstat(path); os.IsNotExist(err) {
+			return path, nil
+		}
+	}
+
+	return "", fmt.Errorf("too many files named %s in %s", name, dir)
+}
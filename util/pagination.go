@@ -0,0 +1,128 @@
+package util
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// MaxFetchAllItems is the hard cap on the number of items a fetch_all request
+// returns. When it is reached the result carries a next_page_token so the
+// caller can continue.
+const MaxFetchAllItems = 1000
+
+// Page holds the pagination arguments shared by all list tools.
+type Page struct {
+	Size     int64
+	Token    string
+	FetchAll bool
+}
+
+// WithPagination adds the page_size, page_token and fetch_all arguments to a
+// list tool.
+func WithPagination(defaultSize int64) mcp.ToolOption {
+	return func(tool *mcp.Tool) {
+		mcp.WithNumber("page_size", mcp.Description(fmt.Sprintf("Maximum number of items per page (default: %d)", defaultSize)))(tool)
+		mcp.WithString("page_token", mcp.Description("Opaque token from a previous response's next_page_token to fetch the next page"))(tool)
+		mcp.WithBoolean("fetch_all", mcp.Description(fmt.Sprintf("Fetch every page, up to %d items", MaxFetchAllItems)))(tool)
+	}
+}
+
+// PageFromArguments reads the pagination arguments, clamping page_size to
+// [1, maxSize].
+func PageFromArguments(arguments map[string]interface{}, defaultSize, maxSize int64) Page {
+	page := Page{Size: defaultSize}
+
+	if size, ok := arguments["page_size"].(float64); ok && size > 0 {
+		page.Size = int64(size)
+	}
+	if page.Size > maxSize {
+		page.Size = maxSize
+	}
+
+	page.Token, _ = arguments["page_token"].(string)
+	page.FetchAll, _ = arguments["fetch_all"].(bool)
+
+	return page
+}
+
+// Paginate fetches one page, or every page up to MaxFetchAllItems when
+// FetchAll is set, and returns the items with the token to resume from
+// (empty once the listing is exhausted). fetch is called with the page token
+// and the number of items to ask for.
+func Paginate[T any](page Page, fetch func(pageToken string, pageSize int64) ([]T, string, error)) ([]T, string, error) {
+	if !page.FetchAll {
+		return fetch(page.Token, page.Size)
+	}
+
+	var all []T
+	token := page.Token
+	for {
+		// Never ask for more than the cap allows so the returned token
+		// resumes exactly after the last returned item.
+		size := min(page.Size, int64(MaxFetchAllItems-len(all)))
+
+		items, next, err := fetch(token, size)
+		if err != nil {
+			return all, token, err
+		}
+
+		all = append(all, items...)
+		token = next
+
+		if token == "" || len(all) >= MaxFetchAllItems {
+			return all, token, nil
+		}
+	}
+}
+
+// PaginateSlice applies the pagination contract to an API that returns
+// everything at once. Its page tokens encode an offset into items.
+func PaginateSlice[T any](page Page, items []T) ([]T, string, error) {
+	offset := 0
+	if page.Token != "" {
+		var err error
+		offset, err = decodeOffsetToken(page.Token)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	size := int(page.Size)
+	if page.FetchAll {
+		size = MaxFetchAllItems
+	}
+
+	if offset >= len(items) {
+		return []T{}, "", nil
+	}
+
+	end := min(offset+size, len(items))
+	next := ""
+	if end < len(items) {
+		next = encodeOffsetToken(end)
+	}
+
+	return items[offset:end], next, nil
+}
+
+func encodeOffsetToken(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("offset:" + strconv.Itoa(offset)))
+}
+
+func decodeOffsetToken(token string) (int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || !strings.HasPrefix(string(data), "offset:") {
+		return 0, fmt.Errorf("invalid page_token")
+	}
+
+	offset, err := strconv.Atoi(strings.TrimPrefix(string(data), "offset:"))
+	if err != nil || offset < 0 {
+		return 0, fmt.Errorf("invalid page_token")
+	}
+
+	return offset, nil
+}
@@ -0,0 +1,247 @@
+package util
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+)
+
+// fakeListing is an API listing total numbered items, whose page tokens are
+// the offset of the next item. It records the page sizes asked for.
+type fakeListing struct {
+	total int
+	sizes []int64
+	// failAt makes the call at that index fail, when not negative.
+	failAt int
+}
+
+func (l *fakeListing) fetch(pageToken string, pageSize int64) ([]int, string, error) {
+	if len(l.sizes) == l.failAt {
+		l.sizes = append(l.sizes, pageSize)
+		return nil, "", errors.New("unavailable")
+	}
+	l.sizes = append(l.sizes, pageSize)
+
+	offset := 0
+	if pageToken != "" {
+		offset, _ = strconv.Atoi(pageToken)
+	}
+	end := min(offset+int(pageSize), l.total)
+
+	items := make([]int, 0, end-offset)
+	for i := offset; i < end; i++ {
+		items = append(items, i)
+	}
+	next := ""
+	if end < l.total {
+		next = strconv.Itoa(end)
+	}
+	return items, next, nil
+}
+
+func TestPageFromArguments(t *testing.T) {
+	tests := []struct {
+		name      string
+		arguments map[string]interface{}
+		want      Page
+	}{
+		{"defaults", map[string]interface{}{}, Page{Size: 10}},
+		{"page size", map[string]interface{}{"page_size": float64(25)}, Page{Size: 25}},
+		{"clamped to max", map[string]interface{}{"page_size": float64(5000)}, Page{Size: 100}},
+		{"zero ignored", map[string]interface{}{"page_size": float64(0)}, Page{Size: 10}},
+		{"token and fetch all", map[string]interface{}{"page_token": "abc", "fetch_all": true}, Page{Size: 10, Token: "abc", FetchAll: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PageFromArguments(tt.arguments, 10, 100); got != tt.want {
+				t.Errorf("PageFromArguments() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	tests := []struct {
+		name      string
+		total     int
+		page      Page
+		failAt    int
+		wantFirst int
+		wantLen   int
+		wantNext  string
+		wantSizes []int64
+		wantErr   bool
+	}{
+		{
+			name:      "first page",
+			total:     25,
+			page:      Page{Size: 10},
+			wantLen:   10,
+			wantNext:  "10",
+			wantSizes: []int64{10},
+		},
+		{
+			name:      "page token resumes",
+			total:     25,
+			page:      Page{Size: 10, Token: "20"},
+			wantFirst: 20,
+			wantLen:   5,
+			wantNext:  "",
+			wantSizes: []int64{10},
+		},
+		{
+			name:      "fetch all",
+			total:     25,
+			page:      Page{Size: 10, FetchAll: true},
+			wantLen:   25,
+			wantNext:  "",
+			wantSizes: []int64{10, 10, 10},
+		},
+		{
+			name:      "fetch all from a token",
+			total:     25,
+			page:      Page{Size: 10, Token: "5", FetchAll: true},
+			wantFirst: 5,
+			wantLen:   20,
+			wantNext:  "",
+			wantSizes: []int64{10, 10},
+		},
+		{
+			name:      "fetch all stops at the cap",
+			total:     2500,
+			page:      Page{Size: 300, FetchAll: true},
+			wantLen:   MaxFetchAllItems,
+			wantNext:  strconv.Itoa(MaxFetchAllItems),
+			wantSizes: []int64{300, 300, 300, 100},
+		},
+		{
+			name:      "error keeps the token to resume from",
+			total:     25,
+			page:      Page{Size: 10, FetchAll: true},
+			failAt:    1,
+			wantLen:   10,
+			wantNext:  "10",
+			wantSizes: []int64{10, 10},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failAt := -1
+			if tt.failAt > 0 {
+				failAt = tt.failAt
+			}
+			listing := &fakeListing{total: tt.total, failAt: failAt}
+
+			items, next, err := Paginate(tt.page, listing.fetch)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Paginate() error = %v, want error %v", err, tt.wantErr)
+			}
+			if len(items) != tt.wantLen {
+				t.Fatalf("Paginate() returned %d items, want %d", len(items), tt.wantLen)
+			}
+			for i, item := range items {
+				if item != tt.wantFirst+i {
+					t.Fatalf("item %d = %d, want %d", i, item, tt.wantFirst+i)
+				}
+			}
+			if next != tt.wantNext {
+				t.Errorf("Paginate() next token = %q, want %q", next, tt.wantNext)
+			}
+			if !equalSizes(listing.sizes, tt.wantSizes) {
+				t.Errorf("page sizes asked = %v, want %v", listing.sizes, tt.wantSizes)
+			}
+		})
+	}
+}
+
+// TestPaginateRoundTrip follows next tokens until the listing is exhausted
+// and checks every item is returned exactly once.
+func TestPaginateRoundTrip(t *testing.T) {
+	listing := &fakeListing{total: 2345, failAt: -1}
+
+	var all []int
+	page := Page{Size: 400, FetchAll: true}
+	for calls := 0; ; calls++ {
+		if calls > 10 {
+			t.Fatal("pagination did not terminate")
+		}
+		items, next, err := Paginate(page, listing.fetch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items) > MaxFetchAllItems {
+			t.Fatalf("returned %d items, over the cap", len(items))
+		}
+		all = append(all, items...)
+		if next == "" {
+			break
+		}
+		page.Token = next
+	}
+
+	if len(all) != listing.total {
+		t.Fatalf("got %d items, want %d", len(all), listing.total)
+	}
+	for i, item := range all {
+		if item != i {
+			t.Fatalf("item %d = %d", i, item)
+		}
+	}
+}
+
+func TestPaginateSlice(t *testing.T) {
+	items := make([]int, 1500)
+	for i := range items {
+		items[i] = i
+	}
+
+	tests := []struct {
+		name      string
+		page      Page
+		wantFirst int
+		wantLen   int
+		wantNext  string
+		wantErr   bool
+	}{
+		{"first page", Page{Size: 100}, 0, 100, encodeOffsetToken(100), false},
+		{"page token resumes", Page{Size: 100, Token: encodeOffsetToken(1450)}, 1450, 50, "", false},
+		{"fetch all stops at the cap", Page{Size: 100, FetchAll: true}, 0, MaxFetchAllItems, encodeOffsetToken(MaxFetchAllItems), false},
+		{"fetch all from a token", Page{Size: 100, Token: encodeOffsetToken(1000), FetchAll: true}, 1000, 500, "", false},
+		{"offset past the end", Page{Size: 100, Token: encodeOffsetToken(5000)}, 0, 0, "", false},
+		{"invalid token", Page{Size: 100, Token: "not-a-token"}, 0, 0, "", true},
+		{"negative offset", Page{Size: 100, Token: encodeOffsetToken(-1)}, 0, 0, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, next, err := PaginateSlice(tt.page, items)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("PaginateSlice() error = %v, want error %v", err, tt.wantErr)
+			}
+			if len(got) != tt.wantLen {
+				t.Fatalf("PaginateSlice() returned %d items, want %d", len(got), tt.wantLen)
+			}
+			if len(got) > 0 && got[0] != tt.wantFirst {
+				t.Errorf("first item = %d, want %d", got[0], tt.wantFirst)
+			}
+			if next != tt.wantNext {
+				t.Errorf("PaginateSlice() next token = %q, want %q", next, tt.wantNext)
+			}
+		})
+	}
+}
+
+func equalSizes(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,121 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// requestArgument is the hidden tool argument through which the stdio
+// transport tells a handler which in-flight request it is serving, since
+// server.ToolHandlerFunc only receives the arguments.
+const requestArgument = "_request"
+
+// Request carries the per-call state of a tool invocation: a context that is
+// cancelled on notifications/cancelled and the client's progress token.
+type Request struct {
+	ctx           context.Context
+	cancel        context.CancelFunc
+	id            string
+	progressToken mcp.ProgressToken
+	notify        func(method string, params interface{}) error
+	report        func(done, total int, message string)
+}
+
+var (
+	requestSeq     atomic.Int64
+	requestsByKey  sync.Map // argument key -> *Request
+	requestsByID   sync.Map // JSON-RPC id -> *Request
+	backgroundCall = &Request{ctx: context.Background()}
+)
+
+// RequestFromArguments returns the request a tool handler is serving.
+// Handlers invoked without the stdio transport get a request whose context
+// is never cancelled and which does not report progress.
+func RequestFromArguments(arguments map[string]interface{}) *Request {
+	key, _ := arguments[requestArgument].(string)
+	if key == "" {
+		return backgroundCall
+	}
+
+	if request, ok := requestsByKey.Load(key); ok {
+		return request.(*Request)
+	}
+
+	return backgroundCall
+}
+
+// NewRequest returns a request for work started outside of a tool call,
+// such as a command line subcommand. report, if not nil, receives progress.
+func NewRequest(ctx context.Context, report func(done, total int, message string)) *Request {
+	return &Request{ctx: ctx, report: report}
+}
+
+// Context returns the context of the request.
+func (r *Request) Context() context.Context {
+	return r.ctx
+}
+
+// Cancelled reports whether the client cancelled the request.
+func (r *Request) Cancelled() bool {
+	return r.ctx.Err() != nil
+}
+
+// Progress sends a notifications/progress message when the client asked for
+// progress by sending a progress token, or passes it to the report function
+// of a request from NewRequest. total may be 0 when unknown.
+func (r *Request) Progress(done, total int, message string) {
+	if r.report != nil {
+		r.report(done, total, message)
+		return
+	}
+	if r.progressToken == nil || r.notify == nil {
+		return
+	}
+
+	params := map[string]interface{}{
+		"progressToken": r.progressToken,
+		"progress":      done,
+	}
+	if total > 0 {
+		params["total"] = total
+	}
+	if message != "" {
+		params["message"] = message
+	}
+
+	_ = r.notify("notifications/progress", params)
+}
+
+// beginRequest registers an in-flight tool call and returns the key to pass
+// in the hidden request argument together with a function that releases it.
+func beginRequest(ctx context.Context, id interface{}, progressToken mcp.ProgressToken, notify func(string, interface{}) error) (string, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	request := &Request{
+		ctx:           ctx,
+		cancel:        cancel,
+		id:            fmt.Sprint(id),
+		progressToken: progressToken,
+		notify:        notify,
+	}
+
+	key := fmt.Sprintf("req-%d", requestSeq.Add(1))
+	requestsByKey.Store(key, request)
+	requestsByID.Store(request.id, request)
+
+	return key, func() {
+		cancel()
+		requestsByKey.Delete(key)
+		requestsByID.CompareAndDelete(request.id, request)
+	}
+}
+
+// cancelRequest cancels the in-flight request with the given JSON-RPC id.
+func cancelRequest(id interface{}) {
+	if request, ok := requestsByID.Load(fmt.Sprint(id)); ok {
+		request.(*Request).cancel()
+	}
+}
@@ -0,0 +1,59 @@
+package util
+
+import (
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// WithArray adds an array argument whose elements follow the items schema,
+// e.g. {"type": "string"}. The mcp package only has helpers for scalars.
+func WithArray(name string, items map[string]interface{}, opts ...mcp.PropertyOption) mcp.ToolOption {
+	return func(t *mcp.Tool) {
+		schema := map[string]interface{}{
+			"type":  "array",
+			"items": items,
+		}
+
+		for _, opt := range opts {
+			opt(schema)
+		}
+
+		if required, ok := schema["required"].(bool); ok && required {
+			delete(schema, "required")
+			t.InputSchema.Required = append(t.InputSchema.Required, name)
+		}
+
+		t.InputSchema.Properties[name] = schema
+	}
+}
+
+// StringsFromArguments reads an array-of-strings argument. A single
+// comma-separated string is accepted too, since clients often send one.
+// Empty items are dropped.
+func StringsFromArguments(arguments map[string]interface{}, name string) []string {
+	var values []string
+
+	switch value := arguments[name].(type) {
+	case string:
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				values = append(values, item)
+			}
+		}
+	case []string:
+		for _, item := range value {
+			if item = strings.TrimSpace(item); item != "" {
+				values = append(values, item)
+			}
+		}
+	case []interface{}:
+		for _, item := range value {
+			if s, ok := item.(string); ok && strings.TrimSpace(s) != "" {
+				values = append(values, strings.TrimSpace(s))
+			}
+		}
+	}
+
+	return values
+}
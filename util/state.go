@@ -0,0 +1,112 @@
+package util
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// StateDir returns the directory used to persist local state such as sync
+// cursors and caches. It defaults to <user cache dir>/google-kit and can be
+// overridden with the STATE_DIR environment variable.
+func StateDir() (string, error) {
+	dir := os.Getenv("STATE_DIR")
+	if dir == "" {
+		cacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve state directory: %v", err)
+		}
+		dir = filepath.Join(cacheDir, "google-kit")
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("failed to create state directory: %v", err)
+	}
+
+	return dir, nil
+}
+
+// LoadState decodes the JSON state file with the given name into v.
+// A missing file is not an error and leaves v untouched.
+func LoadState(name string, v interface{}) error {
+	dir, err := StateDir()
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read state %s: %v", name, err)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to decode state %s: %v", name, err)
+	}
+
+	return nil
+}
+
+// SaveState writes v as JSON to the state file with the given name. The file
+// is replaced atomically so a crash never leaves a truncated state behind.
+func SaveState(name string, v interface{}) error {
+	dir, err := StateDir()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state %s: %v", name, err)
+	}
+
+	return WriteFileAtomic(filepath.Join(dir, name), data, 0o600)
+}
+
+// WriteFileAtomic writes data to a temporary file next to path and renames it
+// into place.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	return WriteFileAtomicFunc(path, perm, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// WriteFileAtomicFunc is WriteFileAtomic for content too large to hold in
+// memory: write streams it to the temporary file.
+func WriteFileAtomicFunc(path string, perm os.FileMode, write func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	buffered := bufio.NewWriter(tmp)
+	err = write(buffered)
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to chmod %s: %v", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %v", path, err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace %s: %v", path, err)
+	}
+
+	return nil
+}
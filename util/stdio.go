@@ -0,0 +1,273 @@
+package util
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// SubscriptionHandler receives resources/subscribe and resources/unsubscribe
+// requests, which the MCPServer does not route on its own.
+type SubscriptionHandler interface {
+	Subscribe(uri string) error
+	Unsubscribe(uri string) error
+}
+
+// StdioServer serves an MCPServer over stdio like server.ServeStdio, and also
+// handles resource subscriptions, runs tool calls concurrently with support
+// for cancellation and progress, and lets the rest of the program push
+// notifications to the client.
+type StdioServer struct {
+	server        *server.MCPServer
+	subscriptions SubscriptionHandler
+	errLogger     *log.Logger
+
+	mu       sync.Mutex
+	out      io.Writer
+	inFlight sync.WaitGroup
+}
+
+// NewStdioServer wraps the given MCPServer.
+func NewStdioServer(s *server.MCPServer) *StdioServer {
+	return &StdioServer{
+		server:    s,
+		errLogger: log.New(os.Stderr, "", log.LstdFlags),
+	}
+}
+
+// SetSubscriptionHandler registers the handler for resource subscriptions.
+func (s *StdioServer) SetSubscriptionHandler(handler SubscriptionHandler) {
+	s.subscriptions = handler
+}
+
+// SendNotification writes a JSON-RPC notification to the client. It is safe to
+// call from any goroutine; notifications sent before Listen starts are dropped.
+func (s *StdioServer) SendNotification(method string, params interface{}) error {
+	notification := struct {
+		JSONRPC string      `json:"jsonrpc"`
+		Method  string      `json:"method"`
+		Params  interface{} `json:"params,omitempty"`
+	}{
+		JSONRPC: mcp.JSONRPC_VERSION,
+		Method:  method,
+		Params:  params,
+	}
+
+	return s.write(notification)
+}
+
+// ServeStdio listens on os.Stdin and os.Stdout until SIGINT or SIGTERM.
+func (s *StdioServer) ServeStdio() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT)
+
+	go func() {
+		<-sigChan
+		cancel()
+	}()
+
+	return s.Listen(ctx, os.Stdin, os.Stdout)
+}
+
+// Listen reads JSON-RPC messages line by line from stdin and writes responses
+// to stdout until the context is cancelled or stdin is closed.
+func (s *StdioServer) Listen(ctx context.Context, stdin io.Reader, stdout io.Writer) error {
+	s.mu.Lock()
+	s.out = stdout
+	s.mu.Unlock()
+
+	reader := bufio.NewReader(stdin)
+	lines := make(chan string)
+	errs := make(chan error, 1)
+
+	go func() {
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				errs <- err
+				return
+			}
+			lines <- line
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errs:
+			if err == io.EOF {
+				s.inFlight.Wait()
+				return nil
+			}
+			s.errLogger.Printf("Error reading input: %v", err)
+			return err
+		case line := <-lines:
+			if err := s.processMessage(ctx, line); err != nil {
+				s.errLogger.Printf("Error handling message: %v", err)
+				return err
+			}
+		}
+	}
+}
+
+func (s *StdioServer) processMessage(ctx context.Context, line string) error {
+	var rawMessage json.RawMessage
+	if err := json.Unmarshal([]byte(line), &rawMessage); err != nil {
+		return s.write(newErrorResponse(nil, mcp.PARSE_ERROR, "Parse error"))
+	}
+
+	var baseMessage struct {
+		Method string      `json:"method"`
+		ID     interface{} `json:"id,omitempty"`
+	}
+	_ = json.Unmarshal(rawMessage, &baseMessage)
+
+	if baseMessage.ID == nil && baseMessage.Method == "notifications/cancelled" {
+		var notification mcp.CancelledNotification
+		if err := json.Unmarshal(rawMessage, &notification); err == nil {
+			cancelRequest(notification.Params.RequestId)
+		}
+	}
+
+	if baseMessage.ID != nil {
+		switch baseMessage.Method {
+		case "resources/subscribe", "resources/unsubscribe":
+			return s.write(s.handleSubscription(baseMessage.ID, baseMessage.Method, rawMessage))
+		case "tools/call":
+			// Tool calls run concurrently so that cancellations and other
+			// requests can be read while a long-running tool is busy.
+			message, release := s.trackToolCall(ctx, baseMessage.ID, rawMessage)
+			s.inFlight.Add(1)
+			go func() {
+				defer s.inFlight.Done()
+				defer release()
+				if response := s.server.HandleMessage(ctx, message); response != nil {
+					if err := s.write(response); err != nil {
+						s.errLogger.Printf("Error writing response: %v", err)
+					}
+				}
+			}()
+			return nil
+		}
+	}
+
+	response := s.server.HandleMessage(ctx, rawMessage)
+	if response == nil {
+		return nil
+	}
+
+	return s.write(response)
+}
+
+// trackToolCall registers the call as an in-flight request and injects the
+// hidden request argument so the handler can find it through
+// RequestFromArguments.
+func (s *StdioServer) trackToolCall(ctx context.Context, id interface{}, rawMessage json.RawMessage) (json.RawMessage, func()) {
+	var call map[string]interface{}
+	if err := json.Unmarshal(rawMessage, &call); err != nil {
+		return rawMessage, func() {}
+	}
+
+	params, _ := call["params"].(map[string]interface{})
+	if params == nil {
+		return rawMessage, func() {}
+	}
+
+	var progressToken mcp.ProgressToken
+	if meta, ok := params["_meta"].(map[string]interface{}); ok {
+		progressToken = meta["progressToken"]
+	}
+
+	arguments, _ := params["arguments"].(map[string]interface{})
+	if arguments == nil {
+		arguments = make(map[string]interface{})
+		params["arguments"] = arguments
+	}
+
+	key, release := beginRequest(ctx, id, progressToken, s.SendNotification)
+	arguments[requestArgument] = key
+
+	message, err := json.Marshal(call)
+	if err != nil {
+		release()
+		return rawMessage, func() {}
+	}
+
+	return message, release
+}
+
+func (s *StdioServer) handleSubscription(id interface{}, method string, rawMessage json.RawMessage) mcp.JSONRPCMessage {
+	if s.subscriptions == nil {
+		return newErrorResponse(id, mcp.METHOD_NOT_FOUND, "Resource subscriptions not supported")
+	}
+
+	var request mcp.SubscribeRequest
+	if err := json.Unmarshal(rawMessage, &request); err != nil || request.Params.URI == "" {
+		return newErrorResponse(id, mcp.INVALID_PARAMS, "Invalid subscription request")
+	}
+
+	var err error
+	if method == "resources/subscribe" {
+		err = s.subscriptions.Subscribe(request.Params.URI)
+	} else {
+		err = s.subscriptions.Unsubscribe(request.Params.URI)
+	}
+	if err != nil {
+		return newErrorResponse(id, mcp.INVALID_PARAMS, err.Error())
+	}
+
+	return mcp.JSONRPCResponse{
+		JSONRPC: mcp.JSONRPC_VERSION,
+		ID:      id,
+		Result:  mcp.EmptyResult{},
+	}
+}
+
+func (s *StdioServer) write(message interface{}) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.out == nil {
+		return nil
+	}
+
+	if _, err := fmt.Fprintf(s.out, "%s\n", data); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+
+	return nil
+}
+
+func newErrorResponse(id interface{}, code int, message string) mcp.JSONRPCMessage {
+	return mcp.JSONRPCError{
+		JSONRPC: mcp.JSONRPC_VERSION,
+		ID:      id,
+		Error: struct {
+			Code    int         `json:"code"`
+			Message string      `json:"message"`
+			Data    interface{} `json:"data,omitempty"`
+		}{
+			Code:    code,
+			Message: message,
+		},
+	}
+}